@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -22,6 +23,8 @@ import (
 func main() {
 	// Parse command line flags
 	var testConnectivity = flag.String("test-connectivity", "", "Test connectivity for a specific provider (e.g., 'openai') or 'all' for all providers")
+	var migrate = flag.String("migrate", "", "Run database migrations and exit: 'up', 'down' or 'status'")
+	var migrateSteps = flag.Int("migrate-steps", 1, "Number of migrations to revert with -migrate down")
 	flag.Parse()
 
 	// Load configuration
@@ -42,6 +45,14 @@ func main() {
 		return
 	}
 
+	// Handle migration mode
+	if *migrate != "" {
+		if err := runMigrations(cfg, *migrate, *migrateSteps); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
 	// Validate required configuration
 	if cfg.BotToken == "" {
 		if logging.IsInitialized() {
@@ -91,6 +102,64 @@ func runBot(cfg *config.Config) error {
 	return discordBot.Stop()
 }
 
+// runMigrations applies, reverts or lists schema migrations without starting the Discord session
+func runMigrations(cfg *config.Config, action string, steps int) error {
+	defer func() {
+		if err := storage.CloseDatabase(); err != nil {
+			log.Printf("Failed to close database: %v", err)
+		}
+	}()
+
+	migrator, err := storage.NewMigrator(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch action {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+	case "down":
+		if steps < 1 {
+			return fmt.Errorf("-migrate-steps must be at least 1")
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations to revert")
+		}
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied() {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-24s %s\n", status.Version, status.Name, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate action %q (use up, down or status)", action)
+	}
+	return nil
+}
+
 // runConnectivityTest tests connectivity for specified provider(s)
 func runConnectivityTest(cfg *config.Config, provider string) {
 	discordBot, err := bot.NewBot(cfg)
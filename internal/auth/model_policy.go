@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// ModelRequester is who asks to use a model and where
+type ModelRequester struct {
+	UserID  string
+	RoleIDs []string
+	GuildID string // Empty in DMs
+}
+
+// ModelDecision is the outcome of a model access check
+type ModelDecision struct {
+	Allowed bool
+	Reason  string // Why the model was denied, for the user
+}
+
+// ModelPolicy decides which configured models a user may use. A model must be configured,
+// allowed in the channel (allowed_models) and permitted by its access rules.
+type ModelPolicy struct {
+	config *config.Config
+}
+
+// NewModelPolicy creates a model policy for a config, usually the one in effect in a channel
+func NewModelPolicy(cfg *config.Config) *ModelPolicy {
+	return &ModelPolicy{config: cfg}
+}
+
+// Check decides whether a requester may use a model
+func (p *ModelPolicy) Check(model string, req ModelRequester) ModelDecision {
+	params, exists := p.config.Models[model]
+	if !exists {
+		return ModelDecision{Reason: fmt.Sprintf("`%s` is not a configured model", model)}
+	}
+	if !p.config.IsModelAllowed(model) {
+		return ModelDecision{Reason: fmt.Sprintf("`%s` is not enabled here", model)}
+	}
+	if params.Access == nil || containsString(p.config.Permissions.Users.AdminIDs, req.UserID) {
+		return ModelDecision{Allowed: true}
+	}
+
+	access := params.Access
+	if len(access.GuildIDs) > 0 && !containsString(access.GuildIDs, req.GuildID) {
+		return ModelDecision{Reason: fmt.Sprintf("`%s` is only available in some servers", model)}
+	}
+	if len(access.UserIDs) > 0 || len(access.RoleIDs) > 0 {
+		permitted := containsString(access.UserIDs, req.UserID)
+		for _, roleID := range req.RoleIDs {
+			permitted = permitted || containsString(access.RoleIDs, roleID)
+		}
+		if !permitted {
+			return ModelDecision{Reason: fmt.Sprintf("`%s` is limited to specific users and roles", model)}
+		}
+	}
+	return ModelDecision{Allowed: true}
+}
+
+// Permitted returns the models a requester may use, cheapest tier first, then by name
+func (p *ModelPolicy) Permitted(req ModelRequester) []string {
+	var models []string
+	for model := range p.config.Models {
+		if p.Check(model, req).Allowed {
+			models = append(models, model)
+		}
+	}
+	sort.Slice(models, func(i, j int) bool {
+		ti, tj := p.CostTier(models[i]), p.CostTier(models[j])
+		if ti != tj {
+			return ti < tj
+		}
+		return models[i] < models[j]
+	})
+	return models
+}
+
+// Alternatives returns up to limit permitted models to suggest instead of a denied one:
+// the same cost tier first, then cheaper tiers from the closest down, then pricier ones
+func (p *ModelPolicy) Alternatives(model string, req ModelRequester, limit int) []string {
+	tier := p.CostTier(model)
+	rank := func(candidate string) int {
+		switch t := p.CostTier(candidate); {
+		case t == tier:
+			return 0
+		case t < tier:
+			return tier - t
+		default:
+			// Pricier models come after every cheaper one
+			return tier + t
+		}
+	}
+
+	var alternatives []string
+	for _, candidate := range p.Permitted(req) {
+		if candidate != model {
+			alternatives = append(alternatives, candidate)
+		}
+	}
+	sort.SliceStable(alternatives, func(i, j int) bool {
+		return rank(alternatives[i]) < rank(alternatives[j])
+	})
+	if limit > 0 && len(alternatives) > limit {
+		alternatives = alternatives[:limit]
+	}
+	return alternatives
+}
+
+// CostTier returns the cost tier of a model, 0 when unset
+func (p *ModelPolicy) CostTier(model string) int {
+	return p.config.Models[model].CostTier
+}
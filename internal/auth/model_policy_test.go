@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// newTestPolicy creates a policy over models with cost tiers and access rules
+func newTestPolicy() *ModelPolicy {
+	cfg := &config.Config{Models: map[string]config.ModelParams{
+		"openai/gpt-5-nano": {},
+		"openai/gpt-5-mini": {CostTier: 1},
+		"gemini/flash":      {CostTier: 1},
+		"openai/gpt-5": {CostTier: 2, Access: &config.ModelAccess{
+			UserIDs: []string{"vip"},
+			RoleIDs: []string{"patron"},
+		}},
+		"anthropic/opus": {CostTier: 3},
+		"gemini/pro":     {CostTier: 2, Access: &config.ModelAccess{GuildIDs: []string{"home"}}},
+		"openai/o3": {CostTier: 2, Access: &config.ModelAccess{
+			UserIDs:  []string{"vip"},
+			GuildIDs: []string{"home"},
+		}},
+	}}
+	cfg.Permissions.Users.AdminIDs = []string{"admin"}
+	return NewModelPolicy(cfg)
+}
+
+func TestModelPolicyCheck(t *testing.T) {
+	policy := newTestPolicy()
+	tests := []struct {
+		name    string
+		model   string
+		req     ModelRequester
+		allowed bool
+		reason  string
+	}{
+		{"unrestricted", "openai/gpt-5-mini", ModelRequester{UserID: "anyone"}, true, ""},
+		{"unknown model", "openai/gpt-6", ModelRequester{UserID: "admin"}, false, "not a configured model"},
+		{"listed user", "openai/gpt-5", ModelRequester{UserID: "vip"}, true, ""},
+		{"listed role", "openai/gpt-5", ModelRequester{UserID: "anyone", RoleIDs: []string{"member", "patron"}}, true, ""},
+		{"unlisted user", "openai/gpt-5", ModelRequester{UserID: "anyone", RoleIDs: []string{"member"}}, false, "specific users and roles"},
+		{"admin", "openai/gpt-5", ModelRequester{UserID: "admin"}, true, ""},
+		{"listed guild", "gemini/pro", ModelRequester{UserID: "anyone", GuildID: "home"}, true, ""},
+		{"other guild", "gemini/pro", ModelRequester{UserID: "anyone", GuildID: "elsewhere"}, false, "some servers"},
+		{"guild-limited in DMs", "gemini/pro", ModelRequester{UserID: "anyone"}, false, "some servers"},
+		{"listed user in listed guild", "openai/o3", ModelRequester{UserID: "vip", GuildID: "home"}, true, ""},
+		{"listed user in other guild", "openai/o3", ModelRequester{UserID: "vip", GuildID: "elsewhere"}, false, "some servers"},
+		{"admin in other guild", "openai/o3", ModelRequester{UserID: "admin", GuildID: "elsewhere"}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := policy.Check(tt.model, tt.req)
+			if decision.Allowed != tt.allowed {
+				t.Errorf("Check(%s) allowed = %v, want %v (%s)", tt.model, decision.Allowed, tt.allowed, decision.Reason)
+			}
+			if !strings.Contains(decision.Reason, tt.reason) {
+				t.Errorf("Check(%s) reason = %q, want it to mention %q", tt.model, decision.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestModelPolicyRespectsAllowedModels(t *testing.T) {
+	policy := newTestPolicy()
+	policy.config.AllowedModels = []string{"openai/gpt-5-mini", "openai/gpt-5"}
+
+	if decision := policy.Check("gemini/flash", ModelRequester{UserID: "admin"}); decision.Allowed {
+		t.Error("a model left out of allowed_models is allowed")
+	}
+	want := []string{"openai/gpt-5-mini", "openai/gpt-5"}
+	if got := policy.Permitted(ModelRequester{UserID: "admin"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Permitted = %v, want %v", got, want)
+	}
+}
+
+func TestModelPolicyPermitted(t *testing.T) {
+	policy := newTestPolicy()
+	tests := []struct {
+		name string
+		req  ModelRequester
+		want []string
+	}{
+		{
+			"anyone in a DM",
+			ModelRequester{UserID: "anyone"},
+			[]string{"openai/gpt-5-nano", "gemini/flash", "openai/gpt-5-mini", "anthropic/opus"},
+		},
+		{
+			"vip at home",
+			ModelRequester{UserID: "vip", GuildID: "home"},
+			[]string{"openai/gpt-5-nano", "gemini/flash", "openai/gpt-5-mini", "gemini/pro", "openai/gpt-5", "openai/o3", "anthropic/opus"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Permitted(tt.req); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Permitted = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelPolicyAlternatives(t *testing.T) {
+	policy := newTestPolicy()
+	anyone := ModelRequester{UserID: "anyone", GuildID: "home"}
+	tests := []struct {
+		name  string
+		model string
+		limit int
+		want  []string
+	}{
+		// Same tier first, then cheaper tiers from the closest down, then pricier ones
+		{"tier 2", "openai/gpt-5", 0, []string{"gemini/pro", "gemini/flash", "openai/gpt-5-mini", "openai/gpt-5-nano", "anthropic/opus"}},
+		{"limited", "openai/gpt-5", 3, []string{"gemini/pro", "gemini/flash", "openai/gpt-5-mini"}},
+		{"cheapest tier", "openai/gpt-5-nano", 0, []string{"gemini/flash", "openai/gpt-5-mini", "gemini/pro", "anthropic/opus"}},
+		{"priciest tier", "anthropic/opus", 2, []string{"gemini/pro", "gemini/flash"}},
+		{"unknown model ranks as tier 0", "openai/gpt-6", 1, []string{"openai/gpt-5-nano"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Alternatives(tt.model, anyone, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Alternatives(%s) = %v, want %v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// rateLimiterMaxBuckets is the bucket count above which refilled buckets are evicted
+const rateLimiterMaxBuckets = 10000
+
+// tokenBucket holds the remaining tokens of a single user or channel
+type tokenBucket struct {
+	tokens   float64
+	lastFill time.Time
+	warned   bool // Whether the owner was already told about the current limit
+}
+
+// refill adds the tokens earned since the last refill, capped at the burst size
+func (t *tokenBucket) refill(bucket config.RateLimitBucket, now time.Time) {
+	elapsed := now.Sub(t.lastFill).Minutes()
+	t.tokens = math.Min(float64(bucket.Burst), t.tokens+elapsed*bucket.PerMinute)
+	t.lastFill = now
+}
+
+// wait returns how long until the bucket has a whole token
+func (t *tokenBucket) wait(bucket config.RateLimitBucket) time.Duration {
+	if t.tokens >= 1 || bucket.PerMinute <= 0 {
+		return 0
+	}
+	return time.Duration((1 - t.tokens) / bucket.PerMinute * float64(time.Minute))
+}
+
+// RateLimitResult describes the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed bool
+	// RetryAfter is how long until the message would be allowed
+	RetryAfter time.Duration
+	// Notify is true for the first rejection since the last allowed message,
+	// so callers can warn once instead of replying to every message
+	Notify bool
+}
+
+// RateLimiter enforces per-user and per-channel token buckets
+type RateLimiter struct {
+	mu       sync.Mutex
+	users    map[string]*tokenBucket
+	channels map[string]*tokenBucket
+}
+
+// NewRateLimiter creates a new rate limiter
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		users:    make(map[string]*tokenBucket),
+		channels: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow takes a token from both the user's and the channel's bucket if both have one.
+// Settings are read from cfg on every call so config reloads apply immediately.
+func (r *RateLimiter) Allow(cfg *config.Config, userID, channelID string) RateLimitResult {
+	if cfg == nil || !cfg.RateLimit.Enabled || containsString(cfg.Permissions.Users.AdminIDs, userID) {
+		return RateLimitResult{Allowed: true}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	user := r.bucket(r.users, userID, cfg.RateLimit.User, now)
+	channel := r.bucket(r.channels, channelID, cfg.RateLimit.Channel, now)
+
+	retryAfter := max(user.wait(cfg.RateLimit.User), channel.wait(cfg.RateLimit.Channel))
+	if user.tokens < 1 || channel.tokens < 1 {
+		result := RateLimitResult{RetryAfter: retryAfter, Notify: !user.warned}
+		user.warned = true
+		return result
+	}
+
+	user.tokens--
+	channel.tokens--
+	user.warned = false
+	return RateLimitResult{Allowed: true}
+}
+
+// bucket returns the refilled bucket for a key, creating a full one if needed
+func (r *RateLimiter) bucket(buckets map[string]*tokenBucket, key string, settings config.RateLimitBucket, now time.Time) *tokenBucket {
+	b, ok := buckets[key]
+	if !ok {
+		if len(buckets) >= rateLimiterMaxBuckets {
+			evictFullBuckets(buckets, settings, now)
+		}
+		b = &tokenBucket{tokens: float64(settings.Burst), lastFill: now}
+		buckets[key] = b
+		return b
+	}
+	b.refill(settings, now)
+	return b
+}
+
+// evictFullBuckets removes buckets that have refilled completely, since they behave like new ones
+func evictFullBuckets(buckets map[string]*tokenBucket, settings config.RateLimitBucket, now time.Time) {
+	for key, b := range buckets {
+		b.refill(settings, now)
+		if b.tokens >= float64(settings.Burst) {
+			delete(buckets, key)
+		}
+	}
+}
+
+// containsString reports whether a slice contains the given string
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
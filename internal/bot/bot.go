@@ -16,22 +16,18 @@ import (
 
 	"DiscordAIChatbot/internal/auth"
 	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/export"
+	"DiscordAIChatbot/internal/interfaces"
 	"DiscordAIChatbot/internal/llm"
 	"DiscordAIChatbot/internal/llm/providers"
 	"DiscordAIChatbot/internal/messaging"
 	"DiscordAIChatbot/internal/net"
 	"DiscordAIChatbot/internal/processors"
 	"DiscordAIChatbot/internal/storage"
+	"DiscordAIChatbot/internal/uploader"
 	"DiscordAIChatbot/internal/utils"
 )
 
-var ()
-
-const (
-	gpt5ModelName        = "openai/gpt-5"
-	gpt5AuthorizedUserID = "676735636656357396"
-)
-
 // Bot represents the Discord bot instance that handles all Discord interactions,
 // manages conversations, processes messages, and integrates with LLM providers.
 // It maintains the bot's configuration, session state, and various service clients.
@@ -40,11 +36,15 @@ type Bot struct {
 	config           atomic.Pointer[config.Config]
 	nodeManager      *messaging.MsgNodeManager
 	permChecker      *auth.PermissionChecker
+	rateLimiter      *auth.RateLimiter
 	llmClient        *llm.LLMClient
 	webSearchClient  *processors.WebSearchClient
 	googleLensClient *processors.GoogleLensClient
 	geminiProvider   *providers.GeminiProvider
 	userPrefs        *storage.UserPreferencesManager
+	usageLedger      *storage.UsageLedger
+	personas         *storage.PersonaStore
+	configOverrides  *storage.ConfigOverrideStore
 	apiKeyManager    *storage.APIKeyManager
 	tableRenderer    *utils.TableRenderer
 	fileProcessor    *processors.FileProcessor
@@ -54,12 +54,17 @@ type Bot struct {
 	lastTaskTime     time.Time
 	mu               sync.RWMutex
 	healthServer     *http.Server
+	exportServer     *export.Server
+	textUploader     interfaces.Uploader
+	fileUploader     interfaces.Uploader
 	shutdownCtx      context.Context
 	shutdownCancel   context.CancelFunc
 	activeGoroutines sync.WaitGroup
 	messageCache     *storage.MessageNodeCache
+	summaryCache     *storage.SummaryCache
 	paginationCache  *PaginationCache
-	messageJobs      chan *discordgo.MessageCreate // Add this
+	scheduler        *FairScheduler
+	generations      *GenerationTracker
 }
 
 // NewBot creates a new Discord bot instance
@@ -86,24 +91,40 @@ func NewBot(cfg *config.Config) (*Bot, error) {
 		session:          session,
 		nodeManager:      messaging.NewMsgNodeManager(config.MaxMessageNodes),
 		permChecker:      auth.NewPermissionChecker(cfg),
+		rateLimiter:      auth.NewRateLimiter(),
 		llmClient:        llm.NewLLMClient(cfg, apiKeyManager, httpClient),
 		webSearchClient:  processors.NewWebSearchClient(cfg, webSearchHTTPClient),
 		googleLensClient: processors.NewGoogleLensClient(cfg, apiKeyManager, httpClient),
 		geminiProvider:   providers.NewGeminiProvider(cfg, apiKeyManager),
 		userPrefs:        storage.NewUserPreferencesManager(cfg.DatabaseURL),
+		usageLedger:      storage.NewUsageLedger(cfg.DatabaseURL),
+		personas:         storage.NewPersonaStore(cfg.DatabaseURL),
+		configOverrides:  storage.NewConfigOverrideStore(cfg.DatabaseURL),
 		apiKeyManager:    apiKeyManager,
 		tableRenderer:    createTableRenderer(cfg),
 		fileProcessor:    processors.NewFileProcessor(),
 		chartProcessor:   processors.NewChartProcessor(cfg.DatabaseURL),
 		channelProcessor: processors.NewChannelProcessor(),
-		messageCache:     storage.NewMessageNodeCache(cfg.DatabaseURL),
 		shutdownCtx:      shutdownCtx,
 		shutdownCancel:   shutdownCancel,
 		httpClient:       httpClient,
 		paginationCache:  NewPaginationCache(),
-		messageJobs:      make(chan *discordgo.MessageCreate, 100), // Buffered channel
+		generations:      NewGenerationTracker(),
 	}
 	bot.config.Store(cfg)
+	bot.scheduler = NewFairScheduler(func() (int, int) {
+		queueCfg := bot.config.Load().Queue
+		return queueCfg.MaxSize, queueCfg.MaxPerUser
+	})
+	messageCacheTTL := func() time.Duration {
+		ttlDays := bot.config.Load().MessageCache.TTLDays
+		if ttlDays <= 0 {
+			return 0
+		}
+		return time.Duration(ttlDays) * 24 * time.Hour
+	}
+	bot.messageCache = storage.NewMessageNodeCache(cfg.DatabaseURL, messageCacheTTL)
+	bot.summaryCache = storage.NewSummaryCache(cfg.DatabaseURL, messageCacheTTL)
 
 	// Configure Discord session
 	session.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentsMessageContent
@@ -111,128 +132,107 @@ func NewBot(cfg *config.Config) (*Bot, error) {
 	// Register event handlers
 	session.AddHandler(bot.onReady)
 	session.AddHandler(bot.onMessageCreate)
+	session.AddHandler(bot.onMessageUpdate)
 	session.AddHandler(bot.onInteractionCreate)
 
-	// Setup health check server
+	// Setup uploaders, then the health check server that also serves exports
+	bot.setupUploaders(cfg)
 	bot.setupHealthServer()
 
 	return bot, nil
 }
 
-// resolveUserModel returns a safe model name for the user, falling back to the configured default when needed.
-func (b *Bot) resolveUserModel(ctx context.Context, userID string, cfg *config.Config) string {
+// modelRequester returns who sent a message and where, for model access checks
+func modelRequester(m *discordgo.Message) auth.ModelRequester {
+	req := auth.ModelRequester{GuildID: m.GuildID}
+	if m.Author != nil {
+		req.UserID = m.Author.ID
+	}
+	if m.Member != nil {
+		req.RoleIDs = m.Member.Roles
+	}
+	return req
+}
+
+// interactionRequester returns who used an interaction and where, for model access checks
+func interactionRequester(i *discordgo.InteractionCreate) auth.ModelRequester {
+	req := auth.ModelRequester{UserID: interactionUserID(i), GuildID: i.GuildID}
+	if i.Member != nil {
+		req.RoleIDs = i.Member.Roles
+	}
+	return req
+}
+
+// resolveUserModel returns a model the user may use, preferring their /model choice and then the
+// configured default. Preferences denied here are kept, since they may be allowed elsewhere.
+func (b *Bot) resolveUserModel(ctx context.Context, req auth.ModelRequester, cfg *config.Config) string {
 	if cfg == nil {
 		return ""
 	}
+	policy := auth.NewModelPolicy(cfg)
 
 	defaultModel := cfg.GetDefaultModel()
-	sanitizedDefault, defaultRestricted, _ := b.sanitizeModelForUser(userID, defaultModel, cfg)
-	if defaultRestricted {
-		if sanitizedDefault == "" {
-			log.Printf("No permitted default model available for user %s", userID)
+	if decision := policy.Check(defaultModel, req); !decision.Allowed {
+		defaultModel = b.pickAlternativeModel(cfg, req, defaultModel)
+		if defaultModel == "" {
+			log.Printf("No permitted default model available for user %s", req.UserID)
 		}
-		defaultModel = sanitizedDefault
 	}
-	if userID == "" || b.userPrefs == nil {
+	if req.UserID == "" || b.userPrefs == nil {
 		return defaultModel
 	}
 
-	preferredModel := b.userPrefs.GetUserModel(ctx, userID, defaultModel)
-	if preferredModel == "" {
+	preferredModel := b.userPrefs.GetUserModel(ctx, req.UserID, defaultModel)
+	if preferredModel == "" || preferredModel == defaultModel {
 		return defaultModel
 	}
 
-	if cfg.Models != nil {
-		if _, exists := cfg.Models[preferredModel]; exists {
-			sanitizedPreferred, restricted, replaced := b.sanitizeModelForUser(userID, preferredModel, cfg)
-			if restricted {
-				if sanitizedPreferred == "" {
-					log.Printf("User %s requested restricted model %s but no alternative is configured", userID, preferredModel)
-					return defaultModel
-				}
-				if replaced && sanitizedPreferred != preferredModel {
-					if err := b.userPrefs.SetUserModel(ctx, userID, sanitizedPreferred); err != nil {
-						log.Printf("Failed to update restricted model preference for user %s: %v", userID, err)
-					}
-				}
-				return sanitizedPreferred
-			}
-			return sanitizedPreferred
-		}
-	}
-
-	if preferredModel != defaultModel {
-		log.Printf("Preferred model %s for user %s not found in config. Using default model %s", preferredModel, userID, defaultModel)
-	}
-
-	if defaultModel != "" {
+	if decision := policy.Check(preferredModel, req); !decision.Allowed {
+		log.Printf("Preferred model %s for user %s is denied (%s). Using %s", preferredModel, req.UserID, decision.Reason, defaultModel)
 		return defaultModel
 	}
-
 	return preferredModel
 }
 
-func (b *Bot) sanitizeModelForUser(userID, requestedModel string, cfg *config.Config) (string, bool, bool) {
-	if cfg == nil {
-		return requestedModel, false, false
-	}
-
-	model := strings.TrimSpace(requestedModel)
-	if model == "" {
-		return model, false, false
-	}
-
-	// Normalize shorthand model names for comparison while preserving configured casing when allowed.
-	if strings.EqualFold(model, "gpt-5") {
-		model = gpt5ModelName
-	}
-
-	if strings.EqualFold(model, gpt5ModelName) && userID != gpt5AuthorizedUserID {
-		alternative := b.pickAlternativeModel(cfg, gpt5ModelName)
-		replaced := !strings.EqualFold(alternative, model)
-		return alternative, true, replaced
-	}
-
-	return model, false, false
-}
-
-func (b *Bot) pickAlternativeModel(cfg *config.Config, disallowed ...string) string {
+// pickAlternativeModel returns a model the requester may use instead of a denied one:
+// the fallback model, then the default, then the closest permitted model by cost tier
+func (b *Bot) pickAlternativeModel(cfg *config.Config, req auth.ModelRequester, denied string) string {
 	if cfg == nil {
 		return ""
 	}
+	policy := auth.NewModelPolicy(cfg)
 
-	candidates := []string{cfg.FallbackModel, cfg.GetDefaultModel()}
-	for model := range cfg.Models {
-		candidates = append(candidates, model)
-	}
-
-	for _, candidate := range candidates {
-		if b.isModelAllowed(cfg, candidate, disallowed) {
+	for _, candidate := range []string{cfg.FallbackModel, cfg.GetDefaultModel()} {
+		if candidate != "" && candidate != denied && policy.Check(candidate, req).Allowed {
 			return candidate
 		}
 	}
-
+	if alternatives := policy.Alternatives(denied, req, 1); len(alternatives) > 0 {
+		return alternatives[0]
+	}
 	return ""
 }
 
-func (b *Bot) isModelAllowed(cfg *config.Config, candidate string, disallowed []string) bool {
-	if candidate == "" {
-		return false
-	}
-
-	if cfg.Models != nil {
-		if _, exists := cfg.Models[candidate]; !exists {
-			return false
-		}
-	}
+// fallbackModelFor returns the model to fall back to when a response to a message fails,
+// picked like any alternative so the message's author may use it here
+func (b *Bot) fallbackModelFor(m *discordgo.Message, model string) string {
+	return b.pickAlternativeModel(b.configFor(m.GuildID, m.ChannelID), modelRequester(m), model)
+}
 
-	for _, blocked := range disallowed {
-		if strings.EqualFold(candidate, blocked) {
-			return false
-		}
+// deniedModelMessage explains why a model was denied and suggests permitted alternatives
+func deniedModelMessage(cfg *config.Config, req auth.ModelRequester, model string, decision auth.ModelDecision) string {
+	message := "❌ " + decision.Reason + "."
+	alternatives := auth.NewModelPolicy(cfg).Alternatives(model, req, config.MaxModelSuggestions)
+	if len(alternatives) > 0 {
+		message += " Try `" + strings.Join(alternatives, "`, `") + "` instead."
 	}
+	return message
+}
 
-	return true
+// extractDocumentText extracts the text of a PDF for models that can't read PDFs natively
+func (b *Bot) extractDocumentText(data []byte, contentType, filename string) (string, error) {
+	text, _, err := b.fileProcessor.ProcessFile(data, contentType, filename)
+	return text, err
 }
 
 // Start starts the Discord bot
@@ -246,13 +246,12 @@ func (b *Bot) Start() error {
 			defer b.activeGoroutines.Done()
 			log.Printf("Starting message worker %d", workerID)
 			for {
-				select {
-				case job := <-b.messageJobs:
-					b.handleMessage(b.session, job)
-				case <-b.shutdownCtx.Done():
+				job, ok := b.scheduler.Next(b.shutdownCtx)
+				if !ok {
 					log.Printf("Stopping message worker %d", workerID)
 					return
 				}
+				b.handleMessage(b.session, job.msg, job.variant)
 			}
 		}(i)
 	}
@@ -379,6 +378,12 @@ func (b *Bot) Stop() error {
 			log.Printf("Failed to close health server: %v", err)
 		}
 	}
+	// Stop deleting expired exports
+	if b.exportServer != nil {
+		if err := b.exportServer.Close(); err != nil {
+			log.Printf("Failed to close export server: %v", err)
+		}
+	}
 
 	// Close table renderer
 	if b.tableRenderer != nil {
@@ -398,12 +403,36 @@ func (b *Bot) Stop() error {
 			log.Printf("Failed to close user preferences: %v", err)
 		}
 	}
+	// Close usage ledger
+	if b.usageLedger != nil {
+		if err := b.usageLedger.Close(); err != nil {
+			log.Printf("Failed to close usage ledger: %v", err)
+		}
+	}
+	// Close persona store
+	if b.personas != nil {
+		if err := b.personas.Close(); err != nil {
+			log.Printf("Failed to close persona store: %v", err)
+		}
+	}
+	// Close config override store
+	if b.configOverrides != nil {
+		if err := b.configOverrides.Close(); err != nil {
+			log.Printf("Failed to close config override store: %v", err)
+		}
+	}
 	// Close message cache
 	if b.messageCache != nil {
 		if err := b.messageCache.Close(); err != nil {
 			log.Printf("Failed to close message cache: %v", err)
 		}
 	}
+	// Close summary cache
+	if b.summaryCache != nil {
+		if err := b.summaryCache.Close(); err != nil {
+			log.Printf("Failed to close summary cache: %v", err)
+		}
+	}
 	// Close API key manager database
 	if b.apiKeyManager != nil {
 		if err := b.apiKeyManager.Close(); err != nil {
@@ -434,6 +463,11 @@ func (b *Bot) setupHealthServer() {
 	mux.HandleFunc("/health", b.healthCheckHandler)
 	mux.HandleFunc("/", b.healthCheckHandler)
 
+	// Export pages and uploads
+	if b.exportServer != nil {
+		b.exportServer.Register(mux)
+	}
+
 	// Get port from environment variable, default to 8080
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -446,6 +480,38 @@ func (b *Bot) setupHealthServer() {
 	}
 }
 
+// setupUploaders starts the export server when enabled and picks the configured uploaders
+func (b *Bot) setupUploaders(cfg *config.Config) {
+	if cfg.Export.Enabled {
+		server, err := export.NewServer(cfg)
+		if err != nil {
+			log.Printf("⚠️ Export server disabled: %v", err)
+		} else {
+			b.exportServer = server
+		}
+	}
+
+	b.textUploader = b.selectUploader(cfg.Export.TextUploader, uploader.NewTextIsUploader())
+	b.fileUploader = b.selectUploader(cfg.Export.FileUploader, uploader.NewCatboxUploader())
+}
+
+// selectUploader returns the uploader with the given name, or fallback when it's unavailable
+func (b *Bot) selectUploader(name string, fallback interfaces.Uploader) interfaces.Uploader {
+	switch name {
+	case config.UploaderLocal:
+		if b.exportServer != nil {
+			return b.exportServer
+		}
+	case config.UploaderTextIs:
+		return uploader.NewTextIsUploader()
+	case config.UploaderCatbox:
+		return uploader.NewCatboxUploader()
+	}
+
+	log.Printf("⚠️ Uploader %q is unavailable, using %s", name, fallback.Name())
+	return fallback
+}
+
 // healthCheckHandler handles health check requests
 func (b *Bot) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
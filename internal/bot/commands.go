@@ -9,11 +9,12 @@ import (
 	"strings"
 	"time"
 
+	"DiscordAIChatbot/internal/auth"
+	"DiscordAIChatbot/internal/config"
 	"DiscordAIChatbot/internal/llm/providers"
 
 	"DiscordAIChatbot/internal/messaging"
 	"DiscordAIChatbot/internal/storage"
-	"DiscordAIChatbot/internal/uploader"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -37,6 +38,18 @@ func (b *Bot) handleSlashCommand(s *discordgo.Session, i *discordgo.InteractionC
 		b.handleGenerateImageCommand(s, i)
 	case "testmodels":
 		b.handleTestModelsCommand(s, i)
+	case "usage":
+		b.handleUsageCommand(s, i)
+	case "export":
+		b.handleExportCommand(s, i)
+	case exportMessageCommandName:
+		b.handleExportMessageCommand(s, i)
+	case "import":
+		b.handleImportCommand(s, i)
+	case "persona":
+		b.handlePersonaCommand(s, i)
+	case "serverconfig":
+		b.handleServerConfigCommand(s, i)
 	}
 }
 
@@ -52,8 +65,8 @@ func (b *Bot) handleModelCommand(s *discordgo.Session, i *discordgo.InteractionC
 		userID = i.Member.User.ID
 	}
 
-	// Atomically load config
-	config := b.config.Load()
+	// Load the config in effect in this channel
+	config := b.configFor(i.GuildID, i.ChannelID)
 
 	// Check if config is nil (safety check)
 	if config == nil {
@@ -71,28 +84,23 @@ func (b *Bot) handleModelCommand(s *discordgo.Session, i *discordgo.InteractionC
 
 	ctx := context.Background()
 
-	// Capture stored preference before potential sanitization
+	// Capture stored preference, which may be denied here
 	var rawPreference string
 	if userID != "" && b.userPrefs != nil {
 		rawPreference = b.userPrefs.GetUserModel(ctx, userID, "")
 	}
 
 	// Get user's current model with safe fallback
-	currentModel := b.resolveUserModel(ctx, userID, config)
-
-	// Detect automatic switching due to GPT-5 restriction
-	autoSwitchWarning := false
-	if rawPreference != "" {
-		_, restrictedPreference, replacedPreference := b.sanitizeModelForUser(userID, rawPreference, config)
-		if restrictedPreference && replacedPreference {
-			autoSwitchWarning = true
-		}
-	}
+	req := interactionRequester(i)
+	policy := auth.NewModelPolicy(config)
+	currentModel := b.resolveUserModel(ctx, req, config)
 
 	if len(data.Options) == 0 {
 		responseLines := []string{fmt.Sprintf("Current model: `%s`", currentModel)}
-		if autoSwitchWarning {
-			responseLines = append(responseLines, "model automatically switched because only sweet potet has access to gpt 5 😛")
+		if rawPreference != "" && rawPreference != currentModel {
+			if decision := policy.Check(rawPreference, req); !decision.Allowed {
+				responseLines = append(responseLines, fmt.Sprintf("⚠️ Your model `%s` can't be used here: %s.", rawPreference, decision.Reason))
+			}
 		}
 		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -106,29 +114,26 @@ func (b *Bot) handleModelCommand(s *discordgo.Session, i *discordgo.InteractionC
 		return
 	}
 
-	requestedModel := data.Options[0].StringValue()
-	sanitizedModel, restricted, _ := b.sanitizeModelForUser(userID, requestedModel, config)
+	requestedModel := strings.TrimSpace(data.Options[0].StringValue())
 
 	var response string
 
-	if restricted {
-		response = "only sweet potet has access to gpt 5 😛"
-	} else if sanitizedModel == "" {
-		response = fmt.Sprintf("❌ Model `%s` is not available.", requestedModel)
-	} else if sanitizedModel == currentModel {
-		response = fmt.Sprintf("Current model: `%s`", sanitizedModel)
+	if decision := policy.Check(requestedModel, req); !decision.Allowed {
+		response = deniedModelMessage(config, req, requestedModel, decision)
+	} else if requestedModel == currentModel {
+		response = fmt.Sprintf("Current model: `%s`", requestedModel)
 	} else {
 		// Save user's model preference
 		if userID == "" || b.userPrefs == nil {
 			response = "❌ Unable to save model preference (user ID not available)"
 		} else {
-			err := b.userPrefs.SetUserModel(ctx, userID, sanitizedModel)
+			err := b.userPrefs.SetUserModel(ctx, userID, requestedModel)
 			if err != nil {
 				log.Printf("Failed to save user model preference: %v", err)
 				response = "❌ Failed to save model preference"
 			} else {
-				response = fmt.Sprintf("Model switched to: `%s`", sanitizedModel)
-				log.Printf("User %s switched model to: %s", userID, sanitizedModel)
+				response = fmt.Sprintf("Model switched to: `%s`", requestedModel)
+				log.Printf("User %s switched model to: %s", userID, requestedModel)
 			}
 		}
 	}
@@ -196,8 +201,8 @@ func (b *Bot) handleSystemPromptCommand(s *discordgo.Session, i *discordgo.Inter
 		}
 
 		newPrompt := data.Options[1].StringValue()
-		if len(newPrompt) > 8000 {
-			response = "❌ System prompt is too long (max 8000 characters)"
+		if len(newPrompt) > config.MaxSystemPromptLength {
+			response = fmt.Sprintf("❌ System prompt is too long (max %d characters)", config.MaxSystemPromptLength)
 			break
 		}
 
@@ -387,6 +392,10 @@ func (b *Bot) handleAutocomplete(s *discordgo.Session, i *discordgo.InteractionC
 	switch data.Name {
 	case "model":
 		b.handleModelAutocomplete(s, i)
+	case "persona":
+		b.handlePersonaAutocomplete(s, i)
+	case "serverconfig":
+		b.handleServerConfigAutocomplete(s, i)
 	}
 }
 
@@ -400,8 +409,8 @@ func (b *Bot) handleModelAutocomplete(s *discordgo.Session, i *discordgo.Interac
 		partial = data.Options[0].StringValue()
 	}
 
-	// Atomically load config
-	config := b.config.Load()
+	// Load the config in effect in this channel
+	config := b.configFor(i.GuildID, i.ChannelID)
 
 	// Check if config is nil (safety check)
 	if config == nil {
@@ -418,22 +427,11 @@ func (b *Bot) handleModelAutocomplete(s *discordgo.Session, i *discordgo.Interac
 	}
 
 	// Get user's current model
-	var userID string
-	if i.User != nil {
-		userID = i.User.ID
-	} else if i.Member != nil && i.Member.User != nil {
-		userID = i.Member.User.ID
-	}
-
-	currentModel := b.resolveUserModel(context.Background(), userID, config)
+	req := interactionRequester(i)
+	currentModel := b.resolveUserModel(context.Background(), req, config)
 
-	// Get all model names
-	var models []string
-	if config.Models != nil {
-		for modelName := range config.Models {
-			models = append(models, modelName)
-		}
-	}
+	// Get all model names the user may switch to here
+	models := auth.NewModelPolicy(config).Permitted(req)
 
 	// Filter models based on partial input and exclude current model from regular list
 	var filteredModels []string
@@ -608,11 +606,11 @@ func (b *Bot) handleGenerateVideoCommand(s *discordgo.Session, i *discordgo.Inte
 
 		// Check video size
 		if len(videoData) > 9*1024*1024 { // 9 MB
-			// Upload to Catbox
-			url, err := uploader.UploadToCatbox("video.mp4", videoData)
+			// Too large for Discord, so upload it
+			url, err := b.fileUploader.UploadFile(ctx, "video.mp4", videoData)
 			if err != nil {
-				log.Printf("Failed to upload video to Catbox: %v", err)
-				errorContent := fmt.Sprintf("❌ Failed to upload video to Catbox: %v", err)
+				log.Printf("Failed to upload video to %s: %v", b.fileUploader.Name(), err)
+				errorContent := fmt.Sprintf("❌ Failed to upload video: %v", err)
 				if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 					Content: &errorContent,
 				}); err != nil {
@@ -621,11 +619,11 @@ func (b *Bot) handleGenerateVideoCommand(s *discordgo.Session, i *discordgo.Inte
 				return
 			}
 
-			successContent := fmt.Sprintf("✅ Video generated and uploaded to Catbox: %s", url)
+			successContent := fmt.Sprintf("✅ Video generated and uploaded: %s", url)
 			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 				Content: &successContent,
 			}); err != nil {
-				log.Printf("Failed to edit interaction response with Catbox URL: %v", err)
+				log.Printf("Failed to edit interaction response with video URL: %v", err)
 			}
 		} else {
 			// Send directly to Discord
@@ -19,8 +19,8 @@ func (b *Bot) buildConversationChainWithWebSearch(s *discordgo.Session, m *disco
 	var messages []messaging.OpenAIMessage
 	var warnings []string
 
-	// Atomically load config
-	config := b.config.Load()
+	// Load the config in effect in this channel
+	config := b.configFor(m.GuildID, m.ChannelID)
 
 	currentMsg := m.Message
 	maxMessages := config.MaxMessages
@@ -65,8 +65,9 @@ func (b *Bot) buildConversationChainWithWebSearch(s *discordgo.Session, m *disco
 		// needs to be reconstructed. Regular conversation flow should use the actual
 		// processed nodes to respect the user's context choice.
 
-		// Process message if not already processed (text empty)
-		if node.GetText() == "" {
+		// Process message if not already processed (text empty). Imported messages
+		// have no Discord message to process.
+		if node.GetText() == "" && !messaging.IsImportedMessageID(currentMsg.ID) {
 			// Check if this message originally had web search enabled
 			webSearchPerformed, _ := node.GetWebSearchInfo()
 
@@ -78,8 +79,23 @@ func (b *Bot) buildConversationChainWithWebSearch(s *discordgo.Session, m *disco
 			b.processMessage(s, currentMsg, node, processForWebSearch, progressMgr)
 		}
 
-		// If ParentMsg not cached, attempt lightweight parent lookup (no URL extraction)
-		if node.ParentMsg == nil {
+		// Nodes loaded from the persistent cache only know their parent's ID
+		if node.ParentMsg == nil && node.ParentMessageID != "" {
+			if messaging.IsImportedMessageID(node.ParentMessageID) {
+				node.ParentMsg = &discordgo.Message{ID: node.ParentMessageID, ChannelID: node.ParentChannelID}
+			} else {
+				parentMsg, err := s.ChannelMessage(node.ParentChannelID, node.ParentMessageID)
+				if err != nil {
+					log.Printf("Failed to fetch cached parent %s: %v", node.ParentMessageID, err)
+				} else {
+					node.ParentMsg = parentMsg
+				}
+			}
+		}
+
+		// If ParentMsg not cached, attempt lightweight parent lookup (no URL extraction).
+		// An imported chain starts at its first imported message.
+		if node.ParentMsg == nil && !node.Imported && !messaging.IsImportedMessageID(currentMsg.ID) {
 			parentMsg, _, err := utils.FindParentMessage(s, &discordgo.MessageCreate{Message: currentMsg}, s.State.User)
 			if err == nil {
 				node.ParentMsg = parentMsg
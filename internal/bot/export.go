@@ -0,0 +1,714 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/export"
+	"DiscordAIChatbot/internal/messaging"
+	"DiscordAIChatbot/internal/utils"
+)
+
+// Conversation export formats
+const (
+	exportFormatMarkdown = "markdown"
+	exportFormatJSON     = "json"
+	exportFormatHTML     = "html"
+)
+
+// exportMessageCommandName is the message context-menu action that exports a conversation
+const exportMessageCommandName = "Export conversation"
+
+// exportTimeLayout formats timestamps in exported transcripts
+const exportTimeLayout = "2006-01-02 15:04 UTC"
+
+// Role markers in Markdown transcript headings
+const (
+	userIcon      = "👤"
+	assistantIcon = "🤖"
+)
+
+// exportExtensions maps export formats to file extensions
+var exportExtensions = map[string]string{
+	exportFormatMarkdown: ".md",
+	exportFormatJSON:     ".json",
+	exportFormatHTML:     ".html",
+}
+
+var (
+	messageLinkPattern = regexp.MustCompile(`^https://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/channels/(?:\d+|@me)/(\d+)/(\d+)/?$`)
+	snowflakePattern   = regexp.MustCompile(`^\d{17,20}$`)
+	footerModelPattern = regexp.MustCompile(`🤖 Model: ([^•]+)`)
+)
+
+// transcriptAttachment is a file attached to an exported message
+type transcriptAttachment struct {
+	Filename    string `json:"filename"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size,omitempty"`
+}
+
+// transcriptSource is a web source an exported response was grounded on
+type transcriptSource struct {
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url"`
+}
+
+// transcriptMetadata holds what OpenAI messages have no field for. In JSON exports it is
+// listed next to the messages, one entry per message in the same order.
+type transcriptMetadata struct {
+	MessageID   string                 `json:"message_id"`
+	Author      string                 `json:"author"`
+	Timestamp   time.Time              `json:"timestamp"`
+	Model       string                 `json:"model,omitempty"`
+	Attachments []transcriptAttachment `json:"attachments,omitempty"`
+	Sources     []transcriptSource     `json:"sources,omitempty"`
+}
+
+// transcriptEntry is one message of an exported conversation
+type transcriptEntry struct {
+	transcriptMetadata
+	Role   string
+	UserID string
+	Text   string
+}
+
+// transcriptFile is the JSON export: OpenAI messages plus their metadata
+type transcriptFile struct {
+	Title      string                    `json:"title"`
+	ExportedAt time.Time                 `json:"exported_at"`
+	Messages   []messaging.OpenAIMessage `json:"messages"`
+	Metadata   []transcriptMetadata      `json:"metadata"`
+}
+
+// handleExportCommand handles the /export slash command
+func (b *Bot) handleExportCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+
+	format := exportFormatMarkdown
+	var target string
+	for _, option := range data.Options {
+		switch option.Name {
+		case "format":
+			format = option.StringValue()
+		case "message":
+			target = option.StringValue()
+		}
+	}
+
+	var messageID string
+	if target != "" {
+		id, err := parseMessageTarget(target, i.ChannelID)
+		if err != nil {
+			if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: fmt.Sprintf("❌ %v", err),
+					Flags:   discordgo.MessageFlagsEphemeral,
+				},
+			}); err != nil {
+				log.Printf("Failed to respond to interaction: %v", err)
+			}
+			return
+		}
+		messageID = id
+	}
+
+	b.exportConversation(s, i, messageID, format)
+}
+
+// handleExportMessageCommand handles the "Export conversation" message action by
+// offering a button per export format
+func (b *Bot) handleExportMessageCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	messageID := i.ApplicationCommandData().TargetID
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "📦 Export this conversation as:",
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    "Markdown",
+							Style:    discordgo.SecondaryButton,
+							CustomID: "export_conversation_" + exportFormatMarkdown + "_" + messageID,
+							Emoji:    &discordgo.ComponentEmoji{Name: "📝"},
+						},
+						discordgo.Button{
+							Label:    "JSON",
+							Style:    discordgo.SecondaryButton,
+							CustomID: "export_conversation_" + exportFormatJSON + "_" + messageID,
+							Emoji:    &discordgo.ComponentEmoji{Name: "🧾"},
+						},
+						discordgo.Button{
+							Label:    "HTML",
+							Style:    discordgo.SecondaryButton,
+							CustomID: "export_conversation_" + exportFormatHTML + "_" + messageID,
+							Emoji:    &discordgo.ComponentEmoji{Name: "🌐"},
+						},
+					},
+				},
+			},
+		},
+	}); err != nil {
+		log.Printf("Failed to respond to interaction: %v", err)
+	}
+}
+
+// handleExportButton handles the format buttons offered by the "Export conversation" action
+func (b *Bot) handleExportButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	parts := strings.SplitN(strings.TrimPrefix(i.MessageComponentData().CustomID, "export_conversation_"), "_", 2)
+	if len(parts) != 2 {
+		return
+	}
+	b.exportConversation(s, i, parts[1], parts[0])
+}
+
+// exportConversation walks the reply chain ending at messageID and sends it to the user as a
+// file in the given format. Without a message ID the bot's latest response in the channel is used.
+func (b *Bot) exportConversation(s *discordgo.Session, i *discordgo.InteractionCreate, messageID, format string) {
+	extension, ok := exportExtensions[format]
+	if !ok {
+		extension, format = exportExtensions[exportFormatMarkdown], exportFormatMarkdown
+	}
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	}); err != nil {
+		log.Printf("Failed to send deferred response: %v", err)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.ExportTimeout*time.Minute)
+		defer cancel()
+
+		edit := func(content string, files []*discordgo.File) {
+			if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Content: &content,
+				Files:   files,
+			}); err != nil {
+				log.Printf("Failed to edit interaction response: %v", err)
+			}
+		}
+
+		if messageID == "" {
+			id, err := latestBotMessageID(s, i.ChannelID)
+			if err != nil {
+				log.Printf("Failed to find a response to export in channel %s: %v", i.ChannelID, err)
+				edit("❌ No bot response found in this channel. Pass a message link or ID to export.", nil)
+				return
+			}
+			messageID = id
+		}
+
+		entries, truncated, err := b.buildTranscript(s, i.GuildID, i.ChannelID, messageID)
+		if err != nil {
+			log.Printf("Failed to build transcript for %s: %v", messageID, err)
+			edit("❌ Could not read that conversation.", nil)
+			return
+		}
+		if len(entries) == 0 {
+			edit("❌ That conversation has nothing to export.", nil)
+			return
+		}
+
+		title := transcriptTitle(s, i.ChannelID)
+		var data []byte
+		switch format {
+		case exportFormatJSON:
+			data, err = renderTranscriptJSON(title, entries)
+		case exportFormatHTML:
+			data, err = b.renderTranscriptHTML(ctx, title, entries)
+		default:
+			data = renderTranscriptMarkdown(title, entries)
+		}
+		if err != nil {
+			log.Printf("Failed to render %s transcript: %v", format, err)
+			edit("❌ Failed to create the export file.", nil)
+			return
+		}
+
+		filename := fmt.Sprintf("conversation_%s_%d%s", messageID, time.Now().Unix(), extension)
+		summary := fmt.Sprintf("📦 Exported %d messages as %s", len(entries), strings.ToUpper(extension[1:]))
+		if truncated {
+			summary += fmt.Sprintf(" (only the latest %d were read)", config.MaxExportMessages)
+		}
+
+		// Discord rejects large attachments, so big exports go through the file uploader
+		if len(data) > config.MaxFileSize {
+			link, err := b.fileUploader.UploadFile(ctx, filename, data)
+			if err != nil {
+				log.Printf("Failed to upload export with %s: %v", b.fileUploader.Name(), err)
+				edit("❌ The export is too large to attach and could not be uploaded.", nil)
+				return
+			}
+			edit(fmt.Sprintf("%s: %s", summary, link), nil)
+			return
+		}
+
+		edit(summary+":", []*discordgo.File{{Name: filename, Reader: bytes.NewReader(data)}})
+	}()
+}
+
+// buildTranscript follows the reply chain from messageID back to its start, the same way
+// buildConversationChainWithWebSearch does, and returns its messages oldest first. Nothing is
+// processed: cached nodes supply full responses, models and sources, and the Discord messages
+// supply the rest. The bool reports whether the chain was cut at config.MaxExportMessages.
+func (b *Bot) buildTranscript(s *discordgo.Session, guildID, channelID, messageID string) ([]transcriptEntry, bool, error) {
+	msg, err := s.ChannelMessage(channelID, messageID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch message %s: %w", messageID, err)
+	}
+
+	visited := make(map[string]bool)
+	var entries []transcriptEntry
+	truncated := false
+
+	for msg != nil {
+		if visited[msg.ID] {
+			log.Printf("Cycle detected in message chain at message ID %s, breaking", msg.ID)
+			break
+		}
+		if len(visited) >= config.MaxExportMessages {
+			truncated = true
+			break
+		}
+		visited[msg.ID] = true
+
+		// Messages fetched by ID carry no guild ID, which the parent lookup relies on
+		msg.GuildID = guildID
+
+		node := b.loadExportNode(msg.ID)
+		entry := transcriptEntryFor(s, msg, node)
+
+		// Consecutive bot messages are parts of one long response
+		if n := len(entries); n > 0 && entry.Role == "assistant" && entries[n-1].Role == "assistant" {
+			mergeResponseParts(&entries[n-1], entry)
+		} else if entry.Text != "" || len(entry.Attachments) > 0 {
+			entries = append(entries, entry)
+		}
+
+		msg = exportParent(s, msg, node)
+	}
+
+	// Reverse to have oldest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, truncated, nil
+}
+
+// loadExportNode returns the cached node for a message, or nil if it was never processed or has expired
+func (b *Bot) loadExportNode(messageID string) *messaging.MsgNode {
+	if node, exists := b.nodeManager.Get(messageID); exists {
+		return node
+	}
+	if b.messageCache == nil {
+		return nil
+	}
+	node, err := b.messageCache.GetNode(context.Background(), messageID)
+	if err != nil {
+		log.Printf("Failed to load node from DB: %v", err)
+		return nil
+	}
+	return node
+}
+
+// exportParent returns the message msg replies to, or nil at the start of the conversation
+func exportParent(s *discordgo.Session, msg *discordgo.Message, node *messaging.MsgNode) *discordgo.Message {
+	if node != nil {
+		if node.ParentMsg != nil {
+			return node.ParentMsg
+		}
+		if node.ParentMessageID != "" {
+			channelID := node.ParentChannelID
+			if channelID == "" {
+				channelID = msg.ChannelID
+			}
+			if messaging.IsImportedMessageID(node.ParentMessageID) {
+				return &discordgo.Message{ID: node.ParentMessageID, ChannelID: channelID}
+			}
+			parent, err := s.ChannelMessage(channelID, node.ParentMessageID)
+			if err == nil {
+				return parent
+			}
+			log.Printf("Failed to fetch cached parent %s: %v", node.ParentMessageID, err)
+		}
+	}
+
+	// An imported chain starts at its first imported message
+	if messaging.IsImportedMessageID(msg.ID) || (node != nil && node.Imported) {
+		return nil
+	}
+
+	parent, _, err := utils.FindParentMessage(s, &discordgo.MessageCreate{Message: msg}, s.State.User)
+	if err != nil {
+		return nil
+	}
+	return parent
+}
+
+// transcriptEntryFor builds the transcript entry for a message and its cached node, if any
+func transcriptEntryFor(s *discordgo.Session, msg *discordgo.Message, node *messaging.MsgNode) transcriptEntry {
+	entry := transcriptEntry{
+		transcriptMetadata: transcriptMetadata{
+			MessageID: msg.ID,
+			Timestamp: msg.Timestamp.UTC(),
+		},
+		Role: "user",
+	}
+
+	// Imported messages are exported as they were imported, without Discord details
+	if node != nil && node.Imported {
+		entry.Role = node.Role
+		entry.UserID = node.UserID
+		entry.Author = "imported " + node.Role
+		entry.Timestamp = time.Time{}
+		entry.Text = node.GetText()
+		return entry
+	}
+
+	if msg.Author != nil {
+		entry.Author = msg.Author.Username
+		if msg.Author.GlobalName != "" {
+			entry.Author = msg.Author.GlobalName
+		}
+		entry.UserID = msg.Author.ID
+		if msg.Author.ID == s.State.User.ID {
+			entry.Role = "assistant"
+		}
+	}
+
+	if entry.Role == "assistant" {
+		entry.Text = responseText(msg)
+		entry.Model = footerModel(msg)
+		if node != nil {
+			// The node holds the whole response, not just the part shown in this message
+			if text := node.GetText(); text != "" {
+				entry.Text = text
+			}
+			if variants, selected := node.GetVariants(); selected >= 0 && selected < len(variants) && variants[selected].Model != "" {
+				entry.Model = variants[selected].Model
+			}
+		}
+	} else {
+		entry.Text = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(msg.Content), s.State.User.Mention()))
+	}
+
+	for _, attachment := range msg.Attachments {
+		entry.Attachments = append(entry.Attachments, transcriptAttachment{
+			Filename:    attachment.Filename,
+			URL:         attachment.URL,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+		})
+	}
+
+	if node != nil {
+		if metadata := node.GetGroundingMetadata(); metadata != nil {
+			for _, chunk := range metadata.GroundingChunks {
+				if chunk.Web.URI != "" {
+					entry.Sources = append(entry.Sources, transcriptSource{Title: chunk.Web.Title, URL: chunk.Web.URI})
+				}
+			}
+		}
+		for _, url := range node.GetDetectedURLs() {
+			entry.Sources = append(entry.Sources, transcriptSource{URL: url})
+		}
+	}
+
+	return entry
+}
+
+// responseText returns the text of a bot message: its content for plain responses,
+// otherwise its embed descriptions
+func responseText(msg *discordgo.Message) string {
+	if strings.TrimSpace(msg.Content) != "" {
+		return msg.Content
+	}
+	var parts []string
+	for _, embed := range msg.Embeds {
+		if embed.Description != "" {
+			parts = append(parts, embed.Description)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// footerModel reads the model name from a response embed footer
+func footerModel(msg *discordgo.Message) string {
+	for _, embed := range msg.Embeds {
+		if embed.Footer == nil {
+			continue
+		}
+		if match := footerModelPattern.FindStringSubmatch(embed.Footer.Text); match != nil {
+			return strings.TrimSpace(match[1])
+		}
+	}
+	return ""
+}
+
+// mergeResponseParts folds an earlier part of a multi-message response into the entry for a later part
+func mergeResponseParts(later *transcriptEntry, earlier transcriptEntry) {
+	// Parts backed by a node already hold the whole response
+	if !strings.Contains(later.Text, earlier.Text) {
+		later.Text = earlier.Text + "\n" + later.Text
+	}
+	later.MessageID = earlier.MessageID
+	later.Timestamp = earlier.Timestamp
+	if later.Model == "" {
+		later.Model = earlier.Model
+	}
+	later.Attachments = append(earlier.Attachments, later.Attachments...)
+
+	seen := make(map[string]bool)
+	var sources []transcriptSource
+	for _, source := range append(earlier.Sources, later.Sources...) {
+		if !seen[source.URL] {
+			seen[source.URL] = true
+			sources = append(sources, source)
+		}
+	}
+	later.Sources = sources
+}
+
+// parseMessageTarget accepts a message link or ID and returns the message ID
+func parseMessageTarget(target, channelID string) (string, error) {
+	target = strings.TrimSpace(target)
+	if match := messageLinkPattern.FindStringSubmatch(target); match != nil {
+		if match[1] != channelID {
+			return "", errors.New("that message is in another channel; run /export there")
+		}
+		return match[2], nil
+	}
+	if snowflakePattern.MatchString(target) {
+		return target, nil
+	}
+	return "", errors.New("expected a message link or ID")
+}
+
+// latestBotMessageID returns the ID of the bot's most recent message in a channel
+func latestBotMessageID(s *discordgo.Session, channelID string) (string, error) {
+	messages, err := s.ChannelMessages(channelID, 50, "", "", "")
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch channel messages: %w", err)
+	}
+	for _, msg := range messages {
+		if msg.Author != nil && msg.Author.ID == s.State.User.ID {
+			return msg.ID, nil
+		}
+	}
+	return "", errors.New("no bot message in the last 50 messages")
+}
+
+// transcriptTitle names an export after its channel
+func transcriptTitle(s *discordgo.Session, channelID string) string {
+	channel, err := s.State.Channel(channelID)
+	if err != nil {
+		channel, err = s.Channel(channelID)
+	}
+	if err != nil || channel.Name == "" {
+		return "Conversation"
+	}
+	return "Conversation in #" + channel.Name
+}
+
+// entryHeading describes who wrote an entry, with which model and when
+func entryHeading(entry transcriptEntry) string {
+	author := entry.Author
+	if entry.Model != "" {
+		author += " (" + entry.Model + ")"
+	}
+	// Imported messages have no timestamp
+	if entry.Timestamp.IsZero() {
+		return author
+	}
+	return author + " · " + entry.Timestamp.Format(exportTimeLayout)
+}
+
+// roleIcon marks Markdown headings with the entry's role so transcripts can be imported again
+func roleIcon(role string) string {
+	if role == "assistant" {
+		return assistantIcon
+	}
+	return userIcon
+}
+
+// sourceLabel returns a source's title, or its URL when it has none
+func sourceLabel(source transcriptSource) string {
+	if source.Title != "" {
+		return source.Title
+	}
+	return source.URL
+}
+
+// renderTranscriptMarkdown renders a transcript as Markdown
+func renderTranscriptMarkdown(title string, entries []transcriptEntry) []byte {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# %s\n\n_Exported %s · %d messages_\n", title, time.Now().UTC().Format(exportTimeLayout), len(entries))
+
+	for _, entry := range entries {
+		fmt.Fprintf(&out, "\n---\n\n### %s %s\n\n", roleIcon(entry.Role), entryHeading(entry))
+		if entry.Text != "" {
+			out.WriteString(entry.Text + "\n")
+		}
+		if len(entry.Attachments) > 0 {
+			out.WriteString("\n**Attachments**\n\n")
+			for _, attachment := range entry.Attachments {
+				fmt.Fprintf(&out, "- [%s](%s)\n", attachment.Filename, attachment.URL)
+			}
+		}
+		if len(entry.Sources) > 0 {
+			out.WriteString("\n**Sources**\n\n")
+			for _, source := range entry.Sources {
+				fmt.Fprintf(&out, "- [%s](%s)\n", sourceLabel(source), source.URL)
+			}
+		}
+	}
+
+	return []byte(out.String())
+}
+
+// renderTranscriptJSON renders a transcript as OpenAI chat messages. Image attachments become
+// image_url parts; everything else is kept in the metadata.
+func renderTranscriptJSON(title string, entries []transcriptEntry) ([]byte, error) {
+	file := transcriptFile{
+		Title:      title,
+		ExportedAt: time.Now().UTC(),
+		Messages:   make([]messaging.OpenAIMessage, 0, len(entries)),
+		Metadata:   make([]transcriptMetadata, 0, len(entries)),
+	}
+
+	for _, entry := range entries {
+		message := messaging.OpenAIMessage{Role: entry.Role, Content: entry.Text}
+		if entry.Role == "user" {
+			message.Name = entry.UserID
+		}
+
+		var images []messaging.MessageContent
+		for _, attachment := range entry.Attachments {
+			if strings.HasPrefix(attachment.ContentType, "image/") {
+				images = append(images, messaging.MessageContent{
+					Type:     "image_url",
+					ImageURL: &messaging.ImageURL{URL: attachment.URL},
+				})
+			}
+		}
+		if len(images) > 0 {
+			var content []messaging.MessageContent
+			if entry.Text != "" {
+				content = append(content, messaging.MessageContent{Type: "text", Text: entry.Text})
+			}
+			message.Content = append(content, images...)
+		}
+
+		file.Messages = append(file.Messages, message)
+		file.Metadata = append(file.Metadata, entry.transcriptMetadata)
+	}
+
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// renderTranscriptHTML renders a transcript as a page that needs nothing but itself:
+// images are embedded while they fit, and other attachments are linked.
+func (b *Bot) renderTranscriptHTML(ctx context.Context, title string, entries []transcriptEntry) ([]byte, error) {
+	var body strings.Builder
+	fmt.Fprintf(&body, "<h1>%s</h1>\n<p class=\"meta\">Exported %s · %d messages</p>\n",
+		html.EscapeString(title), time.Now().UTC().Format(exportTimeLayout), len(entries))
+
+	// Keep embedded images within about half of the attachment limit, as base64 grows them by a third
+	embedded := 0
+	for _, entry := range entries {
+		fmt.Fprintf(&body, "<hr>\n<section>\n<p class=\"meta\"><strong>%s</strong></p>\n", html.EscapeString(entryHeading(entry)))
+		body.WriteString(export.RenderMarkdown(entry.Text))
+
+		for _, attachment := range entry.Attachments {
+			if isEmbeddableImage(attachment.ContentType) && attachment.Size <= config.MaxExportImageSize &&
+				embedded+attachment.Size <= config.MaxFileSize/2 {
+				data, err := b.downloadAttachment(ctx, attachment.URL, config.MaxExportImageSize)
+				if err == nil {
+					embedded += len(data)
+					fmt.Fprintf(&body, "<p><img src=\"data:%s;base64,%s\" alt=\"%s\"></p>\n",
+						html.EscapeString(attachment.ContentType), base64.StdEncoding.EncodeToString(data), html.EscapeString(attachment.Filename))
+					continue
+				}
+				log.Printf("Failed to embed attachment %s: %v", attachment.Filename, err)
+			}
+			fmt.Fprintf(&body, "<p>📎 <a href=\"%s\" rel=\"noopener noreferrer\">%s</a></p>\n",
+				html.EscapeString(attachment.URL), html.EscapeString(attachment.Filename))
+		}
+
+		if len(entry.Sources) > 0 {
+			body.WriteString("<p class=\"meta\">Sources</p>\n<ul>\n")
+			for _, source := range entry.Sources {
+				fmt.Fprintf(&body, "<li><a href=\"%s\" rel=\"noopener noreferrer\">%s</a></li>\n",
+					html.EscapeString(source.URL), html.EscapeString(sourceLabel(source)))
+			}
+			body.WriteString("</ul>\n")
+		}
+		body.WriteString("</section>\n")
+	}
+
+	return export.RenderPage(title, template.HTML(body.String()), "")
+}
+
+// isEmbeddableImage reports whether an attachment can be shown inline from a data URL
+func isEmbeddableImage(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// downloadAttachment fetches an attachment of at most maxSize bytes
+func (b *Bot) downloadAttachment(ctx context.Context, url string, maxSize int) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download attachment: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Failed to close response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("attachment download returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("attachment is larger than %d bytes", maxSize)
+	}
+	return data, nil
+}
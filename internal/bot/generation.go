@@ -0,0 +1,315 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"DiscordAIChatbot/internal/utils"
+)
+
+// trackedRepliesSize is how many answered messages are remembered for edit regeneration
+const trackedRepliesSize = 1000
+
+// errGenerationStopped is the cancellation cause used when a user presses the stop button
+var errGenerationStopped = errors.New("generation stopped by user")
+
+// activeGeneration is a response that is currently being generated
+type activeGeneration struct {
+	userID string
+	cancel context.CancelCauseFunc
+}
+
+// trackedReply marks a message the bot has answered so edits can offer a regeneration
+type trackedReply struct {
+	offerMessageID string // Regeneration offer already posted for the latest edit
+}
+
+// GenerationTracker tracks in-progress generations by triggering message ID
+// and remembers which messages the bot has answered
+type GenerationTracker struct {
+	mu      sync.Mutex
+	active  map[string]*activeGeneration
+	replies *lru.Cache[string, trackedReply]
+}
+
+// NewGenerationTracker creates a new generation tracker
+func NewGenerationTracker() *GenerationTracker {
+	replies, _ := lru.New[string, trackedReply](trackedRepliesSize)
+	return &GenerationTracker{
+		active:  make(map[string]*activeGeneration),
+		replies: replies,
+	}
+}
+
+// Start registers a generation for a triggering message and returns its cancellable context
+// along with a function that unregisters it
+func (g *GenerationTracker) Start(parent context.Context, requestID, userID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	generation := &activeGeneration{userID: userID, cancel: cancel}
+
+	g.mu.Lock()
+	if previous, ok := g.active[requestID]; ok {
+		previous.cancel(errGenerationStopped)
+	}
+	g.active[requestID] = generation
+	g.mu.Unlock()
+
+	return ctx, func() {
+		g.mu.Lock()
+		if g.active[requestID] == generation {
+			delete(g.active, requestID)
+		}
+		g.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// Stop cancels the generation for a triggering message. It returns false when nothing is running.
+func (g *GenerationTracker) Stop(requestID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	generation, ok := g.active[requestID]
+	if !ok {
+		return false
+	}
+	generation.cancel(errGenerationStopped)
+	return true
+}
+
+// Owner returns the user who triggered a running generation
+func (g *GenerationTracker) Owner(requestID string) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	generation, ok := g.active[requestID]
+	if !ok {
+		return "", false
+	}
+	return generation.userID, true
+}
+
+// IsActive reports whether a generation is running for a triggering message
+func (g *GenerationTracker) IsActive(requestID string) bool {
+	_, ok := g.Owner(requestID)
+	return ok
+}
+
+// RecordReply remembers that the bot answered a triggering message
+func (g *GenerationTracker) RecordReply(requestID string) {
+	g.replies.Add(requestID, trackedReply{})
+}
+
+// Reply returns what is remembered about the bot's reply to a triggering message
+func (g *GenerationTracker) Reply(requestID string) (trackedReply, bool) {
+	return g.replies.Get(requestID)
+}
+
+// setOffer stores the regeneration offer posted for a triggering message
+func (g *GenerationTracker) setOffer(requestID, offerMessageID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	reply, _ := g.replies.Get(requestID)
+	reply.offerMessageID = offerMessageID
+	g.replies.Add(requestID, reply)
+}
+
+// wasStopped reports whether a generation context was cancelled by the stop button
+func wasStopped(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errGenerationStopped)
+}
+
+// handleStopGeneration handles the stop button on an in-progress response
+func (b *Bot) handleStopGeneration(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	requestID := strings.TrimPrefix(i.MessageComponentData().CustomID, "stop_generation_")
+	userID := interactionUserID(i)
+
+	owner, running := b.generations.Owner(requestID)
+	if !running {
+		// Already finished; drop the stale button
+		emptyComponents := []discordgo.MessageComponent{}
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Components: emptyComponents,
+			},
+		}); err != nil {
+			log.Printf("Failed to respond to interaction: %v", err)
+		}
+		return
+	}
+
+	cfg := b.config.Load()
+	if userID != owner && (cfg == nil || !contains(cfg.Permissions.Users.AdminIDs, userID)) {
+		b.respondEphemeral(s, i, "❌ Only the person who asked can stop this response")
+		return
+	}
+
+	b.generations.Stop(requestID)
+	log.Printf("User %s stopped generation for message %s", userID, requestID)
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	}); err != nil {
+		log.Printf("Failed to respond to interaction: %v", err)
+	}
+}
+
+// setProgressComponents replaces the buttons on the progress message
+func (b *Bot) setProgressComponents(s *discordgo.Session, progressMgr *utils.ProgressManager, components []discordgo.MessageComponent) {
+	if progressMgr == nil || progressMgr.GetMessageID() == "" {
+		return
+	}
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Channel:    progressMgr.GetChannelID(),
+		ID:         progressMgr.GetMessageID(),
+		Components: &components,
+	}); err != nil {
+		log.Printf("Failed to update progress message buttons: %v", err)
+	}
+}
+
+// onMessageUpdate offers to regenerate the bot's reply when a user edits a message it answered
+func (b *Bot) onMessageUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	if m.Message == nil || m.Author == nil || m.Author.Bot {
+		return
+	}
+
+	// Ignore updates that don't change the text, such as link embeds loading
+	if m.BeforeUpdate != nil {
+		if m.BeforeUpdate.Content == m.Content {
+			return
+		}
+	} else if m.EditedTimestamp == nil {
+		return
+	}
+
+	reply, answered := b.generations.Reply(m.ID)
+	if !answered && !b.generations.IsActive(m.ID) {
+		return
+	}
+
+	// The cached node holds the old text; drop it so a regeneration re-reads the message
+	b.invalidateNode(m.ID)
+
+	if reply.offerMessageID != "" {
+		return
+	}
+
+	offer, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:    "✏️ You edited your message. Regenerate the reply?",
+		Reference:  m.Reference(),
+		Components: utils.CreateRegenerateButton(m.ID),
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse:       []discordgo.AllowedMentionType{},
+			RepliedUser: false,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to send regeneration offer: %v", err)
+		return
+	}
+	b.generations.setOffer(m.ID, offer.ID)
+}
+
+// handleRegenerateEdit regenerates the reply to an edited message
+func (b *Bot) handleRegenerateEdit(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	messageID := strings.TrimPrefix(i.MessageComponentData().CustomID, "regenerate_edit_")
+	userID := interactionUserID(i)
+
+	msg, err := s.ChannelMessage(i.ChannelID, messageID)
+	if err != nil {
+		log.Printf("Failed to fetch edited message %s: %v", messageID, err)
+		b.respondEphemeral(s, i, "❌ Could not find the edited message")
+		return
+	}
+
+	cfg := b.config.Load()
+	if msg.Author == nil || (userID != msg.Author.ID && (cfg == nil || !contains(cfg.Permissions.Users.AdminIDs, userID))) {
+		b.respondEphemeral(s, i, "❌ Only the author of the message can regenerate the reply")
+		return
+	}
+
+	msg.GuildID = i.GuildID
+	if i.Member != nil {
+		msg.Member = i.Member
+	}
+	regen := &discordgo.MessageCreate{Message: msg}
+
+	// Regenerating costs tokens like any other message; the offer stays so the user can retry
+	if reason := b.checkQuota(regen); reason != "" {
+		log.Printf("Usage quota exceeded for user %s", msg.Author.ID)
+		b.respondEphemeral(s, i, "⚠️ "+reason)
+		return
+	}
+	if result := b.rateLimiter.Allow(cfg, userID, i.ChannelID); !result.Allowed {
+		log.Printf("Rate limited user %s in channel %s", userID, i.ChannelID)
+		b.respondEphemeral(s, i, fmt.Sprintf("⏳ You're sending messages too quickly. Try again in %s.", formatWait(result.RetryAfter)))
+		return
+	}
+
+	// Replace the offer with a status line
+	content := "🔄 Regenerating reply…"
+	emptyComponents := []discordgo.MessageComponent{}
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: emptyComponents,
+		},
+	}); err != nil {
+		log.Printf("Failed to respond to interaction: %v", err)
+	}
+	b.generations.setOffer(messageID, "")
+
+	// Stop a response to the old text that may still be streaming
+	b.generations.Stop(messageID)
+	b.invalidateNode(messageID)
+
+	if _, err := b.scheduler.Submit(&messageJob{msg: regen}); err != nil {
+		log.Printf("Failed to queue regeneration for message %s: %v", messageID, err)
+		b.replyNotice(s, regen, "⏳ I'm very busy right now. Please try again in a moment.")
+	}
+}
+
+// invalidateNode drops the cached node of a message from memory and the database
+func (b *Bot) invalidateNode(messageID string) {
+	b.nodeManager.Delete(messageID)
+	if b.messageCache != nil {
+		if err := b.messageCache.DeleteNode(context.Background(), messageID); err != nil {
+			log.Printf("Failed to delete cached node %s: %v", messageID, err)
+		}
+	}
+}
+
+// interactionUserID returns the ID of the user who triggered an interaction
+func interactionUserID(i *discordgo.InteractionCreate) string {
+	if i.User != nil {
+		return i.User.ID
+	}
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	return ""
+}
+
+// respondEphemeral replies to an interaction with a message only the user can see
+func (b *Bot) respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	}); err != nil {
+		log.Printf("Failed to respond to interaction: %v", err)
+	}
+}
@@ -2,9 +2,11 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 
@@ -157,6 +159,215 @@ func (b *Bot) registerCommands() error {
 			Name:        "testmodels",
 			Description: "Test all configured models with a simple 'hi' message",
 		},
+		{
+			Name:        "usage",
+			Description: "View your token usage, server totals and quota",
+		},
+		{
+			Name:        "export",
+			Description: "Export a conversation as Markdown, JSON or HTML",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "format",
+					Description: "File format (default: Markdown)",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{
+							Name:  "Markdown",
+							Value: exportFormatMarkdown,
+						},
+						{
+							Name:  "JSON (OpenAI messages)",
+							Value: exportFormatJSON,
+						},
+						{
+							Name:  "HTML",
+							Value: exportFormatHTML,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "message",
+					Description: "Link or ID of the last message to export (default: the bot's latest response)",
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name: exportMessageCommandName,
+			Type: discordgo.MessageApplicationCommand,
+		},
+		{
+			Name:        "import",
+			Description: "Continue a conversation from an OpenAI JSON file or an /export Markdown transcript",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionAttachment,
+					Name:        "file",
+					Description: "The transcript to import (.json or .md)",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "persona",
+			Description: "Create, switch and manage personas",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "create",
+					Description: "Create a persona or update one of yours",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "name",
+							Description: "Name of the persona",
+							Required:    true,
+							MaxLength:   config.MaxPersonaNameLength,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "prompt",
+							Description: "System prompt the persona answers with",
+							Required:    true,
+						},
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "model",
+							Description:  "Model the persona uses (defaults to your model)",
+							Autocomplete: true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionNumber,
+							Name:        "temperature",
+							Description: "Sampling temperature between 0 and 2 (defaults to the model's)",
+							MinValue:    &personaMinTemperature,
+							MaxValue:    2,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "avatar",
+							Description: "https:// image URL shown on the persona's responses",
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "display_name",
+							Description: "Name shown on the persona's responses",
+							MaxLength:   config.MaxPersonaDisplayNameLength,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "shared",
+							Description: "Make the persona available to everyone (admins only)",
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "delete",
+					Description: "Delete one of your personas",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "name",
+							Description:  "Name of the persona",
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "shared",
+							Description: "Delete the shared persona with this name (admins only)",
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "use",
+					Description: "Talk to a persona, or \"none\" to stop",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "name",
+							Description:  "Name of the persona",
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "List your personas and the shared ones",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "bind",
+					Description: "Make a shared persona the default in this channel, or \"none\" to unbind (server managers only)",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "name",
+							Description:  "Name of the shared persona",
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "serverconfig",
+			Description: "View and change this server's bot settings (Manage Server)",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "view",
+					Description: "Show the settings in effect and where they come from",
+					Options: []*discordgo.ApplicationCommandOption{
+						serverConfigChannelOption("Show the settings in this channel instead of the server's"),
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set",
+					Description: "Change a setting for the server or one channel",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "setting",
+							Description: "Setting to change",
+							Required:    true,
+							Choices:     serverConfigSettingChoices(false),
+						},
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "value",
+							Description:  "New value: a model, comma-separated models, a prompt, on/off or a number",
+							Required:     true,
+							Autocomplete: true,
+						},
+						serverConfigChannelOption("Change the setting only in this channel"),
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "reset",
+					Description: "Go back to the inherited value of a setting",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "setting",
+							Description: "Setting to reset (defaults to all)",
+							Choices:     serverConfigSettingChoices(true),
+						},
+						serverConfigChannelOption("Reset the setting only in this channel"),
+					},
+				},
+			},
+		},
 	}
 
 	for _, cmd := range commands {
@@ -223,14 +434,49 @@ func (b *Bot) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate)
 		return
 	}
 
-	// Instead of `go b.handleMessage(s, m)`, submit to the job channel
-	select {
-	case b.messageJobs <- m:
-	// Job successfully submitted
-	default:
-		// Pool is busy, log and drop the message to prevent blocking the Discord handler.
-		log.Printf("Message processing pool is full. Dropping message from user %s", m.Author.ID)
+	// Enforce usage quotas before queueing the message
+	if reason := b.checkQuota(m); reason != "" {
+		log.Printf("Usage quota exceeded for user %s", m.Author.ID)
+		b.replyNotice(s, m, "⚠️ "+reason)
+		return
 	}
+
+	// Enforce per-user and per-channel rate limits
+	if result := b.rateLimiter.Allow(b.config.Load(), m.Author.ID, m.ChannelID); !result.Allowed {
+		log.Printf("Rate limited user %s in channel %s", m.Author.ID, m.ChannelID)
+		if result.Notify {
+			b.replyNotice(s, m, fmt.Sprintf("⏳ You're sending messages too quickly. Try again in %s.", formatWait(result.RetryAfter)))
+		}
+		return
+	}
+
+	// Queue the message; workers take messages round-robin between users
+	position, err := b.scheduler.Submit(&messageJob{msg: m})
+	switch {
+	case errors.Is(err, ErrUserQueueFull):
+		b.replyNotice(s, m, "⏳ You already have several messages waiting. Please wait for them to finish.")
+	case err != nil:
+		log.Printf("Message queue is full. Rejecting message from user %s", m.Author.ID)
+		b.replyNotice(s, m, "⏳ I'm very busy right now. Please try again in a moment.")
+	case position > 0:
+		b.replyNotice(s, m, fmt.Sprintf("⏳ You're #%d in the queue.", position))
+	}
+}
+
+// replyNotice replies to a message with a short status notice
+func (b *Bot) replyNotice(s *discordgo.Session, m *discordgo.MessageCreate, content string) {
+	if _, err := s.ChannelMessageSendReply(m.ChannelID, content, m.Reference()); err != nil {
+		log.Printf("Failed to send notice to user %s: %v", m.Author.ID, err)
+	}
+}
+
+// formatWait formats a wait time in whole seconds, rounding up
+func formatWait(d time.Duration) string {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds <= 1 {
+		return "1 second"
+	}
+	return fmt.Sprintf("%d seconds", seconds)
 }
 
 // getProperMessageReference returns the appropriate MessageReference for a message
@@ -322,10 +568,11 @@ func (b *Bot) createThreadForResponse(s *discordgo.Session, originalMsg *discord
 	return thread.ID, nil
 }
 
-// handleMessage processes a message and generates LLM response
-func (b *Bot) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
-	// Atomically load config
-	cfg := b.config.Load()
+// handleMessage processes a message and generates LLM response. When variant is set,
+// an existing reply is regenerated in place as a new variant.
+func (b *Bot) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate, variant *variantRequest) {
+	// Load the config in effect in this channel
+	cfg := b.configFor(m.GuildID, m.ChannelID)
 	useThreads := cfg.UseThreads
 
 	targetChannelID := m.ChannelID
@@ -341,7 +588,10 @@ func (b *Bot) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 	}
 
 	// Create thread if enabled and we're not already in one
-	if useThreads && !isAlreadyInThread {
+	if variant != nil {
+		// Regenerate where the existing reply lives
+		targetChannelID = variant.channelID
+	} else if useThreads && !isAlreadyInThread {
 		threadID, err := b.createThreadForResponse(s, m)
 		if err != nil {
 			log.Printf("Failed to create thread, falling back to regular response: %v", err)
@@ -358,6 +608,9 @@ func (b *Bot) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 
 	// Create progress manager with the correct channel ID (thread or original)
 	progressMgr := utils.NewProgressManager(s, targetChannelID)
+	if variant != nil {
+		progressMgr = utils.NewProgressManagerForMessage(s, variant.channelID, variant.messageID)
+	}
 
 	// Show simple progress message once (as a reply)
 	if err := progressMgr.UpdateProgress(utils.ProgressProcessing, nil, messageRef); err != nil {
@@ -373,8 +626,15 @@ func (b *Bot) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 	}()
 
 	// Get user's preferred model with fallback
-	cfg = b.config.Load()
-	currentModel := b.resolveUserModel(context.Background(), m.Author.ID, cfg)
+	cfg = b.configFor(m.GuildID, m.ChannelID)
+	currentModel := b.resolveUserModel(context.Background(), modelRequester(m.Message), cfg)
+	persona := b.activePersona(context.Background(), m.Author.ID, m.ChannelID)
+	if model := b.personaModel(modelRequester(m.Message), persona, cfg); model != "" {
+		currentModel = model
+	}
+	if variant != nil && variant.model != "" {
+		currentModel = variant.model
+	}
 
 	// Parse provider and model
 	parts := strings.SplitN(currentModel, "/", 2)
@@ -403,23 +663,19 @@ func (b *Bot) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 
 	// Build conversation chain
 	forceDisableWebSearch := strings.HasPrefix(m.Content, "SKIP_WEB_SEARCH_DECIDER\n\n")
-	messages, warnings := b.buildConversationChainWithWebSearch(s, m, acceptImages, acceptUsernames, true, forceDisableWebSearch, progressMgr)
+	messages, warnings := b.buildConversationChainWithWebSearch(s, m, acceptImages, acceptUsernames, !cfg.WebSearch.Disabled, forceDisableWebSearch, progressMgr)
 
-	// Get user's custom system prompt or fall back to default
-	userSystemPrompt := b.userPrefs.GetUserSystemPrompt(context.Background(), m.Author.ID)
-	cfg = b.config.Load()
-	systemPrompt := cfg.SystemPrompt
-	if userSystemPrompt != "" {
-		systemPrompt = userSystemPrompt
-	}
+	// Get the persona's or user's custom system prompt or fall back to default
+	cfg = b.configFor(m.GuildID, m.ChannelID)
+	systemPrompt := b.systemPromptFor(context.Background(), m.Author.ID, persona, cfg)
 
 	// Add system prompt
 	messages = b.llmClient.AddSystemPrompt(messages, systemPrompt, acceptUsernames)
 
 	// Apply context management before sending to LLM
 	ctx := context.Background()
-	cfg = b.config.Load()
-	contextManager := contextmgr.NewContextManager(b.llmClient, cfg)
+	cfg = b.configFor(m.GuildID, m.ChannelID)
+	contextManager := contextmgr.NewContextManager(b.llmClient, cfg, b.summaryCache)
 
 	managedResult, err := contextManager.ManageContext(ctx, messages, currentModel)
 	if err != nil {
@@ -457,7 +713,7 @@ func (b *Bot) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 	}
 
 	// Generate response with web search information
-	b.generateResponse(s, m, currentModel, messages, warnings, progressMgr, messageRef, targetChannelID, webSearchPerformed, searchResultCount)
+	b.generateResponse(s, m, currentModel, messages, warnings, progressMgr, messageRef, targetChannelID, webSearchPerformed, searchResultCount, variant, persona)
 }
 
 // updateProgressWithError updates the progress message with an error
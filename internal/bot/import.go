@@ -0,0 +1,308 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// transcriptHeadingPattern matches the message headings of Markdown transcripts written by /export
+var transcriptHeadingPattern = regexp.MustCompile(`(?m)^### (` + userIcon + `|` + assistantIcon + `) .*$`)
+
+// importedMessage is one message read from an uploaded transcript
+type importedMessage struct {
+	Role   string
+	Text   string
+	Images []messaging.ImageContent
+}
+
+// handleImportCommand handles the /import slash command. The uploaded transcript becomes a
+// chain of nodes ending at the bot's confirmation, so replying to it continues the conversation.
+func (b *Bot) handleImportCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+
+	var userID string
+	if i.User != nil {
+		userID = i.User.ID
+	} else if i.Member != nil && i.Member.User != nil {
+		userID = i.Member.User.ID
+	}
+
+	var attachment *discordgo.MessageAttachment
+	if len(data.Options) > 0 && data.Resolved != nil {
+		if id, ok := data.Options[0].Value.(string); ok {
+			attachment = data.Resolved.Attachments[id]
+		}
+	}
+	if attachment == nil || attachment.Size > config.MaxFileSize {
+		content := fmt.Sprintf("❌ Transcripts can be at most %dMB.", config.MaxFileSize/(1024*1024))
+		if attachment == nil {
+			content = "❌ Attach a transcript to import."
+		}
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		}); err != nil {
+			log.Printf("Failed to respond to interaction: %v", err)
+		}
+		return
+	}
+
+	// Not ephemeral: the confirmation is the message users reply to
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	}); err != nil {
+		log.Printf("Failed to send deferred response: %v", err)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.ExportTimeout*time.Minute)
+		defer cancel()
+
+		edit := func(content string) (*discordgo.Message, error) {
+			return s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+		}
+		fail := func(content string) {
+			if _, err := edit(content); err != nil {
+				log.Printf("Failed to edit interaction response: %v", err)
+			}
+		}
+
+		raw, err := b.downloadAttachment(ctx, attachment.URL, config.MaxFileSize)
+		if err != nil {
+			log.Printf("Failed to download transcript %s: %v", attachment.Filename, err)
+			fail("❌ Could not download the transcript.")
+			return
+		}
+
+		messages, skipped, err := parseTranscript(attachment.Filename, raw)
+		if err != nil {
+			log.Printf("Failed to parse transcript %s: %v", attachment.Filename, err)
+			fail(fmt.Sprintf("❌ Could not import `%s`: %v", attachment.Filename, err))
+			return
+		}
+		if len(messages) == 0 {
+			fail(fmt.Sprintf("❌ `%s` has no user or assistant messages to import.", attachment.Filename))
+			return
+		}
+		if len(messages) > config.MaxImportMessages {
+			skipped += len(messages) - config.MaxImportMessages
+			messages = messages[len(messages)-config.MaxImportMessages:]
+		}
+
+		summary := fmt.Sprintf("📥 Imported %d messages from `%s`", len(messages), attachment.Filename)
+		if skipped > 0 {
+			summary += fmt.Sprintf(" (%d skipped: system prompts, tool calls and older messages are not imported)", skipped)
+		}
+		summary += ".\nReply to this message to continue the conversation."
+
+		confirmation, err := edit(summary)
+		if err != nil {
+			log.Printf("Failed to send import confirmation: %v", err)
+			return
+		}
+
+		b.seedImportedChain(confirmation.ChannelID, confirmation.ID, summary, userID, messages)
+		log.Printf("Imported %d messages from %s for user %s as message %s", len(messages), attachment.Filename, userID, confirmation.ID)
+	}()
+}
+
+// seedImportedChain stores imported messages as a chain of nodes. A last assistant message is
+// stored under the confirmation message and the others under IDs that exist only as nodes.
+// When the transcript ends with a user message, the confirmation is stored as the bot's reply to it.
+func (b *Bot) seedImportedChain(channelID, confirmationID, confirmationText, userID string, messages []importedMessage) {
+	endsWithAssistant := messages[len(messages)-1].Role == "assistant"
+
+	var parent *discordgo.Message
+	for idx, message := range messages {
+		id := fmt.Sprintf("%s%s-%d", messaging.ImportedMessagePrefix, confirmationID, idx)
+		if endsWithAssistant && idx == len(messages)-1 {
+			id = confirmationID
+		}
+
+		node := messaging.NewMsgNode()
+		node.Role = message.Role
+		if message.Role == "user" {
+			node.UserID = userID
+		}
+		node.SetText(message.Text)
+		node.SetImages(message.Images)
+		node.Imported = true
+		node.ParentMsg = parent
+
+		b.saveImportedNode(id, node)
+		parent = &discordgo.Message{ID: id, ChannelID: channelID}
+	}
+
+	if !endsWithAssistant {
+		node := messaging.NewMsgNode()
+		node.Role = "assistant"
+		node.SetText(confirmationText)
+		node.ParentMsg = parent
+		b.saveImportedNode(confirmationID, node)
+	}
+}
+
+// saveImportedNode stores a node of an imported chain in memory and in the persistent cache
+func (b *Bot) saveImportedNode(id string, node *messaging.MsgNode) {
+	b.nodeManager.Set(id, node)
+	if b.messageCache != nil {
+		if err := b.messageCache.SaveNode(context.Background(), id, node); err != nil {
+			log.Printf("Failed to save imported node to cache: %v", err)
+		}
+	}
+}
+
+// parseTranscript reads an OpenAI messages JSON file or a Markdown transcript from /export.
+// It returns the messages and how many were skipped.
+func parseTranscript(filename string, data []byte) ([]importedMessage, int, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return parseTranscriptJSON(data)
+	case ".md", ".markdown", ".txt":
+		messages, err := parseTranscriptMarkdown(string(data))
+		return messages, 0, err
+	}
+
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return parseTranscriptJSON(data)
+	}
+	messages, err := parseTranscriptMarkdown(trimmed)
+	return messages, 0, err
+}
+
+// parseTranscriptJSON reads OpenAI chat messages, either as a bare array or under "messages"
+// as in JSON exports. System, developer and tool messages are skipped.
+func parseTranscriptJSON(data []byte) ([]importedMessage, int, error) {
+	var openaiMessages []messaging.OpenAIMessage
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		if err := json.Unmarshal(data, &openaiMessages); err != nil {
+			return nil, 0, fmt.Errorf("invalid JSON: %w", err)
+		}
+	} else {
+		var file struct {
+			Messages []messaging.OpenAIMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, 0, fmt.Errorf("invalid JSON: %w", err)
+		}
+		if file.Messages == nil {
+			return nil, 0, errors.New(`expected a list of messages or an object with "messages"`)
+		}
+		openaiMessages = file.Messages
+	}
+
+	var messages []importedMessage
+	skipped := 0
+	for _, openaiMessage := range openaiMessages {
+		if openaiMessage.Role != "user" && openaiMessage.Role != "assistant" {
+			skipped++
+			continue
+		}
+		message := importedMessage{Role: openaiMessage.Role}
+		message.Text, message.Images = importedContent(openaiMessage.Content)
+		if message.Text == "" && len(message.Images) == 0 {
+			// Assistant turns that only call tools
+			skipped++
+			continue
+		}
+		messages = append(messages, withImageText(message))
+	}
+	return messages, skipped, nil
+}
+
+// importedContent reads OpenAI message content, a string or a list of parts. Inline images are
+// kept; linked images are mentioned in the text since their links may no longer work.
+func importedContent(content any) (string, []messaging.ImageContent) {
+	switch value := content.(type) {
+	case string:
+		return strings.TrimSpace(value), nil
+	case []any:
+		var texts []string
+		var images []messaging.ImageContent
+		for _, item := range value {
+			part, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			switch part["type"] {
+			case "text":
+				if text, ok := part["text"].(string); ok && strings.TrimSpace(text) != "" {
+					texts = append(texts, strings.TrimSpace(text))
+				}
+			case "image_url":
+				imageURL, _ := part["image_url"].(map[string]any)
+				url, _ := imageURL["url"].(string)
+				switch {
+				case strings.HasPrefix(url, "data:image/"):
+					images = append(images, messaging.ImageContent{Type: "image_url", ImageURL: messaging.ImageURL{URL: url}})
+				case url != "":
+					texts = append(texts, "[image: "+url+"]")
+				}
+			}
+		}
+		return strings.Join(texts, "\n\n"), images
+	}
+	return "", nil
+}
+
+// parseTranscriptMarkdown reads a Markdown transcript written by /export
+func parseTranscriptMarkdown(text string) ([]importedMessage, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	headings := transcriptHeadingPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(headings) == 0 {
+		return nil, errors.New("not a JSON file or a Markdown transcript from /export")
+	}
+
+	var messages []importedMessage
+	for idx, heading := range headings {
+		end := len(text)
+		if idx+1 < len(headings) {
+			end = headings[idx+1][0]
+		}
+
+		body := strings.TrimSpace(text[heading[1]:end])
+		body = strings.TrimSpace(strings.TrimSuffix(body, "---"))
+		// Sources are listed last and are not part of the message
+		if strings.HasPrefix(body, "**Sources**\n") {
+			body = ""
+		} else if cut := strings.LastIndex(body, "\n**Sources**\n"); cut != -1 {
+			body = strings.TrimSpace(body[:cut])
+		}
+		if body == "" {
+			continue
+		}
+
+		role := "user"
+		if text[heading[2]:heading[3]] == assistantIcon {
+			role = "assistant"
+		}
+		messages = append(messages, importedMessage{Role: role, Text: body})
+	}
+	return messages, nil
+}
+
+// withImageText gives image-only messages a placeholder text, since nodes without text
+// are reprocessed from their Discord message and the last imported node is stored under one
+func withImageText(message importedMessage) importedMessage {
+	if message.Text == "" && len(message.Images) > 0 {
+		message.Text = "[image]"
+	}
+	return message
+}
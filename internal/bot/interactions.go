@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -8,7 +9,7 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 
-	"DiscordAIChatbot/internal/utils"
+	"DiscordAIChatbot/internal/config"
 )
 
 // handleButtonInteraction handles button click interactions
@@ -24,6 +25,18 @@ func (b *Bot) handleButtonInteraction(s *discordgo.Session, i *discordgo.Interac
 		b.handleShowSources(s, i)
 	case strings.HasPrefix(data.CustomID, "paginate_sources_"):
 		b.handlePaginateSources(s, i)
+	case strings.HasPrefix(data.CustomID, "stop_generation_"):
+		b.handleStopGeneration(s, i)
+	case strings.HasPrefix(data.CustomID, "regenerate_edit_"):
+		b.handleRegenerateEdit(s, i)
+	case strings.HasPrefix(data.CustomID, "variant_select_"):
+		b.handleVariantSelect(s, i)
+	case strings.HasPrefix(data.CustomID, "regenerate_response_"):
+		b.handleRegenerateResponse(s, i)
+	case strings.HasPrefix(data.CustomID, "reroll_model_"):
+		b.handleRerollModel(s, i)
+	case strings.HasPrefix(data.CustomID, "export_conversation_"):
+		b.handleExportButton(s, i)
 	}
 }
 
@@ -118,14 +131,16 @@ func (b *Bot) handleViewOutputBetter(s *discordgo.Session, i *discordgo.Interact
 		return
 	}
 
-	// Post to text.is
-	textIsURL, err := utils.PostToTextIs(content)
+	// Publish with the configured uploader
+	ctx, cancel := context.WithTimeout(context.Background(), config.DefaultHTTPTimeout*time.Second)
+	defer cancel()
+	pageURL, err := b.textUploader.UploadText(ctx, content)
 	if err != nil {
-		log.Printf("Failed to post to text.is: %v", err)
+		log.Printf("Failed to upload response to %s: %v", b.textUploader.Name(), err)
 		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: "❌ Failed to create text.is link. Please try again later.",
+				Content: "❌ Failed to create link. Please try again later.",
 				Flags:   discordgo.MessageFlagsEphemeral,
 			},
 		}); err != nil {
@@ -138,7 +153,7 @@ func (b *Bot) handleViewOutputBetter(s *discordgo.Session, i *discordgo.Interact
 	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("🔗 **View output better:** %s\n\nThis link displays the response with improved formatting and readability.", textIsURL),
+			Content: fmt.Sprintf("🔗 **View output better:** %s\n\nThis link displays the response with improved formatting and readability.", pageURL),
 			Flags:   discordgo.MessageFlagsEphemeral,
 		},
 	}); err != nil {
@@ -15,7 +15,6 @@ import (
 
 	"DiscordAIChatbot/internal/messaging"
 	"DiscordAIChatbot/internal/processors"
-	"DiscordAIChatbot/internal/uploader"
 	"DiscordAIChatbot/internal/utils"
 )
 
@@ -99,8 +98,7 @@ func (b *Bot) processMessage(s *discordgo.Session, msg *discordgo.Message, node
 
 	// Task 3: Process Current Message Attachments
 	eg.Go(func() error {
-		userModel := b.resolveUserModel(gctx, msg.Author.ID, b.config.Load())
-		currentImages, currentAudio, currentPDFs, currentText, currentBad, currentShouldProcessURLs, err := processors.ProcessAttachments(gctx, msg.Attachments, b.fileProcessor, b.llmClient, userModel)
+		currentImages, currentAudio, currentPDFs, currentText, currentBad, currentShouldProcessURLs, err := processors.ProcessAttachments(gctx, msg.Attachments, b.fileProcessor)
 		mu.Lock()
 		defer mu.Unlock()
 		images = append(images, currentImages...)
@@ -124,8 +122,7 @@ func (b *Bot) processMessage(s *discordgo.Session, msg *discordgo.Message, node
 	if isCurrentMessage && parentMsg != nil && len(parentMsg.Attachments) > 0 && !isDirectReply {
 		eg.Go(func() error {
 			log.Printf("Processing %d attachments from parent message for non-reply context", len(parentMsg.Attachments))
-			userModel := b.resolveUserModel(gctx, msg.Author.ID, b.config.Load())
-			parentImages, parentAudio, parentPDFs, parentText, parentBad, parentShouldProcessURLs, err := processors.ProcessAttachments(gctx, parentMsg.Attachments, b.fileProcessor, b.llmClient, userModel)
+			parentImages, parentAudio, parentPDFs, parentText, parentBad, parentShouldProcessURLs, err := processors.ProcessAttachments(gctx, parentMsg.Attachments, b.fileProcessor)
 			mu.Lock()
 			defer mu.Unlock()
 			images = append(parentImages, images...)
@@ -149,8 +146,8 @@ func (b *Bot) processMessage(s *discordgo.Session, msg *discordgo.Message, node
 		eg.Go(func() error {
 			detectedURLs := processors.DetectURLs(contentForURLExtraction)
 			if len(detectedURLs) > 0 {
-				cfg := b.config.Load()
-				userModel := b.resolveUserModel(gctx, msg.Author.ID, cfg)
+				cfg := b.configFor(msg.GuildID, msg.ChannelID)
+				userModel := b.resolveUserModel(gctx, modelRequester(msg), cfg)
 				// Safely derive model name (part after provider/ if present)
 				modelName := userModel
 				if parts := strings.SplitN(userModel, "/", 2); len(parts) == 2 {
@@ -214,8 +211,15 @@ func (b *Bot) processMessage(s *discordgo.Session, msg *discordgo.Message, node
 			safeAttachmentText := attachmentText
 			mu.Unlock()
 
-			cfg := b.config.Load()
-			userModel := b.resolveUserModel(gctx, msg.Author.ID, cfg)
+			cfg := b.configFor(msg.GuildID, msg.ChannelID)
+			if cfg.WebSearch.Disabled {
+				return nil
+			}
+			userModel := b.resolveUserModel(gctx, modelRequester(msg), cfg)
+			persona := b.activePersona(gctx, msg.Author.ID, msg.ChannelID)
+			if model := b.personaModel(modelRequester(msg), persona, cfg); model != "" {
+				userModel = model
+			}
 			if (strings.HasPrefix(userModel, "gemini/") || strings.HasPrefix(userModel, "gemini-")) && cfg.WebSearch.GeminiGrounding {
 				log.Printf("Skipping web search decider for Gemini model with native grounding enabled (model=%s grounding=%v)", userModel, cfg.WebSearch.GeminiGrounding)
 				return nil
@@ -224,13 +228,13 @@ func (b *Bot) processMessage(s *discordgo.Session, msg *discordgo.Message, node
 				log.Printf("Skipping web search for image generation model: %s", userModel)
 				return nil
 			}
+			if b.toolsEnabledForModel(userModel) {
+				log.Printf("Skipping web search decider, %s can call the web_search tool itself", userModel)
+				return nil
+			}
 
 			chatHistory := b.buildChatHistoryForWebSearch(s, msg)
-			userSystemPrompt := b.userPrefs.GetUserSystemPrompt(gctx, msg.Author.ID)
-			systemPrompt := cfg.SystemPrompt
-			if userSystemPrompt != "" {
-				systemPrompt = userSystemPrompt
-			}
+			systemPrompt := b.systemPromptFor(gctx, msg.Author.ID, persona, cfg)
 
 			contentForWebSearchDecision := tempFullContent
 			if hasSkipDirective {
@@ -259,7 +263,7 @@ func (b *Bot) processMessage(s *discordgo.Session, msg *discordgo.Message, node
 				} else {
 					webSearchResults = results
 					webSearchRequired = true
-					webSearchResultCount = len(decision.SearchQueries) * cfg.WebSearch.MaxResults
+					webSearchResultCount = processors.CountSearchResults(results)
 				}
 			} else {
 				log.Printf("Web search not required for this query")
@@ -401,18 +405,18 @@ func (b *Bot) handleVeoGeneration(s *discordgo.Session, msg *discordgo.Message,
 
 		// Check video size
 		if len(videoData) > 9*1024*1024 { // 9 MB
-			// Upload to Catbox
-			url, err := uploader.UploadToCatbox("video.mp4", videoData)
+			// Too large for Discord, so upload it
+			url, err := b.fileUploader.UploadFile(ctx, "video.mp4", videoData)
 			if err != nil {
-				log.Printf("Failed to upload video to Catbox: %v", err)
-				if _, err := s.ChannelMessageSend(msg.ChannelID, fmt.Sprintf("❌ Failed to upload video to Catbox: %v", err)); err != nil {
-					log.Printf("Failed to send Catbox upload failure message: %v", err)
+				log.Printf("Failed to upload video to %s: %v", b.fileUploader.Name(), err)
+				if _, err := s.ChannelMessageSend(msg.ChannelID, fmt.Sprintf("❌ Failed to upload video: %v", err)); err != nil {
+					log.Printf("Failed to send video upload failure message: %v", err)
 				}
 				return
 			}
 
-			if _, err := s.ChannelMessageSend(msg.ChannelID, fmt.Sprintf("✅ Video generated and uploaded to Catbox: %s", url)); err != nil {
-				log.Printf("Failed to send Catbox URL message: %v", err)
+			if _, err := s.ChannelMessageSend(msg.ChannelID, fmt.Sprintf("✅ Video generated and uploaded: %s", url)); err != nil {
+				log.Printf("Failed to send video URL message: %v", err)
 			}
 		} else {
 			// Send directly to Discord
@@ -519,13 +523,13 @@ func (b *Bot) handleGoogleLensQuery(ctx context.Context, msg *discordgo.Message,
 func (b *Bot) handleAskChannelQuery(ctx context.Context, s *discordgo.Session, msg *discordgo.Message, channelQuery string) (string, error) {
 	log.Printf("Detected askchannel query: %s", channelQuery)
 
-	cfg := b.config.Load()
+	cfg := b.configFor(msg.GuildID, msg.ChannelID)
 
-	userModel := b.resolveUserModel(ctx, msg.Author.ID, cfg)
+	userModel := b.resolveUserModel(ctx, modelRequester(msg), cfg)
 	modelTokenLimit := cfg.GetModelTokenLimit(userModel)
 	tokenThreshold := cfg.GetChannelTokenThreshold()
 
-	channelResult, err := b.channelProcessor.FetchChannelMessages(ctx, s, msg.ChannelID, channelQuery, s.State.User.ID, modelTokenLimit, tokenThreshold, cfg)
+	channelResult, err := b.channelProcessor.FetchChannelMessages(ctx, s, msg.ChannelID, channelQuery, s.State.User.ID, userModel, modelTokenLimit, tokenThreshold, cfg)
 	if err != nil {
 		log.Printf("Failed to fetch channel messages: %v", err)
 		return fmt.Sprintf("user query: %s\n\n⚠️ Failed to fetch channel messages: %v", channelQuery, err), nil
@@ -0,0 +1,422 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"DiscordAIChatbot/internal/auth"
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/storage"
+)
+
+// personaNone clears a persona choice or channel binding
+const personaNone = "none"
+
+// personaMinTemperature is the lowest temperature /persona create accepts; Discord takes the minimum by pointer
+var personaMinTemperature float64
+
+// personaNamePattern limits persona names to what reads well in a footer and autocompletes cleanly
+var personaNamePattern = regexp.MustCompile(`^[\w][\w .-]*$`)
+
+// activePersona returns the persona answering a user in a channel, or nil if there is none
+func (b *Bot) activePersona(ctx context.Context, userID, channelID string) *storage.Persona {
+	if b.personas == nil || userID == "" {
+		return nil
+	}
+	persona, err := b.personas.ActivePersona(ctx, userID, channelID)
+	if err != nil {
+		log.Printf("Failed to get active persona for user %s: %v", userID, err)
+		return nil
+	}
+	return persona
+}
+
+// personaModel returns the persona's model if it is configured and the user may use it,
+// otherwise an empty string so the user's own model is used
+func (b *Bot) personaModel(req auth.ModelRequester, persona *storage.Persona, cfg *config.Config) string {
+	if persona == nil || persona.Model == "" || cfg == nil {
+		return ""
+	}
+	if decision := auth.NewModelPolicy(cfg).Check(persona.Model, req); !decision.Allowed {
+		log.Printf("Persona %s uses model %s, which user %s can't use here: %s", persona.Name, persona.Model, req.UserID, decision.Reason)
+		return ""
+	}
+	return persona.Model
+}
+
+// systemPromptFor returns the system prompt for a user: the persona's, then the user's own, then the configured one
+func (b *Bot) systemPromptFor(ctx context.Context, userID string, persona *storage.Persona, cfg *config.Config) string {
+	if persona != nil && persona.SystemPrompt != "" {
+		return persona.SystemPrompt
+	}
+	if userSystemPrompt := b.userPrefs.GetUserSystemPrompt(ctx, userID); userSystemPrompt != "" {
+		return userSystemPrompt
+	}
+	return cfg.SystemPrompt
+}
+
+// handlePersonaCommand handles the /persona slash command and its subcommands
+func (b *Bot) handlePersonaCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+
+	var userID string
+	if i.User != nil {
+		userID = i.User.ID
+	} else if i.Member != nil && i.Member.User != nil {
+		userID = i.Member.User.ID
+	}
+
+	cfg := b.config.Load()
+	if cfg == nil {
+		b.respondEphemeral(s, i, "❌ Configuration is not available")
+		return
+	}
+	if b.personas == nil || userID == "" || len(data.Options) == 0 {
+		b.respondEphemeral(s, i, "❌ Personas are not available")
+		return
+	}
+
+	subcommand := data.Options[0]
+	options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, option := range subcommand.Options {
+		options[option.Name] = option
+	}
+	isAdmin := contains(cfg.Permissions.Users.AdminIDs, userID)
+	ctx := context.Background()
+
+	switch subcommand.Name {
+	case "create":
+		b.handlePersonaCreate(ctx, s, i, cfg, userID, isAdmin, options)
+	case "delete":
+		b.handlePersonaDelete(ctx, s, i, userID, isAdmin, options)
+	case "use":
+		b.handlePersonaUse(ctx, s, i, userID, options)
+	case "list":
+		b.handlePersonaList(ctx, s, i, userID)
+	case "bind":
+		b.handlePersonaBind(ctx, s, i, canManageServerConfig(i, userID, cfg), options)
+	}
+}
+
+// handlePersonaCreate creates or updates a persona. Admins create shared personas with shared:true.
+func (b *Bot) handlePersonaCreate(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, cfg *config.Config, userID string, isAdmin bool, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	persona := storage.Persona{OwnerID: userID}
+	if option, ok := options["name"]; ok {
+		persona.Name = strings.TrimSpace(option.StringValue())
+	}
+	if option, ok := options["prompt"]; ok {
+		persona.SystemPrompt = strings.TrimSpace(option.StringValue())
+	}
+	if option, ok := options["model"]; ok {
+		persona.Model = strings.TrimSpace(option.StringValue())
+	}
+	if option, ok := options["temperature"]; ok {
+		temperature := float32(option.FloatValue())
+		persona.Temperature = &temperature
+	}
+	if option, ok := options["avatar"]; ok {
+		persona.AvatarURL = strings.TrimSpace(option.StringValue())
+	}
+	if option, ok := options["display_name"]; ok {
+		persona.DisplayName = strings.TrimSpace(option.StringValue())
+	}
+	if option, ok := options["shared"]; ok && option.BoolValue() {
+		if !isAdmin {
+			b.respondEphemeral(s, i, "❌ Only administrators can create shared personas")
+			return
+		}
+		persona.OwnerID = ""
+	}
+
+	if err := validatePersona(persona, cfg); err != nil {
+		b.respondEphemeral(s, i, fmt.Sprintf("❌ %v", err))
+		return
+	}
+
+	if !persona.Shared() {
+		existing, err := b.personas.ListPersonas(ctx, userID)
+		if err != nil {
+			log.Printf("Failed to list personas for user %s: %v", userID, err)
+			b.respondEphemeral(s, i, "❌ Failed to save persona")
+			return
+		}
+		owned, replacing := 0, false
+		for _, p := range existing {
+			if !p.Shared() {
+				owned++
+				replacing = replacing || p.Name == persona.Name
+			}
+		}
+		if owned >= config.MaxPersonasPerUser && !replacing {
+			b.respondEphemeral(s, i, fmt.Sprintf("❌ You can have at most %d personas. Delete one first.", config.MaxPersonasPerUser))
+			return
+		}
+	}
+
+	if err := b.personas.SavePersona(ctx, persona); err != nil {
+		log.Printf("Failed to save persona %s: %v", persona.Name, err)
+		b.respondEphemeral(s, i, "❌ Failed to save persona")
+		return
+	}
+
+	scope := "Your persona"
+	if persona.Shared() {
+		scope = "Shared persona"
+	}
+	b.respondEphemeral(s, i, fmt.Sprintf("✅ %s **%s** is saved. Switch to it with `/persona use %s`.", scope, persona.Name, persona.Name))
+}
+
+// validatePersona checks a persona's fields before it is saved
+func validatePersona(persona storage.Persona, cfg *config.Config) error {
+	if len(persona.Name) > config.MaxPersonaNameLength || !personaNamePattern.MatchString(persona.Name) {
+		return fmt.Errorf("persona names are up to %d letters, digits, spaces, dots, dashes or underscores", config.MaxPersonaNameLength)
+	}
+	if strings.EqualFold(persona.Name, personaNone) {
+		return fmt.Errorf("%q is reserved for clearing your persona", personaNone)
+	}
+	if persona.Model != "" {
+		if _, exists := cfg.Models[persona.Model]; !exists {
+			return fmt.Errorf("model %s is not configured", persona.Model)
+		}
+	}
+	if persona.Temperature != nil && (*persona.Temperature < 0 || *persona.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if persona.AvatarURL != "" {
+		parsed, err := url.Parse(persona.AvatarURL)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("the avatar must be an https:// image URL")
+		}
+	}
+	if len(persona.DisplayName) > config.MaxPersonaDisplayNameLength {
+		return fmt.Errorf("display names are up to %d characters", config.MaxPersonaDisplayNameLength)
+	}
+	return nil
+}
+
+// handlePersonaDelete deletes one of the user's personas, or a shared one for admins
+func (b *Bot) handlePersonaDelete(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, userID string, isAdmin bool, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var name string
+	if option, ok := options["name"]; ok {
+		name = strings.TrimSpace(option.StringValue())
+	}
+	ownerID := userID
+	if option, ok := options["shared"]; ok && option.BoolValue() {
+		if !isAdmin {
+			b.respondEphemeral(s, i, "❌ Only administrators can delete shared personas")
+			return
+		}
+		ownerID = ""
+	}
+
+	deleted, err := b.personas.DeletePersona(ctx, ownerID, name)
+	if err != nil {
+		log.Printf("Failed to delete persona %s: %v", name, err)
+		b.respondEphemeral(s, i, "❌ Failed to delete persona")
+		return
+	}
+	if !deleted {
+		b.respondEphemeral(s, i, fmt.Sprintf("❌ No persona named **%s** to delete", name))
+		return
+	}
+	b.respondEphemeral(s, i, fmt.Sprintf("🗑️ Deleted persona **%s**", name))
+}
+
+// handlePersonaUse switches the user to a persona, or back to none
+func (b *Bot) handlePersonaUse(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, userID string, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var name string
+	if option, ok := options["name"]; ok {
+		name = strings.TrimSpace(option.StringValue())
+	}
+
+	if strings.EqualFold(name, personaNone) {
+		if err := b.personas.ClearUserPersona(ctx, userID); err != nil {
+			log.Printf("Failed to clear persona for user %s: %v", userID, err)
+			b.respondEphemeral(s, i, "❌ Failed to clear persona")
+			return
+		}
+		b.respondEphemeral(s, i, "✅ You are no longer using a persona. The channel's persona, if any, applies again.")
+		return
+	}
+
+	persona, err := b.personas.FindPersona(ctx, userID, name)
+	if err != nil {
+		log.Printf("Failed to find persona %s: %v", name, err)
+		b.respondEphemeral(s, i, "❌ Failed to switch persona")
+		return
+	}
+	if persona == nil {
+		b.respondEphemeral(s, i, fmt.Sprintf("❌ No persona named **%s**. See `/persona list`.", name))
+		return
+	}
+
+	if err := b.personas.SetUserPersona(ctx, userID, persona); err != nil {
+		log.Printf("Failed to set persona for user %s: %v", userID, err)
+		b.respondEphemeral(s, i, "❌ Failed to switch persona")
+		return
+	}
+	b.respondEphemeral(s, i, fmt.Sprintf("🎭 You are now talking to **%s**", persona.Name))
+}
+
+// handlePersonaList shows the personas a user can use and which one is active here
+func (b *Bot) handlePersonaList(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, userID string) {
+	personas, err := b.personas.ListPersonas(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to list personas for user %s: %v", userID, err)
+		b.respondEphemeral(s, i, "❌ Failed to list personas")
+		return
+	}
+	if len(personas) == 0 {
+		b.respondEphemeral(s, i, "You have no personas yet. Create one with `/persona create`.")
+		return
+	}
+
+	active := b.activePersona(ctx, userID, i.ChannelID)
+
+	var lines []string
+	for _, persona := range personas {
+		line := "• **" + persona.Name + "**"
+		if persona.Shared() {
+			line += " (shared)"
+		}
+		if persona.Model != "" {
+			line += " · " + persona.Model
+		}
+		if persona.Temperature != nil {
+			line += fmt.Sprintf(" · temperature %.2g", *persona.Temperature)
+		}
+		if active != nil && active.OwnerID == persona.OwnerID && active.Name == persona.Name {
+			line += " ← active"
+		}
+		lines = append(lines, line)
+	}
+	b.respondEphemeral(s, i, "🎭 **Personas**\n"+strings.Join(lines, "\n"))
+}
+
+// handlePersonaBind makes a shared persona the default in the current channel. Bot admins and
+// members who can manage the server may bind, like they may change its /serverconfig overrides.
+func (b *Bot) handlePersonaBind(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, canManage bool, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	if !canManage {
+		b.respondEphemeral(s, i, "❌ You need the Manage Server permission to use this command")
+		return
+	}
+
+	var name string
+	if option, ok := options["name"]; ok {
+		name = strings.TrimSpace(option.StringValue())
+	}
+
+	if strings.EqualFold(name, personaNone) {
+		if err := b.personas.ClearChannelPersona(ctx, i.ChannelID); err != nil {
+			log.Printf("Failed to clear persona of channel %s: %v", i.ChannelID, err)
+			b.respondEphemeral(s, i, "❌ Failed to unbind persona")
+			return
+		}
+		b.respondEphemeral(s, i, "✅ This channel no longer has a persona")
+		return
+	}
+
+	persona, err := b.personas.GetSharedPersona(ctx, name)
+	if err != nil {
+		log.Printf("Failed to get shared persona %s: %v", name, err)
+		b.respondEphemeral(s, i, "❌ Failed to bind persona")
+		return
+	}
+	if persona == nil {
+		b.respondEphemeral(s, i, fmt.Sprintf("❌ No shared persona named **%s**. Only shared personas can be bound to channels.", name))
+		return
+	}
+
+	if err := b.personas.SetChannelPersona(ctx, i.ChannelID, persona.Name); err != nil {
+		log.Printf("Failed to bind persona %s to channel %s: %v", persona.Name, i.ChannelID, err)
+		b.respondEphemeral(s, i, "❌ Failed to bind persona")
+		return
+	}
+	b.respondEphemeral(s, i, fmt.Sprintf("📌 **%s** now answers everyone in this channel who hasn't chosen their own persona", persona.Name))
+}
+
+// handlePersonaAutocomplete suggests persona names and models for /persona
+func (b *Bot) handlePersonaAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+
+	var userID string
+	if i.User != nil {
+		userID = i.User.ID
+	} else if i.Member != nil && i.Member.User != nil {
+		userID = i.Member.User.ID
+	}
+
+	var subcommand string
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	if len(data.Options) > 0 {
+		subcommand = data.Options[0].Name
+		for _, option := range data.Options[0].Options {
+			if option.Focused {
+				focused = option
+			}
+		}
+	}
+
+	var candidates []string
+	if focused != nil {
+		switch focused.Name {
+		case "model":
+			if cfg := b.config.Load(); cfg != nil {
+				for model := range cfg.Models {
+					candidates = append(candidates, model)
+				}
+				sort.Strings(candidates)
+			}
+		case "name":
+			if subcommand == "use" || subcommand == "bind" {
+				candidates = append(candidates, personaNone)
+			}
+			if b.personas != nil && userID != "" {
+				personas, err := b.personas.ListPersonas(context.Background(), userID)
+				if err != nil {
+					log.Printf("Failed to list personas for autocomplete: %v", err)
+				}
+				for _, persona := range personas {
+					if subcommand == "bind" && !persona.Shared() {
+						continue
+					}
+					candidates = append(candidates, persona.Name)
+				}
+			}
+		}
+	}
+
+	var partial string
+	if focused != nil {
+		partial = strings.ToLower(focused.StringValue())
+	}
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, 25)
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if seen[candidate] || !strings.Contains(strings.ToLower(candidate), partial) {
+			continue
+		}
+		seen[candidate] = true
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: candidate, Value: candidate})
+		// Discord shows at most 25 choices
+		if len(choices) == 25 {
+			break
+		}
+	}
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	}); err != nil {
+		log.Printf("Failed to respond to autocomplete interaction: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/utils"
+)
+
+// reasoningDisplay returns how the model's reasoning is shown for a message.
+// Plain responses have no embed or room for a file, so they never show it.
+func (b *Bot) reasoningDisplay(m *discordgo.Message) string {
+	cfg := b.configFor(m.GuildID, m.ChannelID)
+	if cfg.UsePlainResponses {
+		return config.ReasoningDisplayOff
+	}
+	return cfg.Reasoning.Display
+}
+
+// reasoningTail returns the end of the reasoning, which is what the model is thinking about now
+func reasoningTail(reasoning string, limit int) string {
+	reasoning = strings.TrimSpace(reasoning)
+	if len(reasoning) > limit {
+		start := len(reasoning) - limit
+		for start < len(reasoning) && !utf8.RuneStart(reasoning[start]) {
+			start++
+		}
+		reasoning = "…" + reasoning[start:]
+	}
+	// Keep the reasoning from closing the spoiler early
+	return strings.ReplaceAll(reasoning, "||", "|\u200b|")
+}
+
+// reasoningField shows reasoning as a spoilered embed field, collapsed until clicked
+func reasoningField(reasoning string, thinking bool) *discordgo.MessageEmbedField {
+	name := "💭 Thought process"
+	if thinking {
+		name = "💭 Thinking…"
+	}
+	return &discordgo.MessageEmbedField{
+		Name:  name,
+		Value: "||" + reasoningTail(reasoning, config.ReasoningPreviewLength) + "||",
+	}
+}
+
+// updateProgressWithReasoning shows that the model is thinking before its answer starts
+func (b *Bot) updateProgressWithReasoning(s *discordgo.Session, progressMgr *utils.ProgressManager, reasoning, display string) {
+	if progressMgr == nil || progressMgr.GetMessageID() == "" {
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Description: fmt.Sprintf("%s\n💭 Thinking…", utils.ProgressProcessing),
+		Color:       utils.EmbedColorProcessing,
+	}
+	if display == config.ReasoningDisplayEmbed {
+		embed.Fields = []*discordgo.MessageEmbedField{reasoningField(reasoning, true)}
+	}
+	if _, err := s.ChannelMessageEditEmbed(progressMgr.GetChannelID(), progressMgr.GetMessageID(), embed); err != nil {
+		log.Printf("Failed to update progress message with reasoning: %v", err)
+	}
+}
+
+// sendReasoningFile sends the full reasoning as a spoilered Markdown file replying to the response
+func (b *Bot) sendReasoningFile(s *discordgo.Session, channelID string, ref *discordgo.MessageReference, reasoning string) {
+	_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: "💭 **Thought process**",
+		Files: []*discordgo.File{{
+			// Discord blurs attachments whose name starts with SPOILER_
+			Name:        "SPOILER_thinking.md",
+			ContentType: "text/markdown",
+			Reader:      strings.NewReader(strings.TrimSpace(reasoning)),
+		}},
+		Reference: ref,
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse:       []discordgo.AllowedMentionType{},
+			RepliedUser: false,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to send reasoning file: %v", err)
+	}
+}
@@ -11,8 +11,11 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 
+	"DiscordAIChatbot/internal/config"
 	"DiscordAIChatbot/internal/llm"
+	"DiscordAIChatbot/internal/llm/providers"
 	"DiscordAIChatbot/internal/messaging"
+	"DiscordAIChatbot/internal/storage"
 	"DiscordAIChatbot/internal/utils"
 )
 
@@ -22,11 +25,71 @@ var builderPool = sync.Pool{
 	},
 }
 
+// updateProgressWithToolCalls shows which tools are running while no content has been streamed yet
+func (b *Bot) updateProgressWithToolCalls(s *discordgo.Session, progressMgr *utils.ProgressManager, calls []messaging.ToolCall) {
+	if progressMgr == nil || progressMgr.GetMessageID() == "" {
+		return
+	}
+
+	names := make([]string, 0, len(calls))
+	for _, call := range calls {
+		names = append(names, "`"+call.Name+"`")
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Description: fmt.Sprintf("%s\n🔧 Using %s", utils.ProgressProcessing, strings.Join(utils.UniqueStrings(names), ", ")),
+		Color:       utils.EmbedColorProcessing,
+	}
+	if _, err := s.ChannelMessageEditEmbed(progressMgr.GetChannelID(), progressMgr.GetMessageID(), embed); err != nil {
+		log.Printf("Failed to update progress message with tool calls: %v", err)
+	}
+}
+
 // generateResponse generates and sends LLM response
-func (b *Bot) generateResponse(s *discordgo.Session, originalMsg *discordgo.MessageCreate, model string, messages []messaging.OpenAIMessage, warnings []string, progressMgr *utils.ProgressManager, messageRef *discordgo.MessageReference, targetChannelID string, webSearchPerformed bool, searchResultCount int) {
+func (b *Bot) generateResponse(s *discordgo.Session, originalMsg *discordgo.MessageCreate, model string, messages []messaging.OpenAIMessage, warnings []string, progressMgr *utils.ProgressManager, messageRef *discordgo.MessageReference, targetChannelID string, webSearchPerformed bool, searchResultCount int, variant *variantRequest, persona *storage.Persona) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
+	// Let the stop button cancel this response
+	ctx, finishGeneration := b.generations.Start(ctx, originalMsg.ID, originalMsg.Author.ID)
+	defer finishGeneration()
+	b.setProgressComponents(s, progressMgr, utils.CreateStopButton(originalMsg.ID))
+	stopButtonReplaced := false
+	defer func() {
+		if stopButtonReplaced {
+			return
+		}
+		// A failed regeneration keeps the earlier variants reachable
+		components := []discordgo.MessageComponent{}
+		if variant != nil && len(variant.previous) > 0 {
+			components = utils.CreateVariantComponents(variant.messageID, variant.selected, len(variant.previous), rerollModels(b.configFor(originalMsg.GuildID, originalMsg.ChannelID)))
+		}
+		b.setProgressComponents(s, progressMgr, components)
+	}()
+
+	// Personas sample at their own temperature
+	if persona != nil && persona.Temperature != nil {
+		ctx = providers.WithTemperature(ctx, *persona.Temperature)
+	}
+	// Servers and channels with web search turned off don't get Gemini grounding either
+	if b.configFor(originalMsg.GuildID, originalMsg.ChannelID).WebSearch.Disabled {
+		ctx = providers.DisableGeminiGroundingInContext(ctx)
+	}
+	// Regenerated variants sample with a fresh seed where the provider supports it
+	if variant != nil {
+		ctx = providers.WithSeed(ctx, variant.seed)
+	}
+
+	// Ask for the model's reasoning when it is shown
+	reasoningDisplay := b.reasoningDisplay(originalMsg.Message)
+	if reasoningDisplay != config.ReasoningDisplayOff {
+		ctx = providers.WithReasoning(ctx)
+	}
+
+	// Models that can't take audio or PDFs natively get transcripts and extracted text instead
+	messages, modalityWarnings := b.llmClient.AdaptModalities(ctx, b.configFor(originalMsg.GuildID, originalMsg.ChannelID), model, messages, b.extractDocumentText)
+	warnings = append(warnings, modalityWarnings...)
+
 	// targetChannelID is now passed as a parameter from handleMessage
 	// which handles thread creation logic
 
@@ -34,14 +97,21 @@ func (b *Bot) generateResponse(s *discordgo.Session, originalMsg *discordgo.Mess
 	actualModel := model
 	fallbackAttempted := false
 
+	// Tools the model may call while answering; nil when tool calling is disabled
+	toolRegistry, toolState := b.buildToolRegistry(s, originalMsg, model)
+	toolRounds := 0
+	toolLimitReached := false
+
+	// The fallback model must be one the user may use here
+	fallbackModel := b.fallbackModelFor(originalMsg.Message, model)
+
 	// Helper function to attempt streaming with potential fallback
 	attemptStream := func(attemptModel string, isFallback bool) (<-chan llm.StreamResponse, error) {
 		if isFallback {
 			log.Printf("Attempting fallback to model: %s", attemptModel)
 		}
 
-		fallbackModel := b.config.Load().FallbackModel
-		stream, fallbackResult, err := b.llmClient.StreamChatCompletionWithFallback(ctx, attemptModel, messages, nil, fallbackModel)
+		stream, fallbackResult, err := b.llmClient.StreamChatCompletionWithFallback(ctx, attemptModel, messages, nil, fallbackModel, toolRegistry)
 		if err != nil {
 			return nil, err
 		}
@@ -125,7 +195,7 @@ processStream:
 	}
 
 	// Atomically load config
-	cfg := b.config.Load()
+	cfg := b.configFor(originalMsg.GuildID, originalMsg.ChannelID)
 	usePlainResponses := cfg.UsePlainResponses
 
 	maxLength := utils.MaxMessageLength
@@ -147,6 +217,11 @@ processStream:
 	var generatedImages [][]byte // Store generated images
 	var imageMIMETypes []string  // Store MIME types for images
 	var groundingMetadata *messaging.GroundingMetadata
+	var roundText strings.Builder // Text streamed in the current tool round
+	var reasoning strings.Builder // Kept apart from the reply, so it never reaches the conversation history
+	var lastReasoningEdit time.Time
+	var usage llm.ResponseMetadata      // Reported by the provider, summed over tool rounds
+	var lastRound *llm.ResponseMetadata // The last request holds the whole conversation
 	lastEditTime := time.Now()
 	firstContentReceived := false
 
@@ -154,7 +229,7 @@ processStream:
 
 	// Create initial embed with warnings and footer info
 	// Token usage info
-	cfg = b.config.Load()
+	cfg = b.configFor(originalMsg.GuildID, originalMsg.ChannelID)
 
 	tokenLimit := utils.DefaultTokenLimit
 	if params, ok := cfg.Models[model]; ok && params.TokenLimit != nil {
@@ -168,6 +243,13 @@ processStream:
 		SearchResultCount:  searchResultCount,
 		// Token fields left zero; they will appear in final embed
 	}
+	var personaName string
+	if persona != nil {
+		personaName = persona.Name
+		footerInfo.Persona = persona.Name
+		footerInfo.PersonaDisplayName = persona.DisplayName
+		footerInfo.PersonaAvatarURL = persona.AvatarURL
+	}
 
 	// Add timeout monitoring
 	timeoutTicker := time.NewTicker(30 * time.Second)
@@ -180,7 +262,7 @@ processStream:
 	go func() {
 		select {
 		case <-ctx.Done():
-			if !firstContentReceived {
+			if !firstContentReceived && !wasStopped(ctx) {
 				log.Printf("Context timeout reached, updating progress message")
 				b.updateProgressWithError(s, progressMgr, "Request timed out after 5 minutes", actualModel)
 			}
@@ -190,7 +272,12 @@ processStream:
 		}
 	}()
 
-	for response := range stream {
+	for {
+		response, ok := <-stream
+		if !ok || wasStopped(ctx) {
+			break
+		}
+
 		if response.Error != nil {
 			log.Printf("Stream error: %v", response.Error)
 
@@ -201,7 +288,6 @@ processStream:
 				fallbackAttempted = true
 
 				// Try fallback model
-				fallbackModel := b.config.Load().FallbackModel
 				fallbackStream, fallbackErr := attemptStream(fallbackModel, true)
 				if fallbackErr != nil {
 					log.Printf("Fallback model also failed: %v", fallbackErr)
@@ -283,6 +369,45 @@ processStream:
 		}
 
 		if response.FinishReason != "" {
+			if response.Metadata != nil {
+				usage.Add(response.Metadata)
+				lastRound = response.Metadata
+			}
+
+			// The model asked for tools: run them and continue the conversation on a new stream
+			if len(response.ToolCalls) > 0 && toolRegistry != nil {
+				if toolRounds < cfg.GetToolMaxRounds() {
+					toolRounds++
+					if !firstContentReceived {
+						b.updateProgressWithToolCalls(s, progressMgr, response.ToolCalls)
+					}
+					messages = append(messages, b.executeToolCalls(ctx, toolRegistry, roundText.String(), response.ToolCalls)...)
+					roundText.Reset()
+
+					nextStream, err := attemptStream(actualModel, false)
+					if err == nil {
+						stream = nextStream
+						continue
+					}
+					log.Printf("Failed to continue response after tool calls: %v", err)
+				} else if !toolLimitReached {
+					// Out of rounds: the calls are answered without running them, so the model
+					// answers with what it has instead of the response ending empty
+					toolLimitReached = true
+					log.Printf("Tool call limit of %d rounds reached, asking for a final answer", cfg.GetToolMaxRounds())
+					messages = append(messages, declineToolCalls(roundText.String(), response.ToolCalls)...)
+					roundText.Reset()
+
+					nextStream, err := attemptStream(actualModel, false)
+					if err == nil {
+						stream = nextStream
+						continue
+					}
+					log.Printf("Failed to finish response after the tool call limit: %v", err)
+				} else {
+					log.Printf("Model kept calling tools after the limit of %d rounds, finishing response", cfg.GetToolMaxRounds())
+				}
+			}
 			// Stream finished
 			break
 		}
@@ -295,19 +420,16 @@ processStream:
 		}
 
 		if response.GroundingMetadata != nil {
-			groundingMetadata = &messaging.GroundingMetadata{
-				WebSearchQueries: response.GroundingMetadata.WebSearchQueries,
-			}
-			for _, chunk := range response.GroundingMetadata.GroundingChunks {
-				groundingMetadata.GroundingChunks = append(groundingMetadata.GroundingChunks, messaging.GroundingChunk{
-					Web: struct {
-						URI   string `json:"uri"`
-						Title string `json:"title"`
-					}{
-						URI:   chunk.Web.URI,
-						Title: chunk.Web.Title,
-					},
-				})
+			groundingMetadata = response.GroundingMetadata
+		}
+
+		// Show the model thinking until its answer starts
+		if response.Reasoning != "" {
+			reasoning.WriteString(response.Reasoning)
+			readyToEdit := time.Since(lastReasoningEdit) >= time.Duration(utils.EditDelaySeconds)*time.Second
+			if !firstContentReceived && reasoningDisplay != config.ReasoningDisplayOff && readyToEdit {
+				b.updateProgressWithReasoning(s, progressMgr, reasoning.String(), reasoningDisplay)
+				lastReasoningEdit = time.Now()
 			}
 		}
 
@@ -331,8 +453,15 @@ processStream:
 				finalizeContent := responseContents[len(responseContents)-1].String()
 				finalizeEmbed := utils.CreateEmbed(finalizeContent, warnings, false, footerInfo) // Still streaming, so incomplete
 
+				// The stop button moves to the next message
 				lastMsg := responseMessages[len(responseMessages)-1]
-				_, err := s.ChannelMessageEditEmbed(lastMsg.ChannelID, lastMsg.ID, finalizeEmbed)
+				noComponents := []discordgo.MessageComponent{}
+				_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+					Channel:    lastMsg.ChannelID,
+					ID:         lastMsg.ID,
+					Embeds:     &[]*discordgo.MessageEmbed{finalizeEmbed},
+					Components: &noComponents,
+				})
 				if err != nil {
 					log.Printf("Failed to finalize message before split: %v", err)
 				}
@@ -348,6 +477,7 @@ processStream:
 		}
 
 		responseContents[len(responseContents)-1].WriteString(response.Content)
+		roundText.WriteString(response.Content)
 
 		if !usePlainResponses {
 			// Update embed more frequently
@@ -391,8 +521,9 @@ processStream:
 					} else {
 						// Send new message if progress message update failed
 						responseMsg, err := s.ChannelMessageSendComplex(targetChannelID, &discordgo.MessageSend{
-							Embed:     embed,
-							Reference: messageRef,
+							Embed:      embed,
+							Reference:  messageRef,
+							Components: utils.CreateStopButton(originalMsg.ID),
 							AllowedMentions: &discordgo.MessageAllowedMentions{
 								Parse:       []discordgo.AllowedMentionType{},
 								RepliedUser: false,
@@ -424,8 +555,9 @@ processStream:
 						newRef = messageRef
 					}
 					responseMsg, err := s.ChannelMessageSendComplex(targetChannelID, &discordgo.MessageSend{
-						Embed:     embed,
-						Reference: newRef,
+						Embed:      embed,
+						Reference:  newRef,
+						Components: utils.CreateStopButton(originalMsg.ID),
 						AllowedMentions: &discordgo.MessageAllowedMentions{
 							Parse:       []discordgo.AllowedMentionType{},
 							RepliedUser: false,
@@ -457,28 +589,80 @@ processStream:
 		}
 	}
 
+	// Keep the partial answer when the user pressed stop
+	stopped := wasStopped(ctx)
+	if stopped {
+		warnings = append(warnings, "⏹️ Stopped by user")
+		if !firstContentReceived {
+			b.updateProgressWithError(s, progressMgr, "Stopped before any output was generated", actualModel)
+		}
+	}
+
+	// Account for work done by tools during generation
+	if toolState != nil {
+		if searched, resultCount := toolState.searchInfo(); searched {
+			webSearchPerformed = true
+			searchResultCount += resultCount
+		}
+	}
+
 	// Final update to ensure completion
 
 	if !usePlainResponses && len(responseMessages) > 0 && len(responseContents) > 0 {
 		finalContent := responseContents[len(responseContents)-1].String()
 
-		// Add token usage now that generation is complete
-		finalCurrentTokens := utils.EstimateTokenCount(messages)
+		// Add token usage now that generation is complete, as reported by the provider when it can
+		finalCurrentTokens := utils.TokenizerFor(actualModel, cfg.GetModelTokenizer(actualModel)).CountMessages(messages)
+		if lastRound.HasUsage() {
+			finalCurrentTokens = lastRound.PromptTokens
+		}
 		finalFooterInfo := &utils.FooterInfo{
 			Model:              actualModel,
 			WebSearchPerformed: webSearchPerformed,
 			SearchResultCount:  searchResultCount,
 			CurrentTokens:      finalCurrentTokens,
 			TokenLimit:         tokenLimit,
+			Persona:            footerInfo.Persona,
+			PersonaDisplayName: footerInfo.PersonaDisplayName,
+			PersonaAvatarURL:   footerInfo.PersonaAvatarURL,
+			CompletionTokens:   usage.CompletionTokens,
+			ReasoningTokens:    usage.ReasoningTokens,
+			FirstTokenLatency:  usage.FirstTokenLatency,
+			FinishReason:       usage.FinishReason,
+			SafetyFlags:        usage.SafetyFlags,
+		}
+		if lastRound != nil {
+			finalFooterInfo.CachedTokens = lastRound.CachedTokens
 		}
 
 		finalEmbed := utils.CreateEmbed(finalContent, warnings, true, finalFooterInfo)
+		if reasoningDisplay == config.ReasoningDisplayEmbed && strings.TrimSpace(reasoning.String()) != "" {
+			finalEmbed.Fields = append(finalEmbed.Fields, reasoningField(reasoning.String(), false))
+		}
 
 		lastMsg := responseMessages[len(responseMessages)-1]
 
 		// Add action buttons (download + view output better) to the final message
 		actionButtons := utils.CreateActionButtons(lastMsg.ID, webSearchPerformed, groundingMetadata != nil && len(groundingMetadata.GroundingChunks) > 0)
 
+		// Regenerate, variant navigation and the model picker live on the first message,
+		// which holds every variant of the response
+		anchorMsg := responseMessages[0]
+		variantCount := 1
+		if variant != nil {
+			variantCount = len(variant.previous) + 1
+		}
+		variantComponents := utils.CreateVariantComponents(anchorMsg.ID, variantCount-1, variantCount, rerollModels(cfg))
+		if anchorMsg.ID == lastMsg.ID {
+			actionButtons = append(actionButtons, variantComponents...)
+		} else if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			Channel:    anchorMsg.ChannelID,
+			ID:         anchorMsg.ID,
+			Components: &variantComponents,
+		}); err != nil {
+			log.Printf("Failed to add variant buttons: %v", err)
+		}
+
 		if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
 			Channel:    lastMsg.ChannelID,
 			ID:         lastMsg.ID,
@@ -486,6 +670,8 @@ processStream:
 			Components: &actionButtons,
 		}); err != nil {
 			log.Printf("Failed to edit final message: %v", err)
+		} else if progressMgr != nil && responseMessages[0].ID == progressMgr.GetMessageID() {
+			stopButtonReplaced = true
 		}
 	}
 
@@ -555,6 +741,21 @@ processStream:
 	}
 	fullContent := fullContentBuilder.String()
 
+	// Record token usage for accounting and quotas
+	logResponseMetadata(actualModel, &usage)
+	if firstContentReceived {
+		b.recordUsage(originalMsg, actualModel, messages, fullContent, &usage)
+	}
+	// Without tool definitions in the prompt, the reported prompt tokens match the messages
+	if toolRegistry == nil && lastRound.HasUsage() && cfg.Tokenizer.Calibrate {
+		utils.TokenizerFor(actualModel, cfg.GetModelTokenizer(actualModel)).CalibrateFromUsage(messages, lastRound.PromptTokens)
+	}
+
+	// Remember the reply so editing the triggering message can offer a regeneration
+	if len(responseMessages) > 0 {
+		b.generations.RecordReply(originalMsg.ID)
+	}
+
 	// Process tables and convert to images
 	tableCtx := context.Background()
 	processedContent, tableImages, err := b.tableRenderer.ProcessResponse(tableCtx, fullContent)
@@ -569,6 +770,9 @@ processStream:
 	if err != nil {
 		log.Printf("Failed to process charts: %v", err)
 	}
+	if toolState != nil {
+		chartImages = append(toolState.charts(), chartImages...)
+	}
 
 	// Determine the correct message reference for replies (tables, charts, images).
 	// We want to reply to the bot's own message that contained the content.
@@ -585,6 +789,11 @@ processStream:
 		replyRef = messageRef
 	}
 
+	// Send the full reasoning as a file when configured
+	if reasoningDisplay == config.ReasoningDisplayFile && strings.TrimSpace(reasoning.String()) != "" {
+		b.sendReasoningFile(s, targetChannelID, replyRef, reasoning.String())
+	}
+
 	// Send table images as separate attachments if any were generated
 	if len(tableImages) > 0 {
 		for _, tableImage := range tableImages {
@@ -682,10 +891,18 @@ processStream:
 		}
 	}
 
-	for _, responseMsg := range responseMessages {
+	for idx, responseMsg := range responseMessages {
 		if node, exists := b.nodeManager.Get(responseMsg.ID); exists {
 			node.SetText(processedContent)
 			node.SetGroundingMetadata(groundingMetadata)
+
+			// The first message keeps every variant; follow-ups build on the selected one
+			if idx == 0 && !usePlainResponses {
+				if variant != nil {
+					node.SetVariants(variant.previous, 0)
+				}
+				node.AddVariant(messaging.ResponseVariant{Text: processedContent, Model: actualModel, Persona: personaName})
+			}
 	
 			// Add generated images to the response node for conversation history
 			if len(generatedImages) > 0 {
@@ -722,12 +939,11 @@ processStream:
 	}
 
 	// If we never received any content, attempt fallback before giving up
-	if !firstContentReceived && !fallbackAttempted {
+	if !firstContentReceived && !fallbackAttempted && !stopped {
 		log.Printf("No content received from %s, attempting fallback to GPT 4.1", actualModel)
 		fallbackAttempted = true
 
 		// Try fallback model
-		fallbackModel := b.config.Load().FallbackModel
 		fallbackStream, fallbackErr := attemptStream(fallbackModel, true)
 		if fallbackErr != nil {
 			log.Printf("Fallback model also failed: %v", fallbackErr)
@@ -0,0 +1,164 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	// ErrQueueFull is returned when the scheduler holds its maximum number of waiting messages
+	ErrQueueFull = errors.New("message queue is full")
+	// ErrUserQueueFull is returned when a user already has their maximum number of waiting messages
+	ErrUserQueueFull = errors.New("too many queued messages for user")
+)
+
+// messageJob is a message waiting to be answered
+type messageJob struct {
+	msg     *discordgo.MessageCreate
+	variant *variantRequest // Set when regenerating an existing response
+}
+
+// FairScheduler queues messages per user and hands them to workers round-robin,
+// so one busy user can't starve everyone else
+type FairScheduler struct {
+	mu      sync.Mutex
+	queues  map[string][]*messageJob
+	order   []string // Users with waiting messages, in round-robin order
+	size    int
+	idle    int           // Workers currently waiting in Next
+	wake    chan struct{} // Signals waiting workers that a message is available
+	limitFn func() (maxSize, maxPerUser int)
+}
+
+// NewFairScheduler creates a new scheduler. limits is called on every submit so
+// queue sizes follow config reloads.
+func NewFairScheduler(limits func() (maxSize, maxPerUser int)) *FairScheduler {
+	return &FairScheduler{
+		queues:  make(map[string][]*messageJob),
+		wake:    make(chan struct{}, 1),
+		limitFn: limits,
+	}
+}
+
+// Submit queues a message for its author and returns how many waiting messages
+// will be handed out before it. Zero means an idle worker will pick it up immediately.
+func (f *FairScheduler) Submit(job *messageJob) (int, error) {
+	maxSize, maxPerUser := f.limitFn()
+	userID := job.msg.Author.ID
+
+	f.mu.Lock()
+	queue := f.queues[userID]
+	if maxSize > 0 && f.size >= maxSize {
+		f.mu.Unlock()
+		return 0, ErrQueueFull
+	}
+	if maxPerUser > 0 && len(queue) >= maxPerUser {
+		f.mu.Unlock()
+		return 0, ErrUserQueueFull
+	}
+
+	ahead := f.aheadOf(userID, len(queue))
+	if len(queue) == 0 {
+		f.order = append(f.order, userID)
+	}
+	f.queues[userID] = append(queue, job)
+	f.size++
+	idle := f.idle
+	f.mu.Unlock()
+
+	f.signal()
+
+	if ahead < idle {
+		return 0, nil
+	}
+	return ahead - idle + 1, nil
+}
+
+// aheadOf counts the waiting messages that round-robin will hand out before
+// the user's message at the given index of their queue. Must hold f.mu.
+func (f *FairScheduler) aheadOf(userID string, index int) int {
+	ahead := index
+	seen := false
+	for _, other := range f.order {
+		if other == userID {
+			seen = true
+			continue
+		}
+		// Users before this one in the ring get one more turn
+		turns := index
+		if !seen {
+			turns++
+		}
+		ahead += min(len(f.queues[other]), turns)
+	}
+	return ahead
+}
+
+// Next blocks until a message is available or ctx is done
+func (f *FairScheduler) Next(ctx context.Context) (*messageJob, bool) {
+	for {
+		f.mu.Lock()
+		if job := f.pop(); job != nil {
+			remaining := f.size
+			f.mu.Unlock()
+			// Pass the wake-up on so other idle workers pick up the rest
+			if remaining > 0 {
+				f.signal()
+			}
+			return job, true
+		}
+		f.idle++
+		f.mu.Unlock()
+
+		select {
+		case <-f.wake:
+		case <-ctx.Done():
+		}
+
+		f.mu.Lock()
+		f.idle--
+		f.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return nil, false
+		}
+	}
+}
+
+// pop removes the next message in round-robin order. Must hold f.mu.
+func (f *FairScheduler) pop() *messageJob {
+	if len(f.order) == 0 {
+		return nil
+	}
+
+	userID := f.order[0]
+	f.order = f.order[1:]
+	queue := f.queues[userID]
+	job := queue[0]
+	if len(queue) > 1 {
+		f.queues[userID] = queue[1:]
+		f.order = append(f.order, userID)
+	} else {
+		delete(f.queues, userID)
+	}
+	f.size--
+	return job
+}
+
+// signal wakes one waiting worker without blocking
+func (f *FairScheduler) signal() {
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of waiting messages
+func (f *FairScheduler) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.size
+}
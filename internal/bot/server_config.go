@@ -0,0 +1,419 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/storage"
+)
+
+// serverConfigAll resets every setting with /serverconfig reset
+const serverConfigAll = "all"
+
+// configFor returns the config in effect in a channel: the YAML config, then the guild's
+// overrides, then the channel's. Threads use their parent channel's overrides. User
+// preferences such as /model and /systemprompt apply on top of the returned config.
+func (b *Bot) configFor(guildID, channelID string) *config.Config {
+	cfg := b.config.Load()
+	if cfg == nil || b.configOverrides == nil || guildID == "" {
+		return cfg
+	}
+
+	ctx := context.Background()
+	guildOverrides, err := b.configOverrides.GetOverrides(ctx, storage.ScopeGuild, guildID)
+	if err != nil {
+		log.Printf("Failed to get overrides for guild %s: %v", guildID, err)
+	}
+
+	var channelOverrides *config.Overrides
+	if channelID = b.overrideChannelID(channelID); channelID != "" {
+		channelOverrides, err = b.configOverrides.GetOverrides(ctx, storage.ScopeChannel, channelID)
+		if err != nil {
+			log.Printf("Failed to get overrides for channel %s: %v", channelID, err)
+		}
+	}
+
+	if guildOverrides.IsEmpty() && channelOverrides.IsEmpty() {
+		return cfg
+	}
+	return cfg.WithOverrides(guildOverrides, channelOverrides)
+}
+
+// overrideChannelID returns the channel whose overrides apply in a channel: its parent for threads
+func (b *Bot) overrideChannelID(channelID string) string {
+	if b.session == nil || b.session.State == nil || channelID == "" {
+		return channelID
+	}
+	channel, err := b.session.State.Channel(channelID)
+	if err != nil || !channel.IsThread() || channel.ParentID == "" {
+		return channelID
+	}
+	return channel.ParentID
+}
+
+// canManageServerConfig reports whether a user may change a guild's overrides:
+// bot admins and members who can manage the server
+func canManageServerConfig(i *discordgo.InteractionCreate, userID string, cfg *config.Config) bool {
+	if contains(cfg.Permissions.Users.AdminIDs, userID) {
+		return true
+	}
+	return i.Member != nil && i.Member.Permissions&(discordgo.PermissionManageServer|discordgo.PermissionAdministrator) != 0
+}
+
+// handleServerConfigCommand handles the /serverconfig slash command and its subcommands
+func (b *Bot) handleServerConfigCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+
+	var userID string
+	if i.User != nil {
+		userID = i.User.ID
+	} else if i.Member != nil && i.Member.User != nil {
+		userID = i.Member.User.ID
+	}
+
+	cfg := b.config.Load()
+	if cfg == nil {
+		b.respondEphemeral(s, i, "❌ Configuration is not available")
+		return
+	}
+	if i.GuildID == "" {
+		b.respondEphemeral(s, i, "❌ Server settings can only be changed in a server")
+		return
+	}
+	if b.configOverrides == nil || len(data.Options) == 0 {
+		b.respondEphemeral(s, i, "❌ Server settings are not available")
+		return
+	}
+	if !canManageServerConfig(i, userID, cfg) {
+		b.respondEphemeral(s, i, "❌ You need the Manage Server permission to use this command")
+		return
+	}
+
+	subcommand := data.Options[0]
+	options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, option := range subcommand.Options {
+		options[option.Name] = option
+	}
+
+	// Settings apply to the whole server unless a channel is given
+	scope, scopeID := storage.ScopeGuild, i.GuildID
+	if option, ok := options["channel"]; ok {
+		scope, scopeID = storage.ScopeChannel, option.ChannelValue(nil).ID
+	}
+
+	ctx := context.Background()
+	switch subcommand.Name {
+	case "view":
+		b.handleServerConfigView(ctx, s, i, cfg, scopeID, scope == storage.ScopeChannel)
+	case "set":
+		b.handleServerConfigSet(ctx, s, i, cfg, userID, scope, scopeID, options)
+	case "reset":
+		b.handleServerConfigReset(ctx, s, i, userID, scope, scopeID, options)
+	}
+}
+
+// handleServerConfigView shows each setting in effect and where it comes from
+func (b *Bot) handleServerConfigView(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, cfg *config.Config, channelID string, channelScope bool) {
+	guildOverrides, err := b.configOverrides.GetOverrides(ctx, storage.ScopeGuild, i.GuildID)
+	if err != nil {
+		log.Printf("Failed to get overrides for guild %s: %v", i.GuildID, err)
+		b.respondEphemeral(s, i, "❌ Failed to load server settings")
+		return
+	}
+
+	title := "⚙️ **Server settings**"
+	layers := []*config.Overrides{guildOverrides}
+	var channelOverrides *config.Overrides
+	if channelScope {
+		channelOverrides, err = b.configOverrides.GetOverrides(ctx, storage.ScopeChannel, channelID)
+		if err != nil {
+			log.Printf("Failed to get overrides for channel %s: %v", channelID, err)
+			b.respondEphemeral(s, i, "❌ Failed to load channel settings")
+			return
+		}
+		layers = append(layers, channelOverrides)
+		title = fmt.Sprintf("⚙️ **Settings in <#%s>**", channelID)
+	}
+	effective := cfg.WithOverrides(layers...)
+
+	lines := []string{title}
+	for _, setting := range config.OverrideSettings {
+		source := "default"
+		if channelOverrides.Has(setting) {
+			source = "channel"
+		} else if guildOverrides.Has(setting) {
+			source = "server"
+		}
+		lines = append(lines, fmt.Sprintf("• `%s`: %s (%s)", setting, overrideValue(effective, setting), source))
+	}
+	b.respondEphemeral(s, i, strings.Join(lines, "\n"))
+}
+
+// overrideValue formats the value of a setting in a config for display
+func overrideValue(cfg *config.Config, setting string) string {
+	switch setting {
+	case config.OverrideDefaultModel:
+		return "`" + cfg.GetDefaultModel() + "`"
+	case config.OverrideAllowedModels:
+		if len(cfg.AllowedModels) == 0 {
+			return "all models"
+		}
+		return "`" + strings.Join(cfg.AllowedModels, "`, `") + "`"
+	case config.OverrideSystemPrompt:
+		if cfg.SystemPrompt == "" {
+			return "none"
+		}
+		return fmt.Sprintf("%d characters", len(cfg.SystemPrompt))
+	case config.OverrideWebSearch:
+		return onOff(!cfg.WebSearch.Disabled)
+	case config.OverrideMaxMessages:
+		return strconv.Itoa(cfg.MaxMessages)
+	case config.OverrideUseThreads:
+		return onOff(cfg.UseThreads)
+	}
+	return ""
+}
+
+// onOff formats a boolean setting
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
+
+// handleServerConfigSet overrides one setting for the server or a channel
+func (b *Bot) handleServerConfigSet(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, cfg *config.Config, userID, scope, scopeID string, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var setting, value string
+	if option, ok := options["setting"]; ok {
+		setting = option.StringValue()
+	}
+	if option, ok := options["value"]; ok {
+		value = strings.TrimSpace(option.StringValue())
+	}
+
+	overrides, err := b.configOverrides.GetOverrides(ctx, scope, scopeID)
+	if err != nil {
+		log.Printf("Failed to get %s overrides for %s: %v", scope, scopeID, err)
+		b.respondEphemeral(s, i, "❌ Failed to load settings")
+		return
+	}
+	if overrides == nil {
+		overrides = &config.Overrides{}
+	} else {
+		// Cached overrides are shared; change a copy
+		updated := *overrides
+		overrides = &updated
+	}
+
+	if err := setOverride(overrides, setting, value, cfg); err != nil {
+		b.respondEphemeral(s, i, fmt.Sprintf("❌ %v", err))
+		return
+	}
+
+	if err := b.configOverrides.SaveOverrides(ctx, scope, scopeID, overrides, userID); err != nil {
+		log.Printf("Failed to save %s overrides for %s: %v", scope, scopeID, err)
+		b.respondEphemeral(s, i, "❌ Failed to save settings")
+		return
+	}
+	log.Printf("User %s set %s to %q for %s %s", userID, setting, value, scope, scopeID)
+
+	where := "this server"
+	if scope == storage.ScopeChannel {
+		where = fmt.Sprintf("<#%s>", scopeID)
+	}
+	b.respondEphemeral(s, i, fmt.Sprintf("✅ `%s` is now %s in %s", setting, overrideValue(cfg.WithOverrides(overrides), setting), where))
+}
+
+// setOverride parses a value and sets it as the override of a setting
+func setOverride(overrides *config.Overrides, setting, value string, cfg *config.Config) error {
+	switch setting {
+	case config.OverrideDefaultModel:
+		if !cfg.IsModelAllowed(value) {
+			return fmt.Errorf("model `%s` is not available", value)
+		}
+		overrides.DefaultModel = &value
+	case config.OverrideAllowedModels:
+		var models []string
+		for _, model := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if !cfg.IsModelAllowed(model) {
+				return fmt.Errorf("model `%s` is not available", model)
+			}
+			models = append(models, model)
+		}
+		if len(models) == 0 {
+			return fmt.Errorf("list at least one model, separated by commas")
+		}
+		overrides.AllowedModels = models
+	case config.OverrideSystemPrompt:
+		if value == "" {
+			return fmt.Errorf("the system prompt can't be empty; use `/serverconfig reset` to use the default")
+		}
+		if len(value) > config.MaxSystemPromptLength {
+			return fmt.Errorf("the system prompt is too long (max %d characters)", config.MaxSystemPromptLength)
+		}
+		overrides.SystemPrompt = &value
+	case config.OverrideWebSearch, config.OverrideUseThreads:
+		enabled, err := parseOnOff(value)
+		if err != nil {
+			return err
+		}
+		if setting == config.OverrideWebSearch {
+			overrides.WebSearch = &enabled
+		} else {
+			overrides.UseThreads = &enabled
+		}
+	case config.OverrideMaxMessages:
+		maxMessages, err := strconv.Atoi(value)
+		if err != nil || maxMessages < 1 || maxMessages > config.MaxOverrideMaxMessages {
+			return fmt.Errorf("max_messages must be a number between 1 and %d", config.MaxOverrideMaxMessages)
+		}
+		overrides.MaxMessages = &maxMessages
+	default:
+		return fmt.Errorf("unknown setting `%s`", setting)
+	}
+	return nil
+}
+
+// parseOnOff parses the value of an on/off setting
+func parseOnOff(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "true", "yes", "enabled":
+		return true, nil
+	case "off", "false", "no", "disabled":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected `on` or `off`, got `%s`", value)
+}
+
+// handleServerConfigReset removes one or all overrides of the server or a channel
+func (b *Bot) handleServerConfigReset(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, userID, scope, scopeID string, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	setting := serverConfigAll
+	if option, ok := options["setting"]; ok {
+		setting = option.StringValue()
+	}
+
+	overrides := &config.Overrides{}
+	if setting != serverConfigAll {
+		current, err := b.configOverrides.GetOverrides(ctx, scope, scopeID)
+		if err != nil {
+			log.Printf("Failed to get %s overrides for %s: %v", scope, scopeID, err)
+			b.respondEphemeral(s, i, "❌ Failed to load settings")
+			return
+		}
+		if current != nil {
+			// Cached overrides are shared; change a copy
+			updated := *current
+			overrides = &updated
+		}
+		if err := overrides.Clear(setting); err != nil {
+			b.respondEphemeral(s, i, fmt.Sprintf("❌ %v", err))
+			return
+		}
+	}
+
+	if err := b.configOverrides.SaveOverrides(ctx, scope, scopeID, overrides, userID); err != nil {
+		log.Printf("Failed to save %s overrides for %s: %v", scope, scopeID, err)
+		b.respondEphemeral(s, i, "❌ Failed to reset settings")
+		return
+	}
+	log.Printf("User %s reset %s for %s %s", userID, setting, scope, scopeID)
+
+	inherited := "the bot's defaults"
+	if scope == storage.ScopeChannel {
+		inherited = "the server's settings"
+	}
+	if setting == serverConfigAll {
+		b.respondEphemeral(s, i, fmt.Sprintf("✅ All settings are back to %s", inherited))
+		return
+	}
+	b.respondEphemeral(s, i, fmt.Sprintf("✅ `%s` is back to %s", setting, inherited))
+}
+
+// handleServerConfigAutocomplete suggests values for /serverconfig set
+func (b *Bot) handleServerConfigAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+
+	var setting string
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	if len(data.Options) > 0 {
+		for _, option := range data.Options[0].Options {
+			if option.Name == "setting" {
+				setting = option.StringValue()
+			}
+			if option.Focused {
+				focused = option
+			}
+		}
+	}
+
+	var candidates []string
+	var prefix, partial string
+	if focused != nil && focused.Name == "value" {
+		partial = strings.TrimSpace(focused.StringValue())
+		switch setting {
+		case config.OverrideDefaultModel, config.OverrideAllowedModels:
+			if cfg := b.config.Load(); cfg != nil {
+				candidates = cfg.GetAllowedModels()
+			}
+			// Complete the last model of a list
+			if setting == config.OverrideAllowedModels {
+				if cut := strings.LastIndex(partial, ","); cut != -1 {
+					prefix, partial = partial[:cut+1], strings.TrimSpace(partial[cut+1:])
+				}
+			}
+		case config.OverrideWebSearch, config.OverrideUseThreads:
+			candidates = []string{"on", "off"}
+		}
+	}
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, 25)
+	for _, candidate := range candidates {
+		// Discord limits choices to 100 characters
+		if !strings.Contains(strings.ToLower(candidate), strings.ToLower(partial)) || len(prefix+candidate) > 100 {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: prefix + candidate, Value: prefix + candidate})
+		// Discord shows at most 25 choices
+		if len(choices) == 25 {
+			break
+		}
+	}
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	}); err != nil {
+		log.Printf("Failed to respond to autocomplete interaction: %v", err)
+	}
+}
+
+// serverConfigSettingChoices returns the /serverconfig setting choices, with "all" for reset
+func serverConfigSettingChoices(withAll bool) []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, setting := range config.OverrideSettings {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: setting, Value: setting})
+	}
+	if withAll {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: serverConfigAll, Value: serverConfigAll})
+	}
+	return choices
+}
+
+// serverConfigChannelOption returns the /serverconfig option that scopes a subcommand to a channel
+func serverConfigChannelOption(description string) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionChannel,
+		Name:         "channel",
+		Description:  description,
+		ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews, discordgo.ChannelTypeGuildForum},
+	}
+}
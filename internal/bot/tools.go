@@ -0,0 +1,335 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/llm"
+	"DiscordAIChatbot/internal/messaging"
+	"DiscordAIChatbot/internal/processors"
+)
+
+const (
+	toolWebSearch            = "web_search"
+	toolGoogleLens           = "google_lens"
+	toolFetchChannelMessages = "fetch_channel_messages"
+	toolRenderChart          = "render_chart"
+
+	maxToolSearchQueries = 5
+)
+
+// toolSession collects side effects of tool calls made while generating a single response
+type toolSession struct {
+	mu                sync.Mutex
+	chartImages       []processors.ChartImage
+	searchPerformed   bool
+	searchResultCount int
+}
+
+// addChartImage records a chart rendered by the render_chart tool
+func (ts *toolSession) addChartImage(img processors.ChartImage) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.chartImages = append(ts.chartImages, img)
+}
+
+// recordSearch records a web search performed by the web_search tool
+func (ts *toolSession) recordSearch(resultCount int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.searchPerformed = true
+	ts.searchResultCount += resultCount
+}
+
+// charts returns the charts rendered during the response
+func (ts *toolSession) charts() []processors.ChartImage {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]processors.ChartImage(nil), ts.chartImages...)
+}
+
+// searchInfo returns whether a web search ran and the number of results it returned
+func (ts *toolSession) searchInfo() (bool, int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.searchPerformed, ts.searchResultCount
+}
+
+// toolsEnabledForModel reports whether tool calling should be offered for a model
+func (b *Bot) toolsEnabledForModel(model string) bool {
+	cfg := b.config.Load()
+	if cfg == nil || !cfg.Tools.Enabled {
+		return false
+	}
+	// Image generation models cannot call functions
+	return model != "gemini/gemini-2.0-flash-preview-image-generation" && !strings.HasPrefix(model, "gemini/imagen")
+}
+
+// buildToolRegistry creates the tools offered to the model while answering a message.
+// It returns a nil registry when tool calling is disabled.
+func (b *Bot) buildToolRegistry(s *discordgo.Session, originalMsg *discordgo.MessageCreate, model string) (*llm.ToolRegistry, *toolSession) {
+	if !b.toolsEnabledForModel(model) {
+		return nil, nil
+	}
+
+	cfg := b.configFor(originalMsg.GuildID, originalMsg.ChannelID)
+	session := &toolSession{}
+	registry := llm.NewToolRegistry()
+
+	tools := []llm.Tool{
+		&llm.FuncTool{
+			ToolName:        toolWebSearch,
+			ToolDescription: "Search the web for up-to-date information. Use it for current events, facts you are unsure about, or anything after your knowledge cutoff.",
+			Schema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"queries": map[string]any{
+						"type":        "array",
+						"description": fmt.Sprintf("Between 1 and %d concise search queries", maxToolSearchQueries),
+						"items":       map[string]any{"type": "string"},
+					},
+				},
+				"required": []string{"queries"},
+			},
+			Fn: func(ctx context.Context, arguments string) (string, error) {
+				var args struct {
+					Queries []string `json:"queries"`
+				}
+				if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+					return "", fmt.Errorf("invalid arguments: %w", err)
+				}
+				queries := make([]string, 0, len(args.Queries))
+				for _, q := range args.Queries {
+					if q = strings.TrimSpace(q); q != "" {
+						queries = append(queries, q)
+					}
+				}
+				if len(queries) == 0 {
+					return "", fmt.Errorf("at least one query is required")
+				}
+				if len(queries) > maxToolSearchQueries {
+					queries = queries[:maxToolSearchQueries]
+				}
+
+				searchCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+				defer cancel()
+
+				results, err := b.webSearchClient.SearchMultiple(searchCtx, queries)
+				if err != nil {
+					return "", err
+				}
+				session.recordSearch(processors.CountSearchResults(results))
+				return results, nil
+			},
+		},
+		&llm.FuncTool{
+			ToolName:        toolGoogleLens,
+			ToolDescription: "Run a Google Lens reverse image search to identify objects, products, places or the source of an image.",
+			Schema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"image_url": map[string]any{
+						"type":        "string",
+						"description": "Public http(s) URL of the image. Omit to use the image attached to the user's message.",
+					},
+					"query": map[string]any{
+						"type":        "string",
+						"description": "Optional text to refine the results",
+					},
+					"type": map[string]any{
+						"type":        "string",
+						"description": "Kind of results to return",
+						"enum":        processors.GoogleLensAllowedTypeValues(),
+					},
+				},
+			},
+			Fn: func(ctx context.Context, arguments string) (string, error) {
+				var args struct {
+					ImageURL string `json:"image_url"`
+					Query    string `json:"query"`
+					Type     string `json:"type"`
+				}
+				if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+					return "", fmt.Errorf("invalid arguments: %w", err)
+				}
+
+				imageURL := strings.TrimSpace(args.ImageURL)
+				if imageURL == "" {
+					imageURL = findImageAttachmentURL(s, originalMsg.Message)
+				}
+				if !strings.HasPrefix(imageURL, "http://") && !strings.HasPrefix(imageURL, "https://") {
+					return "", fmt.Errorf("an http(s) image URL or an image attachment is required")
+				}
+
+				opts := &processors.SearchOptions{Query: strings.TrimSpace(args.Query)}
+				if args.Type != "" {
+					normalized, ok := processors.NormalizeGoogleLensType(args.Type)
+					if !ok {
+						return "", fmt.Errorf("unsupported type %q; valid options: %s", args.Type, strings.Join(processors.GoogleLensAllowedTypeValues(), ", "))
+					}
+					opts.Type = normalized
+				}
+				if isSearchOptionsEmpty(opts) {
+					opts = nil
+				}
+
+				lensCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+				defer cancel()
+
+				results, err := b.googleLensClient.Search(lensCtx, imageURL, opts)
+				if err != nil {
+					return "", err
+				}
+				if results == "" {
+					return "Google Lens found no visual matches.", nil
+				}
+				return results, nil
+			},
+		},
+		&llm.FuncTool{
+			ToolName:        toolFetchChannelMessages,
+			ToolDescription: "Read the recent message history of the current Discord channel. Use it to answer questions about what was discussed in the channel.",
+			Schema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query": map[string]any{
+						"type":        "string",
+						"description": "The question that should be answered from the channel history",
+					},
+				},
+				"required": []string{"query"},
+			},
+			Fn: func(ctx context.Context, arguments string) (string, error) {
+				var args struct {
+					Query string `json:"query"`
+				}
+				if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+					return "", fmt.Errorf("invalid arguments: %w", err)
+				}
+				return b.handleAskChannelQuery(ctx, s, originalMsg.Message, strings.TrimSpace(args.Query))
+			},
+		},
+		&llm.FuncTool{
+			ToolName:        toolRenderChart,
+			ToolDescription: "Render a chart from a self-contained Python matplotlib/seaborn script. The resulting image is attached to your reply, so do not repeat the code unless asked.",
+			Schema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"code": map[string]any{
+						"type":        "string",
+						"description": "Complete Python plotting code",
+					},
+				},
+				"required": []string{"code"},
+			},
+			Fn: func(ctx context.Context, arguments string) (string, error) {
+				var args struct {
+					Code string `json:"code"`
+				}
+				if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+					return "", fmt.Errorf("invalid arguments: %w", err)
+				}
+
+				chartCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+				defer cancel()
+
+				chart, err := b.chartProcessor.RenderChart(chartCtx, args.Code)
+				if err != nil {
+					return "", err
+				}
+				session.addChartImage(*chart)
+				return fmt.Sprintf("Chart rendered as %s and will be attached to your reply.", chart.Filename), nil
+			},
+		},
+	}
+
+	for _, tool := range tools {
+		if cfg.IsToolDisabled(tool.Name()) || (tool.Name() == toolWebSearch && cfg.WebSearch.Disabled) {
+			continue
+		}
+		if err := registry.Register(tool); err != nil {
+			log.Printf("Failed to register tool %s: %v", tool.Name(), err)
+		}
+	}
+
+	if registry.Len() == 0 {
+		return nil, nil
+	}
+	return registry, session
+}
+
+// findImageAttachmentURL returns the first image attachment URL on a message or the message it replies to
+func findImageAttachmentURL(s *discordgo.Session, msg *discordgo.Message) string {
+	for _, attachment := range msg.Attachments {
+		if strings.HasPrefix(attachment.ContentType, "image/") {
+			return attachment.URL
+		}
+	}
+
+	if msg.MessageReference != nil && msg.MessageReference.MessageID != "" {
+		parent, err := s.ChannelMessage(msg.ChannelID, msg.MessageReference.MessageID)
+		if err != nil {
+			log.Printf("Failed to fetch referenced message for image lookup: %v", err)
+			return ""
+		}
+		for _, attachment := range parent.Attachments {
+			if strings.HasPrefix(attachment.ContentType, "image/") {
+				return attachment.URL
+			}
+		}
+	}
+
+	return ""
+}
+
+// executeToolCalls runs the tool calls requested by the model and returns the messages
+// to append to the conversation: the assistant turn issuing the calls followed by one result per call.
+func (b *Bot) executeToolCalls(ctx context.Context, registry *llm.ToolRegistry, assistantText string, calls []messaging.ToolCall) []messaging.OpenAIMessage {
+	turn := []messaging.OpenAIMessage{{
+		Role:      "assistant",
+		Content:   assistantText,
+		ToolCalls: calls,
+	}}
+
+	results := make([]messaging.OpenAIMessage, len(calls))
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func(idx int, call messaging.ToolCall) {
+			defer wg.Done()
+			log.Printf("Executing tool %s with arguments: %s", call.Name, call.Arguments)
+			start := time.Now()
+			results[idx] = registry.Execute(ctx, call)
+			log.Printf("Tool %s finished in %v", call.Name, time.Since(start))
+		}(i, call)
+	}
+	wg.Wait()
+
+	return append(turn, results...)
+}
+
+// declineToolCalls answers the calls of the round after the tool limit without running them.
+// Each call still gets a result, since providers reject tool calls left unanswered.
+func declineToolCalls(assistantText string, calls []messaging.ToolCall) []messaging.OpenAIMessage {
+	turn := []messaging.OpenAIMessage{{
+		Role:      "assistant",
+		Content:   assistantText,
+		ToolCalls: calls,
+	}}
+	for _, call := range calls {
+		turn = append(turn, messaging.OpenAIMessage{
+			Role:       "tool",
+			Name:       call.Name,
+			ToolCallID: call.ID,
+			Content:    "error: not run, the tool call limit for this response was reached. Answer the user now with the information you already have, without calling tools.",
+		})
+	}
+	return turn
+}
@@ -0,0 +1,249 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"DiscordAIChatbot/internal/messaging"
+)
+
+const testChannelID = "111111111111111111"
+
+func TestParseMessageTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{"222222222222222222", "222222222222222222", false},
+		{"  222222222222222222\n", "222222222222222222", false},
+		{"https://discord.com/channels/333333333333333333/" + testChannelID + "/222222222222222222", "222222222222222222", false},
+		{"https://ptb.discord.com/channels/@me/" + testChannelID + "/222222222222222222/", "222222222222222222", false},
+		{"https://discordapp.com/channels/333333333333333333/" + testChannelID + "/222222222222222222", "222222222222222222", false},
+		{"https://discord.com/channels/333333333333333333/444444444444444444/222222222222222222", "", true},
+		{"https://example.com/channels/1/" + testChannelID + "/222222222222222222", "", true},
+		{"12345", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseMessageTarget(tt.target, testChannelID)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseMessageTarget(%q) = %q, %v; want %q, error %v", tt.target, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// testTranscript covers headings with and without models, multi-line text, attachments and sources
+func testTranscript() []transcriptEntry {
+	timestamp := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	return []transcriptEntry{
+		{
+			transcriptMetadata: transcriptMetadata{
+				Author:      "alice",
+				Timestamp:   timestamp,
+				Attachments: []transcriptAttachment{{Filename: "notes.txt", URL: "https://cdn.example.com/notes.txt"}},
+			},
+			Role:   "user",
+			UserID: "555555555555555555",
+			Text:   "What do my notes say?",
+		},
+		{
+			transcriptMetadata: transcriptMetadata{
+				Author:    "bot",
+				Timestamp: timestamp,
+				Model:     "openai/gpt-4o",
+				Sources:   []transcriptSource{{Title: "Example", URL: "https://example.com"}},
+			},
+			Role: "assistant",
+			Text: "They list three things:\n\n- milk\n- eggs\n\n### Summary\n\nShopping.",
+		},
+		{
+			transcriptMetadata: transcriptMetadata{Author: "imported user"},
+			Role:               "user",
+			Text:               "Thanks!",
+		},
+	}
+}
+
+// roundTrip lists the role and text of each entry, as import reads them back
+func roundTrip(entries []transcriptEntry) []importedMessage {
+	messages := make([]importedMessage, len(entries))
+	for i, entry := range entries {
+		messages[i] = importedMessage{Role: entry.Role, Text: entry.Text}
+	}
+	return messages
+}
+
+func TestMarkdownTranscriptRoundTrip(t *testing.T) {
+	entries := testTranscript()
+	messages, skipped, err := parseTranscript("conversation.md", renderTranscriptMarkdown("Conversation", entries))
+	if err != nil {
+		t.Fatalf("parseTranscript: %v", err)
+	}
+	if skipped != 0 {
+		t.Errorf("skipped %d messages", skipped)
+	}
+
+	// Attachment links stay in the text, the sources are dropped
+	want := roundTrip(entries)
+	want[0].Text += "\n\n**Attachments**\n\n- [notes.txt](https://cdn.example.com/notes.txt)"
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("got %+v\nwant %+v", messages, want)
+	}
+}
+
+func TestJSONTranscriptRoundTrip(t *testing.T) {
+	entries := testTranscript()
+	data, err := renderTranscriptJSON("Conversation", entries)
+	if err != nil {
+		t.Fatalf("renderTranscriptJSON: %v", err)
+	}
+
+	// Without the extension the shape of the file decides
+	for _, filename := range []string{"conversation.json", "conversation"} {
+		messages, skipped, err := parseTranscript(filename, data)
+		if err != nil {
+			t.Fatalf("parseTranscript(%q): %v", filename, err)
+		}
+		if skipped != 0 {
+			t.Errorf("%s: skipped %d messages", filename, skipped)
+		}
+		if want := roundTrip(entries); !reflect.DeepEqual(messages, want) {
+			t.Errorf("%s: got %+v\nwant %+v", filename, messages, want)
+		}
+	}
+}
+
+func TestParseTranscriptJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		want        []importedMessage
+		wantSkipped int
+		wantErr     bool
+	}{
+		{
+			name: "bare array",
+			data: `[
+				{"role": "system", "content": "Be brief."},
+				{"role": "user", "content": " Hi "},
+				{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "web_search", "arguments": "{}"}}]},
+				{"role": "tool", "tool_call_id": "call_1", "content": "results"},
+				{"role": "assistant", "content": "Hello!"}
+			]`,
+			want:        []importedMessage{{Role: "user", Text: "Hi"}, {Role: "assistant", Text: "Hello!"}},
+			wantSkipped: 3,
+		},
+		{
+			name: "messages object",
+			data: `{"messages": [
+				{"role": "user", "content": [
+					{"type": "text", "text": "What is this?"},
+					{"type": "image_url", "image_url": {"url": "https://cdn.example.com/cat.png"}}
+				]},
+				{"role": "assistant", "content": "A cat."}
+			]}`,
+			want: []importedMessage{
+				{Role: "user", Text: "What is this?\n\n[image: https://cdn.example.com/cat.png]"},
+				{Role: "assistant", Text: "A cat."},
+			},
+		},
+		{
+			name:    "object without messages",
+			data:    `{"conversation": []}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			data:    `[{"role": "user"`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, skipped, err := parseTranscriptJSON([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(messages, tt.want) {
+				t.Errorf("got %+v\nwant %+v", messages, tt.want)
+			}
+			if skipped != tt.wantSkipped {
+				t.Errorf("skipped %d messages, want %d", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestParseTranscriptInlineImages(t *testing.T) {
+	data := `[{"role": "user", "content": [{"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}]}]`
+	messages, _, err := parseTranscriptJSON([]byte(data))
+	if err != nil {
+		t.Fatalf("parseTranscriptJSON: %v", err)
+	}
+	if len(messages) != 1 || len(messages[0].Images) != 1 || messages[0].Text != "[image]" {
+		t.Fatalf("got %+v, want one image with placeholder text", messages)
+	}
+	if url := messages[0].Images[0].ImageURL.URL; url != "data:image/png;base64,AAAA" {
+		t.Errorf("got image %q", url)
+	}
+}
+
+func TestParseTranscriptMarkdownRejectsOtherFiles(t *testing.T) {
+	if _, _, err := parseTranscript("notes.md", []byte("# Notes\n\nNothing to import here.")); err == nil {
+		t.Error("parsed a Markdown file that is not a transcript")
+	}
+}
+
+func TestSeedImportedChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		messages  []importedMessage
+		wantRoles []string // From the confirmation back to the first message
+		wantText  string   // Text of the confirmation node
+	}{
+		{
+			name:      "ends with assistant",
+			messages:  []importedMessage{{Role: "user", Text: "Hi"}, {Role: "assistant", Text: "Hello!"}},
+			wantRoles: []string{"assistant", "user"},
+			wantText:  "Hello!",
+		},
+		{
+			name:      "ends with user",
+			messages:  []importedMessage{{Role: "assistant", Text: "Hello!"}, {Role: "user", Text: "Hi"}},
+			wantRoles: []string{"assistant", "user", "assistant"},
+			wantText:  "📥 Imported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bot{nodeManager: messaging.NewMsgNodeManager(10)}
+			b.seedImportedChain(testChannelID, "confirmation", "📥 Imported", "555555555555555555", tt.messages)
+
+			var roles []string
+			id := "confirmation"
+			for id != "" {
+				node, ok := b.nodeManager.Get(id)
+				if !ok {
+					t.Fatalf("no node stored under %s", id)
+				}
+				if id == "confirmation" && node.GetText() != tt.wantText {
+					t.Errorf("confirmation holds %q, want %q", node.GetText(), tt.wantText)
+				}
+				if node.Role == "user" && node.UserID != "555555555555555555" {
+					t.Errorf("user node %s has user ID %q", id, node.UserID)
+				}
+				roles = append(roles, node.Role)
+
+				id = ""
+				if node.ParentMsg != nil {
+					id = node.ParentMsg.ID
+				}
+			}
+			if !reflect.DeepEqual(roles, tt.wantRoles) {
+				t.Errorf("got roles %v, want %v", roles, tt.wantRoles)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/llm"
+	"DiscordAIChatbot/internal/messaging"
+	"DiscordAIChatbot/internal/storage"
+	"DiscordAIChatbot/internal/utils"
+)
+
+// recordUsage adds the prompt and completion tokens of a response to the usage ledger.
+// Counts reported by the provider are used when available, estimates otherwise.
+func (b *Bot) recordUsage(m *discordgo.MessageCreate, model string, messages []messaging.OpenAIMessage, content string, reported *llm.ResponseMetadata) {
+	cfg := b.config.Load()
+	if cfg == nil || !cfg.Usage.Enabled || b.usageLedger == nil || m == nil || m.Author == nil {
+		return
+	}
+
+	promptTokens, completionTokens := 0, 0
+	if reported.HasUsage() {
+		promptTokens, completionTokens = reported.PromptTokens, reported.CompletionTokens
+	} else {
+		tokens := utils.TokenizerFor(model, cfg.GetModelTokenizer(model))
+		promptTokens = tokens.CountMessages(messages)
+		completionTokens = tokens.CountText(content)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.UsageQueryTimeout*time.Second)
+	defer cancel()
+
+	if err := b.usageLedger.Record(ctx, storage.UsageRecord{
+		UserID:           m.Author.ID,
+		GuildID:          m.GuildID,
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Cost:             cfg.GetModelCost(model, promptTokens, completionTokens),
+		Time:             time.Now(),
+	}); err != nil {
+		log.Printf("Failed to record usage for user %s: %v", m.Author.ID, err)
+	}
+}
+
+// logResponseMetadata logs what the provider reported about a response
+func logResponseMetadata(model string, metadata *llm.ResponseMetadata) {
+	if !metadata.HasUsage() && metadata.FirstTokenLatency == 0 {
+		return
+	}
+	log.Printf("Response from %s: %d prompt tokens (%d cached), %d completion tokens (%d reasoning), first token after %v, finish reason %q",
+		model, metadata.PromptTokens, metadata.CachedTokens, metadata.CompletionTokens, metadata.ReasoningTokens,
+		metadata.FirstTokenLatency.Round(time.Millisecond), metadata.FinishReason)
+	if len(metadata.SafetyFlags) > 0 {
+		log.Printf("Response from %s was flagged by safety filters: %s", model, strings.Join(metadata.SafetyFlags, ", "))
+	}
+}
+
+// checkQuota returns a message explaining which quota the author has exhausted, or "" when the message may proceed
+func (b *Bot) checkQuota(m *discordgo.MessageCreate) string {
+	cfg := b.config.Load()
+	if cfg == nil || b.usageLedger == nil {
+		return ""
+	}
+
+	var roleIDs []string
+	if m.Member != nil {
+		roleIDs = m.Member.Roles
+	}
+	quota := cfg.ResolveUsageQuota(m.Author.ID, roleIDs)
+	if quota == nil {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.UsageQueryTimeout*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	daily, err := b.usageLedger.UserTotals(ctx, m.Author.ID, storage.StartOfDay(now))
+	if err != nil {
+		// Fail open so a database hiccup doesn't lock everyone out
+		log.Printf("Failed to check daily usage for user %s: %v", m.Author.ID, err)
+		return ""
+	}
+	monthly, err := b.usageLedger.UserTotals(ctx, m.Author.ID, storage.StartOfMonth(now))
+	if err != nil {
+		log.Printf("Failed to check monthly usage for user %s: %v", m.Author.ID, err)
+		return ""
+	}
+
+	switch {
+	case quota.DailyTokens > 0 && daily.TotalTokens() >= quota.DailyTokens:
+		return fmt.Sprintf("You have used your daily limit of %d tokens. It resets at midnight UTC.", quota.DailyTokens)
+	case quota.DailyCost > 0 && daily.Cost >= quota.DailyCost:
+		return fmt.Sprintf("You have used your daily limit of $%.2f. It resets at midnight UTC.", quota.DailyCost)
+	case quota.MonthlyTokens > 0 && monthly.TotalTokens() >= quota.MonthlyTokens:
+		return fmt.Sprintf("You have used your monthly limit of %d tokens. It resets on the 1st (UTC).", quota.MonthlyTokens)
+	case quota.MonthlyCost > 0 && monthly.Cost >= quota.MonthlyCost:
+		return fmt.Sprintf("You have used your monthly limit of $%.2f. It resets on the 1st (UTC).", quota.MonthlyCost)
+	}
+	return ""
+}
+
+// formatUsageTotals formats usage totals as a short multi-line summary
+func formatUsageTotals(totals storage.UsageTotals) string {
+	return fmt.Sprintf("**Tokens:** %d (%d prompt, %d completion)\n**Cost:** $%.4f\n**Requests:** %d",
+		totals.TotalTokens(), totals.PromptTokens, totals.CompletionTokens, totals.Cost, totals.Requests)
+}
+
+// formatQuotaLimits describes the non-zero limits of a quota
+func formatQuotaLimits(quota *config.UsageQuota) string {
+	var limits []string
+	if quota.DailyTokens > 0 {
+		limits = append(limits, fmt.Sprintf("%d tokens/day", quota.DailyTokens))
+	}
+	if quota.DailyCost > 0 {
+		limits = append(limits, fmt.Sprintf("$%.2f/day", quota.DailyCost))
+	}
+	if quota.MonthlyTokens > 0 {
+		limits = append(limits, fmt.Sprintf("%d tokens/month", quota.MonthlyTokens))
+	}
+	if quota.MonthlyCost > 0 {
+		limits = append(limits, fmt.Sprintf("$%.2f/month", quota.MonthlyCost))
+	}
+	if len(limits) == 0 {
+		return "Unlimited"
+	}
+	return strings.Join(limits, "\n")
+}
+
+// handleUsageCommand handles the /usage slash command
+func (b *Bot) handleUsageCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Get user ID and roles
+	var userID string
+	var roleIDs []string
+	if i.User != nil {
+		userID = i.User.ID
+	} else if i.Member != nil && i.Member.User != nil {
+		userID = i.Member.User.ID
+		roleIDs = i.Member.Roles
+	}
+
+	respond := func(content string, embeds []*discordgo.MessageEmbed) {
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+				Embeds:  embeds,
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		}); err != nil {
+			log.Printf("Failed to respond to interaction: %v", err)
+		}
+	}
+
+	cfg := b.config.Load()
+	if cfg == nil {
+		respond("❌ Configuration is not available", nil)
+		return
+	}
+	if !cfg.Usage.Enabled || b.usageLedger == nil {
+		respond("❌ Usage tracking is not enabled", nil)
+		return
+	}
+	if userID == "" {
+		respond("❌ Could not determine your user ID", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.UsageQueryTimeout*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	startOfDay := storage.StartOfDay(now)
+	startOfMonth := storage.StartOfMonth(now)
+
+	today, err := b.usageLedger.UserTotals(ctx, userID, startOfDay)
+	if err != nil {
+		log.Printf("Failed to get daily usage for user %s: %v", userID, err)
+		respond("❌ Failed to get usage statistics", nil)
+		return
+	}
+	month, err := b.usageLedger.UserTotals(ctx, userID, startOfMonth)
+	if err != nil {
+		log.Printf("Failed to get monthly usage for user %s: %v", userID, err)
+		respond("❌ Failed to get usage statistics", nil)
+		return
+	}
+
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "📅 You — today", Value: formatUsageTotals(today), Inline: true},
+		{Name: "🗓️ You — this month", Value: formatUsageTotals(month), Inline: true},
+	}
+
+	if breakdown, err := b.usageLedger.UserModelBreakdown(ctx, userID, startOfMonth); err != nil {
+		log.Printf("Failed to get usage breakdown for user %s: %v", userID, err)
+	} else if len(breakdown) > 0 {
+		var lines []string
+		for _, usage := range breakdown {
+			lines = append(lines, fmt.Sprintf("`%s`: %d tokens, $%.4f", usage.Model, usage.TotalTokens(), usage.Cost))
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "🤖 Models this month", Value: strings.Join(lines, "\n")})
+	}
+
+	if i.GuildID != "" {
+		guildToday, err := b.usageLedger.GuildTotals(ctx, i.GuildID, startOfDay)
+		if err != nil {
+			log.Printf("Failed to get daily usage for guild %s: %v", i.GuildID, err)
+		}
+		guildMonth, monthErr := b.usageLedger.GuildTotals(ctx, i.GuildID, startOfMonth)
+		if monthErr != nil {
+			log.Printf("Failed to get monthly usage for guild %s: %v", i.GuildID, monthErr)
+		}
+		if err == nil && monthErr == nil {
+			fields = append(fields,
+				&discordgo.MessageEmbedField{Name: "🏠 Server — today", Value: formatUsageTotals(guildToday), Inline: true},
+				&discordgo.MessageEmbedField{Name: "🏠 Server — this month", Value: formatUsageTotals(guildMonth), Inline: true},
+			)
+		}
+	}
+
+	quotaText := "Unlimited"
+	if quota := cfg.ResolveUsageQuota(userID, roleIDs); quota != nil {
+		quotaText = formatQuotaLimits(quota)
+	}
+	fields = append(fields, &discordgo.MessageEmbedField{Name: "⚖️ Your quota", Value: quotaText})
+
+	respond("", []*discordgo.MessageEmbed{{
+		Title:  "📊 Usage",
+		Color:  config.EmbedColorInfo,
+		Fields: fields,
+		Footer: &discordgo.MessageEmbedFooter{Text: "Token counts are the provider's where it reports them and estimates otherwise. Days and months are in UTC."},
+	}})
+}
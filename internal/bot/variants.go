@@ -0,0 +1,319 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"DiscordAIChatbot/internal/auth"
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/messaging"
+	"DiscordAIChatbot/internal/utils"
+)
+
+// variantRequest asks handleMessage to regenerate an existing reply in place
+type variantRequest struct {
+	guildID   string
+	channelID string
+	messageID string // First message of the reply, which holds the variants
+	model     string // Model override; empty uses the user's model
+	seed      int32
+	previous  []messaging.ResponseVariant
+	selected  int // Variant shown before regenerating
+}
+
+// rerollModels returns the allowed models offered in the "Try with model…" picker
+func rerollModels(cfg *config.Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	return cfg.GetAllowedModels()
+}
+
+// loadNode returns a message node from memory or the persistent cache
+func (b *Bot) loadNode(messageID string) *messaging.MsgNode {
+	if node, exists := b.nodeManager.Get(messageID); exists {
+		return node
+	}
+	if b.messageCache == nil {
+		return nil
+	}
+
+	node, err := b.messageCache.GetNode(context.Background(), messageID)
+	if err != nil {
+		log.Printf("Failed to load node from DB: %v", err)
+		return nil
+	}
+	if node != nil {
+		b.nodeManager.Set(messageID, node)
+	}
+	return node
+}
+
+// findTriggerMessage returns the user message a response answered
+func (b *Bot) findTriggerMessage(s *discordgo.Session, channelID, responseID string, node *messaging.MsgNode) (*discordgo.Message, error) {
+	if node != nil && node.ParentMsg != nil {
+		return node.ParentMsg, nil
+	}
+
+	// Responses are sent as replies to the triggering message
+	response, err := s.ChannelMessage(channelID, responseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch response: %w", err)
+	}
+	if response.MessageReference == nil || response.MessageReference.MessageID == "" {
+		return nil, fmt.Errorf("response %s is not a reply", responseID)
+	}
+	refChannelID := response.MessageReference.ChannelID
+	if refChannelID == "" {
+		refChannelID = channelID
+	}
+	return s.ChannelMessage(refChannelID, response.MessageReference.MessageID)
+}
+
+// canControlResponse reports whether a user may change a response to the given message
+func (b *Bot) canControlResponse(userID string, trigger *discordgo.Message) bool {
+	if trigger.Author != nil && trigger.Author.ID == userID {
+		return true
+	}
+	cfg := b.config.Load()
+	return cfg != nil && contains(cfg.Permissions.Users.AdminIDs, userID)
+}
+
+// replaceVariantComponents swaps the variant rows of a message's components, keeping the other rows
+func replaceVariantComponents(existing, variantRows []discordgo.MessageComponent) []discordgo.MessageComponent {
+	components := make([]discordgo.MessageComponent, 0, len(existing)+len(variantRows))
+	for _, component := range existing {
+		if !isVariantRow(component) {
+			components = append(components, component)
+		}
+	}
+	return append(components, variantRows...)
+}
+
+// isVariantRow reports whether an action row holds variant navigation or the model picker
+func isVariantRow(component discordgo.MessageComponent) bool {
+	var rowComponents []discordgo.MessageComponent
+	switch row := component.(type) {
+	case *discordgo.ActionsRow:
+		rowComponents = row.Components
+	case discordgo.ActionsRow:
+		rowComponents = row.Components
+	default:
+		return false
+	}
+
+	for _, child := range rowComponents {
+		var customID string
+		switch c := child.(type) {
+		case *discordgo.Button:
+			customID = c.CustomID
+		case discordgo.Button:
+			customID = c.CustomID
+		case *discordgo.SelectMenu:
+			customID = c.CustomID
+		case discordgo.SelectMenu:
+			customID = c.CustomID
+		}
+		for _, prefix := range []string{"variant_", "regenerate_response_", "reroll_model_"} {
+			if strings.HasPrefix(customID, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleVariantSelect flips a response to another variant with the ◀ ▶ buttons
+func (b *Bot) handleVariantSelect(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Custom ID format: variant_select_<messageID>_<index>
+	parts := strings.Split(i.MessageComponentData().CustomID, "_")
+	if len(parts) != 4 {
+		log.Printf("Invalid variant custom ID: %s", i.MessageComponentData().CustomID)
+		return
+	}
+	messageID := parts[2]
+	index, err := strconv.Atoi(parts[3])
+	if err != nil {
+		log.Printf("Invalid variant index: %v", err)
+		return
+	}
+
+	node := b.loadNode(messageID)
+	if node == nil {
+		b.respondEphemeral(s, i, "❌ The variants of this response are no longer available")
+		return
+	}
+
+	trigger, err := b.findTriggerMessage(s, i.ChannelID, messageID, node)
+	if err == nil && !b.canControlResponse(interactionUserID(i), trigger) {
+		b.respondEphemeral(s, i, "❌ Only the person who asked can switch variants")
+		return
+	}
+
+	selected, ok := node.SelectVariant(index)
+	if !ok {
+		b.respondEphemeral(s, i, "❌ That variant no longer exists")
+		return
+	}
+	variants, _ := node.GetVariants()
+
+	// Follow-up replies build on the selected variant, so persist the choice
+	if b.messageCache != nil {
+		if err := b.messageCache.SaveNode(context.Background(), messageID, node); err != nil {
+			log.Printf("Failed to save variant selection: %v", err)
+		}
+	}
+
+	webSearchPerformed, searchResultCount := node.GetWebSearchInfo()
+	embed := utils.CreateEmbed(utils.TruncateWithEllipsis(selected.Text, utils.MaxMessageLength), nil, true, &utils.FooterInfo{
+		Model:              selected.Model,
+		WebSearchPerformed: webSearchPerformed,
+		SearchResultCount:  searchResultCount,
+		Persona:            selected.Persona,
+	})
+	components := replaceVariantComponents(i.Message.Components,
+		utils.CreateVariantComponents(messageID, index, len(variants), rerollModels(b.configFor(i.GuildID, i.ChannelID))))
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	}); err != nil {
+		log.Printf("Failed to respond to interaction: %v", err)
+	}
+}
+
+// handleRegenerateResponse regenerates a response with the same model
+func (b *Bot) handleRegenerateResponse(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	messageID := strings.TrimPrefix(i.MessageComponentData().CustomID, "regenerate_response_")
+	b.startVariant(s, i, messageID, "")
+}
+
+// handleRerollModel regenerates a response with the model picked from the select menu
+func (b *Bot) handleRerollModel(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+	if len(data.Values) == 0 {
+		return
+	}
+	messageID := strings.TrimPrefix(data.CustomID, "reroll_model_")
+	b.startVariant(s, i, messageID, data.Values[0])
+}
+
+// startVariant queues the regeneration of a response as a new variant
+func (b *Bot) startVariant(s *discordgo.Session, i *discordgo.InteractionCreate, messageID, model string) {
+	userID := interactionUserID(i)
+	cfg := b.configFor(i.GuildID, i.ChannelID)
+	if cfg == nil {
+		b.respondEphemeral(s, i, "❌ Configuration is not available")
+		return
+	}
+
+	node := b.loadNode(messageID)
+	if node == nil {
+		b.respondEphemeral(s, i, "❌ This response can no longer be regenerated")
+		return
+	}
+
+	trigger, err := b.findTriggerMessage(s, i.ChannelID, messageID, node)
+	if err != nil {
+		log.Printf("Failed to find message answered by %s: %v", messageID, err)
+		b.respondEphemeral(s, i, "❌ Could not find the message this response answered")
+		return
+	}
+	if !b.canControlResponse(userID, trigger) {
+		b.respondEphemeral(s, i, "❌ Only the person who asked can regenerate this response")
+		return
+	}
+	if b.generations.IsActive(trigger.ID) {
+		b.respondEphemeral(s, i, "⏳ This response is still being generated")
+		return
+	}
+
+	if model != "" {
+		req := interactionRequester(i)
+		if decision := auth.NewModelPolicy(cfg).Check(model, req); !decision.Allowed {
+			b.respondEphemeral(s, i, deniedModelMessage(cfg, req, model, decision))
+			return
+		}
+	}
+
+	msg := *trigger
+	msg.GuildID = i.GuildID
+	if i.Member != nil {
+		msg.Member = i.Member
+	}
+	job := &messageJob{msg: &discordgo.MessageCreate{Message: &msg}}
+
+	// Regenerating costs tokens like any other message
+	if reason := b.checkQuota(job.msg); reason != "" {
+		b.respondEphemeral(s, i, "⚠️ "+reason)
+		return
+	}
+	if result := b.rateLimiter.Allow(cfg, userID, i.ChannelID); !result.Allowed {
+		b.respondEphemeral(s, i, fmt.Sprintf("⏳ You're sending messages too quickly. Try again in %s.", formatWait(result.RetryAfter)))
+		return
+	}
+
+	previous, selected := node.GetVariants()
+	if len(previous) == 0 && node.GetText() != "" {
+		// Responses from before variants existed become the first variant
+		previous = []messaging.ResponseVariant{{Text: node.GetText()}}
+	}
+	job.variant = &variantRequest{
+		guildID:   i.GuildID,
+		channelID: i.ChannelID,
+		messageID: messageID,
+		model:     model,
+		seed:      rand.Int31(),
+		previous:  previous,
+		selected:  selected,
+	}
+
+	// Show progress in place of the current variant while the new one is queued
+	emptyComponents := []discordgo.MessageComponent{}
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{{
+				Description: utils.ProgressProcessing,
+				Color:       utils.EmbedColorProcessing,
+			}},
+			Components: emptyComponents,
+		},
+	}); err != nil {
+		log.Printf("Failed to respond to interaction: %v", err)
+		return
+	}
+
+	if _, err := b.scheduler.Submit(job); err != nil {
+		log.Printf("Failed to queue regeneration of %s: %v", messageID, err)
+		b.restoreVariant(s, job.variant, "⏳ I'm very busy right now. Please try again in a moment.")
+	}
+}
+
+// restoreVariant shows the previously selected variant again after a regeneration could not start
+func (b *Bot) restoreVariant(s *discordgo.Session, variant *variantRequest, warning string) {
+	if variant.selected < 0 || variant.selected >= len(variant.previous) {
+		return
+	}
+
+	selected := variant.previous[variant.selected]
+	embed := utils.CreateEmbed(utils.TruncateWithEllipsis(selected.Text, utils.MaxMessageLength), []string{warning}, true, &utils.FooterInfo{Model: selected.Model, Persona: selected.Persona})
+	components := utils.CreateVariantComponents(variant.messageID, variant.selected, len(variant.previous), rerollModels(b.configFor(variant.guildID, variant.channelID)))
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Channel:    variant.channelID,
+		ID:         variant.messageID,
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &components,
+	}); err != nil {
+		log.Printf("Failed to restore response variant: %v", err)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"sort"
+	"strings"
 
 	yaml "gopkg.in/yaml.v3"
 )
@@ -22,9 +24,26 @@ type Config struct {
 	// Worker settings
 	WorkerCount int `yaml:"worker_count"`
 
+	// Job queue settings. Waiting messages are taken round-robin between users.
+	Queue struct {
+		// Maximum number of messages waiting across all users
+		MaxSize int `yaml:"max_size"`
+		// Maximum number of messages a single user may have waiting
+		MaxPerUser int `yaml:"max_per_user"`
+	} `yaml:"queue"`
+
+	// Rate limiting settings. Admins are never limited.
+	RateLimit struct {
+		Enabled bool            `yaml:"enabled"`
+		User    RateLimitBucket `yaml:"user"`
+		Channel RateLimitBucket `yaml:"channel"`
+	} `yaml:"rate_limit"`
+
 	// Default model for new users
 	DefaultModel  string `yaml:"default_model"`
 	FallbackModel string `yaml:"fallback_model,omitempty"`
+	// Models users may switch to with /model. Empty allows every configured model.
+	AllowedModels []string `yaml:"allowed_models,omitempty"`
 
 	// Message limits
 	MaxImages   int `yaml:"max_images"`
@@ -42,6 +61,36 @@ type Config struct {
 	// Database settings
 	DatabaseURL string `yaml:"database_url"`
 
+	// Persistent message cache settings
+	MessageCache struct {
+		// Days a cached message node is kept after it was last written.
+		// Default: 30. A negative value keeps nodes forever.
+		TTLDays int `yaml:"ttl_days"`
+	} `yaml:"message_cache"`
+
+	// Built-in export server, served alongside the health check. It hosts responses
+	// and uploads itself instead of sending them to text.is or Catbox.
+	Export struct {
+		Enabled bool `yaml:"enabled"`
+		// Public URL the health server port is reachable at, e.g. "https://bot.example.com"
+		BaseURL string `yaml:"base_url"`
+		// Directory uploads are stored in
+		// Default: "exports"
+		StorageDir string `yaml:"storage_dir"`
+		// Secret used to sign links. A random key is used when empty,
+		// so links stop working when the bot restarts.
+		SigningKey string `yaml:"signing_key"`
+		// Hours a link stays valid; uploads are deleted afterwards
+		// Default: 168 (one week)
+		LinkTTLHours int `yaml:"link_ttl_hours"`
+		// Where "View output better" pages go: "local", "textis" or "catbox"
+		// Default: "local" when enabled, otherwise "textis"
+		TextUploader string `yaml:"text_uploader"`
+		// Where files too large for Discord go: "local" or "catbox"
+		// Default: "local" when enabled, otherwise "catbox"
+		FileUploader string `yaml:"file_uploader"`
+	} `yaml:"export"`
+
 	// Logging settings
 	Logging struct {
 		LogLevel string `yaml:"log_level"`
@@ -58,6 +107,11 @@ type Config struct {
 		DeciderPrompt     string `yaml:"decider_prompt"`
 		YouTubeAPIKey     string `yaml:"youtube_api_key"`
 		GeminiGrounding   bool   `yaml:"gemini_grounding"`
+		// Turn off web search: the decider, the web_search tool and Gemini grounding
+		Disabled bool `yaml:"disabled"`
+
+		// Backends are tried in order until one succeeds
+		Backends []WebSearchBackend `yaml:"backends"`
 	} `yaml:"web_search"`
 
 	// SerpAPI settings
@@ -112,8 +166,76 @@ type Config struct {
 		// Minimum number of conversation pairs to keep unsummarized
 		// Default: 0 (can summarize all pairs)
 		MinUnsummarizedPairs int `yaml:"min_unsummarized_pairs"`
+		// Number of summaries combined into one higher-level summary
+		// Default: 4
+		FanIn int `yaml:"fan_in"`
 	} `yaml:"context_summarization"`
 
+	// Token estimation settings
+	Tokenizer struct {
+		// Scale token estimates toward counts reported by providers, sampled from
+		// Gemini CountTokens calls until each model has a few samples
+		Calibrate bool `yaml:"calibrate"`
+	} `yaml:"tokenizer"`
+
+	// Tool calling settings
+	Tools struct {
+		// Let the model call bot tools (web search, Google Lens, channel history, charts)
+		// instead of running the web search decider up front
+		Enabled bool `yaml:"enabled"`
+		// Maximum number of tool call/result rounds per response
+		// Default: 5
+		MaxRounds int `yaml:"max_rounds"`
+		// Tool names that should never be offered to the model
+		Disabled []string `yaml:"disabled"`
+	} `yaml:"tools"`
+
+	// Reasoning display settings
+	Reasoning struct {
+		// How the model's reasoning is shown: "off", "embed" (a spoilered "Thinking…" section
+		// in the response embed) or "file" (a spoilered Markdown file sent with the response).
+		// Reasoning is never kept in the conversation history.
+		// Default: "off"
+		Display string `yaml:"display"`
+	} `yaml:"reasoning"`
+
+	// Audio transcription for models that can't hear audio natively
+	Transcription struct {
+		// Backend: "gemini", "whisper" (an OpenAI-compatible /audio/transcriptions server) or "disabled"
+		// Default: "gemini"
+		Backend string `yaml:"backend"`
+		// Gemini model reference, or the model name sent to the whisper server
+		// Default: "gemini/gemini-2.5-flash", or "whisper-1" for whisper
+		Model string `yaml:"model"`
+		// Whisper server URL, e.g. "http://localhost:8000/v1"
+		BaseURL string `yaml:"base_url"`
+		APIKey  string `yaml:"api_key"`
+		// ISO-639-1 language hint, e.g. "en". Detected when empty.
+		Language string `yaml:"language"`
+	} `yaml:"transcription"`
+
+	// PDF text extraction for models that can't read PDFs natively
+	PDF struct {
+		// Model that reads scanned PDFs, which have no text to extract: a Gemini model, a model
+		// listing pdf in its input_modalities, or "disabled"
+		// Default: "gemini/gemini-2.5-flash", or "disabled" without a gemini provider
+		OCRModel string `yaml:"ocr_model"`
+		// Extracted text longer than this many tokens is split into chunks, and only the chunks
+		// most relevant to the question are sent, naming the pages left out
+		// Default: 12000
+		MaxTokens int `yaml:"max_tokens"`
+	} `yaml:"pdf"`
+
+	// Usage accounting settings
+	Usage struct {
+		// Record prompt and completion tokens per user, guild, model and day
+		Enabled bool `yaml:"enabled"`
+		// Quotas limit usage per user or role. The first quota listing the user wins,
+		// then the first quota matching one of the user's roles, then the first quota
+		// with neither user_ids nor role_ids. Admins are never limited.
+		Quotas []UsageQuota `yaml:"quotas"`
+	} `yaml:"usage"`
+
 	// Table rendering settings
 	TableRendering struct {
 		// Method for table rendering: "gg" or "rod"
@@ -130,6 +252,7 @@ type Config struct {
 
 // Provider represents an LLM provider configuration
 type Provider struct {
+	Type    string   `yaml:"type,omitempty"` // API flavour: openai, gemini, anthropic or ollama
 	BaseURL string   `yaml:"base_url"`
 	APIKey  string   `yaml:"api_key,omitempty"`  // Keep for backward compatibility
 	APIKeys []string `yaml:"api_keys,omitempty"` // New field for multiple keys
@@ -146,6 +269,18 @@ func (p *Provider) GetAPIKeys() []string {
 	return []string{}
 }
 
+// GetProviderType returns the API flavour used to talk to a provider.
+// Providers without an explicit type default to OpenAI-compatible, except "gemini".
+func (c *Config) GetProviderType(providerName string) string {
+	if provider, ok := c.Providers[providerName]; ok && provider.Type != "" {
+		return strings.ToLower(provider.Type)
+	}
+	if providerName == ProviderTypeGemini {
+		return ProviderTypeGemini
+	}
+	return ProviderTypeOpenAI
+}
+
 // GetSerpAPIKeys returns all available SerpAPI keys
 func (c *Config) GetSerpAPIKeys() []string {
 	if len(c.SerpAPI.APIKeys) > 0 {
@@ -228,6 +363,34 @@ func (c *Config) GetContextSummarizationMinUnsummarizedPairs() int {
 	return DefaultContextSummarizationMinUnsummarizedPairs
 }
 
+// GetContextSummarizationFanIn returns how many summaries are combined into one higher-level summary
+// Falls back to DefaultContextSummarizationFanIn if not specified
+func (c *Config) GetContextSummarizationFanIn() int {
+	if c.ContextSummarization.FanIn >= 2 {
+		return c.ContextSummarization.FanIn
+	}
+	return DefaultContextSummarizationFanIn
+}
+
+// GetToolMaxRounds returns the maximum number of tool call rounds per response
+// Falls back to DefaultToolMaxRounds if not specified
+func (c *Config) GetToolMaxRounds() int {
+	if c.Tools.MaxRounds > 0 {
+		return c.Tools.MaxRounds
+	}
+	return DefaultToolMaxRounds
+}
+
+// IsToolDisabled reports whether a tool has been disabled in the config
+func (c *Config) IsToolDisabled(name string) bool {
+	for _, disabled := range c.Tools.Disabled {
+		if disabled == name {
+			return true
+		}
+	}
+	return false
+}
+
 // GetModelTokenLimit returns the token limit for a specific model
 // Falls back to DefaultTokenLimit if not specified
 func (c *Config) GetModelTokenLimit(modelName string) int {
@@ -250,6 +413,83 @@ func (c *Config) GetModelTokenLimit(modelName string) int {
 	return DefaultTokenLimit
 }
 
+// RateLimitBucket configures a token bucket: up to Burst messages at once,
+// refilled at PerMinute messages per minute
+type RateLimitBucket struct {
+	Burst     int     `yaml:"burst"`
+	PerMinute float64 `yaml:"per_minute"`
+}
+
+// WebSearchBackend selects one search or extraction service. Type is one of
+// ragforge, searxng, brave, bing or readability.
+type WebSearchBackend struct {
+	Type         string `yaml:"type"`
+	BaseURL      string `yaml:"base_url,omitempty"` // Defaults to web_search.base_url for ragforge and the public API for brave and bing
+	APIKey       string `yaml:"api_key,omitempty"`
+	SnippetsOnly bool   `yaml:"snippets_only,omitempty"` // Don't fetch result pages for searxng, brave and bing
+}
+
+// UsageQuota limits the tokens and cost a user may consume. Zero limits are unlimited.
+type UsageQuota struct {
+	UserIDs       []string `yaml:"user_ids,omitempty"`
+	RoleIDs       []string `yaml:"role_ids,omitempty"`
+	DailyTokens   int64    `yaml:"daily_tokens,omitempty"`
+	MonthlyTokens int64    `yaml:"monthly_tokens,omitempty"`
+	DailyCost     float64  `yaml:"daily_cost,omitempty"`
+	MonthlyCost   float64  `yaml:"monthly_cost,omitempty"`
+}
+
+// ResolveUsageQuota returns the quota that applies to a user, or nil when usage is unlimited
+func (c *Config) ResolveUsageQuota(userID string, roleIDs []string) *UsageQuota {
+	if !c.Usage.Enabled || containsString(c.Permissions.Users.AdminIDs, userID) {
+		return nil
+	}
+
+	for i := range c.Usage.Quotas {
+		if containsString(c.Usage.Quotas[i].UserIDs, userID) {
+			return &c.Usage.Quotas[i]
+		}
+	}
+	for i := range c.Usage.Quotas {
+		for _, roleID := range roleIDs {
+			if containsString(c.Usage.Quotas[i].RoleIDs, roleID) {
+				return &c.Usage.Quotas[i]
+			}
+		}
+	}
+	for i := range c.Usage.Quotas {
+		if len(c.Usage.Quotas[i].UserIDs) == 0 && len(c.Usage.Quotas[i].RoleIDs) == 0 {
+			return &c.Usage.Quotas[i]
+		}
+	}
+	return nil
+}
+
+// GetModelTokenizer returns the tokenizer family configured for a model, or "" to match by name
+func (c *Config) GetModelTokenizer(modelName string) string {
+	if params, ok := c.Models[modelName]; ok {
+		return params.Tokenizer
+	}
+	return ""
+}
+
+// GetModelCost returns the cost in USD of a request using the model's configured prices
+func (c *Config) GetModelCost(modelName string, promptTokens, completionTokens int) float64 {
+	params, ok := c.Models[modelName]
+	if !ok {
+		return 0
+	}
+
+	var cost float64
+	if params.InputPrice != nil {
+		cost += float64(promptTokens) / 1_000_000 * *params.InputPrice
+	}
+	if params.OutputPrice != nil {
+		cost += float64(completionTokens) / 1_000_000 * *params.OutputPrice
+	}
+	return cost
+}
+
 // ModelParams represents model-specific parameters
 type ModelParams struct {
 	Temperature      *float32       `yaml:"temperature,omitempty"`
@@ -257,9 +497,23 @@ type ModelParams struct {
 	SearchParameters map[string]any `yaml:"search_parameters,omitempty"`
 	ThinkingBudget   *int32         `yaml:"thinking_budget,omitempty"`
 	TokenLimit       *int           `yaml:"token_limit,omitempty"`
+	Tokenizer        string         `yaml:"tokenizer,omitempty"`        // Tokenizer family, matched from the model name by default
+	InputPrice       *float64       `yaml:"input_price,omitempty"`      // USD per million prompt tokens
+	OutputPrice      *float64       `yaml:"output_price,omitempty"`     // USD per million completion tokens
+	Access           *ModelAccess   `yaml:"access,omitempty"`           // Who may use the model; everyone when unset
+	CostTier         int            `yaml:"cost_tier,omitempty"`        // Relative cost, higher is pricier; alternatives prefer the same tier or cheaper
+	InputModalities  []string       `yaml:"input_modalities,omitempty"` // Attachments sent natively: "audio", "pdf". Gemini takes both.
 	ExtraParams      map[string]any `yaml:",inline"`
 }
 
+// ModelAccess limits who may use a model. Users in user_ids or with a role in role_ids may use it,
+// and only in the guilds in guild_ids. Empty lists don't restrict. Admins may always use it.
+type ModelAccess struct {
+	UserIDs  []string `yaml:"user_ids,omitempty"`
+	RoleIDs  []string `yaml:"role_ids,omitempty"`
+	GuildIDs []string `yaml:"guild_ids,omitempty"`
+}
+
 // LoadConfig loads configuration from YAML file
 // It supports both local development and Render deployment:
 // 1. Local: reads from configs/config.yaml
@@ -321,6 +575,34 @@ func parseConfig(data []byte) (*Config, error) {
 	if config.WorkerCount == 0 {
 		config.WorkerCount = runtime.NumCPU() * 2 // Default to 2x threads for I/O-bound tasks
 	}
+	if config.DatabaseURL == "" {
+		config.DatabaseURL = DefaultDatabaseURL
+	}
+
+	// Set queue and rate limit defaults
+	if config.Queue.MaxSize == 0 {
+		config.Queue.MaxSize = DefaultQueueMaxSize
+	}
+	if config.Queue.MaxPerUser == 0 {
+		config.Queue.MaxPerUser = DefaultQueueMaxPerUser
+	}
+	if config.RateLimit.User.Burst == 0 {
+		config.RateLimit.User.Burst = DefaultRateLimitUserBurst
+	}
+	if config.RateLimit.User.PerMinute == 0 {
+		config.RateLimit.User.PerMinute = DefaultRateLimitUserPerMinute
+	}
+	if config.RateLimit.Channel.Burst == 0 {
+		config.RateLimit.Channel.Burst = DefaultRateLimitChannelBurst
+	}
+	if config.RateLimit.Channel.PerMinute == 0 {
+		config.RateLimit.Channel.PerMinute = DefaultRateLimitChannelPerMinute
+	}
+
+	// Set message cache defaults
+	if config.MessageCache.TTLDays == 0 {
+		config.MessageCache.TTLDays = DefaultMessageCacheTTLDays
+	}
 
 	// Set web search defaults
 	if config.WebSearch.BaseURL == "" {
@@ -341,6 +623,64 @@ func parseConfig(data []byte) (*Config, error) {
 	if config.WebSearch.FallbackModel == "" {
 		config.WebSearch.FallbackModel = DefaultFallbackModel
 	}
+	if len(config.WebSearch.Backends) == 0 {
+		// RAG-Forge first, with native page extraction when it's unreachable
+		config.WebSearch.Backends = []WebSearchBackend{
+			{Type: WebSearchBackendRAGForge},
+			{Type: WebSearchBackendReadability},
+		}
+	}
+
+	// Set reasoning defaults
+	if config.Reasoning.Display == "" {
+		config.Reasoning.Display = ReasoningDisplayOff
+	}
+
+	// Set transcription defaults
+	if config.Transcription.Backend == "" {
+		config.Transcription.Backend = TranscriptionBackendGemini
+		if _, exists := config.Providers[ProviderTypeGemini]; !exists && config.Transcription.Model == "" {
+			// Without a Gemini provider there is nothing to transcribe with until one is configured
+			config.Transcription.Backend = TranscriptionBackendDisabled
+		}
+	}
+	if config.Transcription.Model == "" {
+		config.Transcription.Model = DefaultTranscriptionModel
+		if config.Transcription.Backend == TranscriptionBackendWhisper {
+			config.Transcription.Model = DefaultWhisperModel
+		}
+	}
+
+	// Set PDF defaults
+	if config.PDF.OCRModel == "" {
+		config.PDF.OCRModel = DefaultOCRModel
+		if _, exists := config.Providers[ProviderTypeGemini]; !exists {
+			config.PDF.OCRModel = PDFOCRDisabled
+		}
+	}
+	if config.PDF.MaxTokens == 0 {
+		config.PDF.MaxTokens = DefaultPDFMaxTokens
+	}
+
+	// Set export defaults
+	if config.Export.StorageDir == "" {
+		config.Export.StorageDir = DefaultExportStorageDir
+	}
+	if config.Export.LinkTTLHours <= 0 {
+		config.Export.LinkTTLHours = DefaultExportLinkTTLHours
+	}
+	if config.Export.TextUploader == "" {
+		config.Export.TextUploader = UploaderTextIs
+		if config.Export.Enabled {
+			config.Export.TextUploader = UploaderLocal
+		}
+	}
+	if config.Export.FileUploader == "" {
+		config.Export.FileUploader = UploaderCatbox
+		if config.Export.Enabled {
+			config.Export.FileUploader = UploaderLocal
+		}
+	}
 
 	// Set logging defaults
 	if config.Logging.LogLevel == "" {
@@ -374,6 +714,39 @@ func parseConfig(data []byte) (*Config, error) {
 	if config.ContextSummarization.MinUnsummarizedPairs == 0 {
 		config.ContextSummarization.MinUnsummarizedPairs = DefaultContextSummarizationMinUnsummarizedPairs
 	}
+	if config.ContextSummarization.FanIn == 0 {
+		config.ContextSummarization.FanIn = DefaultContextSummarizationFanIn
+	}
+
+	// Set tool calling defaults
+	if config.Tools.MaxRounds == 0 {
+		config.Tools.MaxRounds = DefaultToolMaxRounds
+	}
+
+	if err := config.validateProviders(); err != nil {
+		return nil, err
+	}
+	if err := config.validateRateLimits(); err != nil {
+		return nil, err
+	}
+	if err := config.validateUsageQuotas(); err != nil {
+		return nil, err
+	}
+	if err := config.validateExport(); err != nil {
+		return nil, err
+	}
+	if err := config.validateModels(); err != nil {
+		return nil, err
+	}
+	if err := config.validateReasoning(); err != nil {
+		return nil, err
+	}
+	if err := config.validateTranscription(); err != nil {
+		return nil, err
+	}
+	if err := config.validatePDF(); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
@@ -389,13 +762,45 @@ func (c *Config) GetFirstModel() string {
 // GetDefaultModel returns the default model for new users
 func (c *Config) GetDefaultModel() string {
 	// Use the configured default model
-	if c.DefaultModel != "" {
-		// Check if the default model exists in config
-		if _, exists := c.Models[c.DefaultModel]; exists {
-			return c.DefaultModel
-		}
+	if c.DefaultModel != "" && c.IsModelAllowed(c.DefaultModel) {
+		return c.DefaultModel
+	}
+
+	// Fallback to the first allowed model
+	if allowed := c.GetAllowedModels(); len(allowed) > 0 {
+		return allowed[0]
 	}
 
 	// Fallback to the first available model from config
 	return c.GetFirstModel()
 }
+
+// IsModelAllowed reports whether a model is configured and users may switch to it
+func (c *Config) IsModelAllowed(model string) bool {
+	if _, exists := c.Models[model]; !exists {
+		return false
+	}
+	return len(c.AllowedModels) == 0 || containsString(c.AllowedModels, model)
+}
+
+// GetAllowedModels returns the models users may switch to, sorted by name
+func (c *Config) GetAllowedModels() []string {
+	var models []string
+	for model := range c.Models {
+		if c.IsModelAllowed(model) {
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// AcceptsModality reports whether a model takes "audio" or "pdf" attachments natively.
+// Gemini models take both; other models list them in input_modalities.
+func (c *Config) AcceptsModality(model, modality string) bool {
+	providerName, _, _ := strings.Cut(model, "/")
+	if c.GetProviderType(providerName) == ProviderTypeGemini {
+		return true
+	}
+	return containsString(c.Models[model].InputModalities, modality)
+}
@@ -13,6 +13,12 @@ const (
 	DefaultModel         = "gemini/gemini-2.5-pro"
 	DefaultFallbackModel = "gemini/gemini-2.5-flash"
 
+	// Provider API types
+	ProviderTypeOpenAI    = "openai"
+	ProviderTypeGemini    = "gemini"
+	ProviderTypeAnthropic = "anthropic"
+	ProviderTypeOllama    = "ollama"
+
 	// Discord status message length limit
 	MaxStatusMessageLength = 128
 
@@ -23,9 +29,51 @@ const (
 	DefaultWebSearchModel             = "gemini/gemini-2.5-flash"
 	DefaultWebSearchMaxURLsPerExtract = 20
 
+	// Web search backend types
+	WebSearchBackendRAGForge    = "ragforge"
+	WebSearchBackendSearXNG     = "searxng"
+	WebSearchBackendBrave       = "brave"
+	WebSearchBackendBing        = "bing"
+	WebSearchBackendReadability = "readability"
+
+	// Reasoning display modes
+	ReasoningDisplayOff    = "off"
+	ReasoningDisplayEmbed  = "embed"
+	ReasoningDisplayFile   = "file"
+	ReasoningPreviewLength = 700 // characters shown in embeds, which are capped at 6000 in total
+
+	// Attachment modalities and audio transcription
+	ModalityAudio                = "audio"
+	ModalityPDF                  = "pdf"
+	TranscriptionBackendGemini   = "gemini"
+	TranscriptionBackendWhisper  = "whisper"
+	TranscriptionBackendDisabled = "disabled"
+	DefaultTranscriptionModel    = "gemini/gemini-2.5-flash"
+	DefaultWhisperModel          = "whisper-1"
+	TranscriptionTimeout         = 2 // minutes
+
+	// Export server and uploaders
+	DefaultExportStorageDir   = "exports"
+	DefaultExportLinkTTLHours = 168
+	UploaderLocal             = "local"
+	UploaderTextIs            = "textis"
+	UploaderCatbox            = "catbox"
+
 	// Bot message handling
 	MaxMessageNodes = 500
 
+	// Storage defaults
+	DefaultDatabaseURL         = "sqlite://discordbot.db" // Embedded database for trying the bot without a server
+	DefaultMessageCacheTTLDays = 30
+
+	// Job queue and rate limiting defaults
+	DefaultQueueMaxSize              = 100
+	DefaultQueueMaxPerUser           = 5
+	DefaultRateLimitUserBurst        = 5
+	DefaultRateLimitUserPerMinute    = 10
+	DefaultRateLimitChannelBurst     = 20
+	DefaultRateLimitChannelPerMinute = 40
+
 	// HTTP timeouts and limits
 	DefaultHTTPTimeout    = 30 // seconds
 	MaxIdleConns          = 100
@@ -34,6 +82,30 @@ const (
 	TLSHandshakeTimeout   = 10 // seconds
 	ExpectContinueTimeout = 1  // second
 
+	// Usage accounting
+	UsageQueryTimeout = 5 // seconds
+
+	// Tokenizer calibration
+	TokenCalibrationTimeout = 15 // seconds
+
+	// Conversation export and import
+	MaxExportMessages  = 200
+	MaxExportImageSize = 4 * 1024 * 1024 // 4MB; larger images are linked instead of embedded
+	ExportTimeout      = 2               // minutes
+	MaxImportMessages  = 200             // older messages of longer transcripts are dropped
+
+	// Personas
+	MaxPersonaNameLength        = 32
+	MaxPersonaDisplayNameLength = 80
+	MaxPersonasPerUser          = 25
+
+	// System prompts and server config overrides
+	MaxSystemPromptLength  = 8000
+	MaxOverrideMaxMessages = 100
+
+	// Model access
+	MaxModelSuggestions = 3 // permitted models suggested when one is denied
+
 	// Stream response channel buffer size
 	StreamResponseBufferSize = 10
 
@@ -44,8 +116,29 @@ const (
 	EmbedColorInfo       = 0x0099ff // Blue
 
 	// File processing
-	MaxFileSize  = 10 * 1024 * 1024 // 10MB
-	PDFPageLimit = 50
+	MaxFileSize = 10 * 1024 * 1024 // 10MB
+
+	// PDF extraction, OCR and relevance ranking
+	PDFExtractionTimeout = 60   // seconds
+	MaxPDFPages          = 1000 // pages read from a PDF; later pages are noted as left out
+	MinPDFPageText       = 20   // characters; pages with less text over an image are treated as scanned
+	PDFOCRDisabled       = "disabled"
+	DefaultOCRModel      = "gemini/gemini-2.5-flash"
+	PDFOCRTimeout        = 5     // minutes
+	DefaultPDFMaxTokens  = 12000 // extracted text beyond this is cut to the chunks most relevant to the question
+	PDFChunkTokens       = 800   // target size of the chunks a long PDF is ranked in
+	PDFNoteTokens        = 100   // room kept next to the chunks for the note on what was left out
+
+	// Office documents, e-books, notebooks and zip archives
+	DocumentExtractionTimeout = 30               // seconds
+	MaxDocumentMemberSize     = 20 * 1024 * 1024 // 20MB uncompressed per file inside a document or archive
+	MaxArchiveFiles           = 50               // files extracted from an archive, nested archives included
+	MaxArchiveTotalSize       = 50 * 1024 * 1024 // 50MB uncompressed across a document or archive, nested files included
+	MaxArchiveDepth           = 3                // levels of archives nested in archives
+	MaxArchiveListedNames     = 20               // skipped or failed files named in an archive's notes; the rest are counted
+	MaxSpreadsheetRows        = 500              // per sheet; later rows are left out
+	MaxSpreadsheetColumns     = 50
+	MaxNotebookOutputLength   = 2000 // characters per cell output
 
 	// Logging defaults
 	DefaultLogLevel = "INFO"
@@ -61,4 +154,8 @@ const (
 	DefaultContextSummarizationModel                = "gemini/gemini-2.5-flash"
 	DefaultContextSummarizationMaxPairsPerBatch     = 1
 	DefaultContextSummarizationMinUnsummarizedPairs = 0
+	DefaultContextSummarizationFanIn                = 4
+
+	// Tool calling defaults
+	DefaultToolMaxRounds = 5
 )
@@ -0,0 +1,126 @@
+package config
+
+import "fmt"
+
+// Override settings, as named in /serverconfig
+const (
+	OverrideDefaultModel  = "default_model"
+	OverrideAllowedModels = "allowed_models"
+	OverrideSystemPrompt  = "system_prompt"
+	OverrideWebSearch     = "web_search"
+	OverrideMaxMessages   = "max_messages"
+	OverrideUseThreads    = "use_threads"
+)
+
+// OverrideSettings lists the settings a guild or channel can override, in display order
+var OverrideSettings = []string{
+	OverrideDefaultModel,
+	OverrideAllowedModels,
+	OverrideSystemPrompt,
+	OverrideWebSearch,
+	OverrideMaxMessages,
+	OverrideUseThreads,
+}
+
+// Overrides are settings a guild or channel changes from the YAML config.
+// Nil fields keep the value inherited from the layer below.
+type Overrides struct {
+	DefaultModel  *string  `json:"default_model,omitempty"`
+	AllowedModels []string `json:"allowed_models,omitempty"`
+	SystemPrompt  *string  `json:"system_prompt,omitempty"`
+	WebSearch     *bool    `json:"web_search,omitempty"`
+	MaxMessages   *int     `json:"max_messages,omitempty"`
+	UseThreads    *bool    `json:"use_threads,omitempty"`
+}
+
+// IsEmpty reports whether the overrides change nothing
+func (o *Overrides) IsEmpty() bool {
+	return o == nil || (o.DefaultModel == nil && o.AllowedModels == nil && o.SystemPrompt == nil &&
+		o.WebSearch == nil && o.MaxMessages == nil && o.UseThreads == nil)
+}
+
+// Has reports whether a setting is overridden
+func (o *Overrides) Has(setting string) bool {
+	if o == nil {
+		return false
+	}
+	switch setting {
+	case OverrideDefaultModel:
+		return o.DefaultModel != nil
+	case OverrideAllowedModels:
+		return o.AllowedModels != nil
+	case OverrideSystemPrompt:
+		return o.SystemPrompt != nil
+	case OverrideWebSearch:
+		return o.WebSearch != nil
+	case OverrideMaxMessages:
+		return o.MaxMessages != nil
+	case OverrideUseThreads:
+		return o.UseThreads != nil
+	}
+	return false
+}
+
+// Clear removes the override of a setting
+func (o *Overrides) Clear(setting string) error {
+	switch setting {
+	case OverrideDefaultModel:
+		o.DefaultModel = nil
+	case OverrideAllowedModels:
+		o.AllowedModels = nil
+	case OverrideSystemPrompt:
+		o.SystemPrompt = nil
+	case OverrideWebSearch:
+		o.WebSearch = nil
+	case OverrideMaxMessages:
+		o.MaxMessages = nil
+	case OverrideUseThreads:
+		o.UseThreads = nil
+	default:
+		return fmt.Errorf("unknown setting %s", setting)
+	}
+	return nil
+}
+
+// WithOverrides returns a copy of the config with each layer of overrides applied in order,
+// so later layers win. Nil layers are skipped. Overridden models that are no longer
+// configured are ignored, so a config reload can't leave a server without a model.
+func (c *Config) WithOverrides(layers ...*Overrides) *Config {
+	effective := *c
+	for _, layer := range layers {
+		if layer.IsEmpty() {
+			continue
+		}
+		if layer.AllowedModels != nil {
+			var allowed []string
+			for _, model := range layer.AllowedModels {
+				// Layers can only narrow the models allowed below them
+				if c.IsModelAllowed(model) && (len(effective.AllowedModels) == 0 || containsString(effective.AllowedModels, model)) {
+					allowed = append(allowed, model)
+				}
+			}
+			if len(allowed) > 0 {
+				effective.AllowedModels = allowed
+			}
+		}
+		if layer.DefaultModel != nil {
+			if _, exists := c.Models[*layer.DefaultModel]; exists {
+				effective.DefaultModel = *layer.DefaultModel
+			}
+		}
+		if layer.SystemPrompt != nil {
+			effective.SystemPrompt = *layer.SystemPrompt
+		}
+		if layer.WebSearch != nil {
+			// Web search turned off in the YAML config has no backends to turn back on
+			effective.WebSearch.Disabled = c.WebSearch.Disabled || !*layer.WebSearch
+		}
+		if layer.MaxMessages != nil && *layer.MaxMessages > 0 {
+			effective.MaxMessages = *layer.MaxMessages
+		}
+		if layer.UseThreads != nil {
+			effective.UseThreads = *layer.UseThreads
+		}
+	}
+	return &effective
+}
@@ -0,0 +1,330 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// paramKind describes the expected YAML type of an extra model parameter
+type paramKind int
+
+const (
+	paramAny paramKind = iota
+	paramNumber
+	paramInteger
+	paramBool
+	paramString
+	paramMap
+)
+
+// paramRule describes how a known extra request parameter is validated
+type paramRule struct {
+	kind paramKind
+	min  *float64
+	max  *float64
+}
+
+func floatPtr(v float64) *float64 { return &v }
+
+// knownExtraParams lists request body parameters understood by OpenAI-compatible providers.
+// Keys outside this list are still forwarded, but reported at load time to catch typos.
+var knownExtraParams = map[string]paramRule{
+	"top_p":                 {kind: paramNumber, min: floatPtr(0), max: floatPtr(1)},
+	"top_k":                 {kind: paramInteger, min: floatPtr(0)},
+	"min_p":                 {kind: paramNumber, min: floatPtr(0), max: floatPtr(1)},
+	"max_tokens":            {kind: paramInteger, min: floatPtr(1)},
+	"max_completion_tokens": {kind: paramInteger, min: floatPtr(1)},
+	"seed":                  {kind: paramInteger},
+	"n":                     {kind: paramInteger, min: floatPtr(1)},
+	"presence_penalty":      {kind: paramNumber, min: floatPtr(-2), max: floatPtr(2)},
+	"frequency_penalty":     {kind: paramNumber, min: floatPtr(-2), max: floatPtr(2)},
+	"repetition_penalty":    {kind: paramNumber, min: floatPtr(0)},
+	"logprobs":              {kind: paramBool},
+	"top_logprobs":          {kind: paramInteger, min: floatPtr(0), max: floatPtr(20)},
+	"parallel_tool_calls":   {kind: paramBool},
+	"store":                 {kind: paramBool},
+	"include_reasoning":     {kind: paramBool},
+	"user":                  {kind: paramString},
+	"service_tier":          {kind: paramString},
+	"verbosity":             {kind: paramString},
+	"logit_bias":            {kind: paramMap},
+	"metadata":              {kind: paramMap},
+	"response_format":       {kind: paramMap},
+	"web_search_options":    {kind: paramMap},
+	"reasoning":             {kind: paramMap},
+	"provider":              {kind: paramMap},
+	"stop":                  {kind: paramAny},
+	"tool_choice":           {kind: paramAny},
+	"modalities":            {kind: paramAny},
+	"prediction":            {kind: paramAny},
+	"audio":                 {kind: paramAny},
+	"transforms":            {kind: paramAny},
+}
+
+// reservedRequestParams are set by the bot itself and may not be overridden from config
+var reservedRequestParams = map[string]struct{}{
+	"model":          {},
+	"messages":       {},
+	"stream":         {},
+	"stream_options": {},
+	"tools":          {},
+}
+
+// validReasoningEfforts lists accepted reasoning_effort values
+var validReasoningEfforts = []string{"none", "minimal", "low", "medium", "high"}
+
+// Validate checks the model parameters. It returns an error for invalid values and
+// a list of warnings for unknown extra keys, which are still forwarded to the provider.
+func (p *ModelParams) Validate() ([]string, error) {
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2) {
+		return nil, fmt.Errorf("temperature must be between 0 and 2, got %v", *p.Temperature)
+	}
+	if p.TokenLimit != nil && *p.TokenLimit <= 0 {
+		return nil, fmt.Errorf("token_limit must be positive, got %d", *p.TokenLimit)
+	}
+	if p.InputPrice != nil && *p.InputPrice < 0 {
+		return nil, fmt.Errorf("input_price cannot be negative, got %v", *p.InputPrice)
+	}
+	if p.OutputPrice != nil && *p.OutputPrice < 0 {
+		return nil, fmt.Errorf("output_price cannot be negative, got %v", *p.OutputPrice)
+	}
+	if p.CostTier < 0 {
+		return nil, fmt.Errorf("cost_tier cannot be negative, got %d", p.CostTier)
+	}
+	for _, modality := range p.InputModalities {
+		if modality != ModalityAudio && modality != ModalityPDF {
+			return nil, fmt.Errorf("input_modalities must list audio or pdf, got %q", modality)
+		}
+	}
+	if p.ReasoningEffort != "" && !containsString(validReasoningEfforts, p.ReasoningEffort) {
+		return nil, fmt.Errorf("reasoning_effort must be one of %s, got %q", strings.Join(validReasoningEfforts, ", "), p.ReasoningEffort)
+	}
+
+	keys := make([]string, 0, len(p.ExtraParams))
+	for key := range p.ExtraParams {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var warnings []string
+	for _, key := range keys {
+		if _, reserved := reservedRequestParams[key]; reserved {
+			return nil, fmt.Errorf("%s is set by the bot and cannot be configured per model", key)
+		}
+
+		rule, known := knownExtraParams[key]
+		if !known {
+			warnings = append(warnings, fmt.Sprintf("unknown parameter %q will be forwarded as-is", key))
+			continue
+		}
+		if err := rule.check(key, p.ExtraParams[key]); err != nil {
+			return nil, err
+		}
+	}
+
+	return warnings, nil
+}
+
+// check validates a single value against the rule
+func (r paramRule) check(key string, value any) error {
+	switch r.kind {
+	case paramNumber, paramInteger:
+		num, ok := toFloat64(value)
+		if !ok {
+			return fmt.Errorf("%s must be a number, got %T", key, value)
+		}
+		if r.kind == paramInteger && num != float64(int64(num)) {
+			return fmt.Errorf("%s must be an integer, got %v", key, value)
+		}
+		if r.min != nil && num < *r.min {
+			return fmt.Errorf("%s must be at least %v, got %v", key, *r.min, value)
+		}
+		if r.max != nil && num > *r.max {
+			return fmt.Errorf("%s must be at most %v, got %v", key, *r.max, value)
+		}
+	case paramBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean, got %T", key, value)
+		}
+	case paramString:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s must be a string, got %T", key, value)
+		}
+	case paramMap:
+		if _, ok := value.(map[string]any); !ok {
+			return fmt.Errorf("%s must be a mapping, got %T", key, value)
+		}
+	}
+	return nil
+}
+
+// toFloat64 converts YAML numeric values to float64
+func toFloat64(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// containsString checks if a slice contains a string
+func containsString(slice []string, value string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyRestrictedModels were limited to one user before models had access rules. Configs
+// that still list them without rules now open them to everyone, which is worth a warning.
+var legacyRestrictedModels = []string{"openai/gpt-5"}
+
+// validateModels validates every configured model and logs warnings for unknown parameters
+// and for models that lost their old restriction
+func (c *Config) validateModels() error {
+	names := make([]string, 0, len(c.Models))
+	for name := range c.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		params := c.Models[name]
+		warnings, err := params.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid parameters for model %s: %w", name, err)
+		}
+		for _, warning := range warnings {
+			log.Printf("Config warning: model %s: %s", name, warning)
+		}
+	}
+
+	for _, name := range legacyRestrictedModels {
+		if params, exists := c.Models[name]; exists && params.Access == nil {
+			log.Printf("Config warning: model %s is available to everyone: it was limited to one user before, "+
+				"add an access block to restrict it", name)
+		}
+	}
+
+	for _, name := range c.AllowedModels {
+		if _, exists := c.Models[name]; !exists {
+			return fmt.Errorf("allowed_models lists %s, which is not configured", name)
+		}
+	}
+	return nil
+}
+
+// validateReasoning checks the reasoning display mode
+func (c *Config) validateReasoning() error {
+	if !containsString([]string{ReasoningDisplayOff, ReasoningDisplayEmbed, ReasoningDisplayFile}, c.Reasoning.Display) {
+		return fmt.Errorf("invalid reasoning.display: must be off, embed or file, got %q", c.Reasoning.Display)
+	}
+	return nil
+}
+
+// validateTranscription checks the transcription backend and where it is reached
+func (c *Config) validateTranscription() error {
+	switch c.Transcription.Backend {
+	case TranscriptionBackendDisabled:
+	case TranscriptionBackendWhisper:
+		if c.Transcription.BaseURL == "" {
+			return fmt.Errorf("transcription.base_url is required for the whisper backend")
+		}
+	case TranscriptionBackendGemini:
+		providerName, _, _ := strings.Cut(c.Transcription.Model, "/")
+		if _, exists := c.Providers[providerName]; !exists || c.GetProviderType(providerName) != ProviderTypeGemini {
+			return fmt.Errorf("transcription.model must be a Gemini model reference such as %s, got %q", DefaultTranscriptionModel, c.Transcription.Model)
+		}
+	default:
+		return fmt.Errorf("invalid transcription.backend: must be gemini, whisper or disabled, got %q", c.Transcription.Backend)
+	}
+	return nil
+}
+
+// validatePDF checks that the OCR model reads PDFs natively and the text budget fits a chunk
+func (c *Config) validatePDF() error {
+	if minTokens := PDFChunkTokens + PDFNoteTokens; c.PDF.MaxTokens < minTokens {
+		return fmt.Errorf("pdf.max_tokens must be at least %d, got %d", minTokens, c.PDF.MaxTokens)
+	}
+	if c.PDF.OCRModel == PDFOCRDisabled {
+		return nil
+	}
+	providerName, _, _ := strings.Cut(c.PDF.OCRModel, "/")
+	if _, exists := c.Providers[providerName]; !exists {
+		return fmt.Errorf("pdf.ocr_model must be a model reference such as %s with a configured provider, got %q", DefaultOCRModel, c.PDF.OCRModel)
+	}
+	if !c.AcceptsModality(c.PDF.OCRModel, ModalityPDF) || c.GetProviderType(providerName) == ProviderTypeOllama {
+		return fmt.Errorf("pdf.ocr_model %q must read PDFs natively: use a Gemini model or list pdf in its input_modalities", c.PDF.OCRModel)
+	}
+	return nil
+}
+
+// validateRateLimits checks that queue sizes and token buckets are positive
+func (c *Config) validateRateLimits() error {
+	if c.Queue.MaxSize < 0 || c.Queue.MaxPerUser < 0 {
+		return fmt.Errorf("invalid queue settings: sizes cannot be negative")
+	}
+	buckets := map[string]RateLimitBucket{"user": c.RateLimit.User, "channel": c.RateLimit.Channel}
+	for name, bucket := range buckets {
+		if bucket.Burst < 0 || bucket.PerMinute < 0 {
+			return fmt.Errorf("invalid %s rate limit: burst and per_minute cannot be negative", name)
+		}
+	}
+	return nil
+}
+
+// validateUsageQuotas checks that quota limits are not negative
+func (c *Config) validateUsageQuotas() error {
+	for i, quota := range c.Usage.Quotas {
+		if quota.DailyTokens < 0 || quota.MonthlyTokens < 0 || quota.DailyCost < 0 || quota.MonthlyCost < 0 {
+			return fmt.Errorf("invalid usage quota #%d: limits cannot be negative", i+1)
+		}
+	}
+	return nil
+}
+
+// validProviderTypes lists accepted provider type values
+var validProviderTypes = []string{ProviderTypeOpenAI, ProviderTypeGemini, ProviderTypeAnthropic, ProviderTypeOllama}
+
+// validateProviders checks that every provider declares a supported type
+func (c *Config) validateProviders() error {
+	for name, provider := range c.Providers {
+		if provider.Type == "" {
+			continue
+		}
+		if !containsString(validProviderTypes, strings.ToLower(provider.Type)) {
+			return fmt.Errorf("invalid type for provider %s: must be one of %s, got %q", name, strings.Join(validProviderTypes, ", "), provider.Type)
+		}
+	}
+	return nil
+}
+
+// validateExport checks the uploader names and that enabling the export server gives it a URL
+func (c *Config) validateExport() error {
+	if c.Export.Enabled && c.Export.BaseURL == "" {
+		return fmt.Errorf("export.base_url is required when the export server is enabled")
+	}
+	if !containsString([]string{UploaderLocal, UploaderTextIs, UploaderCatbox}, c.Export.TextUploader) {
+		return fmt.Errorf("invalid export.text_uploader: must be local, textis or catbox, got %q", c.Export.TextUploader)
+	}
+	if !containsString([]string{UploaderLocal, UploaderCatbox}, c.Export.FileUploader) {
+		return fmt.Errorf("invalid export.file_uploader: must be local or catbox, got %q", c.Export.FileUploader)
+	}
+	if !c.Export.Enabled && (c.Export.TextUploader == UploaderLocal || c.Export.FileUploader == UploaderLocal) {
+		return fmt.Errorf("the local uploader needs export.enabled")
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package context
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"log"
+
+	json "github.com/json-iterator/go"
+)
+
+// summaryNode is a summary of a run of conversation pairs. Level 1 summarizes pairs directly;
+// higher levels summarize fanIn summaries of the level below.
+type summaryNode struct {
+	hash    string
+	level   int
+	summary string
+	pairs   int // Conversation pairs covered
+}
+
+// pairHash identifies a conversation pair by its content
+func pairHash(pair ConversationPair) string {
+	hasher := sha256.New()
+	encoder := json.NewEncoder(hasher)
+	// Encoding errors only leave content out of the hash
+	_ = encoder.Encode(pair.UserMessage)
+	_ = encoder.Encode(pair.AssistantMessage)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// pairsHash identifies a batch of pairs by the hashes of the pairs in it
+func pairsHash(hashes []string) string {
+	hasher := sha256.New()
+	for _, hash := range hashes {
+		hasher.Write([]byte(hash))
+		hasher.Write([]byte{0})
+	}
+	return "pairs:" + hex.EncodeToString(hasher.Sum(nil))
+}
+
+// isBoundary reports whether a hash ends a run of at most limit items. About one hash in
+// limit/2 does, so runs end where their content says rather than where the chain starts.
+func isBoundary(hash string, limit int) bool {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(hash))
+	return hasher.Sum32()%uint32(max(limit/2, 2)) == 0
+}
+
+// nextBatchEnd returns the end of the batch starting at start: after the first pair that is a
+// boundary, or after maxPairs pairs. The chain is cut to max_messages, so its oldest pairs
+// change from turn to turn; boundaries picked by content keep every later batch the same.
+func nextBatchEnd(hashes []string, start, maxPairs int) int {
+	end := min(start+maxPairs, len(hashes))
+	for i := start; i < end; i++ {
+		if isBoundary(hashes[i], maxPairs) {
+			return i + 1
+		}
+	}
+	return end
+}
+
+// childrenHash identifies a summary of summaries by the summaries it combines
+func childrenHash(children []summaryNode) string {
+	hasher := sha256.New()
+	for _, child := range children {
+		hasher.Write([]byte(child.hash))
+		hasher.Write([]byte{0})
+	}
+	return "summaries:" + hex.EncodeToString(hasher.Sum(nil))
+}
+
+// summarizeBatch returns the level 1 summary of a batch of pairs, from the store when present.
+// hashes are the pairHash of each pair.
+func (cm *ContextManager) summarizeBatch(ctx context.Context, pairs []ConversationPair, hashes []string) (summaryNode, error) {
+	node := summaryNode{hash: pairsHash(hashes), level: 1, pairs: len(pairs)}
+	if summary, ok := cm.cachedSummary(ctx, node.hash); ok {
+		node.summary = summary
+		return node, nil
+	}
+
+	result, err := cm.summarizer.SummarizePairs(ctx, pairs)
+	if err != nil {
+		return node, err
+	}
+	node.summary = result.Summary
+	cm.storeSummary(ctx, node)
+	return node, nil
+}
+
+// combineSummaries returns the summary one level above children, from the store when present
+func (cm *ContextManager) combineSummaries(ctx context.Context, children []summaryNode) (summaryNode, error) {
+	node := summaryNode{hash: childrenHash(children), level: children[0].level + 1}
+	for _, child := range children {
+		node.pairs += child.pairs
+		if child.level >= node.level {
+			node.level = child.level + 1
+		}
+	}
+	if summary, ok := cm.cachedSummary(ctx, node.hash); ok {
+		node.summary = summary
+		return node, nil
+	}
+
+	summaries := make([]string, len(children))
+	for i, child := range children {
+		summaries[i] = child.summary
+	}
+	result, err := cm.summarizer.SummarizeSummaries(ctx, summaries)
+	if err != nil {
+		return node, err
+	}
+	node.summary = result.Summary
+	cm.storeSummary(ctx, node)
+	return node, nil
+}
+
+// foldSummaries combines the newest summaries that share a level into one of the level above,
+// like carrying in a counter, once fanIn of them gathered or the newest is a boundary. Like
+// batches, groups end where their content says, so later turns build the same tree and hit the store.
+func (cm *ContextManager) foldSummaries(ctx context.Context, stack []summaryNode, fanIn int) ([]summaryNode, error) {
+	for len(stack) >= 2 {
+		newest := stack[len(stack)-1]
+		run := 1
+		for run < len(stack) && run < fanIn && stack[len(stack)-1-run].level == newest.level {
+			run++
+		}
+		if run < 2 || (run < fanIn && !isBoundary(newest.hash, fanIn)) {
+			break
+		}
+
+		combined, err := cm.combineSummaries(ctx, stack[len(stack)-run:])
+		if err != nil {
+			return stack, err
+		}
+		stack = append(stack[:len(stack)-run], combined)
+	}
+	return stack, nil
+}
+
+// cachedSummary looks a summary up in the store. Store errors count as a miss.
+func (cm *ContextManager) cachedSummary(ctx context.Context, hash string) (string, bool) {
+	if cm.store == nil {
+		return "", false
+	}
+	summary, ok, err := cm.store.GetSummary(ctx, hash)
+	if err != nil {
+		log.Printf("Failed to load cached summary: %v", err)
+		return "", false
+	}
+	return summary, ok
+}
+
+// storeSummary saves a new summary for later turns
+func (cm *ContextManager) storeSummary(ctx context.Context, node summaryNode) {
+	if cm.store == nil {
+		return
+	}
+	if err := cm.store.SaveSummary(ctx, node.hash, node.level, node.summary); err != nil {
+		log.Printf("Failed to cache summary: %v", err)
+	}
+}
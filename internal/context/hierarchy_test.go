@@ -0,0 +1,70 @@
+package context
+
+import (
+	"fmt"
+	"testing"
+
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// testPairHashes returns the hashes of n distinct conversation pairs
+func testPairHashes(n int) []string {
+	hashes := make([]string, n)
+	for i := range hashes {
+		hashes[i] = pairHash(ConversationPair{
+			UserMessage:      messaging.OpenAIMessage{Role: "user", Content: fmt.Sprintf("question %d", i)},
+			AssistantMessage: messaging.OpenAIMessage{Role: "assistant", Content: fmt.Sprintf("answer %d", i)},
+		})
+	}
+	return hashes
+}
+
+// batchHashes splits hashes into batches and returns the hash of each
+func batchHashes(hashes []string, maxPairs int) []string {
+	var batches []string
+	for start := 0; start < len(hashes); {
+		end := nextBatchEnd(hashes, start, maxPairs)
+		batches = append(batches, pairsHash(hashes[start:end]))
+		start = end
+	}
+	return batches
+}
+
+func TestBatchesSurviveDroppedPairs(t *testing.T) {
+	for _, maxPairs := range []int{1, 2, 4, 8} {
+		t.Run(fmt.Sprintf("max %d", maxPairs), func(t *testing.T) {
+			hashes := testPairHashes(200)
+			full := make(map[string]bool)
+			for _, hash := range batchHashes(hashes, maxPairs) {
+				full[hash] = true
+			}
+
+			// Cutting the chain to max_messages drops its oldest pairs; only the batches near the new
+			// start may change, the rest must be the same as before and so be found in the store
+			for dropped := 1; dropped <= 10; dropped++ {
+				batches := batchHashes(hashes[dropped:], maxPairs)
+				missed := 0
+				for _, hash := range batches {
+					if !full[hash] {
+						missed++
+					}
+				}
+				if missed > 2 {
+					t.Errorf("dropping %d pairs changed %d of %d batches", dropped, missed, len(batches))
+				}
+			}
+		})
+	}
+}
+
+func TestNextBatchEndLimits(t *testing.T) {
+	hashes := testPairHashes(50)
+	for _, maxPairs := range []int{1, 3, 5} {
+		for start := 0; start < len(hashes); start++ {
+			end := nextBatchEnd(hashes, start, maxPairs)
+			if end <= start || end-start > maxPairs || end > len(hashes) {
+				t.Fatalf("batch from %d with at most %d pairs ends at %d", start, maxPairs, end)
+			}
+		}
+	}
+}
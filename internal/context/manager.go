@@ -6,8 +6,11 @@ import (
 	"fmt"
 	json "github.com/json-iterator/go"
 	"log"
+	"strings"
+	"time"
 
 	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
 	"DiscordAIChatbot/internal/llm"
 	"DiscordAIChatbot/internal/messaging"
 	"DiscordAIChatbot/internal/utils"
@@ -17,13 +20,16 @@ import (
 type ContextManager struct {
 	summarizer *ContextSummarizer
 	config     *config.Config
+	store      interfaces.SummaryStore
 }
 
-// NewContextManager creates a new context manager
-func NewContextManager(llmClient *llm.Client, cfg *config.Config) *ContextManager {
+// NewContextManager creates a new context manager. Summaries are reused from store
+// across turns; a nil store summarizes every time.
+func NewContextManager(llmClient *llm.Client, cfg *config.Config, store interfaces.SummaryStore) *ContextManager {
 	return &ContextManager{
 		summarizer: NewContextSummarizer(llmClient, cfg),
 		config:     cfg,
+		store:      store,
 	}
 }
 
@@ -33,19 +39,21 @@ type ManageContextResult struct {
 	TokensUsed     int
 	WasSummarized  bool
 	WasTruncated   bool
-	SummariesCount int
+	SummariesCount int // Conversation pairs replaced by summaries
 }
 
 // ManageContext processes a conversation to fit within token limits
 // It applies summarization and truncation as needed according to the configured thresholds
 func (cm *ContextManager) ManageContext(ctx context.Context, messages []messaging.OpenAIMessage, modelName string) (*ManageContextResult, error) {
+	tokens := utils.TokenizerFor(modelName, cm.config.GetModelTokenizer(modelName))
+	cm.calibrateTokenizer(modelName, tokens, messages)
+
 	// Check if context summarization is enabled
 	if !cm.config.GetContextSummarizationEnabled() {
 		// Context summarization is disabled, return messages as-is
-		tokens := utils.EstimateTokenCount(messages)
 		return &ManageContextResult{
 			Messages:       messages,
-			TokensUsed:     tokens,
+			TokensUsed:     tokens.CountMessages(messages),
 			WasSummarized:  false,
 			WasTruncated:   false,
 			SummariesCount: 0,
@@ -58,10 +66,10 @@ func (cm *ContextManager) ManageContext(ctx context.Context, messages []messagin
 	triggerTokenLimit := int(float64(tokenLimit) * triggerThreshold)
 
 	// Calculate current token usage
-	currentTokens := utils.EstimateTokenCount(messages)
+	currentTokens := tokens.CountMessages(messages)
 
-	log.Printf("Context management: %d tokens, limit: %d, trigger at: %d (%.1f%%)",
-		currentTokens, tokenLimit, triggerTokenLimit, triggerThreshold*100)
+	log.Printf("Context management: %d tokens (%s tokenizer), limit: %d, trigger at: %d (%.1f%%)",
+		currentTokens, tokens.Family(), tokenLimit, triggerTokenLimit, triggerThreshold*100)
 
 	// If we're under the trigger threshold, no action needed
 	if currentTokens <= triggerTokenLimit {
@@ -80,7 +88,7 @@ func (cm *ContextManager) ManageContext(ctx context.Context, messages []messagin
 	systemMessages, conversationMessages := cm.separateSystemMessages(messages)
 
 	// Calculate tokens used by system messages
-	systemTokens := utils.EstimateTokenCount(systemMessages)
+	systemTokens := tokens.CountMessages(systemMessages)
 	availableTokens := triggerTokenLimit - systemTokens
 
 	if availableTokens <= 0 {
@@ -88,14 +96,14 @@ func (cm *ContextManager) ManageContext(ctx context.Context, messages []messagin
 	}
 
 	// Apply context management to conversation messages
-	managedMessages, wasSummarized, wasTruncated, summariesCount, err := cm.manageConversationMessages(ctx, conversationMessages, availableTokens)
+	managedMessages, wasSummarized, wasTruncated, summariesCount, err := cm.manageConversationMessages(ctx, conversationMessages, availableTokens, tokens)
 	if err != nil {
 		return nil, fmt.Errorf("failed to manage conversation context: %w", err)
 	}
 
 	// Combine system messages with managed conversation messages
 	finalMessages := append(systemMessages, managedMessages...)
-	finalTokens := utils.EstimateTokenCount(finalMessages)
+	finalTokens := tokens.CountMessages(finalMessages)
 
 	log.Printf("Context management complete: %d → %d tokens (summarized: %v, truncated: %v, summaries: %d)",
 		currentTokens, finalTokens, wasSummarized, wasTruncated, summariesCount)
@@ -109,6 +117,37 @@ func (cm *ContextManager) ManageContext(ctx context.Context, messages []messagin
 	}, nil
 }
 
+// calibrateTokenizer has the provider count the conversation text in the background,
+// until the model's tokenizer has enough calibration samples
+func (cm *ContextManager) calibrateTokenizer(modelName string, tokens utils.Tokenizer, messages []messaging.OpenAIMessage) {
+	if !cm.config.Tokenizer.Calibrate || !utils.NeedsCalibration(modelName) {
+		return
+	}
+
+	var text strings.Builder
+	for _, msg := range messages {
+		switch content := msg.Content.(type) {
+		case string:
+			text.WriteString(content)
+		case []messaging.MessageContent:
+			for _, part := range content {
+				if part.Type == "text" {
+					text.WriteString(part.Text)
+				}
+			}
+		}
+		text.WriteString("\n")
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.TokenCalibrationTimeout*time.Second)
+		defer cancel()
+		if err := cm.summarizer.llmClient.CalibrateTokenizer(ctx, modelName, tokens, text.String()); err != nil {
+			log.Printf("Tokenizer calibration failed: %v", err)
+		}
+	}()
+}
+
 // separateSystemMessages separates system messages from conversation messages
 func (cm *ContextManager) separateSystemMessages(messages []messaging.OpenAIMessage) ([]messaging.OpenAIMessage, []messaging.OpenAIMessage) {
 	var systemMessages []messaging.OpenAIMessage
@@ -126,7 +165,7 @@ func (cm *ContextManager) separateSystemMessages(messages []messaging.OpenAIMess
 }
 
 // manageConversationMessages applies summarization and truncation to conversation messages
-func (cm *ContextManager) manageConversationMessages(ctx context.Context, messages []messaging.OpenAIMessage, availableTokens int) ([]messaging.OpenAIMessage, bool, bool, int, error) {
+func (cm *ContextManager) manageConversationMessages(ctx context.Context, messages []messaging.OpenAIMessage, availableTokens int, tokens utils.Tokenizer) ([]messaging.OpenAIMessage, bool, bool, int, error) {
 	if len(messages) == 0 {
 		return messages, false, false, 0, nil
 	}
@@ -136,18 +175,18 @@ func (cm *ContextManager) manageConversationMessages(ctx context.Context, messag
 
 	if len(pairs) == 0 {
 		// No pairs to summarize, check if we need to truncate
-		currentTokens := utils.EstimateTokenCount(messages)
+		currentTokens := tokens.CountMessages(messages)
 		if currentTokens <= availableTokens {
 			return messages, false, false, 0, nil
 		}
 
 		// Try to truncate if the last message is a user message
-		truncatedMessages, wasTruncated, _, err := cm.handleTruncation(messages, availableTokens)
+		truncatedMessages, wasTruncated, _, err := cm.handleTruncation(messages, availableTokens, tokens)
 		return truncatedMessages, false, wasTruncated, 0, err
 	}
 
 	// Apply progressive summarization
-	managedMessages, summariesCount, err := cm.applySummarization(ctx, messages, pairs, availableTokens)
+	managedMessages, summariesCount, err := cm.applySummarization(ctx, messages, pairs, availableTokens, tokens)
 	if err != nil {
 		return nil, false, false, 0, err
 	}
@@ -155,13 +194,13 @@ func (cm *ContextManager) manageConversationMessages(ctx context.Context, messag
 	wasSummarized := summariesCount > 0
 
 	// Check if we still exceed the limit after summarization
-	finalTokens := utils.EstimateTokenCount(managedMessages)
+	finalTokens := tokens.CountMessages(managedMessages)
 	if finalTokens <= availableTokens {
 		return managedMessages, wasSummarized, false, summariesCount, nil
 	}
 
 	// Still over limit, try truncation as last resort
-	truncatedMessages, wasTruncated, _, err := cm.handleTruncation(managedMessages, availableTokens)
+	truncatedMessages, wasTruncated, _, err := cm.handleTruncation(managedMessages, availableTokens, tokens)
 	if err != nil {
 		return nil, wasSummarized, false, summariesCount, err
 	}
@@ -169,73 +208,73 @@ func (cm *ContextManager) manageConversationMessages(ctx context.Context, messag
 	return truncatedMessages, wasSummarized, wasTruncated, summariesCount, nil
 }
 
-// applySummarization progressively summarizes conversation pairs until we fit within the token budget
-func (cm *ContextManager) applySummarization(ctx context.Context, messages []messaging.OpenAIMessage, pairs []ConversationPair, availableTokens int) ([]messaging.OpenAIMessage, int, error) {
+// applySummarization progressively summarizes conversation pairs, oldest first, until we fit within
+// the token budget. Batches end at boundaries picked by content, so earlier turns' summaries are reused
+// from the store, and runs of up to fanIn summaries of a level are combined into one of the level above.
+// It returns the managed messages and the number of pairs summarized.
+func (cm *ContextManager) applySummarization(ctx context.Context, messages []messaging.OpenAIMessage, pairs []ConversationPair, availableTokens int, tokens utils.Tokenizer) ([]messaging.OpenAIMessage, int, error) {
 	maxPairsPerBatch := cm.config.GetContextSummarizationMaxPairsPerBatch()
 	minUnsummarizedPairs := cm.config.GetContextSummarizationMinUnsummarizedPairs()
+	fanIn := cm.config.GetContextSummarizationFanIn()
+
+	// Messages outside pairs (e.g., a user message without an assistant response) stay at the end
+	nonPairedMessages := cm.findNonPairedMessages(messages, pairs)
 
 	currentMessages := make([]messaging.OpenAIMessage, len(messages))
 	copy(currentMessages, messages)
 
-	summariesCount := 0
-	currentPairs := pairs
-
-	for {
-		// Check current token usage
-		currentTokens := utils.EstimateTokenCount(currentMessages)
-		if currentTokens <= availableTokens {
-			// We fit within the budget
-			break
-		}
+	hashes := make([]string, len(pairs))
+	for i, pair := range pairs {
+		hashes[i] = pairHash(pair)
+	}
 
-		// Check if we have enough pairs to summarize
-		if len(currentPairs) <= minUnsummarizedPairs {
-			log.Printf("Cannot summarize further: only %d pairs left (minimum: %d)", len(currentPairs), minUnsummarizedPairs)
-			break
-		}
+	var stack []summaryNode
+	summarizedPairs := 0
 
+	for tokens.CountMessages(currentMessages) > availableTokens {
 		// Determine how many pairs to summarize in this batch
-		pairsToSummarize := maxPairsPerBatch
-		maxPossiblePairs := len(currentPairs) - minUnsummarizedPairs
-		if pairsToSummarize > maxPossiblePairs {
-			pairsToSummarize = maxPossiblePairs
-		}
+		batchEnd := nextBatchEnd(hashes, summarizedPairs, maxPairsPerBatch)
+		pairsToSummarize := min(batchEnd-summarizedPairs, len(pairs)-summarizedPairs-minUnsummarizedPairs)
+
+		if pairsToSummarize > 0 {
+			end := summarizedPairs + pairsToSummarize
+			node, err := cm.summarizeBatch(ctx, pairs[summarizedPairs:end], hashes[summarizedPairs:end])
+			if err != nil {
+				return nil, summarizedPairs, fmt.Errorf("failed to summarize conversation pairs: %w", err)
+			}
+			summarizedPairs += pairsToSummarize
 
-		if pairsToSummarize <= 0 {
+			stack, err = cm.foldSummaries(ctx, append(stack, node), fanIn)
+			if err != nil {
+				return nil, summarizedPairs, fmt.Errorf("failed to combine summaries: %w", err)
+			}
+		} else if len(stack) > 1 {
+			// No pairs left to summarize, so combine the remaining summaries into one
+			node, err := cm.combineSummaries(ctx, stack)
+			if err != nil {
+				return nil, summarizedPairs, fmt.Errorf("failed to combine summaries: %w", err)
+			}
+			stack = []summaryNode{node}
+		} else {
+			log.Printf("Cannot summarize further: only %d pairs left (minimum: %d)", len(pairs)-summarizedPairs, minUnsummarizedPairs)
 			break
 		}
 
-		// Summarize the oldest pairs
-		pairsForSummary := currentPairs[:pairsToSummarize]
-
-		log.Printf("Summarizing %d conversation pairs to reduce token usage", len(pairsForSummary))
-
-		summaryResult, err := cm.summarizer.SummarizePairs(ctx, pairsForSummary)
-		if err != nil {
-			return nil, summariesCount, fmt.Errorf("failed to summarize conversation pairs: %w", err)
+		// Summaries replace the pairs they cover, oldest first
+		newMessages := make([]messaging.OpenAIMessage, 0, len(stack)+2*(len(pairs)-summarizedPairs)+len(nonPairedMessages))
+		for _, node := range stack {
+			newMessages = append(newMessages, NewSummaryMessage(node.summary))
 		}
-
-		// Replace the summarized pairs with the summary
-		newMessages := []messaging.OpenAIMessage{summaryResult.SummaryMessage}
-
-		// Add remaining unsummarized messages
-		remainingPairs := currentPairs[pairsToSummarize:]
-		for _, pair := range remainingPairs {
+		for _, pair := range pairs[summarizedPairs:] {
 			newMessages = append(newMessages, pair.UserMessage, pair.AssistantMessage)
 		}
-
-		// Add any non-paired messages at the end (e.g., a user message without an assistant response)
-		nonPairedMessages := cm.findNonPairedMessages(messages, pairs)
 		newMessages = append(newMessages, nonPairedMessages...)
-
 		currentMessages = newMessages
-		currentPairs = remainingPairs
-		summariesCount++
 
-		log.Printf("Summarization batch complete: %d pairs summarized, %d pairs remaining", pairsToSummarize, len(remainingPairs))
+		log.Printf("Summarization step complete: %d pairs summarized in %d summaries, %d pairs remaining", summarizedPairs, len(stack), len(pairs)-summarizedPairs)
 	}
 
-	return currentMessages, summariesCount, nil
+	return currentMessages, summarizedPairs, nil
 }
 
 // findNonPairedMessages finds messages that aren't part of conversation pairs
@@ -295,7 +334,7 @@ func (cm *ContextManager) messagesEqual(msg1, msg2 messaging.OpenAIMessage) bool
 }
 
 // handleTruncation handles truncation of the latest user query as a last resort
-func (cm *ContextManager) handleTruncation(messages []messaging.OpenAIMessage, availableTokens int) ([]messaging.OpenAIMessage, bool, int, error) {
+func (cm *ContextManager) handleTruncation(messages []messaging.OpenAIMessage, availableTokens int, tokens utils.Tokenizer) ([]messaging.OpenAIMessage, bool, int, error) {
 	if len(messages) == 0 {
 		return messages, false, 0, nil
 	}
@@ -311,7 +350,7 @@ func (cm *ContextManager) handleTruncation(messages []messaging.OpenAIMessage, a
 
 	if lastUserMessageIndex == -1 {
 		// No user message to truncate
-		return messages, false, utils.EstimateTokenCount(messages), nil
+		return messages, false, tokens.CountMessages(messages), nil
 	}
 
 	// Calculate tokens used by all messages except the last user message
@@ -321,7 +360,7 @@ func (cm *ContextManager) handleTruncation(messages []messaging.OpenAIMessage, a
 		messagesWithoutLastUser = append(messagesWithoutLastUser, messages[lastUserMessageIndex+1:]...)
 	}
 
-	tokensWithoutLastUser := utils.EstimateTokenCount(messagesWithoutLastUser)
+	tokensWithoutLastUser := tokens.CountMessages(messagesWithoutLastUser)
 	availableForLastUser := availableTokens - tokensWithoutLastUser
 
 	if availableForLastUser <= 0 {
@@ -333,14 +372,14 @@ func (cm *ContextManager) handleTruncation(messages []messaging.OpenAIMessage, a
 	originalContent := cm.summarizer.extractTextContent(lastUserMessage)
 
 	// Truncate the content
-	truncatedContent := cm.summarizer.TruncateQuery(originalContent, availableForLastUser)
+	truncatedContent := cm.summarizer.TruncateQuery(originalContent, availableForLastUser, tokens)
 
 	wasTruncated := truncatedContent != originalContent
 
 	if wasTruncated {
 		log.Printf("Truncated last user message: %d → %d tokens",
-			utils.EstimateTokenCountFromText(originalContent),
-			utils.EstimateTokenCountFromText(truncatedContent))
+			tokens.CountText(originalContent),
+			tokens.CountText(truncatedContent))
 	}
 
 	// Create new message with truncated content
@@ -354,7 +393,7 @@ func (cm *ContextManager) handleTruncation(messages []messaging.OpenAIMessage, a
 	copy(finalMessages, messages)
 	finalMessages[lastUserMessageIndex] = truncatedMessage
 
-	finalTokens := utils.EstimateTokenCount(finalMessages)
+	finalTokens := tokens.CountMessages(finalMessages)
 
 	return finalMessages, wasTruncated, finalTokens, nil
 }
@@ -30,12 +30,41 @@ type ConversationPair struct {
 
 // SummaryResult contains the result of summarizing conversation pairs
 type SummaryResult struct {
+	Summary        string // The summary text without the message wrapper
 	SummaryMessage messaging.OpenAIMessage
 	OriginalTokens int // Total tokens of the original pairs
 	SummaryTokens  int // Tokens in the summary
 	TokensSaved    int // How many tokens were saved
 }
 
+// conversationSummary is the structured reply of the summarization model
+type conversationSummary struct {
+	Summary string `json:"summary"`
+}
+
+// conversationSummarySchema constrains the summarization reply to a conversationSummary
+var conversationSummarySchema = &llm.ResponseSchema{
+	Name:        "conversation_summary",
+	Description: "A concise summary of a conversation excerpt",
+	Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"summary": map[string]any{"type": "string"},
+		},
+		"required":             []string{"summary"},
+		"additionalProperties": false,
+	},
+}
+
+// Validate rejects empty summaries
+func (s *conversationSummary) Validate() error {
+	s.Summary = strings.TrimSpace(s.Summary)
+	if s.Summary == "" {
+		return fmt.Errorf("summary must not be empty")
+	}
+	return nil
+}
+
 // ContextSummarizer handles summarization of conversation pairs to manage context length
 type ContextSummarizer struct {
 	llmClient *llm.Client
@@ -66,6 +95,28 @@ func (cs *ContextSummarizer) SummarizePairs(ctx context.Context, pairs []Convers
 	conversationText := cs.buildConversationText(pairs)
 	summarizationPrompt := cs.buildSummarizationPrompt(conversationText)
 
+	log.Printf("Summarizing %d conversation pairs (%d tokens)", len(pairs), originalTokens)
+	return cs.summarize(ctx, summarizationPrompt, originalTokens)
+}
+
+// SummarizeSummaries combines summaries of consecutive parts of a conversation, oldest first,
+// into one higher-level summary
+func (cs *ContextSummarizer) SummarizeSummaries(ctx context.Context, summaries []string) (*SummaryResult, error) {
+	if len(summaries) == 0 {
+		return nil, fmt.Errorf("no summaries provided for summarization")
+	}
+
+	originalTokens := 0
+	for _, summary := range summaries {
+		originalTokens += utils.EstimateTokenCountFromText(summary)
+	}
+
+	log.Printf("Combining %d summaries (%d tokens)", len(summaries), originalTokens)
+	return cs.summarize(ctx, cs.buildCombinePrompt(summaries), originalTokens)
+}
+
+// summarize asks the summarization model to respond to prompt with a summary
+func (cs *ContextSummarizer) summarize(ctx context.Context, prompt string, originalTokens int) (*SummaryResult, error) {
 	// Prepare messages for the summarization LLM
 	summarizationMessages := []messaging.OpenAIMessage{
 		{
@@ -74,18 +125,17 @@ func (cs *ContextSummarizer) SummarizePairs(ctx context.Context, pairs []Convers
 		},
 		{
 			Role:    "user",
-			Content: summarizationPrompt,
+			Content: prompt,
 		},
 	}
 
 	// Use the configured summarization model
 	summarizationModel := cs.config.GetContextSummarizationModel()
 
-	log.Printf("Summarizing %d conversation pairs (%d tokens) using model %s", len(pairs), originalTokens, summarizationModel)
-
 	// Get summary from LLM with fallback
 	// No specific fallback for summarization, so pass an empty string
-	response, fallbackResult, err := cs.llmClient.GetChatCompletionWithFallback(ctx, summarizationMessages, summarizationModel, nil, "")
+	var summary conversationSummary
+	fallbackResult, err := cs.llmClient.GetStructuredCompletionWithFallback(ctx, summarizationMessages, summarizationModel, "", conversationSummarySchema, &summary)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get summarization from LLM (original and fallback models failed): %w", err)
 	}
@@ -95,17 +145,7 @@ func (cs *ContextSummarizer) SummarizePairs(ctx context.Context, pairs []Convers
 		log.Printf("Context summarization: Using fallback model %s (original model %s failed)", fallbackResult.FallbackModel, summarizationModel)
 	}
 
-	// Extract summary content
-	summaryContent := strings.TrimSpace(response)
-	if summaryContent == "" {
-		return nil, fmt.Errorf("received empty summary from LLM")
-	}
-
-	// Create summary message
-	summaryMessage := messaging.OpenAIMessage{
-		Role:    "system",
-		Content: fmt.Sprintf("[Summary of earlier conversation: %s]", summaryContent),
-	}
+	summaryMessage := NewSummaryMessage(summary.Summary)
 
 	// Calculate summary tokens
 	summaryTokens := utils.EstimateTokenCount([]messaging.OpenAIMessage{summaryMessage})
@@ -114,6 +154,7 @@ func (cs *ContextSummarizer) SummarizePairs(ctx context.Context, pairs []Convers
 	log.Printf("Summarization complete: %d original tokens → %d summary tokens (saved %d tokens)", originalTokens, summaryTokens, tokensSaved)
 
 	return &SummaryResult{
+		Summary:        summary.Summary,
 		SummaryMessage: summaryMessage,
 		OriginalTokens: originalTokens,
 		SummaryTokens:  summaryTokens,
@@ -121,6 +162,14 @@ func (cs *ContextSummarizer) SummarizePairs(ctx context.Context, pairs []Convers
 	}, nil
 }
 
+// NewSummaryMessage wraps a summary in the system message that replaces the summarized messages
+func NewSummaryMessage(summary string) messaging.OpenAIMessage {
+	return messaging.OpenAIMessage{
+		Role:    "system",
+		Content: fmt.Sprintf("[Summary of earlier conversation: %s]", summary),
+	}
+}
+
 // buildConversationText converts conversation pairs into a readable text format for summarization
 func (cs *ContextSummarizer) buildConversationText(pairs []ConversationPair) string {
 	builder := builderPool.Get().(*strings.Builder)
@@ -181,7 +230,30 @@ func (cs *ContextSummarizer) buildSummarizationPrompt(conversationText string) s
 Conversation to summarize:
 %s
 
-Please provide a clear, concise summary that captures the essential points of this conversation:`, conversationText)
+Put a clear, concise summary that captures the essential points of this conversation in the "summary" field.`, conversationText)
+}
+
+// buildCombinePrompt creates the prompt for merging summaries into one
+func (cs *ContextSummarizer) buildCombinePrompt(summaries []string) string {
+	builder := builderPool.Get().(*strings.Builder)
+	defer func() {
+		builder.Reset()
+		builderPool.Put(builder)
+	}()
+
+	for i, summary := range summaries {
+		_, _ = fmt.Fprintf(builder, "Part %d:\n%s\n\n", i+1, summary)
+	}
+
+	return fmt.Sprintf(`The following are summaries of consecutive parts of one conversation, oldest first. Combine them into a single concise summary that:
+
+1. Preserves key information, decisions, and context that would be important for continuing the conversation
+2. Maintains the chronological flow of the discussion
+3. Drops details that later parts made obsolete
+4. Is shorter than the parts combined
+
+%s
+Put the combined summary in the "summary" field.`, builder.String())
 }
 
 // IdentifyConversationPairs analyzes a conversation history and identifies user-assistant pairs
@@ -223,8 +295,8 @@ func (cs *ContextSummarizer) IdentifyConversationPairs(messages []messaging.Open
 }
 
 // TruncateQuery truncates a user query to fit within the remaining token budget
-func (cs *ContextSummarizer) TruncateQuery(query string, maxTokens int) string {
-	queryTokens := utils.EstimateTokenCountFromText(query)
+func (cs *ContextSummarizer) TruncateQuery(query string, maxTokens int, tokens utils.Tokenizer) string {
+	queryTokens := tokens.CountText(query)
 
 	if queryTokens <= maxTokens {
 		return query // No truncation needed
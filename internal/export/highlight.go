@@ -0,0 +1,48 @@
+package export
+
+import (
+	"html"
+	"log"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// codeStyle is the chroma style code blocks are highlighted with, to suit the dark page
+const codeStyle = "github-dark"
+
+// codeFormatter tags code tokens with classes, which codeCSS styles
+var codeFormatter = chromahtml.New(chromahtml.WithClasses(true), chromahtml.PreventSurroundingPre(true))
+
+// codeCSS is the stylesheet for highlighted code, included in every page
+var codeCSS string
+
+func init() {
+	var css strings.Builder
+	if err := codeFormatter.WriteCSS(&css, styles.Get(codeStyle)); err != nil {
+		log.Printf("Failed to generate code highlighting styles: %v", err)
+		return
+	}
+	codeCSS = css.String()
+}
+
+// highlightCode returns code as HTML, highlighted when chroma knows the language and escaped otherwise
+func highlightCode(code, language string) string {
+	lexer := lexers.Get(language)
+	if language == "" || lexer == nil {
+		return html.EscapeString(code)
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return html.EscapeString(code)
+	}
+
+	var out strings.Builder
+	if err := codeFormatter.Format(&out, styles.Get(codeStyle), iterator); err != nil {
+		return html.EscapeString(code)
+	}
+	return out.String()
+}
@@ -0,0 +1,346 @@
+package export
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Block patterns for the Markdown subset models write: headings, fenced code, math blocks,
+// lists, quotes, rules and GitHub tables
+var (
+	headingPattern   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	fencePattern     = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+#.-]*)")
+	rulePattern      = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	listItemPattern  = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])\s+`)
+	tableRulePattern = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+// Inline patterns, applied to HTML-escaped text
+var (
+	inlineCodeOrMathPattern = regexp.MustCompile("`+[^`]+`+|\\$\\$[^$]+\\$\\$|\\$[^$\\s](?:[^$\\n]*[^$\\s])?\\$")
+	linkPattern             = regexp.MustCompile(`\[([^\]]+)\]\(((?:https?://|mailto:)[^)\s]+)\)`)
+	autoLinkPattern         = regexp.MustCompile(`(^|[\s(])(https?://[^\s<)]*[^\s<).,;:!?])`)
+	boldPattern             = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	italicPattern           = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*|\b_([^_\s](?:[^_]*[^_\s])?)_\b`)
+	strikePattern           = regexp.MustCompile(`~~(.+?)~~`)
+
+	// Escaped text has no "<" of its own, so "<N>" can stand in for the Nth link
+	linkPlaceholderPattern = regexp.MustCompile(`<(\d+)>`)
+)
+
+// RenderMarkdown converts a model response to HTML. Code blocks are highlighted and math is
+// left as TeX for KaTeX; everything else is escaped.
+func RenderMarkdown(markdown string) string {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	var out strings.Builder
+	renderBlocks(&out, lines)
+	return out.String()
+}
+
+// renderBlocks renders a run of lines as block elements
+func renderBlocks(out *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case fencePattern.MatchString(line):
+			i = renderFence(out, lines, i)
+
+		case trimmed == "$$" || (strings.HasPrefix(trimmed, "$$") && !strings.HasSuffix(trimmed[2:], "$$")):
+			i = renderMathBlock(out, lines, i)
+
+		case headingPattern.MatchString(trimmed):
+			match := headingPattern.FindStringSubmatch(trimmed)
+			level := strconv.Itoa(len(match[1]))
+			out.WriteString("<h" + level + ">" + renderInline(match[2]) + "</h" + level + ">\n")
+			i++
+
+		case rulePattern.MatchString(line):
+			out.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			i = renderQuote(out, lines, i)
+
+		case listItemPattern.MatchString(line):
+			i = renderList(out, lines, i)
+
+		case i+1 < len(lines) && strings.Contains(line, "|") && tableRulePattern.MatchString(lines[i+1]) && strings.Contains(lines[i+1], "|"):
+			i = renderTable(out, lines, i)
+
+		default:
+			i = renderParagraph(out, lines, i)
+		}
+	}
+}
+
+// renderFence renders a fenced code block starting at lines[start]
+func renderFence(out *strings.Builder, lines []string, start int) int {
+	match := fencePattern.FindStringSubmatch(lines[start])
+	fence, language := match[1], match[2]
+
+	end := start + 1
+	for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), fence) {
+		end++
+	}
+
+	out.WriteString(`<pre class="chroma"><code`)
+	if language != "" {
+		out.WriteString(` class="language-` + html.EscapeString(strings.ToLower(language)) + `"`)
+	}
+	out.WriteString(">")
+	out.WriteString(highlightCode(strings.Join(lines[start+1:min(end, len(lines))], "\n"), language))
+	out.WriteString("</code></pre>\n")
+	return end + 1
+}
+
+// renderMathBlock renders a $$ display math block starting at lines[start]
+func renderMathBlock(out *strings.Builder, lines []string, start int) int {
+	body := []string{strings.TrimPrefix(strings.TrimSpace(lines[start]), "$$")}
+	end := start + 1
+	for ; end < len(lines); end++ {
+		trimmed := strings.TrimSpace(lines[end])
+		if strings.HasSuffix(trimmed, "$$") {
+			body = append(body, strings.TrimSuffix(trimmed, "$$"))
+			break
+		}
+		body = append(body, lines[end])
+	}
+
+	out.WriteString(`<div class="math">$$` + html.EscapeString(strings.Join(body, "\n")) + "$$</div>\n")
+	return end + 1
+}
+
+// renderQuote renders consecutive "> " lines as a blockquote
+func renderQuote(out *strings.Builder, lines []string, start int) int {
+	var body []string
+	end := start
+	for ; end < len(lines); end++ {
+		trimmed := strings.TrimSpace(lines[end])
+		if !strings.HasPrefix(trimmed, ">") {
+			break
+		}
+		body = append(body, strings.TrimPrefix(strings.TrimPrefix(trimmed, ">"), " "))
+	}
+
+	out.WriteString("<blockquote>\n")
+	renderBlocks(out, body)
+	out.WriteString("</blockquote>\n")
+	return end
+}
+
+// renderList renders a list starting at lines[start]. Lines indented past an item's
+// marker belong to the item and are rendered as blocks, which nests sublists.
+func renderList(out *strings.Builder, lines []string, start int) int {
+	first := listItemPattern.FindStringSubmatch(lines[start])
+	indent := len(first[1])
+	ordered := isOrdered(first[2])
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	out.WriteString("<" + tag + ">\n")
+
+	end := start
+	for end < len(lines) {
+		match := listItemPattern.FindStringSubmatch(lines[end])
+		if match == nil || len(match[1]) != indent || isOrdered(match[2]) != ordered {
+			break
+		}
+
+		contentIndent := len(match[0])
+		item := []string{lines[end][contentIndent:]}
+		end++
+		for end < len(lines) {
+			line := lines[end]
+			if strings.TrimSpace(line) == "" {
+				// A blank line continues the item only if indented content follows
+				if end+1 < len(lines) && leadingSpaces(lines[end+1]) > indent {
+					item = append(item, "")
+					end++
+					continue
+				}
+				break
+			}
+			if leadingSpaces(line) <= indent {
+				break
+			}
+			item = append(item, strings.TrimPrefix(line, strings.Repeat(" ", min(leadingSpaces(line), contentIndent))))
+			end++
+		}
+
+		out.WriteString("<li>" + renderInline(item[0]))
+		if len(item) > 1 {
+			out.WriteString("\n")
+			renderBlocks(out, item[1:])
+		}
+		out.WriteString("</li>\n")
+
+		// Skip a blank line between items of the same list
+		if end+1 < len(lines) && strings.TrimSpace(lines[end]) == "" {
+			if next := listItemPattern.FindStringSubmatch(lines[end+1]); next != nil && len(next[1]) == indent && isOrdered(next[2]) == ordered {
+				end++
+			}
+		}
+	}
+
+	out.WriteString("</" + tag + ">\n")
+	return end
+}
+
+// isOrdered reports whether a list marker is numbered
+func isOrdered(marker string) bool {
+	return marker[0] >= '0' && marker[0] <= '9'
+}
+
+// renderTable renders a GitHub table whose header is lines[start]
+func renderTable(out *strings.Builder, lines []string, start int) int {
+	header := tableCells(lines[start])
+	var aligns []string
+	for _, cell := range tableCells(lines[start+1]) {
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "center")
+		case strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "right")
+		case strings.HasPrefix(cell, ":"):
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+
+	writeRow := func(cells []string, tag string) {
+		out.WriteString("<tr>")
+		for i, cell := range cells {
+			out.WriteString("<" + tag)
+			if i < len(aligns) && aligns[i] != "" {
+				out.WriteString(` style="text-align:` + aligns[i] + `"`)
+			}
+			out.WriteString(">" + renderInline(cell) + "</" + tag + ">")
+		}
+		out.WriteString("</tr>\n")
+	}
+
+	out.WriteString("<table>\n<thead>\n")
+	writeRow(header, "th")
+	out.WriteString("</thead>\n<tbody>\n")
+
+	end := start + 2
+	for ; end < len(lines); end++ {
+		if strings.TrimSpace(lines[end]) == "" || !strings.Contains(lines[end], "|") {
+			break
+		}
+		writeRow(tableCells(lines[end]), "td")
+	}
+	out.WriteString("</tbody>\n</table>\n")
+	return end
+}
+
+// tableCells splits a table row into trimmed cells
+func tableCells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	row = strings.TrimSuffix(row, "|")
+	cells := strings.Split(row, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// renderParagraph renders lines up to the next blank line or block as a paragraph,
+// keeping line breaks as Discord does
+func renderParagraph(out *strings.Builder, lines []string, start int) int {
+	end := start + 1
+	for end < len(lines) {
+		line := lines[end]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || fencePattern.MatchString(line) || headingPattern.MatchString(trimmed) ||
+			strings.HasPrefix(trimmed, ">") || listItemPattern.MatchString(line) || rulePattern.MatchString(line) {
+			break
+		}
+		end++
+	}
+
+	rendered := make([]string, 0, end-start)
+	for _, line := range lines[start:end] {
+		rendered = append(rendered, renderInline(strings.TrimSpace(line)))
+	}
+	out.WriteString("<p>" + strings.Join(rendered, "<br>\n") + "</p>\n")
+	return end
+}
+
+// renderInline escapes text and renders emphasis, links and code spans. Code and math
+// spans are kept out of the other rules so their contents render literally.
+func renderInline(text string) string {
+	var out strings.Builder
+	last := 0
+	for _, span := range inlineCodeOrMathPattern.FindAllStringIndex(text, -1) {
+		out.WriteString(renderEmphasis(text[last:span[0]]))
+		token := text[span[0]:span[1]]
+		if strings.HasPrefix(token, "`") {
+			out.WriteString("<code>" + html.EscapeString(strings.Trim(token, "`")) + "</code>")
+		} else {
+			out.WriteString(`<span class="math">` + html.EscapeString(token) + "</span>")
+		}
+		last = span[1]
+	}
+	out.WriteString(renderEmphasis(text[last:]))
+	return out.String()
+}
+
+// renderEmphasis escapes text, then renders links, bold, italics and strikethrough. Links are
+// swapped for placeholders while emphasis is rendered, so it can't reach into their URLs.
+func renderEmphasis(text string) string {
+	var links []string
+	link := func(href, label string) string {
+		links = append(links, `<a href="`+href+`" rel="noopener noreferrer">`+label+"</a>")
+		return "<" + strconv.Itoa(len(links)-1) + ">"
+	}
+
+	escaped := html.EscapeString(text)
+	escaped = linkPattern.ReplaceAllStringFunc(escaped, func(match string) string {
+		parts := linkPattern.FindStringSubmatch(match)
+		return link(parts[2], renderStyles(parts[1]))
+	})
+	escaped = autoLinkPattern.ReplaceAllStringFunc(escaped, func(match string) string {
+		parts := autoLinkPattern.FindStringSubmatch(match)
+		return parts[1] + link(parts[2], parts[2])
+	})
+	escaped = renderStyles(escaped)
+	return linkPlaceholderPattern.ReplaceAllStringFunc(escaped, func(placeholder string) string {
+		index, _ := strconv.Atoi(placeholder[1 : len(placeholder)-1])
+		return links[index]
+	})
+}
+
+// renderStyles renders bold, italics and strikethrough in escaped text
+func renderStyles(escaped string) string {
+	escaped = boldPattern.ReplaceAllString(escaped, "<strong>$1$2</strong>")
+	escaped = italicPattern.ReplaceAllString(escaped, "<em>$1$2</em>")
+	return strikePattern.ReplaceAllString(escaped, "<del>$1</del>")
+}
+
+// leadingSpaces counts the indentation of a line, with tabs as four spaces
+func leadingSpaces(line string) int {
+	count := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			count++
+		case '\t':
+			count += 4
+		default:
+			return count
+		}
+	}
+	return count
+}
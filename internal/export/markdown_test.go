@@ -0,0 +1,69 @@
+package export
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"escapes HTML", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"escapes attributes", `<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>\n"},
+		{"heading", "## Title *one*", "<h2>Title <em>one</em></h2>\n"},
+		{"emphasis", "**bold** *italic* ~~gone~~", "<p><strong>bold</strong> <em>italic</em> <del>gone</del></p>\n"},
+		{
+			"link",
+			"[the **docs**](https://example.com/a_b_c)",
+			`<p><a href="https://example.com/a_b_c" rel="noopener noreferrer">the <strong>docs</strong></a></p>` + "\n",
+		},
+		{
+			"emphasis stays out of link URLs",
+			"see https://x.com/**y** and [z](https://x.com/_a_)",
+			`<p>see <a href="https://x.com/**y**" rel="noopener noreferrer">https://x.com/**y**</a> and <a href="https://x.com/_a_" rel="noopener noreferrer">z</a></p>` + "\n",
+		},
+		{
+			"emphasis around a link",
+			"**read [this](https://example.com)**",
+			`<p><strong>read <a href="https://example.com" rel="noopener noreferrer">this</a></strong></p>` + "\n",
+		},
+		{"javascript links stay text", "[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>\n"},
+		{"inline code is literal", "`**a** <b>`", "<p><code>**a** &lt;b&gt;</code></p>\n"},
+		{"inline math is literal", "$a_1 * b_2$", `<p><span class="math">$a_1 * b_2$</span></p>` + "\n"},
+		{"math block", "$$\nx < y\n$$", `<div class="math">$$` + "\nx &lt; y\n" + `$$</div>` + "\n"},
+		{"list", "- one\n- two\n  - nested", "<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul>\n</li>\n</ul>\n"},
+		{"quote", "> quoted", "<blockquote>\n<p>quoted</p>\n</blockquote>\n"},
+		{
+			"table",
+			"| a | b |\n|:--|--:|\n| 1 | 2 |",
+			"<table>\n<thead>\n<tr><th style=\"text-align:left\">a</th><th style=\"text-align:right\">b</th></tr>\n</thead>\n<tbody>\n<tr><td style=\"text-align:left\">1</td><td style=\"text-align:right\">2</td></tr>\n</tbody>\n</table>\n",
+		},
+		{"unknown language", "```nosuchlang\n<b>\n```", `<pre class="chroma"><code class="language-nosuchlang">&lt;b&gt;</code></pre>` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderMarkdown(tt.markdown); got != tt.want {
+				t.Errorf("RenderMarkdown(%q) =\n%s\nwant\n%s", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownHighlightsCode(t *testing.T) {
+	got := RenderMarkdown("```go\nfunc main() { s := \"</code><script>\" }\n```")
+	if !strings.HasPrefix(got, `<pre class="chroma"><code class="language-go">`) {
+		t.Errorf("code block is not tagged with its language:\n%s", got)
+	}
+	if !strings.Contains(got, `<span class="kd">func</span>`) {
+		t.Errorf("code is not highlighted:\n%s", got)
+	}
+	if strings.Contains(got, "<script>") || strings.Count(got, "</code>") != 1 {
+		t.Errorf("code is not escaped:\n%s", got)
+	}
+	if !strings.Contains(codeCSS, ".chroma .kd") {
+		t.Error("the highlighting stylesheet is missing")
+	}
+}
@@ -0,0 +1,113 @@
+package export
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+)
+
+// KaTeX assets for rendering math, pinned with the integrity hashes KaTeX publishes for the
+// release. Code is highlighted when the Markdown is rendered, so math is the only thing pages
+// load from elsewhere, and pages still read well without it: math stays as TeX.
+const (
+	katexBase              = "https://cdn.jsdelivr.net/npm/katex@0.16.9/dist/"
+	katexCSS               = katexBase + "katex.min.css"
+	katexCSSIntegrity      = "sha384-n8MVd4RsNIU0tAv4ct0nTaAbDJwPJzDEaqSD1odI+WdtXRGWt2kTvGFasHpSy3SV"
+	katexJS                = katexBase + "katex.min.js"
+	katexJSIntegrity       = "sha384-XjKyOOlGwcjNTAIQHIpgOno0Hl1YQqzUOEleOLALmuqehneUG+vnGctmUb0ZY0l8"
+	katexRenderJS          = katexBase + "contrib/auto-render.min.js"
+	katexRenderJSIntegrity = "sha384-+VBxd3r6XgURycqtZ117nYw44OOcIax56Z4dCRWbxyPt0Koah1uHoK0o4+/RRE05"
+)
+
+// pageCSP only lets pages load the KaTeX files above, its fonts and the script carrying the page nonce
+const pageCSP = "default-src 'none'; img-src 'self' data:; media-src 'self'; " +
+	"style-src 'unsafe-inline' " + katexCSS + "; font-src " + katexBase + "fonts/; " +
+	"script-src 'nonce-%s' " + katexJS + " " + katexRenderJS + "; base-uri 'none'; form-action 'none'"
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="referrer" content="no-referrer">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+{{if .Scripts}}<link rel="stylesheet" href="{{.KatexCSS}}" integrity="{{.KatexCSSIntegrity}}" crossorigin="anonymous">
+{{end}}<style>
+body { margin: 0; background: #313338; color: #dbdee1; font: 16px/1.6 "gg sans", "Segoe UI", Helvetica, Arial, sans-serif; }
+main { max-width: 860px; margin: 0 auto; padding: 32px 20px 64px; }
+a { color: #00a8fc; }
+h1, h2, h3, h4, h5, h6 { color: #f2f3f5; line-height: 1.25; }
+pre { background: #1e1f22; border-radius: 6px; padding: 12px; overflow-x: auto; }
+code { font: 14px/1.45 Consolas, "Courier New", monospace; background: #1e1f22; border-radius: 4px; padding: 2px 4px; }
+pre code { padding: 0; background: none; }
+blockquote { margin: 0; padding: 0 12px; border-left: 4px solid #4e5058; }
+table { border-collapse: collapse; margin: 12px 0; display: block; overflow-x: auto; }
+th, td { border: 1px solid #4e5058; padding: 6px 12px; }
+th { background: #2b2d31; }
+hr { border: none; border-top: 1px solid #4e5058; }
+img, video { max-width: 100%; }
+.meta { color: #949ba4; font-size: 13px; }
+.math { overflow-x: auto; }
+{{.CodeCSS}}
+</style>
+</head>
+<body>
+<main>
+{{.Body}}
+</main>
+{{if .Scripts}}<script src="{{.KatexJS}}" integrity="{{.KatexJSIntegrity}}" crossorigin="anonymous" defer></script>
+<script src="{{.KatexRenderJS}}" integrity="{{.KatexRenderJSIntegrity}}" crossorigin="anonymous" defer></script>
+<script nonce="{{.Nonce}}">
+window.addEventListener("DOMContentLoaded", function () {
+  if (window.renderMathInElement) {
+    document.querySelectorAll(".math").forEach(function (el) {
+      renderMathInElement(el, { delimiters: [
+        { left: "$$", right: "$$", display: true },
+        { left: "$", right: "$", display: false }
+      ], throwOnError: false });
+    });
+  }
+});
+</script>
+{{end}}</body>
+</html>
+`))
+
+// pageData fills the page template
+type pageData struct {
+	Title                  string
+	Body                   template.HTML
+	CodeCSS                template.CSS
+	Nonce                  string
+	Scripts                bool
+	KatexCSS               string
+	KatexCSSIntegrity      string
+	KatexJS                string
+	KatexJSIntegrity       string
+	KatexRenderJS          string
+	KatexRenderJSIntegrity string
+}
+
+// RenderPage wraps rendered Markdown in a styled HTML page. With a nonce, pages with math
+// load KaTeX; otherwise the page has no scripts and needs nothing but itself.
+func RenderPage(title string, body template.HTML, nonce string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := pageTemplate.Execute(&buf, pageData{
+		Title:                  title,
+		Body:                   body,
+		CodeCSS:                template.CSS(codeCSS),
+		Nonce:                  nonce,
+		Scripts:                nonce != "" && strings.Contains(string(body), `class="math"`),
+		KatexCSS:               katexCSS,
+		KatexCSSIntegrity:      katexCSSIntegrity,
+		KatexJS:                katexJS,
+		KatexJSIntegrity:       katexJSIntegrity,
+		KatexRenderJS:          katexRenderJS,
+		KatexRenderJSIntegrity: katexRenderJSIntegrity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
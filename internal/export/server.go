@@ -0,0 +1,299 @@
+package export
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+)
+
+// routePrefix is where stored uploads are served on the health server
+const routePrefix = "/export/"
+
+// cleanupInterval is how often expired uploads are deleted
+const cleanupInterval = time.Hour
+
+// textExtension marks uploads that are Markdown responses rendered as pages
+const textExtension = ".md"
+
+// storedNamePattern matches the names uploads are stored under: a random ID and an extension
+var storedNamePattern = regexp.MustCompile(`^[0-9a-f]{32}(\.[a-z0-9]{1,10})?$`)
+
+// Server stores uploads on disk and serves them on the health server through signed links
+// that expire after the configured TTL. It implements interfaces.Uploader.
+type Server struct {
+	baseURL string
+	dir     string
+	key     []byte
+	ttl     time.Duration
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+var _ interfaces.Uploader = (*Server)(nil)
+
+// NewServer creates the export server from the export config and starts deleting expired uploads
+func NewServer(cfg *config.Config) (*Server, error) {
+	if cfg.Export.BaseURL == "" {
+		return nil, fmt.Errorf("export.base_url is required")
+	}
+	if _, err := url.Parse(cfg.Export.BaseURL); err != nil {
+		return nil, fmt.Errorf("invalid export.base_url: %w", err)
+	}
+	if err := os.MkdirAll(cfg.Export.StorageDir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create export storage directory: %w", err)
+	}
+
+	key := []byte(cfg.Export.SigningKey)
+	if len(key) == 0 {
+		log.Printf("⚠️ export.signing_key is not set; export links will stop working when the bot restarts")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+	}
+
+	s := &Server{
+		baseURL: strings.TrimSuffix(cfg.Export.BaseURL, "/"),
+		dir:     cfg.Export.StorageDir,
+		key:     key,
+		ttl:     time.Duration(cfg.Export.LinkTTLHours) * time.Hour,
+		stop:    make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.cleanupWorker()
+
+	return s, nil
+}
+
+// Register adds the export routes to mux
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+routePrefix+"{name}", s.handleExport)
+}
+
+// Name returns "local"
+func (s *Server) Name() string {
+	return config.UploaderLocal
+}
+
+// UploadFile stores a file and returns a signed link to it
+func (s *Server) UploadFile(_ context.Context, filename string, data []byte) (string, error) {
+	return s.store(fileExtension(filename), data)
+}
+
+// UploadText stores a Markdown response and returns a signed link to its rendered page
+func (s *Server) UploadText(_ context.Context, content string) (string, error) {
+	return s.store(textExtension, []byte(content))
+}
+
+// store writes data under a new random name and returns its signed link
+func (s *Server) store(extension string, data []byte) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+	name := hex.EncodeToString(id) + extension
+
+	if err := os.WriteFile(filepath.Join(s.dir, name), data, 0o640); err != nil {
+		return "", fmt.Errorf("failed to store upload: %w", err)
+	}
+	return s.SignedURL(name, time.Now().Add(s.ttl)), nil
+}
+
+// SignedURL returns a link to a stored upload that is valid until expires
+func (s *Server) SignedURL(name string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	params := url.Values{"expires": {exp}, "sig": {s.sign(name, exp)}}
+	return s.baseURL + routePrefix + name + "?" + params.Encode()
+}
+
+// sign computes the link signature for a name and expiry
+func (s *Server) sign(name, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(name + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// handleExport serves a stored upload after checking its link signature.
+// Markdown responses are rendered as pages; media is served inline and anything else as a download.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !storedNamePattern.MatchString(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	expires := r.URL.Query().Get("expires")
+	sig := r.URL.Query().Get("sig")
+	if !hmac.Equal([]byte(sig), []byte(s.sign(name, expires))) {
+		http.Error(w, "invalid link", http.StatusForbidden)
+		return
+	}
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		http.Error(w, "this link has expired", http.StatusGone)
+		return
+	}
+
+	path := filepath.Join(s.dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+
+	extension := filepath.Ext(name)
+	if extension == textExtension {
+		s.servePage(w, path)
+		return
+	}
+
+	contentType := mime.TypeByExtension(extension)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if !isInlineType(contentType) {
+		w.Header().Set("Content-Disposition", "attachment; filename=\"export"+extension+"\"")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Printf("Failed to close export file: %v", err)
+		}
+	}()
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// servePage renders a stored Markdown response
+func (s *Server) servePage(w http.ResponseWriter, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		http.Error(w, "failed to read export", http.StatusInternalServerError)
+		return
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		http.Error(w, "failed to render export", http.StatusInternalServerError)
+		return
+	}
+	nonceText := hex.EncodeToString(nonce)
+
+	page, err := RenderPage("Response", template.HTML(RenderMarkdown(string(data))), nonceText)
+	if err != nil {
+		log.Printf("Failed to render export page: %v", err)
+		http.Error(w, "failed to render export", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(pageCSP, nonceText))
+	if _, err := w.Write(page); err != nil {
+		log.Printf("Failed to write export page: %v", err)
+	}
+}
+
+// cleanupWorker deletes uploads older than the link TTL, whose links have all expired
+func (s *Server) cleanupWorker() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		s.deleteExpired(time.Now().Add(-s.ttl))
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// deleteExpired deletes uploads written before cutoff
+func (s *Server) deleteExpired(cutoff time.Time) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Printf("Failed to list exports: %v", err)
+		return
+	}
+
+	deleted := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !storedNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err != nil {
+			log.Printf("Failed to delete expired export %s: %v", entry.Name(), err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d expired exports", deleted)
+	}
+}
+
+// Close stops the cleanup worker
+func (s *Server) Close() error {
+	close(s.stop)
+	s.wg.Wait()
+	return nil
+}
+
+// fileExtension returns a safe lowercase extension for a stored upload
+func fileExtension(filename string) string {
+	extension := strings.ToLower(filepath.Ext(filename))
+	if !storedNamePattern.MatchString(strings.Repeat("0", 32) + extension) {
+		return ""
+	}
+	// Uploaded Markdown files are served as files, not rendered
+	if extension == textExtension {
+		return ".txt"
+	}
+	return extension
+}
+
+// isInlineType reports whether a content type is shown in the browser rather than downloaded
+func isInlineType(contentType string) bool {
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/pdf", "text/plain"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return !strings.HasPrefix(contentType, "image/svg")
+		}
+	}
+	return false
+}
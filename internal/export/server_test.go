@@ -0,0 +1,170 @@
+package export
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// newTestServer starts an export server storing uploads in a temporary directory
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Export.BaseURL = "https://bot.example.com"
+	cfg.Export.StorageDir = t.TempDir()
+	cfg.Export.SigningKey = "test-key"
+	cfg.Export.LinkTTLHours = 1
+
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	mux := http.NewServeMux()
+	s.Register(mux)
+	httpServer := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		httpServer.Close()
+		_ = s.Close()
+	})
+	return s, httpServer
+}
+
+// get requests a link's path and query from the test server
+func get(t *testing.T, httpServer *httptest.Server, link string) *http.Response {
+	t.Helper()
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(httpServer.URL + parsed.RequestURI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func TestServerChecksLinks(t *testing.T) {
+	s, httpServer := newTestServer(t)
+	link, err := s.UploadFile(context.Background(), "notes.txt", []byte("notes"))
+	if err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+	if !strings.HasPrefix(link, "https://bot.example.com/export/") {
+		t.Errorf("link %s is not under the base URL", link)
+	}
+	parsed, _ := url.Parse(link)
+	name := strings.TrimPrefix(parsed.Path, routePrefix)
+
+	forged := parsed.Query()
+	forged.Set("sig", strings.Repeat("0", 64))
+	expired := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name   string
+		link   string
+		status int
+	}{
+		{"valid", link, http.StatusOK},
+		{"forged signature", routePrefix + name + "?" + forged.Encode(), http.StatusForbidden},
+		{"signature of another upload", routePrefix + strings.Repeat("a", 32) + ".txt?" + parsed.RawQuery, http.StatusForbidden},
+		{"expired", s.SignedURL(name, expired), http.StatusGone},
+		{"bad name", s.SignedURL("..%2Fconfig.yaml", time.Now().Add(time.Hour)), http.StatusNotFound},
+		{"uppercase name", s.SignedURL(strings.ToUpper(name), time.Now().Add(time.Hour)), http.StatusNotFound},
+		{"missing upload", s.SignedURL(strings.Repeat("b", 32)+".txt", time.Now().Add(time.Hour)), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := get(t, httpServer, tt.link); resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestServerContentHeaders(t *testing.T) {
+	s, httpServer := newTestServer(t)
+	tests := []struct {
+		filename    string
+		contentType string
+		attachment  bool
+	}{
+		{"page.html", "text/html", true},
+		{"image.svg", "image/svg+xml", true},
+		{"photo.png", "image/png", false},
+		{"notes.txt", "text/plain", false},
+		{"response.md", "text/plain", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			link, err := s.UploadFile(context.Background(), tt.filename, []byte("<script>alert(1)</script>"))
+			if err != nil {
+				t.Fatalf("UploadFile: %v", err)
+			}
+			resp := get(t, httpServer, link)
+			if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+				t.Errorf("Content-Type %q, want %s", got, tt.contentType)
+			}
+			if got := resp.Header.Get("Content-Disposition"); strings.HasPrefix(got, "attachment") != tt.attachment {
+				t.Errorf("Content-Disposition %q, want attachment %v", got, tt.attachment)
+			}
+			if got := resp.Header.Get("Content-Security-Policy"); !strings.Contains(got, "sandbox") {
+				t.Errorf("Content-Security-Policy %q does not sandbox the file", got)
+			}
+		})
+	}
+}
+
+func TestServerRendersPages(t *testing.T) {
+	s, httpServer := newTestServer(t)
+	link, err := s.UploadText(context.Background(), "# Title\n\n<script>alert(1)</script>\n\n$$x^2$$")
+	if err != nil {
+		t.Fatalf("UploadText: %v", err)
+	}
+	resp := get(t, httpServer, link)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(body)
+
+	if got := resp.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type %q, want an HTML page", got)
+	}
+	if strings.Contains(page, "<script>alert") || !strings.Contains(page, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Error("the response's HTML is not escaped")
+	}
+
+	// The page's scripts are the pinned KaTeX files and its own inline script
+	csp := resp.Header.Get("Content-Security-Policy")
+	for _, source := range strings.Fields(csp[strings.Index(csp, "script-src"):strings.Index(csp, "; base-uri")])[1:] {
+		if source != katexJS && source != katexRenderJS && !strings.HasPrefix(source, "'nonce-") {
+			t.Errorf("script-src allows %s", source)
+		}
+	}
+	if strings.Count(page, `integrity="sha384-`) != 3 || strings.Count(page, `crossorigin="anonymous"`) != 3 {
+		t.Error("KaTeX is loaded without integrity hashes")
+	}
+	nonce := csp[strings.Index(csp, "'nonce-")+len("'nonce-"):]
+	nonce = nonce[:strings.Index(nonce, "'")]
+	if !strings.Contains(page, `<script nonce="`+nonce+`">`) {
+		t.Error("the page's script doesn't carry the CSP nonce")
+	}
+}
+
+func TestPagesWithoutMathHaveNoScripts(t *testing.T) {
+	page, err := RenderPage("Response", "<p>No math here</p>", "nonce")
+	if err != nil {
+		t.Fatalf("RenderPage: %v", err)
+	}
+	if strings.Contains(string(page), "<script") || strings.Contains(string(page), "cdn.jsdelivr.net") {
+		t.Errorf("page without math loads scripts:\n%s", page)
+	}
+}
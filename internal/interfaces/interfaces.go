@@ -2,41 +2,92 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
-	openai "github.com/sashabaranov/go-openai"
 
 	"DiscordAIChatbot/internal/messaging"
 )
 
-// LLMProvider defines the interface for LLM communication
+// LLMProvider defines a provider-neutral streaming chat backend.
+// Implementations exist for OpenAI-compatible APIs, Gemini, Anthropic and Ollama.
 type LLMProvider interface {
-	// CreateChatCompletionStream creates a streaming chat completion
-	CreateChatCompletionStream(ctx context.Context, model string, messages []messaging.OpenAIMessage) (*openai.ChatCompletionStream, error)
+	// Name returns the provider type, e.g. "openai" or "anthropic"
+	Name() string
 
-	// StreamChatCompletion streams chat completion responses
-	StreamChatCompletion(ctx context.Context, model string, messages []messaging.OpenAIMessage) (<-chan StreamResponse, error)
-
-	// GenerateVideo generates a video
-	GenerateVideo(ctx context.Context, model string, prompt string) ([]byte, error)
-
-	// BuildMessages creates OpenAI messages from conversation chain
-	BuildMessages(nodes []*messaging.MsgNode, maxImages int, acceptImages, acceptUsernames bool) ([]messaging.OpenAIMessage, []string)
+	// StreamChat streams a chat completion for the request
+	StreamChat(ctx context.Context, req ChatRequest) (<-chan StreamResponse, error)
+}
 
-	// AddSystemPrompt adds system prompt to messages
-	AddSystemPrompt(messages []messaging.OpenAIMessage, systemPrompt string, acceptUsernames bool) []messaging.OpenAIMessage
+// ChatRequest describes a single streaming chat completion request
+type ChatRequest struct {
+	// Model is the full "provider/model" reference from the config
+	Model        string
+	Messages     []messaging.OpenAIMessage
+	DetectedURLs []string
+	// Tools may be empty when no tool calling is desired
+	Tools []ToolDefinition
+}
 
-	// TestProviderConnectivity tests if a provider's server is reachable
-	TestProviderConnectivity(providerName string) error
+// ToolDefinition describes a function the model may call
+type ToolDefinition struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the function arguments
+	Parameters map[string]any
 }
 
 // StreamResponse represents a streaming response chunk
 type StreamResponse struct {
-	Content       string
-	FinishReason  string
-	Error         error
-	ImageData     []byte
-	ImageMIMEType string
+	Content string
+	// Reasoning is thinking text the model streams before or alongside Content.
+	// It is shown separately and never becomes part of the reply.
+	Reasoning         string
+	FinishReason      string
+	Error             error
+	ImageData         []byte
+	ImageMIMEType     string
+	GroundingMetadata *messaging.GroundingMetadata
+	// ToolCalls is set on the final chunk when the model requests tool execution
+	ToolCalls []messaging.ToolCall
+	// Metadata is set on the final chunk with what the provider reported about the response
+	Metadata *ResponseMetadata
+}
+
+// ResponseMetadata is the usage and finish details a provider reports for a response.
+// Token counts are zero when the provider didn't report them.
+type ResponseMetadata struct {
+	PromptTokens     int
+	CompletionTokens int
+	CachedTokens     int // Prompt tokens served from the provider's cache
+	ReasoningTokens  int // Completion tokens spent thinking
+	// FirstTokenLatency is the time from sending the request to the first content or reasoning
+	FirstTokenLatency time.Duration
+	FinishReason      string
+	// SafetyFlags names the safety filters that blocked or flagged the response
+	SafetyFlags []string
+}
+
+// HasUsage reports whether the provider reported token usage
+func (m *ResponseMetadata) HasUsage() bool {
+	return m != nil && (m.PromptTokens > 0 || m.CompletionTokens > 0)
+}
+
+// Add sums in the usage of a later request of the same response, such as a tool round.
+// The first token latency stays that of the first request; the finish reason becomes the latest.
+func (m *ResponseMetadata) Add(other *ResponseMetadata) {
+	if other == nil {
+		return
+	}
+	m.PromptTokens += other.PromptTokens
+	m.CompletionTokens += other.CompletionTokens
+	m.CachedTokens += other.CachedTokens
+	m.ReasoningTokens += other.ReasoningTokens
+	if m.FirstTokenLatency == 0 {
+		m.FirstTokenLatency = other.FirstTokenLatency
+	}
+	m.FinishReason = other.FinishReason
+	m.SafetyFlags = append(m.SafetyFlags, other.SafetyFlags...)
 }
 
 // FileProcessor defines the interface for file processing
@@ -66,12 +117,34 @@ type WebSearchProvider interface {
 	CheckHealth(ctx context.Context) error
 }
 
+// Uploader publishes files and responses and returns a link to them.
+// Implementations exist for Catbox, text.is and the built-in export server.
+type Uploader interface {
+	// Name returns the uploader name, e.g. "catbox"
+	Name() string
+
+	// UploadFile publishes a file such as a generated video or image
+	UploadFile(ctx context.Context, filename string, data []byte) (string, error)
+
+	// UploadText publishes a Markdown response as a readable page
+	UploadText(ctx context.Context, content string) (string, error)
+}
+
 // PermissionChecker defines the interface for permission checking
 type PermissionChecker interface {
 	// CheckPermissions checks if a user has permission to use the bot
 	CheckPermissions(m *discordgo.MessageCreate) bool
 }
 
+// SummaryStore persists conversation summaries keyed by a hash of what they summarize
+type SummaryStore interface {
+	// GetSummary returns the summary stored under hash, if any
+	GetSummary(ctx context.Context, hash string) (string, bool, error)
+
+	// SaveSummary stores a summary; level is 1 for conversation pairs and higher for summaries of summaries
+	SaveSummary(ctx context.Context, hash string, level int, summary string) error
+}
+
 // UserPreferences defines the interface for user preference management
 type UserPreferences interface {
 	// GetUserModel returns the user's preferred model
@@ -96,16 +169,16 @@ type UserPreferences interface {
 // APIKeyManager defines the interface for API key management
 type APIKeyManager interface {
 	// GetNextAPIKey returns the next available API key for a provider
-	GetNextAPIKey(provider string, availableKeys []string) (string, error)
+	GetNextAPIKey(ctx context.Context, provider string, availableKeys []string) (string, error)
 
 	// MarkKeyAsBad marks an API key as bad so it won't be used again
-	MarkKeyAsBad(provider, apiKey string, reason string) error
+	MarkKeyAsBad(ctx context.Context, provider, apiKey string, reason string) error
 
 	// ResetBadKeys resets bad keys for a provider
-	ResetBadKeys(provider string) error
+	ResetBadKeys(ctx context.Context, provider string) error
 
 	// GetBadKeyStats returns statistics about bad keys
-	GetBadKeyStats() (map[string]int, error)
+	GetBadKeyStats(ctx context.Context) (map[string]int, error)
 
 	// Close closes the database connection
 	Close() error
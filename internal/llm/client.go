@@ -10,15 +10,13 @@ import (
 	"sync"
 	"time"
 
-	json "github.com/json-iterator/go"
-
 	"golang.org/x/sync/singleflight"
 
 	lru "github.com/hashicorp/golang-lru/v2"
-	openai "github.com/sashabaranov/go-openai"
 	"google.golang.org/genai"
 
 	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
 	"DiscordAIChatbot/internal/llm/providers"
 	"DiscordAIChatbot/internal/logging"
 	"DiscordAIChatbot/internal/messaging"
@@ -36,10 +34,10 @@ type LLMClient struct {
 	config         *config.Config
 	apiKeyManager  *storage.APIKeyManager
 	geminiProvider *providers.GeminiProvider
-	openAIClients  map[string]*openai.Client
-	clientMapMutex sync.RWMutex
+	providers      map[string]interfaces.LLMProvider
 	imageCache     *lru.Cache[string, *ImageCacheEntry]
 	imageCacheMu   sync.RWMutex
+	mediaTextCache *lru.Cache[string, string] // Audio transcripts and PDF text, see AdaptModalities
 	httpClient     *http.Client
 	fetchGroup     singleflight.Group
 }
@@ -54,60 +52,70 @@ func NewLLMClient(cfg *config.Config, apiKeyManager *storage.APIKeyManager, http
 	if err != nil {
 		log.Fatalf("Failed to create image cache: %v", err)
 	}
+	mediaTextCache, err := lru.New[string, string](256)
+	if err != nil {
+		log.Fatalf("Failed to create media text cache: %v", err)
+	}
 	client := &LLMClient{
 		config:         cfg,
 		apiKeyManager:  apiKeyManager,
-		geminiProvider: providers.NewGeminiProvider(cfg, apiKeyManager),
-		openAIClients:  make(map[string]*openai.Client),
 		imageCache:     imageCache,
+		mediaTextCache: mediaTextCache,
 		httpClient:     httpClient,
 	}
+
+	helpers := providers.Helpers{
+		DownloadImage:            client.downloadImageFromURL,
+		IsAPIKeyError:            client.isAPIKeyError,
+		Is503Error:               client.is503Error,
+		RetryWith503Backoff:      client.retryWith503Backoff,
+		IsInternalError:          client.isInternalError,
+		RetryWithInternalBackoff: client.retryWithInternalBackoff,
+	}
+	// Streams can outlive the shared client's timeout, so native providers rely on the request context instead
+	streamClient := &http.Client{Transport: httpClient.Transport}
+
+	client.geminiProvider = providers.NewGeminiProvider(cfg, apiKeyManager).WithHelpers(helpers)
+	client.providers = map[string]interfaces.LLMProvider{
+		config.ProviderTypeOpenAI:    providers.NewOpenAIProvider(cfg, apiKeyManager, helpers),
+		config.ProviderTypeGemini:    client.geminiProvider,
+		config.ProviderTypeAnthropic: providers.NewAnthropicProvider(cfg, apiKeyManager, streamClient, helpers),
+		config.ProviderTypeOllama:    providers.NewOllamaProvider(cfg, apiKeyManager, streamClient, helpers),
+	}
 	return client
 }
 
-// isGeminiModel checks if the given model uses the Gemini provider
+// IsGeminiModel checks if the given model uses the Gemini provider
 func (c *LLMClient) IsGeminiModel(model string) bool {
 	parts := strings.SplitN(model, "/", 2)
 	if len(parts) != 2 {
 		return false
 	}
-	return parts[0] == "gemini"
+	return c.config.GetProviderType(parts[0]) == config.ProviderTypeGemini
 }
 
 // StreamResponse represents a streaming response chunk
-type StreamResponse struct {
-	Content           string
-	FinishReason      string
-	Error             error
-	ImageData         []byte
-	ImageMIMEType     string
-	GroundingMetadata *genai.GroundingMetadata
-}
+type StreamResponse = interfaces.StreamResponse
 
-// createGeminiStream creates a streaming chat completion using Gemini
-func (c *LLMClient) createGeminiStream(ctx context.Context, model string, messages []messaging.OpenAIMessage, detectedURLs []string) (<-chan StreamResponse, error) {
-	stream, err := c.geminiProvider.CreateGeminiStream(ctx, model, messages, detectedURLs, c.downloadImageFromURL, c.isAPIKeyError, c.is503Error, c.retryWith503Backoff, c.isInternalError, c.retryWithInternalBackoff)
-	if err != nil {
-		return nil, err
-	}
+// ResponseMetadata is the usage and finish details reported with the final chunk of a stream
+type ResponseMetadata = interfaces.ResponseMetadata
 
-	// Convert provider.StreamResponse to llm.StreamResponse
-	responseChan := make(chan StreamResponse, 10)
-	go func() {
-		defer close(responseChan)
-		for resp := range stream {
-			responseChan <- StreamResponse{
-				Content:           resp.Content,
-				FinishReason:      resp.FinishReason,
-				Error:             resp.Error,
-				ImageData:         resp.ImageData,
-				ImageMIMEType:     resp.ImageMIMEType,
-				GroundingMetadata: resp.GroundingMetadata,
-			}
-		}
-	}()
+// providerFor returns the chat provider serving a "provider/model" reference
+func (c *LLMClient) providerFor(model string) (interfaces.LLMProvider, error) {
+	parts := strings.SplitN(model, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid model format: %s (expected provider/model)", model)
+	}
+	if _, exists := c.config.Providers[parts[0]]; !exists {
+		return nil, fmt.Errorf("unknown provider: %s", parts[0])
+	}
 
-	return responseChan, nil
+	providerType := c.config.GetProviderType(parts[0])
+	provider, exists := c.providers[providerType]
+	if !exists {
+		return nil, fmt.Errorf("unsupported type %q for provider %s", providerType, parts[0])
+	}
+	return provider, nil
 }
 
 // GenerateVideo generates a video using the appropriate provider
@@ -128,298 +136,61 @@ func (c *LLMClient) GenerateImage(ctx context.Context, model string, prompt stri
 	return c.geminiProvider.GenerateImage(ctx, model, prompt, c.isAPIKeyError, c.is503Error, c.retryWith503Backoff, c.isInternalError, c.retryWithInternalBackoff)
 }
 
-// getOpenAIClient gets a client from the cache or creates a new one if it doesn't exist
-func (c *LLMClient) getOpenAIClient(providerName, baseURL, apiKey string) *openai.Client {
-	c.clientMapMutex.Lock()
-	defer c.clientMapMutex.Unlock()
-
-	// Use a combination of provider and key to cache clients
-	cacheKey := providerName + ":" + apiKey
-	if client, exists := c.openAIClients[cacheKey]; exists {
-		return client
-	}
-
-	clientConfig := openai.DefaultConfig(apiKey)
-	if baseURL != "" {
-		clientConfig.BaseURL = baseURL
-	}
-	newClient := openai.NewClientWithConfig(clientConfig)
-	c.openAIClients[cacheKey] = newClient
-	return newClient
-}
-
-// CreateChatCompletionStream creates a streaming chat completion
-func (c *LLMClient) CreateChatCompletionStream(ctx context.Context, model string, messages []messaging.OpenAIMessage) (*openai.ChatCompletionStream, error) {
-	// Check if this is a Gemini model
-	if c.IsGeminiModel(model) {
-		return nil, fmt.Errorf("use StreamChatCompletion method for Gemini models")
-	}
-
-	// Parse provider and model
-	parts := strings.SplitN(model, "/", 2)
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid model format: %s (expected provider/model)", model)
-	}
-
-	providerName := parts[0]
-	modelName := parts[1]
-
-	// Get provider config
-	provider, exists := c.config.Providers[providerName]
-	if !exists {
-		return nil, fmt.Errorf("unknown provider: %s", providerName)
-	}
-
-	// Get model parameters
-	modelParams, exists := c.config.Models[model]
-	if !exists {
-		modelParams = config.ModelParams{}
-	}
-
-	// Get available API keys for this provider
-	availableKeys := provider.GetAPIKeys()
-	if len(availableKeys) == 0 {
-		return nil, fmt.Errorf("no API keys configured for provider: %s", providerName)
-	}
-
-	// Convert messages to OpenAI format
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openaiMsg := openai.ChatCompletionMessage{
-			Role: msg.Role,
-			Name: msg.Name,
-		}
-
-		// Handle different content types
-		switch content := msg.Content.(type) {
-		case string:
-			openaiMsg.Content = content
-		case []messaging.MessageContent:
-			var parts []openai.ChatMessagePart
-			for _, part := range content {
-				if part.Type == "text" {
-					parts = append(parts, openai.ChatMessagePart{
-						Type: openai.ChatMessagePartTypeText,
-						Text: part.Text,
-					})
-				} else if part.Type == "image_url" && part.ImageURL != nil {
-					parts = append(parts, openai.ChatMessagePart{
-						Type: openai.ChatMessagePartTypeImageURL,
-						ImageURL: &openai.ChatMessageImageURL{
-							URL: part.ImageURL.URL,
-						},
-					})
-				}
-			}
-			openaiMsg.MultiContent = parts
-		default:
-			openaiMsg.Content = fmt.Sprintf("%v", content)
-		}
-
-		openaiMessages[i] = openaiMsg
-	}
-
-	// Create request
-	req := openai.ChatCompletionRequest{
-		Model:    modelName,
-		Messages: openaiMessages,
-		Stream:   true,
-	}
-
-	// Apply model-specific parameters
-	if modelParams.Temperature != nil {
-		req.Temperature = *modelParams.Temperature
-	}
-
-	// Log request start
-	logging.LogToFile("Starting OpenAI-compatible LLM request: Model=%s, Provider=%s", req.Model, providerName)
-
-	// Debug: Print OpenAI payload
-	c.logOpenAIPayload(req, providerName, provider.BaseURL)
-
-	// Try API keys until one works or we run out
-	maxRetries := len(availableKeys)
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		apiKey, err := c.apiKeyManager.GetNextAPIKey(ctx, providerName, availableKeys)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get API key: %w", err)
-		}
-
-		client := c.getOpenAIClient(providerName, provider.BaseURL, apiKey)
-
-		// Try to create stream with 503 retry mechanism
-		var stream *openai.ChatCompletionStream
-		err = c.retryWith503Backoff(ctx, func() error {
-			var streamErr error
-			stream, streamErr = client.CreateChatCompletionStream(ctx, req)
-			return streamErr
-		})
-
-		if err != nil {
-			detailedErr := c.buildDetailedError(err, providerName, provider.BaseURL)
-
-			if c.isAPIKeyError(err) {
-				markErr := c.apiKeyManager.MarkKeyAsBad(ctx, providerName, apiKey, err.Error())
-				if markErr != nil {
-					fmt.Printf("Failed to mark API key as bad: %v\n", markErr)
-				}
-				fmt.Printf("API key issue detected, trying next key. %v\n", detailedErr)
-				continue
-			}
-
-			return nil, fmt.Errorf("failed to create chat completion stream: %w", detailedErr)
-		}
-
-		return stream, nil
-	}
-
-	return nil, fmt.Errorf("all API keys failed for provider: %s", providerName)
-}
-
-// logOpenAIPayload logs the OpenAI API request payload for debugging
-func (c *LLMClient) logOpenAIPayload(req openai.ChatCompletionRequest, providerName, baseURL string) {
-	logging.LogExternalContentToFile("=== DEBUG: OpenAI-Compatible API Payload ===")
-	logging.LogExternalContentToFile("Model: %s", req.Model)
-	logging.LogExternalContentToFile("Provider: %s", providerName)
-	logging.LogExternalContentToFile("BaseURL: %s", baseURL)
-	logging.LogExternalContentToFile("Temperature: %f", req.Temperature)
-	logging.LogExternalContentToFile("Stream: %t", req.Stream)
-	logging.LogExternalContentToFile("Messages:")
-	for i, msg := range req.Messages {
-		logging.LogExternalContentToFile("  Message %d [Role: %s]:", i, msg.Role)
-		if msg.Name != "" {
-			logging.LogExternalContentToFile("    Name: %s", msg.Name)
-		}
-		if msg.Content != "" {
-			// Highlight system messages in the debug output
-			if msg.Role == "system" {
-				logging.LogExternalContentToFile("    SystemPrompt: %s", msg.Content)
-			} else {
-				logging.LogExternalContentToFile("    Content: %s", msg.Content)
-			}
-		} else if len(msg.MultiContent) > 0 {
-			logging.LogExternalContentToFile("    MultiContent:")
-			for j, part := range msg.MultiContent {
-				if part.Type == openai.ChatMessagePartTypeText {
-					logging.LogExternalContentToFile("      Part %d [Text]: %s", j, part.Text)
-				} else if part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil {
-					logging.LogExternalContentToFile("      Part %d [Image]: %s", j, part.ImageURL.URL)
-				}
-			}
-		}
-	}
-
-	// Also print as JSON for complete payload visibility
-	if payloadJSON, err := json.MarshalIndent(req, "", "  "); err == nil {
-		logging.LogExternalContentToFile("Complete JSON Payload:\n%s", string(payloadJSON))
-	}
-	logging.LogExternalContentToFile("=== END DEBUG ===\n")
-}
-
-// buildDetailedError builds a detailed error message with helpful suggestions
-func (c *LLMClient) buildDetailedError(err error, providerName, baseURL string) error {
-	errStr := err.Error()
-
-	// Detect common issues and provide helpful suggestions
-	if strings.Contains(errStr, "invalid character") && strings.Contains(errStr, "looking for beginning of value") {
-		return fmt.Errorf("server returned non-JSON response (likely HTML error page). "+
-			"Provider: %s, BaseURL: %s, Error: %w. "+
-			"This usually means: 1) The server at %s is down or misconfigured, "+
-			"2) Wrong base URL in config, or 3) Server returning HTML error pages instead of JSON. "+
-			"If using GitHub Copilot proxy, check proxy logs for upstream API errors",
-			providerName, baseURL, err, baseURL)
-	} else if strings.Contains(errStr, "Bad Request") || strings.Contains(errStr, "status code: 400") {
-		return fmt.Errorf("bad request error from API. "+
-			"Provider: %s, BaseURL: %s, Error: %w. "+
-			"This usually means: 1) Invalid request parameters, 2) Authentication issues, "+
-			"3) Model not available, or 4) Quota/rate limit exceeded",
-			providerName, baseURL, err)
-	} else if strings.Contains(errStr, "connection refused") || strings.Contains(errStr, "no such host") {
-		return fmt.Errorf("cannot connect to server. "+
-			"Provider: %s, BaseURL: %s, Error: %w. "+
-			"Please check: 1) Is the server running at %s? 2) Is the base URL correct? 3) Network connectivity",
-			providerName, baseURL, err, baseURL)
-	} else if strings.Contains(errStr, "timeout") {
-		return fmt.Errorf("request timeout. "+
-			"Provider: %s, BaseURL: %s, Error: %w. "+
-			"The server may be overloaded or too slow to respond",
-			providerName, baseURL, err)
-	} else {
-		return fmt.Errorf("request failed. "+
-			"Provider: %s, BaseURL: %s, Error: %w",
-			providerName, baseURL, err)
-	}
-}
-
 // StreamChatCompletion streams chat completion responses
 func (c *LLMClient) StreamChatCompletion(ctx context.Context, model string, messages []messaging.OpenAIMessage, detectedURLs []string) (<-chan StreamResponse, error) {
-	// Check if this is a Gemini model
-	if c.IsGeminiModel(model) {
-		return c.createGeminiStream(ctx, model, messages, detectedURLs)
-	}
+	return c.StreamChatCompletionWithTools(ctx, model, messages, detectedURLs, nil)
+}
 
-	// Handle OpenAI-compatible models
-	stream, err := c.CreateChatCompletionStream(ctx, model, messages)
+// StreamChatCompletionWithTools streams chat completion responses while offering the given tools to the model.
+// When the model requests tool execution, the final chunk carries the calls and FinishReason "tool_calls".
+func (c *LLMClient) StreamChatCompletionWithTools(ctx context.Context, model string, messages []messaging.OpenAIMessage, detectedURLs []string, tools *ToolRegistry) (<-chan StreamResponse, error) {
+	provider, err := c.providerFor(model)
 	if err != nil {
 		return nil, err
 	}
 
-	responseChan := make(chan StreamResponse, 10)
+	start := time.Now()
+	stream, err := provider.StreamChat(ctx, interfaces.ChatRequest{
+		Model:        model,
+		Messages:     messages,
+		DetectedURLs: detectedURLs,
+		Tools:        tools.Definitions(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return withFirstTokenLatency(ctx, start, stream), nil
+}
 
+// withFirstTokenLatency forwards a stream, stamping the time from start to the first
+// content or reasoning on the metadata of its final chunk
+func withFirstTokenLatency(ctx context.Context, start time.Time, stream <-chan StreamResponse) <-chan StreamResponse {
+	forwarded := make(chan StreamResponse, config.StreamResponseBufferSize)
 	go func() {
-		defer close(responseChan)
-		defer func() {
-			if err := stream.Close(); err != nil {
-				log.Printf("Failed to close stream: %v", err)
+		defer close(forwarded)
+		var latency time.Duration
+		for chunk := range stream {
+			if latency == 0 && (chunk.Content != "" || chunk.Reasoning != "" || len(chunk.ImageData) > 0) {
+				latency = time.Since(start)
 			}
-		}()
-
-		for {
-			response, err := stream.Recv()
-			if err != nil {
-				if err == io.EOF {
-					// Stream finished normally
-					responseChan <- StreamResponse{FinishReason: "stop"}
-					return
+			if chunk.FinishReason != "" || chunk.Metadata != nil {
+				if chunk.Metadata == nil {
+					chunk.Metadata = &ResponseMetadata{FinishReason: chunk.FinishReason}
 				}
-
-				// Stream error
-				responseChan <- StreamResponse{Error: err}
-				return
+				chunk.Metadata.FirstTokenLatency = latency
 			}
 
-			// Process response
-			if len(response.Choices) > 0 {
-				choice := response.Choices[0]
-
-				// Log the response content
-				if choice.Delta.Content != "" {
-					logging.LogExternalContentToFile("OpenAI Response Text: %s", choice.Delta.Content)
-				}
-				if choice.FinishReason != "" {
-					logging.LogExternalContentToFile("OpenAI Response Finish Reason: %s", string(choice.FinishReason))
-				}
-
-				streamResp := StreamResponse{
-					Content:      choice.Delta.Content,
-					FinishReason: string(choice.FinishReason),
-				}
-
-				select {
-				case responseChan <- streamResp:
-				case <-ctx.Done():
-					return
-				}
-
-				// Check if stream is finished
-				if choice.FinishReason != "" {
-					return
+			select {
+			case forwarded <- chunk:
+			case <-ctx.Done():
+				// Drain the provider so it isn't left blocked on a send
+				for range stream {
 				}
+				return
 			}
 		}
 	}()
-
-	return responseChan, nil
+	return forwarded
 }
 
 // GetChatCompletion gets a complete chat completion response (non-streaming)
@@ -642,7 +413,8 @@ type FallbackResult struct {
 }
 
 // StreamChatCompletionWithFallback streams chat completion with an enforced Gemini 2.5 Flash fallback.
-func (c *LLMClient) StreamChatCompletionWithFallback(ctx context.Context, model string, messages []messaging.OpenAIMessage, detectedURLs []string, fallbackModel string) (<-chan StreamResponse, *FallbackResult, error) {
+// tools may be nil when no tool calling is desired.
+func (c *LLMClient) StreamChatCompletionWithFallback(ctx context.Context, model string, messages []messaging.OpenAIMessage, detectedURLs []string, fallbackModel string, tools *ToolRegistry) (<-chan StreamResponse, *FallbackResult, error) {
 	fallbackResult := &FallbackResult{
 		UsedFallback:  false,
 		FallbackModel: "",
@@ -652,7 +424,7 @@ func (c *LLMClient) StreamChatCompletionWithFallback(ctx context.Context, model
 	fallbackModel = c.resolveFallbackModel(fallbackModel)
 
 	// Try original model first
-	stream, err := c.StreamChatCompletion(ctx, model, messages, detectedURLs)
+	stream, err := c.StreamChatCompletionWithTools(ctx, model, messages, detectedURLs, tools)
 	if err != nil {
 		// If the error does not warrant a fallback, or if no fallback is configured, return the error.
 		if !c.ShouldFallback(err) || fallbackModel == "" {
@@ -666,7 +438,7 @@ func (c *LLMClient) StreamChatCompletionWithFallback(ctx context.Context, model
 		fallbackResult.FallbackModel = fallbackModel
 
 		// Try fallback model
-		fallbackStream, fallbackErr := c.StreamChatCompletion(ctx, fallbackModel, messages, detectedURLs)
+		fallbackStream, fallbackErr := c.StreamChatCompletionWithTools(ctx, fallbackModel, messages, detectedURLs, tools)
 		if fallbackErr != nil {
 			logging.LogToFile("Fallback model %s also failed: %v", fallbackModel, fallbackErr)
 			return nil, fallbackResult, fmt.Errorf("both original model (%s) and fallback model (%s) failed. Original error: %w, Fallback error: %v", model, fallbackModel, err, fallbackErr)
@@ -733,6 +505,10 @@ func (c *LLMClient) TestProviderConnectivity(providerName string) error {
 	// Test basic connectivity with a simple HTTP request
 	// Try to reach the models endpoint (common for OpenAI-compatible APIs)
 	testURL := strings.TrimSuffix(provider.BaseURL, "/") + "/models"
+	if c.config.GetProviderType(providerName) == config.ProviderTypeOllama {
+		// Native Ollama servers list local models under /api/tags
+		testURL = strings.TrimSuffix(strings.TrimSuffix(provider.BaseURL, "/"), "/v1") + "/api/tags"
+	}
 
 	resp, err := c.httpClient.Get(testURL)
 	if err != nil {
@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/llm/providers"
+	"DiscordAIChatbot/internal/messaging"
+	"DiscordAIChatbot/internal/utils"
+)
+
+// TextExtractor extracts the text of a document, e.g. with the FileProcessor
+type TextExtractor func(data []byte, contentType, filename string) (string, error)
+
+// modalityStats counts the fallbacks used while adapting a conversation
+type modalityStats struct {
+	transcribed       int
+	untranscribed     int
+	transcriptionOff  int
+	extractedPDFs     int
+	ocrPDFs           int
+	scannedPDFs       int
+	unextractablePDFs int
+	cutPDFs           int
+}
+
+// AdaptModalities rewrites the audio and PDF parts a model can't take natively. Audio is replaced
+// by a transcript from the configured backend and PDFs by the text the extractor finds in them,
+// or the OCR model for scanned PDFs, ranked against the last user message when too long.
+// It returns the rewritten messages and warnings naming the fallbacks used.
+func (c *LLMClient) AdaptModalities(ctx context.Context, cfg *config.Config, model string, messages []messaging.OpenAIMessage, extractText TextExtractor) ([]messaging.OpenAIMessage, []string) {
+	providerName, _, _ := strings.Cut(model, "/")
+	providerType := cfg.GetProviderType(providerName)
+	native := func(modality, mimeType string) bool {
+		return cfg.AcceptsModality(model, modality) && providers.SupportsNativeModality(providerType, modality, mimeType)
+	}
+
+	question := questionText(messages)
+	tokenizer := utils.TokenizerFor(model, cfg.GetModelTokenizer(model))
+
+	var stats modalityStats
+	adapted := make([]messaging.OpenAIMessage, len(messages))
+	for i, msg := range messages {
+		adapted[i] = msg
+		parts, ok := msg.Content.([]messaging.MessageContent)
+		if !ok {
+			continue
+		}
+
+		rewritten := make([]messaging.MessageContent, 0, len(parts))
+		for _, part := range parts {
+			switch {
+			case part.Type == "audio_file" && part.AudioFile != nil && !native(config.ModalityAudio, part.AudioFile.MIMEType):
+				rewritten = append(rewritten, messaging.MessageContent{Type: "text", Text: c.audioAsText(ctx, cfg, part.AudioFile, &stats)})
+			case part.Type == "pdf_file" && part.PDFFile != nil && !native(config.ModalityPDF, part.PDFFile.MIMEType):
+				rewritten = append(rewritten, messaging.MessageContent{Type: "text", Text: c.pdfAsText(ctx, cfg, part.PDFFile, question, tokenizer, extractText, &stats)})
+			default:
+				rewritten = append(rewritten, part)
+			}
+		}
+		adapted[i].Content = rewritten
+	}
+
+	return adapted, stats.warnings(cfg.Transcription.Backend)
+}
+
+// audioAsText returns the transcript of an audio attachment, or a note telling the model it can't hear it
+func (c *LLMClient) audioAsText(ctx context.Context, cfg *config.Config, audio *messaging.AudioContent, stats *modalityStats) string {
+	if cfg.Transcription.Backend == config.TranscriptionBackendDisabled {
+		stats.transcriptionOff++
+		return "> 🎤 An audio attachment was left out because it can't be transcribed."
+	}
+
+	key := mediaCacheKey("transcript:"+cfg.Transcription.Backend+":"+cfg.Transcription.Model, audio.Data)
+	transcript, cached := c.mediaTextCache.Get(key)
+	if !cached {
+		var err error
+		transcript, err = c.Transcribe(ctx, cfg, audio)
+		if err != nil {
+			log.Printf("Failed to transcribe audio attachment: %v", err)
+			stats.untranscribed++
+			return "> ⚠️ **Error:** Could not transcribe this audio attachment."
+		}
+		c.mediaTextCache.Add(key, transcript)
+	}
+
+	stats.transcribed++
+	if strings.TrimSpace(transcript) == "" {
+		return "> 🎤 This audio attachment contains no speech."
+	}
+	return "**🎤 Audio Transcript:**\n" + transcript
+}
+
+// pdfAsText returns the text of a PDF attachment: the extracted text, or what the OCR model reads
+// in a scanned PDF. Text over the budget is cut to the parts most relevant to the question.
+func (c *LLMClient) pdfAsText(ctx context.Context, cfg *config.Config, pdf *messaging.PDFContent, question string, tokenizer utils.Tokenizer, extractText TextExtractor, stats *modalityStats) string {
+	header := fmt.Sprintf("**📄 PDF Document: %s**\n", pdf.Filename)
+
+	text, ocr, err := c.readPDF(ctx, cfg, pdf, extractText)
+	if err != nil {
+		log.Printf("Failed to extract text from PDF %s: %v", pdf.Filename, err)
+		if errors.Is(err, ErrScannedPDF) {
+			stats.scannedPDFs++
+			return header + "\n> ⚠️ **Error:** This PDF is scanned and has no text, and OCR is disabled."
+		}
+		stats.unextractablePDFs++
+		return header + "\n> ⚠️ **Error:** Could not extract text from this PDF."
+	}
+
+	if ocr {
+		stats.ocrPDFs++
+	} else {
+		stats.extractedPDFs++
+	}
+	if strings.TrimSpace(text) == "" {
+		return header + "\n> 📄 This PDF appears to be empty or contains no text."
+	}
+	text, cut := fitPDFText(text, question, cfg.PDF.MaxTokens, tokenizer)
+	if cut {
+		stats.cutPDFs++
+	}
+	return header + text
+}
+
+// warnings describes the fallbacks used, once per kind
+func (s modalityStats) warnings(backend string) []string {
+	var warnings []string
+	if s.transcribed > 0 {
+		name := "Gemini"
+		if backend == config.TranscriptionBackendWhisper {
+			name = "Whisper"
+		}
+		warnings = append(warnings, fmt.Sprintf("⚠️ Audio sent as a %s transcript", name))
+	}
+	if s.untranscribed > 0 {
+		warnings = append(warnings, "⚠️ Couldn't transcribe audio")
+	}
+	if s.transcriptionOff > 0 {
+		warnings = append(warnings, "⚠️ Can't hear audio")
+	}
+	if s.extractedPDFs > 0 {
+		warnings = append(warnings, "⚠️ PDF sent as extracted text")
+	}
+	if s.ocrPDFs > 0 {
+		warnings = append(warnings, "⚠️ Scanned PDF read by OCR")
+	}
+	if s.cutPDFs > 0 {
+		warnings = append(warnings, "⚠️ Long PDF cut to the most relevant pages")
+	}
+	if s.scannedPDFs > 0 {
+		warnings = append(warnings, "⚠️ Can't read scanned PDF")
+	}
+	if s.unextractablePDFs > 0 {
+		warnings = append(warnings, "⚠️ Couldn't read PDF")
+	}
+	return warnings
+}
+
+// mediaCacheKey keys text by the attachment contents, so later turns of a conversation reuse it
+func mediaCacheKey(kind string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return kind + ":" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,309 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/llm/providers"
+	"DiscordAIChatbot/internal/messaging"
+	"DiscordAIChatbot/internal/utils"
+)
+
+// ErrScannedPDF is returned by a TextExtractor for a PDF whose pages are images without text
+var ErrScannedPDF = errors.New("PDF is scanned and has no text layer")
+
+// pdfPageMarker matches the [p.N] lines that start each page of extracted text
+var pdfPageMarker = regexp.MustCompile(`(?m)^\[p\.(\d+)\]$`)
+
+// OCR reads a scanned PDF with the configured OCR model, marking pages like the extractor does
+func (c *LLMClient) OCR(ctx context.Context, cfg *config.Config, pdf *messaging.PDFContent) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.PDFOCRTimeout*time.Minute)
+	defer cancel()
+
+	prompt := "Transcribe the text of this scanned document. Start each page with a line holding only its " +
+		"page number as [p.N], e.g. [p.1]. Keep headings, lists and the reading order of columns, write " +
+		"tables as Markdown tables and describe figures in a few words in brackets. Reply with the " +
+		"transcription only, without commentary."
+	messages := []messaging.OpenAIMessage{{
+		Role: "user",
+		Content: []messaging.MessageContent{
+			{Type: "text", Text: prompt},
+			{Type: "pdf_file", PDFFile: pdf},
+		},
+	}}
+
+	text, err := c.GetChatCompletion(providers.DisableGeminiGroundingInContext(ctx), messages, cfg.PDF.OCRModel, nil)
+	if err != nil {
+		return "", fmt.Errorf("OCR with %s failed: %w", cfg.PDF.OCRModel, err)
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// readPDF returns the text of a PDF from the cache, the extractor or, for scanned PDFs, the OCR
+// model. It also reports whether the text was read by OCR.
+func (c *LLMClient) readPDF(ctx context.Context, cfg *config.Config, pdf *messaging.PDFContent, extractText TextExtractor) (string, bool, error) {
+	key := mediaCacheKey("pdf", pdf.Data)
+	if text, cached := c.mediaTextCache.Get(key); cached {
+		return text, false, nil
+	}
+	ocrKey := mediaCacheKey("ocr:"+cfg.PDF.OCRModel, pdf.Data)
+	if text, cached := c.mediaTextCache.Get(ocrKey); cached {
+		return text, true, nil
+	}
+
+	mimeType := pdf.MIMEType
+	if mimeType == "" {
+		mimeType = "application/pdf"
+	}
+	text, err := extractText(pdf.Data, mimeType, pdf.Filename)
+	if err == nil {
+		c.mediaTextCache.Add(key, text)
+		return text, false, nil
+	}
+	if !errors.Is(err, ErrScannedPDF) || cfg.PDF.OCRModel == config.PDFOCRDisabled {
+		return "", false, err
+	}
+
+	text, err = c.OCR(ctx, cfg, pdf)
+	if err != nil {
+		return "", false, err
+	}
+	c.mediaTextCache.Add(ocrKey, text)
+	return text, true, nil
+}
+
+// pdfChunk is a page of extracted PDF text, or part of a long page
+type pdfChunk struct {
+	page   int    // 0 when the text has no page markers
+	text   string // Starting with the page marker
+	tokens int
+	score  float64
+}
+
+// fitPDFText keeps the text of a PDF within a token budget. Longer text is split into chunks,
+// and the chunks most relevant to the question are kept in page order, naming the pages left
+// out. It reports whether the text was cut.
+func fitPDFText(text, question string, budget int, tokenizer utils.Tokenizer) (string, bool) {
+	if tokenizer.CountText(text) <= budget {
+		return text, false
+	}
+
+	preamble, chunks := splitPDFText(text, tokenizer)
+	rankPDFChunks(chunks, question)
+
+	// Best first; without a question to rank by, chunks keep their order and the start is kept
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return chunks[order[i]].score > chunks[order[j]].score })
+
+	// Leave room for the note on what was left out
+	used := tokenizer.CountText(preamble) + config.PDFNoteTokens
+	keep := make([]bool, len(chunks))
+	for rank, i := range order {
+		// The best chunk is kept even when the preamble leaves it no room, so some text gets through
+		if rank == 0 || used+chunks[i].tokens <= budget {
+			keep[i] = true
+			used += chunks[i].tokens
+		}
+	}
+
+	var parts []string
+	if preamble != "" {
+		parts = append(parts, preamble)
+	}
+	keptPages := make(map[int]bool)
+	for i, chunk := range chunks {
+		if keep[i] {
+			keptPages[chunk.page] = true
+		}
+	}
+	var omitted []int
+	for i, chunk := range chunks {
+		if !keep[i] {
+			if chunk.page > 0 && !keptPages[chunk.page] && (len(omitted) == 0 || omitted[len(omitted)-1] != chunk.page) {
+				omitted = append(omitted, chunk.page)
+			}
+			continue
+		}
+		if i > 0 && !keep[i-1] {
+			parts = append(parts, "[…]")
+		}
+		parts = append(parts, chunk.text)
+	}
+	if !keep[len(chunks)-1] {
+		parts = append(parts, "[…]")
+	}
+
+	note := "_This PDF is too long to include whole, so only the parts most relevant to the question are included; […] marks what was left out."
+	if len(omitted) > 0 {
+		note += " Pages left out: " + pageRanges(omitted) + "."
+	}
+	return strings.Join(append(parts, note+"_"), "\n\n"), true
+}
+
+// splitPDFText splits page-marked text into what comes before the first page and chunks of
+// about PDFChunkTokens at most, each starting with its page marker
+func splitPDFText(text string, tokenizer utils.Tokenizer) (string, []pdfChunk) {
+	markers := pdfPageMarker.FindAllStringSubmatchIndex(text, -1)
+	if len(markers) == 0 {
+		return "", pageChunks(0, "", text, tokenizer)
+	}
+
+	var chunks []pdfChunk
+	for i, marker := range markers {
+		page, _ := strconv.Atoi(text[marker[2]:marker[3]])
+		end := len(text)
+		if i+1 < len(markers) {
+			end = markers[i+1][0]
+		}
+		chunks = append(chunks, pageChunks(page, text[marker[0]:marker[1]], text[marker[1]:end], tokenizer)...)
+	}
+	return strings.TrimSpace(text[:markers[0][0]]), chunks
+}
+
+// pageChunks splits the text of a page at paragraphs, or at lines for paragraphs that are too long
+func pageChunks(page int, marker, text string, tokenizer utils.Tokenizer) []pdfChunk {
+	var pieces []string
+	for _, paragraph := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		if tokenizer.CountText(paragraph) <= config.PDFChunkTokens {
+			pieces = append(pieces, paragraph)
+			continue
+		}
+		pieces = append(pieces, strings.Split(paragraph, "\n")...)
+	}
+
+	var chunks []pdfChunk
+	var current []string
+	tokens := 0
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		body := strings.Join(current, "\n\n")
+		if marker != "" {
+			body = marker + "\n" + body
+		}
+		chunks = append(chunks, pdfChunk{page: page, text: body, tokens: tokens})
+		current, tokens = nil, 0
+	}
+	for _, piece := range pieces {
+		pieceTokens := tokenizer.CountText(piece)
+		if tokens > 0 && tokens+pieceTokens > config.PDFChunkTokens {
+			flush()
+		}
+		current = append(current, piece)
+		tokens += pieceTokens
+	}
+	flush()
+	return chunks
+}
+
+// rankPDFChunks scores chunks by how well they match the words of the question, with BM25
+func rankPDFChunks(chunks []pdfChunk, question string) {
+	const k1, b = 1.2, 0.75
+
+	terms := make(map[string]bool)
+	for _, word := range searchWords(question) {
+		terms[word] = true
+	}
+	if len(terms) == 0 || len(chunks) == 0 {
+		return
+	}
+
+	frequencies := make([]map[string]int, len(chunks))
+	lengths := make([]int, len(chunks))
+	documentFrequency := make(map[string]int)
+	totalLength := 0
+	for i, chunk := range chunks {
+		frequencies[i] = make(map[string]int)
+		words := searchWords(chunk.text)
+		for _, word := range words {
+			if terms[word] {
+				frequencies[i][word]++
+			}
+		}
+		for word := range frequencies[i] {
+			documentFrequency[word]++
+		}
+		lengths[i] = len(words)
+		totalLength += len(words)
+	}
+
+	n := float64(len(chunks))
+	averageLength := max(float64(totalLength)/n, 1)
+	for i := range chunks {
+		score := 0.0
+		for word, count := range frequencies[i] {
+			df := float64(documentFrequency[word])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			tf := float64(count)
+			score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(lengths[i])/averageLength))
+		}
+		chunks[i].score = score
+	}
+}
+
+// searchWords splits text into lowercase words of two or more characters
+func searchWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	words := fields[:0]
+	for _, field := range fields {
+		if len([]rune(field)) >= 2 {
+			words = append(words, field)
+		}
+	}
+	return words
+}
+
+// pageRanges formats sorted page numbers as ranges, e.g. "1-3, 7, 9-10"
+func pageRanges(pages []int) string {
+	var ranges []string
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+		if j > i {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", pages[i], pages[j]))
+		} else {
+			ranges = append(ranges, strconv.Itoa(pages[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// questionText returns the text of the last user message, which long PDFs are ranked against
+func questionText(messages []messaging.OpenAIMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		switch content := messages[i].Content.(type) {
+		case string:
+			return content
+		case []messaging.MessageContent:
+			var texts []string
+			for _, part := range content {
+				if part.Type == "text" {
+					texts = append(texts, part.Text)
+				}
+			}
+			return strings.Join(texts, "\n")
+		}
+	}
+	return ""
+}
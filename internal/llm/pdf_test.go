@@ -0,0 +1,148 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/utils"
+)
+
+// pdfFixture returns page-marked text like the extractor's, one page per entry
+func pdfFixture(pages ...string) string {
+	sections := []string{fmt.Sprintf("_%d pages, each starting with its [p.N] marker._", len(pages))}
+	for i, page := range pages {
+		sections = append(sections, fmt.Sprintf("[p.%d]\n%s", i+1, page))
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+// filler returns paragraphs of text that matches no question in these tests
+func filler(paragraphs int) string {
+	parts := make([]string, paragraphs)
+	for i := range parts {
+		parts[i] = strings.Repeat("The committee reviewed the budget and the schedule for the next quarter. ", 8)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func TestPageRanges(t *testing.T) {
+	tests := []struct {
+		pages []int
+		want  string
+	}{
+		{nil, ""},
+		{[]int{4}, "4"},
+		{[]int{1, 2}, "1-2"},
+		{[]int{1, 2, 3, 7, 9, 10}, "1-3, 7, 9-10"},
+		{[]int{2, 4, 6}, "2, 4, 6"},
+	}
+	for _, tt := range tests {
+		if got := pageRanges(tt.pages); got != tt.want {
+			t.Errorf("pageRanges(%v) = %q, want %q", tt.pages, got, tt.want)
+		}
+	}
+}
+
+func TestRankPDFChunks(t *testing.T) {
+	chunks := []pdfChunk{
+		{text: "[p.1]\n" + filler(1)},
+		{text: "[p.2]\nVolcanoes erupt when magma rises. Magma chambers fill over centuries."},
+		{text: "[p.3]\nOne paragraph mentions magma in passing. " + filler(1)},
+	}
+
+	rankPDFChunks(chunks, "Why does magma rise in volcanoes?")
+	if !(chunks[1].score > chunks[2].score && chunks[2].score > chunks[0].score) {
+		t.Errorf("scores = %v, %v, %v, want the volcano page first and the unrelated one last",
+			chunks[0].score, chunks[1].score, chunks[2].score)
+	}
+	if chunks[0].score != 0 {
+		t.Errorf("unrelated chunk scored %v, want 0", chunks[0].score)
+	}
+
+	for i := range chunks {
+		chunks[i].score = 0
+	}
+	rankPDFChunks(chunks, "?? a")
+	for i, chunk := range chunks {
+		if chunk.score != 0 {
+			t.Errorf("chunk %d scored %v without question words", i, chunk.score)
+		}
+	}
+}
+
+func TestSplitPDFText(t *testing.T) {
+	tokenizer := utils.TokenizerFor("test/pdf", utils.TokenizerO200k)
+	text := pdfFixture("Short first page.", filler(12))
+
+	preamble, chunks := splitPDFText(text, tokenizer)
+	if preamble != "_2 pages, each starting with its [p.N] marker._" {
+		t.Errorf("preamble = %q", preamble)
+	}
+	if len(chunks) < 3 || chunks[0].page != 1 || chunks[0].text != "[p.1]\nShort first page." {
+		t.Fatalf("first chunk = %+v of %d, want page 1 alone", chunks[0], len(chunks))
+	}
+	for _, chunk := range chunks[1:] {
+		if chunk.page != 2 || !strings.HasPrefix(chunk.text, "[p.2]\n") {
+			t.Errorf("chunk of the long page = page %d %q…, want it marked as page 2", chunk.page, chunk.text[:10])
+		}
+		if chunk.tokens > config.PDFChunkTokens {
+			t.Errorf("chunk has %d tokens, more than %d", chunk.tokens, config.PDFChunkTokens)
+		}
+	}
+
+	// Text without markers is chunked as page 0
+	if preamble, chunks := splitPDFText("plain text", tokenizer); preamble != "" || len(chunks) != 1 || chunks[0].page != 0 {
+		t.Errorf("unmarked text = %q, %+v", preamble, chunks)
+	}
+}
+
+func TestFitPDFText(t *testing.T) {
+	tokenizer := utils.TokenizerFor("test/pdf", utils.TokenizerO200k)
+	volcano := "Volcanoes erupt when magma rises through the crust."
+	text := pdfFixture(filler(6), filler(6)+"\n\n"+volcano, filler(6), filler(6))
+	preamble, chunks := splitPDFText(text, tokenizer)
+
+	// Room for the preamble, the note and one page
+	budget := tokenizer.CountText(preamble) + config.PDFNoteTokens + chunks[1].tokens
+
+	t.Run("fits", func(t *testing.T) {
+		if got, cut := fitPDFText(text, "", tokenizer.CountText(text), tokenizer); cut || got != text {
+			t.Error("text within the budget was changed")
+		}
+	})
+
+	t.Run("relevant page", func(t *testing.T) {
+		got, cut := fitPDFText(text, "Why do volcanoes erupt?", budget, tokenizer)
+		if !cut || !strings.Contains(got, volcano) {
+			t.Fatalf("the page about volcanoes was not kept:\n%s", got)
+		}
+		if !strings.HasPrefix(got, preamble+"\n\n[…]\n\n[p.2]\n") {
+			t.Errorf("kept text doesn't start with the preamble and a gap:\n%.200s", got)
+		}
+		if !strings.Contains(got, "Pages left out: 1, 3-4.") || !strings.HasSuffix(got, "_") {
+			t.Errorf("note doesn't name the pages left out:\n%s", got[len(got)-300:])
+		}
+		if tokens := tokenizer.CountText(got); tokens > budget {
+			t.Errorf("kept %d tokens, over the budget of %d", tokens, budget)
+		}
+	})
+
+	t.Run("no question", func(t *testing.T) {
+		got, cut := fitPDFText(text, "", budget, tokenizer)
+		if !cut || !strings.Contains(got, "[p.1]") || strings.Contains(got, volcano) {
+			t.Errorf("without a question the start is not kept:\n%.300s", got)
+		}
+		if !strings.Contains(got, "Pages left out: 2-4.") {
+			t.Errorf("note doesn't name the pages left out:\n%s", got[len(got)-300:])
+		}
+	})
+
+	t.Run("budget below a chunk", func(t *testing.T) {
+		got, cut := fitPDFText(text, "Why do volcanoes erupt?", 10, tokenizer)
+		if !cut || !strings.Contains(got, volcano) {
+			t.Errorf("the best chunk was dropped when nothing fit:\n%.300s", got)
+		}
+	})
+}
@@ -0,0 +1,592 @@
+package providers
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+	"DiscordAIChatbot/internal/logging"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+const (
+	anthropicDefaultBaseURL    = "https://api.anthropic.com/v1"
+	anthropicAPIVersion        = "2023-06-01"
+	anthropicDefaultMaxTokens  = 8192
+	anthropicMinThinkingBudget = 1024
+)
+
+// anthropicEffortBudgets maps reasoning_effort values to extended thinking budgets
+var anthropicEffortBudgets = map[string]int{
+	"low":    2048,
+	"medium": 8192,
+	"high":   24576,
+}
+
+// AnthropicProvider streams chat completions from the native Anthropic Messages API
+type AnthropicProvider struct {
+	config        *config.Config
+	apiKeyManager interfaces.APIKeyManager
+	httpClient    *http.Client
+	helpers       Helpers
+}
+
+// NewAnthropicProvider creates a new Anthropic provider
+func NewAnthropicProvider(cfg *config.Config, apiKeyManager interfaces.APIKeyManager, httpClient *http.Client, helpers Helpers) *AnthropicProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &AnthropicProvider{
+		config:        cfg,
+		apiKeyManager: apiKeyManager,
+		httpClient:    httpClient,
+		helpers:       helpers.withDefaults(),
+	}
+}
+
+// Name returns the provider type
+func (p *AnthropicProvider) Name() string {
+	return config.ProviderTypeAnthropic
+}
+
+// anthropicRequest is the Messages API request body
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Stream      bool               `json:"stream"`
+	Temperature *float32           `json:"temperature,omitempty"`
+	Thinking    *anthropicThinking `json:"thinking,omitempty"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+}
+
+// anthropicThinking enables extended thinking
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// anthropicTool is a client tool definition
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+// anthropicMessage is a single conversation turn
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block. Only the fields relevant to its type are set.
+type anthropicBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     any                   `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+	Thinking  string                `json:"thinking,omitempty"`
+	Signature string                `json:"signature,omitempty"`
+	Data      string                `json:"data,omitempty"`
+}
+
+// anthropicImageSource is an inline base64 image, or a PDF in document blocks
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// anthropicStreamEvent is a server-sent event from a streaming Messages API response
+type anthropicStreamEvent struct {
+	Type         string          `json:"type"`
+	Index        int             `json:"index"`
+	ContentBlock *anthropicBlock `json:"content_block,omitempty"`
+	Delta        *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta,omitempty"`
+	// Message carries the prompt usage in message_start
+	Message *struct {
+		Usage *anthropicUsage `json:"usage"`
+	} `json:"message,omitempty"`
+	// Usage carries the output token count in message_delta
+	Usage *anthropicUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// anthropicUsage is the token usage of a Messages API response
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+}
+
+// anthropicMessagesURL returns the Messages API endpoint for a configured base URL
+func anthropicMessagesURL(baseURL string) string {
+	base := strings.TrimSuffix(baseURL, "/")
+	if base == "" {
+		base = anthropicDefaultBaseURL
+	}
+	if !strings.HasSuffix(base, "/v1") {
+		base += "/v1"
+	}
+	return base + "/messages"
+}
+
+// anthropicSupportedImageTypes lists the image media types accepted by the Messages API
+var anthropicSupportedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// convertToAnthropicMessages converts messages to Anthropic turns. System messages are returned separately.
+// Consecutive messages with the same role are merged because the API requires alternating turns.
+func (p *AnthropicProvider) convertToAnthropicMessages(ctx context.Context, messages []messaging.OpenAIMessage) (string, []anthropicMessage) {
+	system, nonSystemMessages := ExtractSystemMessages(messages)
+
+	var result []anthropicMessage
+	var pendingCallIDs []string
+	for i, msg := range nonSystemMessages {
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "assistant"
+		}
+
+		var blocks []anthropicBlock
+		if msg.Role == "tool" {
+			toolUseID := msg.ToolCallID
+			if toolUseID == "" && len(pendingCallIDs) > 0 {
+				toolUseID = pendingCallIDs[0]
+				pendingCallIDs = pendingCallIDs[1:]
+			}
+			blocks = append(blocks, anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: toolUseID,
+				Content:   contentText(msg.Content),
+			})
+		} else {
+			// Thinking blocks must be replayed before the tool calls they led to
+			if len(msg.ToolCalls) > 0 {
+				blocks = append(blocks, decodeAnthropicThinking(msg.ToolCalls[0].ThoughtSignature)...)
+			}
+			blocks = append(blocks, p.convertContentBlocks(ctx, msg.Content)...)
+			for j, call := range msg.ToolCalls {
+				callID := call.ID
+				if callID == "" {
+					callID = fmt.Sprintf("toolu_%d_%d", i, j)
+					pendingCallIDs = append(pendingCallIDs, callID)
+				}
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    callID,
+					Name:  call.Name,
+					Input: decodeToolArguments(call),
+				})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(result); n > 0 && result[n-1].Role == role {
+			result[n-1].Content = append(result[n-1].Content, blocks...)
+			continue
+		}
+		result = append(result, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	return system, result
+}
+
+// convertContentBlocks converts message content into text, image and document blocks
+func (p *AnthropicProvider) convertContentBlocks(ctx context.Context, content any) []anthropicBlock {
+	parts, ok := content.([]messaging.MessageContent)
+	if !ok {
+		if text := contentText(content); text != "" {
+			return []anthropicBlock{{Type: "text", Text: text}}
+		}
+		return nil
+	}
+
+	var blocks []anthropicBlock
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+			}
+		case "image_url":
+			if part.ImageURL == nil {
+				continue
+			}
+			imageData, mimeType, err := p.helpers.DownloadImage(ctx, part.ImageURL.URL)
+			if err != nil {
+				log.Printf("Failed to download image from %s: %v", part.ImageURL.URL, err)
+				continue
+			}
+			if block, ok := anthropicImageBlock(imageData, mimeType); ok {
+				blocks = append(blocks, block)
+			}
+		case "generated_image":
+			if part.GeneratedImage == nil {
+				continue
+			}
+			if block, ok := anthropicImageBlock(part.GeneratedImage.Data, part.GeneratedImage.MIMEType); ok {
+				blocks = append(blocks, block)
+			}
+		case "pdf_file":
+			if part.PDFFile == nil || len(part.PDFFile.Data) == 0 {
+				continue
+			}
+			blocks = append(blocks, anthropicBlock{
+				Type: "document",
+				Source: &anthropicImageSource{
+					Type:      "base64",
+					MediaType: "application/pdf",
+					Data:      base64.StdEncoding.EncodeToString(part.PDFFile.Data),
+				},
+			})
+		}
+	}
+	return blocks
+}
+
+// anthropicImageBlock builds a base64 image block, skipping unsupported media types
+func anthropicImageBlock(data []byte, mimeType string) (anthropicBlock, bool) {
+	if !anthropicSupportedImageTypes[mimeType] {
+		log.Printf("Skipping image with unsupported media type for Anthropic: %s", mimeType)
+		return anthropicBlock{}, false
+	}
+	return anthropicBlock{
+		Type: "image",
+		Source: &anthropicImageSource{
+			Type:      "base64",
+			MediaType: mimeType,
+			Data:      base64.StdEncoding.EncodeToString(data),
+		},
+	}, true
+}
+
+// encodeAnthropicThinking stores thinking blocks in a tool call's opaque thought signature
+// so they can be replayed on the next tool calling round, as the API requires.
+func encodeAnthropicThinking(blocks []anthropicBlock) []byte {
+	if len(blocks) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(blocks)
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+// decodeAnthropicThinking restores thinking blocks saved by encodeAnthropicThinking.
+// Signatures produced by other providers are ignored.
+func decodeAnthropicThinking(signature []byte) []anthropicBlock {
+	if len(signature) == 0 {
+		return nil
+	}
+	var blocks []anthropicBlock
+	if err := json.Unmarshal(signature, &blocks); err != nil {
+		return nil
+	}
+	for _, block := range blocks {
+		if block.Type != "thinking" && block.Type != "redacted_thinking" {
+			return nil
+		}
+	}
+	return blocks
+}
+
+// buildAnthropicRequest builds the request body and returns it encoded with the extra model parameters merged in
+func (p *AnthropicProvider) buildAnthropicRequest(ctx context.Context, target *modelTarget, req interfaces.ChatRequest) ([]byte, error) {
+	system, messages := p.convertToAnthropicMessages(ctx, req.Messages)
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no messages to send to %s", target.modelName)
+	}
+
+	body := anthropicRequest{
+		Model:       target.modelName,
+		MaxTokens:   anthropicDefaultMaxTokens,
+		System:      system,
+		Messages:    messages,
+		Stream:      true,
+		Temperature: target.params.Temperature,
+	}
+
+	extra := make(map[string]any, len(target.params.ExtraParams))
+	for key, value := range target.params.ExtraParams {
+		extra[key] = value
+	}
+	if maxTokens, ok := toInt(extra["max_tokens"]); ok && maxTokens > 0 {
+		body.MaxTokens = maxTokens
+	}
+	delete(extra, "max_tokens")
+
+	// Extended thinking: an explicit budget wins over reasoning_effort
+	budget := 0
+	if target.params.ThinkingBudget != nil {
+		budget = int(*target.params.ThinkingBudget)
+	} else if effortBudget, ok := anthropicEffortBudgets[target.params.ReasoningEffort]; ok {
+		budget = effortBudget
+	}
+	if budget > 0 {
+		if budget < anthropicMinThinkingBudget {
+			budget = anthropicMinThinkingBudget
+		}
+		if body.MaxTokens <= budget {
+			body.MaxTokens = budget + anthropicDefaultMaxTokens
+		}
+		body.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+		// Extended thinking is incompatible with a custom temperature
+		body.Temperature = nil
+	}
+
+	for _, def := range req.Tools {
+		body.Tools = append(body.Tools, anthropicTool{
+			Name:        def.Name,
+			Description: def.Description,
+			InputSchema: def.Parameters,
+		})
+	}
+
+	return mergeExtraParams(body, extra)
+}
+
+// toInt converts YAML numeric values to int
+func toInt(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+// StreamChat implements interfaces.LLMProvider
+func (p *AnthropicProvider) StreamChat(ctx context.Context, req interfaces.ChatRequest) (<-chan StreamResponse, error) {
+	target, err := resolveModel(ctx, p.config, req.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	availableKeys := target.provider.GetAPIKeys()
+	if len(availableKeys) == 0 {
+		return nil, fmt.Errorf("no API keys configured for provider: %s", target.providerName)
+	}
+
+	body, err := p.buildAnthropicRequest(ctx, target, req)
+	if err != nil {
+		return nil, err
+	}
+
+	url := anthropicMessagesURL(target.provider.BaseURL)
+	logging.LogToFile("Starting Anthropic LLM request: Model=%s, Provider=%s", target.modelName, target.providerName)
+	logging.LogExternalContentToFile("=== DEBUG: Anthropic API Payload ===\nURL: %s\n%s\n=== END DEBUG ===\n", url, string(body))
+
+	resp, err := openWithKeyRotation(ctx, p.apiKeyManager, p.helpers, target.providerName, availableKeys, func(apiKey string) (*http.Response, error) {
+		return postJSON(ctx, p.httpClient, url, map[string]string{
+			"x-api-key":         apiKey,
+			"anthropic-version": anthropicAPIVersion,
+			"Accept":            "text/event-stream",
+		}, body)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Anthropic stream: %w", err)
+	}
+
+	responseChan := make(chan StreamResponse, config.StreamResponseBufferSize)
+	go func() {
+		defer close(responseChan)
+		defer closeBody(resp)
+		p.readStream(ctx, resp, responseChan)
+	}()
+
+	return responseChan, nil
+}
+
+// readStream parses the server-sent events of a streaming response
+func (p *AnthropicProvider) readStream(ctx context.Context, resp *http.Response, responseChan chan<- StreamResponse) {
+	send := func(streamResp StreamResponse) bool {
+		select {
+		case responseChan <- streamResp:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	// Content blocks are keyed by their index in the response
+	blocks := make(map[int]*anthropicBlock)
+	toolInputs := make(map[int]*strings.Builder)
+	stopReason := ""
+	metadata := &interfaces.ResponseMetadata{}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			log.Printf("Failed to decode Anthropic stream event: %v", err)
+			continue
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil && event.Message.Usage != nil {
+				usage := event.Message.Usage
+				// Cached prompt tokens aren't included in input_tokens
+				metadata.PromptTokens = usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+				metadata.CachedTokens = usage.CacheReadInputTokens
+			}
+		case "content_block_start":
+			if event.ContentBlock == nil {
+				continue
+			}
+			block := *event.ContentBlock
+			blocks[event.Index] = &block
+			if block.Type == "tool_use" {
+				toolInputs[event.Index] = &strings.Builder{}
+			}
+		case "content_block_delta":
+			block := blocks[event.Index]
+			if block == nil || event.Delta == nil {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				logging.LogExternalContentToFile("Anthropic Response Text: %s", event.Delta.Text)
+				if !send(StreamResponse{Content: event.Delta.Text}) {
+					return
+				}
+			case "thinking_delta":
+				block.Thinking += event.Delta.Thinking
+				logging.LogExternalContentToFile("Anthropic Response Thinking: %s", event.Delta.Thinking)
+				if !send(StreamResponse{Reasoning: event.Delta.Thinking}) {
+					return
+				}
+			case "signature_delta":
+				block.Signature += event.Delta.Signature
+			case "input_json_delta":
+				if input := toolInputs[event.Index]; input != nil {
+					input.WriteString(event.Delta.PartialJSON)
+				}
+			}
+		case "message_delta":
+			if event.Delta != nil && event.Delta.StopReason != "" {
+				stopReason = event.Delta.StopReason
+			}
+			if event.Usage != nil {
+				metadata.CompletionTokens = event.Usage.OutputTokens
+			}
+		case "message_stop":
+			logging.LogExternalContentToFile("Anthropic Response Stop Reason: %s", stopReason)
+			final := anthropicFinish(stopReason, blocks, toolInputs)
+			metadata.FinishReason = stopReason
+			if stopReason == "refusal" {
+				metadata.SafetyFlags = append(metadata.SafetyFlags, "refusal")
+			}
+			final.Metadata = metadata
+			send(final)
+			return
+		case "error":
+			message := "unknown error"
+			if event.Error != nil {
+				message = fmt.Sprintf("%s: %s", event.Error.Type, event.Error.Message)
+			}
+			send(StreamResponse{Error: fmt.Errorf("anthropic stream error: %s", message)})
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		send(StreamResponse{Error: fmt.Errorf("failed to read Anthropic stream: %w", err)})
+		return
+	}
+	send(StreamResponse{Error: fmt.Errorf("anthropic stream ended without message_stop")})
+}
+
+// anthropicFinish builds the final chunk from the stop reason and the accumulated content blocks
+func anthropicFinish(stopReason string, blocks map[int]*anthropicBlock, toolInputs map[int]*strings.Builder) StreamResponse {
+	indexes := make([]int, 0, len(blocks))
+	for idx := range blocks {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	var thinking []anthropicBlock
+	var toolCalls []messaging.ToolCall
+	for _, idx := range indexes {
+		block := blocks[idx]
+		switch block.Type {
+		case "thinking", "redacted_thinking":
+			thinking = append(thinking, *block)
+		case "tool_use":
+			arguments := "{}"
+			if input := toolInputs[idx]; input != nil && strings.TrimSpace(input.String()) != "" {
+				arguments = input.String()
+			}
+			toolCalls = append(toolCalls, messaging.ToolCall{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: arguments,
+			})
+		}
+	}
+
+	switch stopReason {
+	case "tool_use":
+		if len(toolCalls) == 0 {
+			return StreamResponse{FinishReason: "stop"}
+		}
+		toolCalls[0].ThoughtSignature = encodeAnthropicThinking(thinking)
+		logging.LogExternalContentToFile("Anthropic Response Tool Calls: %+v", toolCalls)
+		return StreamResponse{FinishReason: "tool_calls", ToolCalls: toolCalls}
+	case "max_tokens":
+		return StreamResponse{FinishReason: "length"}
+	case "refusal":
+		return StreamResponse{Error: &PrematureStreamFinishError{FinishReason: stopReason}}
+	default:
+		return StreamResponse{FinishReason: "stop"}
+	}
+}
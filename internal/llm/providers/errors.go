@@ -1,12 +1,20 @@
 package providers
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // PrematureStreamFinishError is a custom error type for premature stream finishes
 type PrematureStreamFinishError struct {
 	FinishReason string
+	// SafetyFlags names the safety filters that stopped the stream, if any
+	SafetyFlags []string
 }
 
 func (e *PrematureStreamFinishError) Error() string {
+	if len(e.SafetyFlags) > 0 {
+		return fmt.Sprintf("stream finished prematurely with reason: %s (%s)", e.FinishReason, strings.Join(e.SafetyFlags, ", "))
+	}
 	return fmt.Sprintf("stream finished prematurely with reason: %s", e.FinishReason)
 }
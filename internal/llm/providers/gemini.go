@@ -10,18 +10,20 @@ import (
 	"strings"
 	"time"
 
+	json "github.com/json-iterator/go"
 	"google.golang.org/genai"
 
 	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
 	"DiscordAIChatbot/internal/logging"
 	"DiscordAIChatbot/internal/messaging"
-	"DiscordAIChatbot/internal/storage"
 )
 
 // GeminiProvider handles Gemini-specific operations
 type GeminiProvider struct {
 	config        *config.Config
-	apiKeyManager *storage.APIKeyManager
+	apiKeyManager interfaces.APIKeyManager
+	helpers       Helpers
 }
 
 const geminiInlinePDFMaxBytes = 20 * 1024 * 1024 // 20MB limit from Gemini inline upload guidance
@@ -52,21 +54,96 @@ func isGroundingDisabled(ctx context.Context) bool {
 }
 
 // NewGeminiProvider creates a new Gemini provider
-func NewGeminiProvider(cfg *config.Config, apiKeyManager *storage.APIKeyManager) *GeminiProvider {
+func NewGeminiProvider(cfg *config.Config, apiKeyManager interfaces.APIKeyManager) *GeminiProvider {
 	return &GeminiProvider{
 		config:        cfg,
 		apiKeyManager: apiKeyManager,
 	}
 }
 
-// StreamResponse represents a streaming response chunk
-type StreamResponse struct {
-	Content           string
-	FinishReason      string
-	Error             error
-	ImageData         []byte
-	ImageMIMEType     string
-	GroundingMetadata *genai.GroundingMetadata
+// WithHelpers returns a copy of the provider that uses the given helpers when streaming via StreamChat
+func (g *GeminiProvider) WithHelpers(helpers Helpers) *GeminiProvider {
+	return &GeminiProvider{
+		config:        g.config,
+		apiKeyManager: g.apiKeyManager,
+		helpers:       helpers.withDefaults(),
+	}
+}
+
+// Name returns the provider type
+func (g *GeminiProvider) Name() string {
+	return config.ProviderTypeGemini
+}
+
+// StreamChat implements interfaces.LLMProvider
+func (g *GeminiProvider) StreamChat(ctx context.Context, req interfaces.ChatRequest) (<-chan StreamResponse, error) {
+	h := g.helpers.withDefaults()
+	return g.CreateGeminiStream(ctx, req.Model, req.Messages, req.DetectedURLs, geminiFunctionDeclarations(req.Tools), h.DownloadImage, h.IsAPIKeyError, h.Is503Error, h.RetryWith503Backoff, h.IsInternalError, h.RetryWithInternalBackoff)
+}
+
+// geminiFunctionDeclarations translates tool definitions into Gemini function declarations
+func geminiFunctionDeclarations(defs []interfaces.ToolDefinition) []*genai.FunctionDeclaration {
+	var declarations []*genai.FunctionDeclaration
+	for _, def := range defs {
+		declarations = append(declarations, &genai.FunctionDeclaration{
+			Name:                 def.Name,
+			Description:          def.Description,
+			ParametersJsonSchema: def.Parameters,
+		})
+	}
+	return declarations
+}
+
+// geminiSchema converts a JSON schema into Gemini's OpenAPI-style schema.
+// Keywords Gemini doesn't support, such as additionalProperties, are dropped.
+func geminiSchema(schema map[string]any) *genai.Schema {
+	if schema == nil {
+		return nil
+	}
+
+	converted := &genai.Schema{}
+	if schemaType, ok := schema["type"].(string); ok {
+		converted.Type = genai.Type(strings.ToUpper(schemaType))
+	}
+	if description, ok := schema["description"].(string); ok {
+		converted.Description = description
+	}
+	converted.Required = SchemaStrings(schema["required"])
+	converted.Enum = SchemaStrings(schema["enum"])
+
+	if properties, ok := schema["properties"].(map[string]any); ok {
+		converted.Properties = make(map[string]*genai.Schema, len(properties))
+		for name, property := range properties {
+			if propertySchema, ok := property.(map[string]any); ok {
+				converted.Properties[name] = geminiSchema(propertySchema)
+			}
+		}
+		// Keep the model's output in the order the schema requires fields
+		if len(converted.Required) == len(converted.Properties) {
+			converted.PropertyOrdering = converted.Required
+		}
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		converted.Items = geminiSchema(items)
+	}
+	return converted
+}
+
+// convertGroundingMetadata converts Gemini grounding metadata into the provider-neutral form
+func convertGroundingMetadata(metadata *genai.GroundingMetadata) *messaging.GroundingMetadata {
+	converted := &messaging.GroundingMetadata{
+		WebSearchQueries: metadata.WebSearchQueries,
+	}
+	for _, chunk := range metadata.GroundingChunks {
+		if chunk == nil || chunk.Web == nil {
+			continue
+		}
+		var groundingChunk messaging.GroundingChunk
+		groundingChunk.Web.URI = chunk.Web.URI
+		groundingChunk.Web.Title = chunk.Web.Title
+		converted.GroundingChunks = append(converted.GroundingChunks, groundingChunk)
+	}
+	return converted
 }
 
 // ExtractSystemMessages extracts system messages from the messages array and returns them as a single string
@@ -117,6 +194,18 @@ func (g *GeminiProvider) ConvertToGeminiMessages(ctx context.Context, messages [
 			role = genai.RoleUser
 		}
 
+		// Tool results are sent back as function responses. Consecutive results must share a single turn.
+		if msg.Role == "tool" {
+			part := genai.NewPartFromFunctionResponse(msg.Name, map[string]any{"output": fmt.Sprintf("%v", msg.Content)})
+			part.FunctionResponse.ID = msg.ToolCallID
+			if n := len(contents); n > 0 && isFunctionResponseContent(contents[n-1]) {
+				contents[n-1].Parts = append(contents[n-1].Parts, part)
+			} else {
+				contents = append(contents, genai.NewContentFromParts([]*genai.Part{part}, genai.RoleUser))
+			}
+			continue
+		}
+
 		var parts []*genai.Part
 		type pdfUploadCandidate struct {
 			partIdx     int
@@ -224,12 +313,28 @@ func (g *GeminiProvider) ConvertToGeminiMessages(ctx context.Context, messages [
 					}
 				}
 			}
+		case nil:
+			// Turns holding only function calls have no content
 		default:
 			if str := fmt.Sprintf("%v", content); str != "" {
 				parts = append(parts, genai.NewPartFromText(str))
 			}
 		}
 
+		// Function calls previously issued by the model
+		for _, call := range msg.ToolCalls {
+			args := map[string]any{}
+			if strings.TrimSpace(call.Arguments) != "" {
+				if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+					log.Printf("Failed to decode tool call arguments for %s: %v", call.Name, err)
+				}
+			}
+			part := genai.NewPartFromFunctionCall(call.Name, args)
+			part.FunctionCall.ID = call.ID
+			part.ThoughtSignature = call.ThoughtSignature
+			parts = append(parts, part)
+		}
+
 		if len(parts) > 0 {
 			content := genai.NewContentFromParts(parts, role)
 			contentIdx := len(contents)
@@ -250,8 +355,23 @@ func (g *GeminiProvider) ConvertToGeminiMessages(ctx context.Context, messages [
 	return contents, pdfUploads, nil
 }
 
-// CreateGeminiStream creates a streaming chat completion using Gemini
-func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, messages []messaging.OpenAIMessage, detectedURLs []string, downloadImageFunc func(context.Context, string) ([]byte, string, error), isAPIKeyError func(error) bool, is503Error func(error) bool, retryWith503Backoff func(context.Context, func() error) error, isInternalError func(error) bool, retryWithInternalBackoff func(context.Context, func() error) error) (<-chan StreamResponse, error) {
+// isFunctionResponseContent reports whether a content consists solely of function responses
+func isFunctionResponseContent(content *genai.Content) bool {
+	if content == nil || len(content.Parts) == 0 {
+		return false
+	}
+	for _, part := range content.Parts {
+		if part == nil || part.FunctionResponse == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateGeminiStream creates a streaming chat completion using Gemini.
+// functionDeclarations may be nil; when present, built-in grounding tools are not added
+// because Gemini does not allow combining them with function calling.
+func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, messages []messaging.OpenAIMessage, detectedURLs []string, functionDeclarations []*genai.FunctionDeclaration, downloadImageFunc func(context.Context, string) ([]byte, string, error), isAPIKeyError func(error) bool, is503Error func(error) bool, retryWith503Backoff func(context.Context, func() error) error, isInternalError func(error) bool, retryWithInternalBackoff func(context.Context, func() error) error) (<-chan StreamResponse, error) {
 	parts := strings.SplitN(model, "/", 2)
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("invalid model format: %s (expected gemini/model)", model)
@@ -277,6 +397,7 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 	if !exists {
 		modelParams = config.ModelParams{}
 	}
+	modelParams = paramsForRequest(ctx, modelParams)
 
 	// Extract system messages and convert remaining messages to Gemini format
 	systemInstruction, nonSystemMessages := ExtractSystemMessages(messages)
@@ -398,6 +519,9 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 			if modelParams.Temperature != nil {
 				config.Temperature = modelParams.Temperature
 			}
+			if seed, ok := seedFromContext(ctx); ok {
+				config.Seed = &seed
+			}
 
 			// Apply thinking budget configuration
 			if modelParams.ThinkingBudget != nil {
@@ -405,11 +529,21 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 					ThinkingBudget: modelParams.ThinkingBudget,
 				}
 			}
+			// Thought summaries are only returned when asked for
+			if reasoningRequested(ctx) {
+				if config.ThinkingConfig == nil {
+					config.ThinkingConfig = &genai.ThinkingConfig{}
+				}
+				config.ThinkingConfig.IncludeThoughts = true
+			}
 
 			// Apply Gemini Grounding with Google Search if enabled (unless disabled by context or excluded model)
 			// Requirement: For gemini 2.5 pro we should use the external Web Search (RAG-Forge) pipeline instead of native Gemini grounding.
 			// Therefore we explicitly skip adding GoogleSearch tool when modelName starts with gemini-2.5-pro.
-			if g.config.WebSearch.GeminiGrounding && !isGroundingDisabled(ctx) {
+			if len(functionDeclarations) > 0 {
+				config.Tools = []*genai.Tool{{FunctionDeclarations: functionDeclarations}}
+				logging.LogExternalContentToFile("Enabled %d function declarations", len(functionDeclarations))
+			} else if g.config.WebSearch.GeminiGrounding && !isGroundingDisabled(ctx) {
 				if strings.HasPrefix(modelName, "gemini-2.5-pro") {
 					log.Printf("Skipping native Gemini grounding for %s in favor of external Web Search (RAG-Forge)", modelName)
 				} else if modelName != "gemini-2.0-flash-preview-image-generation" { // existing exclusion
@@ -422,7 +556,7 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 			}
 
 			// Enable URL context tool if the model supports it and URLs are detected
-			if g.SupportsURLContext(modelName) && len(detectedURLs) > 0 {
+			if g.SupportsURLContext(modelName) && len(detectedURLs) > 0 && len(functionDeclarations) == 0 {
 				if config.Tools == nil {
 					config.Tools = []*genai.Tool{}
 				}
@@ -430,11 +564,21 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 				logging.LogExternalContentToFile("Enabled URL Context Tool for %d URLs", len(detectedURLs))
 			}
 
+			// Structured replies are constrained by a response schema. Gemini doesn't
+			// allow tools alongside a JSON response type.
+			if schema := responseSchemaFromContext(ctx); schema != nil {
+				config.ResponseMIMEType = "application/json"
+				config.ResponseSchema = geminiSchema(schema.Schema)
+				config.Tools = nil
+			}
+
 			// Check if this is an image generation model
 			isImageGenModel := modelName == "gemini-2.0-flash-preview-image-generation" || strings.HasPrefix(modelName, "imagen")
 			if isImageGenModel {
 				// For image generation models, set response modalities to include both text and images
 				config.ResponseModalities = []string{"TEXT", "IMAGE"}
+				// Image generation models do not support function calling
+				config.Tools = nil
 				// Clear system instruction for image generation models as they don't support it
 				config.SystemInstruction = nil
 			}
@@ -453,6 +597,9 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 			if len(config.ResponseModalities) > 0 {
 				logging.LogExternalContentToFile("ResponseModalities: %v", config.ResponseModalities)
 			}
+			if config.ResponseSchema != nil {
+				logging.LogExternalContentToFile("ResponseMIMEType: %s", config.ResponseMIMEType)
+			}
 			logging.LogExternalContentToFile("=== END DEBUG ===\n")
 
 			// Create the stream
@@ -460,6 +607,7 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 
 			// Process stream responses
 			streamErr := false
+			var toolCalls []messaging.ToolCall
 			for chunk, err := range stream {
 				if err != nil {
 					// Check if this is an INTERNAL error and retry the entire stream
@@ -497,7 +645,12 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 					candidate := chunk.Candidates[0]
 					if candidate.Content != nil && len(candidate.Content.Parts) > 0 {
 						for _, part := range candidate.Content.Parts {
-							if part.Text != "" {
+							if part.Thought && part.Text != "" {
+								logging.LogExternalContentToFile("Gemini Response Thought: %s", part.Text)
+								responseChan <- StreamResponse{
+									Reasoning: part.Text,
+								}
+							} else if part.Text != "" {
 								logging.LogExternalContentToFile("Gemini Response Text: %s", part.Text)
 								responseChan <- StreamResponse{
 									Content: part.Text,
@@ -509,6 +662,18 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 									ImageData:     part.InlineData.Data,
 									ImageMIMEType: part.InlineData.MIMEType,
 								}
+							} else if part.FunctionCall != nil {
+								args, err := json.Marshal(part.FunctionCall.Args)
+								if err != nil {
+									args = []byte("{}")
+								}
+								logging.LogExternalContentToFile("Gemini Response Function Call: %s(%s)", part.FunctionCall.Name, string(args))
+								toolCalls = append(toolCalls, messaging.ToolCall{
+									ID:               part.FunctionCall.ID,
+									Name:             part.FunctionCall.Name,
+									Arguments:        string(args),
+									ThoughtSignature: part.ThoughtSignature,
+								})
 							}
 						}
 					}
@@ -516,7 +681,7 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 					if candidate.GroundingMetadata != nil {
 						logging.LogExternalContentToFile("Gemini Grounding Metadata: %+v", candidate.GroundingMetadata)
 						responseChan <- StreamResponse{
-							GroundingMetadata: candidate.GroundingMetadata,
+							GroundingMetadata: convertGroundingMetadata(candidate.GroundingMetadata),
 						}
 					}
 
@@ -524,22 +689,43 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 					if candidate.FinishReason != "" {
 						finishReasonStr := string(candidate.FinishReason)
 						logging.LogExternalContentToFile("Gemini Response Finish Reason: %s", finishReasonStr)
+						metadata := geminiResponseMetadata(chunk, candidate)
+						logging.LogExternalContentToFile("Gemini Response Metadata: %+v", *metadata)
 
 						// Check for abnormal finish reasons that should trigger a fallback
 						switch candidate.FinishReason {
 						case genai.FinishReasonStop, genai.FinishReasonMaxTokens:
 							// These are normal finish reasons, pass them through
-							responseChan <- StreamResponse{
-								FinishReason: finishReasonStr,
+							if len(toolCalls) > 0 {
+								responseChan <- StreamResponse{
+									FinishReason: "tool_calls",
+									ToolCalls:    toolCalls,
+									Metadata:     metadata,
+								}
+							} else {
+								responseChan <- StreamResponse{
+									FinishReason: finishReasonStr,
+									Metadata:     metadata,
+								}
 							}
 						default:
 							// Any other reason is considered a premature finish that should trigger a fallback
 							responseChan <- StreamResponse{
-								Error: &PrematureStreamFinishError{FinishReason: finishReasonStr},
+								Error:    &PrematureStreamFinishError{FinishReason: finishReasonStr, SafetyFlags: metadata.SafetyFlags},
+								Metadata: metadata,
 							}
 						}
 						return
 					}
+				} else if chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+					// The prompt itself was blocked, so no candidate is generated
+					metadata := geminiResponseMetadata(chunk, nil)
+					logging.LogExternalContentToFile("Gemini Prompt Blocked: %s %s", chunk.PromptFeedback.BlockReason, chunk.PromptFeedback.BlockReasonMessage)
+					responseChan <- StreamResponse{
+						Error:    &PrematureStreamFinishError{FinishReason: metadata.FinishReason, SafetyFlags: metadata.SafetyFlags},
+						Metadata: metadata,
+					}
+					return
 				}
 			}
 
@@ -556,6 +742,45 @@ func (g *GeminiProvider) CreateGeminiStream(ctx context.Context, model string, m
 	return responseChan, nil
 }
 
+// geminiResponseMetadata collects the usage and safety details of the final chunk of a stream.
+// The candidate is nil when the prompt was blocked.
+func geminiResponseMetadata(chunk *genai.GenerateContentResponse, candidate *genai.Candidate) *interfaces.ResponseMetadata {
+	metadata := &interfaces.ResponseMetadata{}
+	if usage := chunk.UsageMetadata; usage != nil {
+		metadata.PromptTokens = int(usage.PromptTokenCount)
+		metadata.CompletionTokens = int(usage.CandidatesTokenCount + usage.ThoughtsTokenCount)
+		metadata.CachedTokens = int(usage.CachedContentTokenCount)
+		metadata.ReasoningTokens = int(usage.ThoughtsTokenCount)
+	}
+
+	var ratings []*genai.SafetyRating
+	if candidate != nil {
+		metadata.FinishReason = string(candidate.FinishReason)
+		ratings = candidate.SafetyRatings
+	}
+	if feedback := chunk.PromptFeedback; feedback != nil {
+		if feedback.BlockReason != "" {
+			metadata.FinishReason = "PROMPT_" + string(feedback.BlockReason)
+		}
+		ratings = append(ratings, feedback.SafetyRatings...)
+	}
+	for _, rating := range ratings {
+		if rating == nil {
+			continue
+		}
+		if rating.Blocked || rating.Probability == genai.HarmProbabilityHigh || rating.Probability == genai.HarmProbabilityMedium {
+			flag := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(string(rating.Category), "HARM_CATEGORY_"), "_", " "))
+			if rating.Blocked {
+				flag += " (blocked)"
+			} else {
+				flag += " (" + strings.ToLower(string(rating.Probability)) + ")"
+			}
+			metadata.SafetyFlags = append(metadata.SafetyFlags, flag)
+		}
+	}
+	return metadata
+}
+
 func cloneGeminiContents(contents []*genai.Content) []*genai.Content {
 	if len(contents) == 0 {
 		return nil
@@ -858,6 +1083,54 @@ func (g *GeminiProvider) GenerateVideo(ctx context.Context, model string, prompt
 	return nil, fmt.Errorf("all API keys failed for provider: %s", providerName)
 }
 
+// CountTokens asks Gemini how many tokens text uses for the given model, without generating anything.
+func (g *GeminiProvider) CountTokens(ctx context.Context, model string, text string, isAPIKeyError func(error) bool) (int, error) {
+	parts := strings.SplitN(model, "/", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid model format: %s (expected gemini/model)", model)
+	}
+
+	providerName := parts[0]
+	modelName := parts[1]
+
+	provider, exists := g.config.Providers[providerName]
+	if !exists {
+		return 0, fmt.Errorf("unknown provider: %s", providerName)
+	}
+
+	availableKeys := provider.GetAPIKeys()
+	if len(availableKeys) == 0 {
+		return 0, fmt.Errorf("no API keys configured for provider: %s", providerName)
+	}
+
+	contents := []*genai.Content{genai.NewContentFromText(text, genai.RoleUser)}
+
+	for attempt := 0; attempt < len(availableKeys); attempt++ {
+		apiKey, err := g.apiKeyManager.GetNextAPIKey(ctx, providerName, availableKeys)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get API key: %w", err)
+		}
+
+		client, err := genai.NewClient(ctx, &genai.ClientConfig{APIKey: apiKey})
+		if err == nil {
+			var response *genai.CountTokensResponse
+			response, err = client.Models.CountTokens(ctx, modelName, contents, nil)
+			if err == nil {
+				return int(response.TotalTokens), nil
+			}
+		}
+
+		if !isAPIKeyError(err) {
+			return 0, fmt.Errorf("failed to count tokens: %w", err)
+		}
+		if err := g.apiKeyManager.MarkKeyAsBad(ctx, providerName, apiKey, err.Error()); err != nil {
+			log.Printf("Failed to mark API key as bad: %v", err)
+		}
+		log.Printf("API key issue detected, trying next key: %v", err)
+	}
+	return 0, fmt.Errorf("all API keys failed for provider: %s", providerName)
+}
+
 // SupportsURLContext checks if a given Gemini model supports the URL context tool.
 func (g *GeminiProvider) SupportsURLContext(modelName string) bool {
 	supportedModels := map[string]bool{
@@ -0,0 +1,401 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// geminiTestServer serves streamGenerateContent from handle and records the request bodies and keys
+type geminiTestServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []map[string]any
+	keys   []string
+}
+
+// newGeminiTestServer starts the server and points the Gemini SDK at it
+func newGeminiTestServer(t *testing.T, handle func(w http.ResponseWriter, apiKey string)) *geminiTestServer {
+	s := &geminiTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/models/model-1:streamGenerateContent") {
+			http.NotFound(w, r)
+			return
+		}
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		apiKey := r.Header.Get("x-goog-api-key")
+
+		s.mu.Lock()
+		s.bodies = append(s.bodies, body)
+		s.keys = append(s.keys, apiKey)
+		s.mu.Unlock()
+
+		handle(w, apiKey)
+	}))
+	t.Cleanup(s.Close)
+	t.Setenv("GOOGLE_GEMINI_BASE_URL", s.URL)
+	t.Setenv("GOOGLE_GENAI_USE_VERTEXAI", "")
+	return s
+}
+
+// writeGeminiSSE streams the chunks as server-sent events
+func writeGeminiSSE(w http.ResponseWriter, chunks ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, chunk := range chunks {
+		_, _ = fmt.Fprintf(w, "data: %s\r\n\r\n", chunk)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
+
+// writeGeminiError responds with a Google API error body
+func writeGeminiError(w http.ResponseWriter, status int, apiStatus, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `{"error":{"code":%d,"message":%q,"status":%q}}`, status, message, apiStatus)
+}
+
+// newTestGeminiProvider configures the "gemini" provider with the given keys
+func newTestGeminiProvider(keys []string, params config.ModelParams) (*GeminiProvider, *fakeKeyManager) {
+	cfg := &config.Config{
+		Providers: map[string]config.Provider{"gemini": {APIKeys: keys}},
+		Models:    map[string]config.ModelParams{"gemini/model-1": params},
+	}
+	keyManager := newFakeKeyManager()
+	helpers := testHelpers()
+	helpers.DownloadImage = func(_ context.Context, url string) ([]byte, string, error) {
+		if url == "https://example.com/cat.png" {
+			return []byte("png bytes"), "image/png", nil
+		}
+		return nil, "", errors.New("not found")
+	}
+	return NewGeminiProvider(cfg, keyManager).WithHelpers(helpers), keyManager
+}
+
+const geminiStopChunk = `{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":"STOP"}]}`
+
+func TestGeminiRequestMapping(t *testing.T) {
+	server := newGeminiTestServer(t, func(w http.ResponseWriter, _ string) {
+		writeGeminiSSE(w, geminiStopChunk)
+	})
+
+	temperature := float32(0.5)
+	budget := int32(128)
+	provider, _ := newTestGeminiProvider([]string{"key-1"}, config.ModelParams{Temperature: &temperature, ThinkingBudget: &budget})
+
+	messages := []messaging.OpenAIMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: []messaging.MessageContent{
+			{Type: "text", Text: "What is in this?"},
+			{Type: "image_url", ImageURL: &messaging.ImageURL{URL: "https://example.com/cat.png"}},
+			{Type: "image_url", ImageURL: &messaging.ImageURL{URL: "https://example.com/missing.png"}},
+		}},
+		{Role: "assistant", ToolCalls: []messaging.ToolCall{
+			{ID: "call_1", Name: "web_search", Arguments: `{"query":"cats"}`},
+			{ID: "call_2", Name: "web_search", Arguments: `{"query":"dogs"}`},
+		}},
+		{Role: "tool", Name: "web_search", ToolCallID: "call_1", Content: "cat results"},
+		{Role: "tool", Name: "web_search", ToolCallID: "call_2", Content: "dog results"},
+	}
+	tools := []interfaces.ToolDefinition{{
+		Name:        "web_search",
+		Description: "Search the web",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"query": map[string]any{"type": "string", "description": "Search query"}},
+			"required":   []any{"query"},
+		},
+	}}
+
+	ctx := WithReasoning(WithSeed(context.Background(), 7))
+	stream, err := provider.StreamChat(ctx, interfaces.ChatRequest{Model: "gemini/model-1", Messages: messages, Tools: tools})
+	if err != nil {
+		t.Fatalf("StreamChat: %v", err)
+	}
+	if content, _, final := streamText(collectStream(t, stream)); content != "ok" || final.Error != nil {
+		t.Fatalf("got content %q and error %v, want ok", content, final.Error)
+	}
+
+	if len(server.bodies) != 1 {
+		t.Fatalf("got %d requests, want 1", len(server.bodies))
+	}
+	body := server.bodies[0]
+	if server.keys[0] != "key-1" {
+		t.Errorf("sent key %q, want key-1", server.keys[0])
+	}
+
+	system, _ := body["systemInstruction"].(map[string]any)
+	if parts, _ := system["parts"].([]any); len(parts) != 1 || parts[0].(map[string]any)["text"] != "Be brief." {
+		t.Errorf("got system instruction %v", body["systemInstruction"])
+	}
+
+	contents, _ := body["contents"].([]any)
+	if len(contents) != 3 {
+		t.Fatalf("got %d contents, want user, model and one turn of function responses", len(contents))
+	}
+
+	user := contents[0].(map[string]any)
+	userParts, _ := user["parts"].([]any)
+	if user["role"] != "user" || len(userParts) != 2 {
+		t.Fatalf("got user content %v, want the text and the image that downloaded", user)
+	}
+	inline, _ := userParts[1].(map[string]any)["inlineData"].(map[string]any)
+	if inline["mimeType"] != "image/png" || inline["data"] != "cG5nIGJ5dGVz" {
+		t.Errorf("got inline image %v", inline)
+	}
+
+	model := contents[1].(map[string]any)
+	modelParts, _ := model["parts"].([]any)
+	if model["role"] != "model" || len(modelParts) != 2 {
+		t.Fatalf("got model content %v, want two function calls", model)
+	}
+	call, _ := modelParts[0].(map[string]any)["functionCall"].(map[string]any)
+	if call["name"] != "web_search" || call["id"] != "call_1" || call["args"].(map[string]any)["query"] != "cats" {
+		t.Errorf("got function call %v", call)
+	}
+
+	responses := contents[2].(map[string]any)
+	responseParts, _ := responses["parts"].([]any)
+	if responses["role"] != "user" || len(responseParts) != 2 {
+		t.Fatalf("got function responses %v, want both results in one user turn", responses)
+	}
+	response, _ := responseParts[1].(map[string]any)["functionResponse"].(map[string]any)
+	if response["name"] != "web_search" || response["id"] != "call_2" || response["response"].(map[string]any)["output"] != "dog results" {
+		t.Errorf("got function response %v", response)
+	}
+
+	// Function declarations replace the built-in grounding tools
+	sentTools, _ := body["tools"].([]any)
+	if len(sentTools) != 1 {
+		t.Fatalf("got tools %v, want one tool with function declarations", body["tools"])
+	}
+	declarations, _ := sentTools[0].(map[string]any)["functionDeclarations"].([]any)
+	if len(declarations) != 1 || declarations[0].(map[string]any)["name"] != "web_search" {
+		t.Errorf("got function declarations %v", declarations)
+	}
+
+	generation, _ := body["generationConfig"].(map[string]any)
+	if generation["temperature"] != 0.5 || generation["seed"] != float64(7) {
+		t.Errorf("got generation config %v, want temperature 0.5 and seed 7", generation)
+	}
+	thinking, _ := generation["thinkingConfig"].(map[string]any)
+	if thinking["thinkingBudget"] != float64(128) || thinking["includeThoughts"] != true {
+		t.Errorf("got thinking config %v, want a budget of 128 with thoughts included", thinking)
+	}
+	if settings, _ := body["safetySettings"].([]any); len(settings) == 0 {
+		t.Error("no safety settings sent")
+	}
+}
+
+func TestGeminiStreaming(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []string
+		wantContent   string
+		wantReasoning string
+		wantFinish    string
+		wantToolCalls int
+		wantPremature string
+	}{
+		{
+			name: "text with reasoning and a function call",
+			chunks: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"Let me think.","thought":true}]}}]}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}]}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"},{"functionCall":{"name":"web_search","args":{"query":"cats"}}}]},"finishReason":"STOP"}],` +
+					`"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"thoughtsTokenCount":2,"cachedContentTokenCount":3}}`,
+			},
+			wantContent:   "Hello",
+			wantReasoning: "Let me think.",
+			wantFinish:    "tool_calls",
+			wantToolCalls: 1,
+		},
+		{
+			name: "max tokens is a normal finish",
+			chunks: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"Long"}]},"finishReason":"MAX_TOKENS"}]}`,
+			},
+			wantContent: "Long",
+			wantFinish:  "MAX_TOKENS",
+		},
+		{
+			name: "safety stop is premature",
+			chunks: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"Par"}]},"finishReason":"SAFETY",` +
+					`"safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","probability":"HIGH","blocked":true}]}]}`,
+			},
+			wantContent:   "Par",
+			wantPremature: "SAFETY",
+		},
+		{
+			name: "blocked prompt is premature",
+			chunks: []string{
+				`{"promptFeedback":{"blockReason":"SAFETY"}}`,
+			},
+			wantPremature: "PROMPT_SAFETY",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newGeminiTestServer(t, func(w http.ResponseWriter, _ string) {
+				writeGeminiSSE(w, tt.chunks...)
+			})
+			provider, _ := newTestGeminiProvider([]string{"key-1"}, config.ModelParams{})
+
+			stream, err := provider.StreamChat(context.Background(), interfaces.ChatRequest{
+				Model:    "gemini/model-1",
+				Messages: []messaging.OpenAIMessage{{Role: "user", Content: "Hi"}},
+			})
+			if err != nil {
+				t.Fatalf("StreamChat: %v", err)
+			}
+			content, reasoning, final := streamText(collectStream(t, stream))
+
+			if content != tt.wantContent || reasoning != tt.wantReasoning {
+				t.Errorf("got content %q and reasoning %q, want %q and %q", content, reasoning, tt.wantContent, tt.wantReasoning)
+			}
+			if tt.wantPremature != "" {
+				var premature *PrematureStreamFinishError
+				if !errors.As(final.Error, &premature) || premature.FinishReason != tt.wantPremature {
+					t.Fatalf("got error %v, want a premature finish with %s", final.Error, tt.wantPremature)
+				}
+				return
+			}
+			if final.Error != nil {
+				t.Fatalf("stream failed: %v", final.Error)
+			}
+			if final.FinishReason != tt.wantFinish || len(final.ToolCalls) != tt.wantToolCalls {
+				t.Errorf("got finish reason %q with %d tool calls, want %q with %d", final.FinishReason, len(final.ToolCalls), tt.wantFinish, tt.wantToolCalls)
+			}
+			if tt.wantToolCalls > 0 && (final.ToolCalls[0].Name != "web_search" || final.ToolCalls[0].Arguments != `{"query":"cats"}`) {
+				t.Errorf("got tool call %+v", final.ToolCalls[0])
+			}
+		})
+	}
+}
+
+func TestGeminiUsageMetadata(t *testing.T) {
+	newGeminiTestServer(t, func(w http.ResponseWriter, _ string) {
+		writeGeminiSSE(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":"STOP"}],`+
+			`"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"thoughtsTokenCount":2,"cachedContentTokenCount":3}}`)
+	})
+	provider, _ := newTestGeminiProvider([]string{"key-1"}, config.ModelParams{})
+
+	stream, err := provider.StreamChat(context.Background(), interfaces.ChatRequest{
+		Model:    "gemini/model-1",
+		Messages: []messaging.OpenAIMessage{{Role: "user", Content: "Hi"}},
+	})
+	if err != nil {
+		t.Fatalf("StreamChat: %v", err)
+	}
+	_, _, final := streamText(collectStream(t, stream))
+
+	metadata := final.Metadata
+	if metadata == nil {
+		t.Fatal("final chunk has no metadata")
+	}
+	// Thinking tokens are billed as completion tokens
+	if metadata.PromptTokens != 10 || metadata.CompletionTokens != 7 || metadata.CachedTokens != 3 || metadata.ReasoningTokens != 2 || metadata.FinishReason != "STOP" {
+		t.Errorf("got metadata %+v", *metadata)
+	}
+}
+
+func TestGeminiErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   map[string]int // Status returned for each key, 200 streams a reply
+		wantKeys []string       // Keys tried in order
+		wantBad  int
+		wantErr  bool
+	}{
+		{
+			name:     "invalid key falls back to the next key",
+			status:   map[string]int{"key-1": http.StatusUnauthorized, "key-2": http.StatusOK},
+			wantKeys: []string{"key-1", "key-2"},
+			wantBad:  1,
+		},
+		{
+			name:     "overload moves to the next key",
+			status:   map[string]int{"key-1": http.StatusServiceUnavailable, "key-2": http.StatusOK},
+			wantKeys: []string{"key-1", "key-2"},
+		},
+		{
+			name:     "internal error moves to the next key",
+			status:   map[string]int{"key-1": http.StatusInternalServerError, "key-2": http.StatusOK},
+			wantKeys: []string{"key-1", "key-2"},
+		},
+		{
+			name:     "bad request is not retried",
+			status:   map[string]int{"key-1": http.StatusBadRequest, "key-2": http.StatusOK},
+			wantKeys: []string{"key-1"},
+			wantErr:  true,
+		},
+		{
+			name:     "every key invalid",
+			status:   map[string]int{"key-1": http.StatusUnauthorized, "key-2": http.StatusUnauthorized},
+			wantKeys: []string{"key-1", "key-2"},
+			wantBad:  2,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newGeminiTestServer(t, func(w http.ResponseWriter, apiKey string) {
+				switch status := tt.status[apiKey]; status {
+				case http.StatusOK:
+					writeGeminiSSE(w, geminiStopChunk)
+				case http.StatusUnauthorized:
+					writeGeminiError(w, status, "UNAUTHENTICATED", "API key not valid")
+				case http.StatusServiceUnavailable:
+					writeGeminiError(w, status, "UNAVAILABLE", "The model is overloaded")
+				case http.StatusInternalServerError:
+					writeGeminiError(w, status, "INTERNAL", "An internal error has occurred")
+				default:
+					writeGeminiError(w, status, "INVALID_ARGUMENT", "Bad request")
+				}
+			})
+			provider, keyManager := newTestGeminiProvider([]string{"key-1", "key-2"}, config.ModelParams{})
+
+			stream, err := provider.StreamChat(context.Background(), interfaces.ChatRequest{
+				Model:    "gemini/model-1",
+				Messages: []messaging.OpenAIMessage{{Role: "user", Content: "Hi"}},
+			})
+			if err != nil {
+				t.Fatalf("StreamChat: %v", err)
+			}
+			content, _, final := streamText(collectStream(t, stream))
+
+			if (final.Error != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", final.Error, tt.wantErr)
+			}
+			if !tt.wantErr && content != "ok" {
+				t.Errorf("got content %q, want ok", content)
+			}
+			if strings.Join(server.keys, ",") != strings.Join(tt.wantKeys, ",") {
+				t.Errorf("tried keys %v, want %v", server.keys, tt.wantKeys)
+			}
+			if bad := keyManager.badKeys(); len(bad) != tt.wantBad {
+				t.Errorf("marked %v as bad, want %d keys", bad, tt.wantBad)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package providers
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+	"DiscordAIChatbot/internal/logging"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+const ollamaDefaultBaseURL = "http://localhost:11434"
+
+// ollamaTopLevelParams are extra model parameters that belong at the top level of the request
+// instead of inside "options"
+var ollamaTopLevelParams = map[string]bool{
+	"format":     true,
+	"keep_alive": true,
+}
+
+// ollamaOptionAliases maps OpenAI-style parameter names to their Ollama option names
+var ollamaOptionAliases = map[string]string{
+	"max_tokens":         "num_predict",
+	"repetition_penalty": "repeat_penalty",
+}
+
+// OllamaProvider streams chat completions from the native Ollama /api/chat endpoint
+type OllamaProvider struct {
+	config        *config.Config
+	apiKeyManager interfaces.APIKeyManager
+	httpClient    *http.Client
+	helpers       Helpers
+}
+
+// NewOllamaProvider creates a new Ollama provider
+func NewOllamaProvider(cfg *config.Config, apiKeyManager interfaces.APIKeyManager, httpClient *http.Client, helpers Helpers) *OllamaProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &OllamaProvider{
+		config:        cfg,
+		apiKeyManager: apiKeyManager,
+		httpClient:    httpClient,
+		helpers:       helpers.withDefaults(),
+	}
+}
+
+// Name returns the provider type
+func (p *OllamaProvider) Name() string {
+	return config.ProviderTypeOllama
+}
+
+// ollamaRequest is the /api/chat request body
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Think    any             `json:"think,omitempty"`
+	Tools    []ollamaTool    `json:"tools,omitempty"`
+	Format   any             `json:"format,omitempty"`
+	Options  map[string]any  `json:"options,omitempty"`
+}
+
+// ollamaMessage is a single chat message
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+// ollamaTool is a function tool definition
+type ollamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description,omitempty"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
+}
+
+// ollamaToolCall is a function call issued by the model
+type ollamaToolCall struct {
+	Function struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaChunk is a single line of a streaming /api/chat response
+type ollamaChunk struct {
+	Message    ollamaMessage `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason"`
+	Error      string        `json:"error"`
+	// Token counts, sent with the final chunk
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+// ollamaChatURL returns the /api/chat endpoint for a configured base URL.
+// A trailing /v1 (the OpenAI-compatible prefix) is stripped.
+func ollamaChatURL(baseURL string) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+	if base == "" {
+		base = ollamaDefaultBaseURL
+	}
+	return base + "/api/chat"
+}
+
+// convertToOllamaMessages converts messages to Ollama chat messages with base64 images
+func (p *OllamaProvider) convertToOllamaMessages(ctx context.Context, messages []messaging.OpenAIMessage) []ollamaMessage {
+	result := make([]ollamaMessage, 0, len(messages))
+	for _, msg := range messages {
+		ollamaMsg := ollamaMessage{
+			Role:    msg.Role,
+			Content: contentText(msg.Content),
+		}
+
+		if msg.Role == "tool" {
+			ollamaMsg.ToolName = msg.Name
+		}
+
+		if parts, ok := msg.Content.([]messaging.MessageContent); ok {
+			for _, part := range parts {
+				switch part.Type {
+				case "image_url":
+					if part.ImageURL == nil {
+						continue
+					}
+					imageData, _, err := p.helpers.DownloadImage(ctx, part.ImageURL.URL)
+					if err != nil {
+						log.Printf("Failed to download image from %s: %v", part.ImageURL.URL, err)
+						continue
+					}
+					ollamaMsg.Images = append(ollamaMsg.Images, base64.StdEncoding.EncodeToString(imageData))
+				case "generated_image":
+					if part.GeneratedImage == nil {
+						continue
+					}
+					ollamaMsg.Images = append(ollamaMsg.Images, base64.StdEncoding.EncodeToString(part.GeneratedImage.Data))
+				}
+			}
+		}
+
+		for _, call := range msg.ToolCalls {
+			var toolCall ollamaToolCall
+			toolCall.Function.Name = call.Name
+			toolCall.Function.Arguments = decodeToolArguments(call)
+			ollamaMsg.ToolCalls = append(ollamaMsg.ToolCalls, toolCall)
+		}
+
+		result = append(result, ollamaMsg)
+	}
+	return result
+}
+
+// ollamaThink returns the "think" value for the model parameters, or nil to use the model default.
+// An explicit thinking budget toggles thinking; reasoning_effort is passed through as a level.
+func ollamaThink(params config.ModelParams) any {
+	if params.ThinkingBudget != nil {
+		return *params.ThinkingBudget != 0
+	}
+	switch params.ReasoningEffort {
+	case "":
+		return nil
+	case "none", "minimal":
+		return false
+	default:
+		return params.ReasoningEffort
+	}
+}
+
+// buildOllamaRequest builds the request body with extra model parameters split between options and the top level
+func (p *OllamaProvider) buildOllamaRequest(ctx context.Context, target *modelTarget, req interfaces.ChatRequest) ([]byte, error) {
+	body := ollamaRequest{
+		Model:    target.modelName,
+		Messages: p.convertToOllamaMessages(ctx, req.Messages),
+		Stream:   true,
+		Think:    ollamaThink(target.params),
+	}
+
+	options := make(map[string]any)
+	if target.params.Temperature != nil {
+		options["temperature"] = *target.params.Temperature
+	}
+	if seed, ok := seedFromContext(ctx); ok {
+		options["seed"] = seed
+	}
+	topLevel := make(map[string]any)
+	for key, value := range target.params.ExtraParams {
+		if ollamaTopLevelParams[key] {
+			topLevel[key] = value
+			continue
+		}
+		if alias, ok := ollamaOptionAliases[key]; ok {
+			key = alias
+		}
+		options[key] = value
+	}
+	if len(options) > 0 {
+		body.Options = options
+	}
+
+	for _, def := range req.Tools {
+		var tool ollamaTool
+		tool.Type = "function"
+		tool.Function.Name = def.Name
+		tool.Function.Description = def.Description
+		tool.Function.Parameters = def.Parameters
+		body.Tools = append(body.Tools, tool)
+	}
+	if schema := responseSchemaFromContext(ctx); schema != nil {
+		// Ollama takes the JSON schema itself as the format
+		body.Format = schema.Schema
+	}
+
+	return mergeExtraParams(body, topLevel)
+}
+
+// StreamChat implements interfaces.LLMProvider
+func (p *OllamaProvider) StreamChat(ctx context.Context, req interfaces.ChatRequest) (<-chan StreamResponse, error) {
+	target, err := resolveModel(ctx, p.config, req.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.buildOllamaRequest(ctx, target, req)
+	if err != nil {
+		return nil, err
+	}
+
+	url := ollamaChatURL(target.provider.BaseURL)
+	logging.LogToFile("Starting Ollama LLM request: Model=%s, Provider=%s", target.modelName, target.providerName)
+	logging.LogExternalContentToFile("=== DEBUG: Ollama API Payload ===\nURL: %s\n%s\n=== END DEBUG ===\n", url, string(body))
+
+	// Local servers need no key; hosted Ollama accepts a bearer token
+	resp, err := openWithKeyRotation(ctx, p.apiKeyManager, p.helpers, target.providerName, target.provider.GetAPIKeys(), func(apiKey string) (*http.Response, error) {
+		headers := map[string]string{}
+		if apiKey != "" {
+			headers["Authorization"] = "Bearer " + apiKey
+		}
+		return postJSON(ctx, p.httpClient, url, headers, body)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Ollama stream: %w", err)
+	}
+
+	responseChan := make(chan StreamResponse, config.StreamResponseBufferSize)
+	go func() {
+		defer close(responseChan)
+		defer closeBody(resp)
+		p.readStream(ctx, resp, responseChan)
+	}()
+
+	return responseChan, nil
+}
+
+// readStream parses the newline-delimited JSON chunks of a streaming response
+func (p *OllamaProvider) readStream(ctx context.Context, resp *http.Response, responseChan chan<- StreamResponse) {
+	send := func(streamResp StreamResponse) bool {
+		select {
+		case responseChan <- streamResp:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var toolCalls []messaging.ToolCall
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk ollamaChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			log.Printf("Failed to decode Ollama stream chunk: %v", err)
+			continue
+		}
+		if chunk.Error != "" {
+			send(StreamResponse{Error: fmt.Errorf("ollama stream error: %s", chunk.Error)})
+			return
+		}
+
+		if chunk.Message.Thinking != "" {
+			logging.LogExternalContentToFile("Ollama Response Thinking: %s", chunk.Message.Thinking)
+			if !send(StreamResponse{Reasoning: chunk.Message.Thinking}) {
+				return
+			}
+		}
+		for _, call := range chunk.Message.ToolCalls {
+			arguments, err := json.Marshal(call.Function.Arguments)
+			if err != nil || call.Function.Arguments == nil {
+				arguments = []byte("{}")
+			}
+			toolCalls = append(toolCalls, messaging.ToolCall{
+				Name:      call.Function.Name,
+				Arguments: string(arguments),
+			})
+		}
+		if chunk.Message.Content != "" {
+			logging.LogExternalContentToFile("Ollama Response Text: %s", chunk.Message.Content)
+			if !send(StreamResponse{Content: chunk.Message.Content}) {
+				return
+			}
+		}
+
+		if chunk.Done {
+			logging.LogExternalContentToFile("Ollama Response Done Reason: %s", chunk.DoneReason)
+			metadata := &interfaces.ResponseMetadata{
+				PromptTokens:     chunk.PromptEvalCount,
+				CompletionTokens: chunk.EvalCount,
+			}
+			if len(toolCalls) > 0 {
+				logging.LogExternalContentToFile("Ollama Response Tool Calls: %+v", toolCalls)
+				metadata.FinishReason = "tool_calls"
+				send(StreamResponse{FinishReason: "tool_calls", ToolCalls: toolCalls, Metadata: metadata})
+				return
+			}
+			finishReason := chunk.DoneReason
+			if finishReason == "" {
+				finishReason = "stop"
+			}
+			metadata.FinishReason = finishReason
+			send(StreamResponse{FinishReason: finishReason, Metadata: metadata})
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		send(StreamResponse{Error: fmt.Errorf("failed to read Ollama stream: %w", err)})
+		return
+	}
+	send(StreamResponse{Error: fmt.Errorf("ollama stream ended before completion")})
+}
@@ -0,0 +1,616 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	json "github.com/json-iterator/go"
+	openai "github.com/sashabaranov/go-openai"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+	"DiscordAIChatbot/internal/logging"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// OpenAIProvider streams chat completions from OpenAI-compatible APIs
+type OpenAIProvider struct {
+	config         *config.Config
+	apiKeyManager  interfaces.APIKeyManager
+	helpers        Helpers
+	clients        map[string]*openai.Client
+	clientMapMutex sync.RWMutex
+	// noStreamUsage holds the providers that rejected stream_options, see rejectsStreamOptions
+	noStreamUsage sync.Map
+}
+
+// NewOpenAIProvider creates a new OpenAI-compatible provider
+func NewOpenAIProvider(cfg *config.Config, apiKeyManager interfaces.APIKeyManager, helpers Helpers) *OpenAIProvider {
+	return &OpenAIProvider{
+		config:        cfg,
+		apiKeyManager: apiKeyManager,
+		helpers:       helpers.withDefaults(),
+		clients:       make(map[string]*openai.Client),
+	}
+}
+
+// Name returns the provider type
+func (p *OpenAIProvider) Name() string {
+	return config.ProviderTypeOpenAI
+}
+
+// getClient gets a client from the cache or creates a new one if it doesn't exist
+func (p *OpenAIProvider) getClient(providerName, baseURL, apiKey string) *openai.Client {
+	p.clientMapMutex.Lock()
+	defer p.clientMapMutex.Unlock()
+
+	// Use a combination of provider and key to cache clients
+	cacheKey := providerName + ":" + apiKey
+	if client, exists := p.clients[cacheKey]; exists {
+		return client
+	}
+
+	clientConfig := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		clientConfig.BaseURL = baseURL
+	}
+	// Merge per-model request parameters that the typed request cannot carry
+	clientConfig.HTTPClient = &http.Client{
+		Transport: &bodyOverrideTransport{base: http.DefaultTransport},
+	}
+	newClient := openai.NewClientWithConfig(clientConfig)
+	p.clients[cacheKey] = newClient
+	return newClient
+}
+
+// openAITools translates tool definitions into OpenAI function tool definitions
+func openAITools(defs []interfaces.ToolDefinition) []openai.Tool {
+	var tools []openai.Tool
+	for _, def := range defs {
+		tools = append(tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        def.Name,
+				Description: def.Description,
+				Parameters:  def.Parameters,
+			},
+		})
+	}
+	return tools
+}
+
+// jsonSchema lets a schema map be used where go-openai expects a json.Marshaler
+type jsonSchema map[string]any
+
+// MarshalJSON implements json.Marshaler
+func (s jsonSchema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any(s))
+}
+
+// openAIAudioFormat maps an audio MIME type to an input_audio format. Only WAV and MP3 are accepted.
+func openAIAudioFormat(mimeType string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0])) {
+	case "audio/wav", "audio/x-wav", "audio/wave":
+		return "wav", true
+	case "audio/mpeg", "audio/mp3":
+		return "mp3", true
+	}
+	return "", false
+}
+
+// openAIMediaPart builds the input_audio or file part for an audio or PDF attachment.
+// go-openai has no types for them, so they are merged into the request body as raw JSON.
+func openAIMediaPart(part messaging.MessageContent) (map[string]any, bool) {
+	switch {
+	case part.Type == "audio_file" && part.AudioFile != nil && len(part.AudioFile.Data) > 0:
+		format, ok := openAIAudioFormat(part.AudioFile.MIMEType)
+		if !ok {
+			log.Printf("Skipping audio with unsupported format for OpenAI: %s", part.AudioFile.MIMEType)
+			return nil, false
+		}
+		return map[string]any{
+			"type": "input_audio",
+			"input_audio": map[string]any{
+				"data":   base64.StdEncoding.EncodeToString(part.AudioFile.Data),
+				"format": format,
+			},
+		}, true
+	case part.Type == "pdf_file" && part.PDFFile != nil && len(part.PDFFile.Data) > 0:
+		filename := part.PDFFile.Filename
+		if filename == "" {
+			filename = "document.pdf"
+		}
+		return map[string]any{
+			"type": "file",
+			"file": map[string]any{
+				"filename":  filename,
+				"file_data": "data:application/pdf;base64," + base64.StdEncoding.EncodeToString(part.PDFFile.Data),
+			},
+		}, true
+	}
+	return nil, false
+}
+
+// messagesWithMediaParts encodes the request messages and appends the media parts to the
+// messages they belong to, keyed by message index
+func messagesWithMediaParts(messages []openai.ChatCompletionMessage, media map[int][]map[string]any) ([]map[string]any, error) {
+	encoded, err := json.Marshal(messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode messages: %w", err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode messages: %w", err)
+	}
+
+	for idx, parts := range media {
+		if idx >= len(decoded) {
+			continue
+		}
+		var content []any
+		switch existing := decoded[idx]["content"].(type) {
+		case []any:
+			content = existing
+		case string:
+			if existing != "" {
+				content = append(content, map[string]any{"type": "text", "text": existing})
+			}
+		}
+		for _, part := range parts {
+			content = append(content, part)
+		}
+		decoded[idx]["content"] = content
+	}
+	return decoded, nil
+}
+
+// convertToOpenAIMessages converts messages to the go-openai request format. Audio and PDF
+// parts are returned separately, keyed by message index, see messagesWithMediaParts.
+func convertToOpenAIMessages(messages []messaging.OpenAIMessage) ([]openai.ChatCompletionMessage, map[int][]map[string]any) {
+	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
+	media := make(map[int][]map[string]any)
+	var pendingCallIDs []string
+	for i, msg := range messages {
+		openaiMsg := openai.ChatCompletionMessage{
+			Role: msg.Role,
+			Name: msg.Name,
+		}
+
+		// Tool calls issued by the model and the results we sent back.
+		// Providers such as Gemini may not assign call IDs, so synthesize them in order.
+		for j, call := range msg.ToolCalls {
+			callID := call.ID
+			if callID == "" {
+				callID = fmt.Sprintf("call_%d_%d", i, j)
+				pendingCallIDs = append(pendingCallIDs, callID)
+			}
+			openaiMsg.ToolCalls = append(openaiMsg.ToolCalls, openai.ToolCall{
+				ID:   callID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      call.Name,
+					Arguments: call.Arguments,
+				},
+			})
+		}
+		if msg.Role == "tool" {
+			// Tool messages do not accept a name on OpenAI-compatible APIs
+			openaiMsg.Name = ""
+			openaiMsg.ToolCallID = msg.ToolCallID
+			if openaiMsg.ToolCallID == "" && len(pendingCallIDs) > 0 {
+				openaiMsg.ToolCallID = pendingCallIDs[0]
+				pendingCallIDs = pendingCallIDs[1:]
+			}
+		}
+
+		// Handle different content types
+		switch content := msg.Content.(type) {
+		case string:
+			openaiMsg.Content = content
+		case []messaging.MessageContent:
+			var parts []openai.ChatMessagePart
+			for _, part := range content {
+				if part.Type == "text" {
+					parts = append(parts, openai.ChatMessagePart{
+						Type: openai.ChatMessagePartTypeText,
+						Text: part.Text,
+					})
+				} else if part.Type == "image_url" && part.ImageURL != nil {
+					parts = append(parts, openai.ChatMessagePart{
+						Type: openai.ChatMessagePartTypeImageURL,
+						ImageURL: &openai.ChatMessageImageURL{
+							URL: part.ImageURL.URL,
+						},
+					})
+				} else if mediaPart, ok := openAIMediaPart(part); ok {
+					media[i] = append(media[i], mediaPart)
+				}
+			}
+			openaiMsg.MultiContent = parts
+		default:
+			openaiMsg.Content = fmt.Sprintf("%v", content)
+		}
+
+		openaiMessages[i] = openaiMsg
+	}
+	return openaiMessages, media
+}
+
+// CreateChatCompletionStream creates a streaming chat completion. tools may be empty.
+func (p *OpenAIProvider) CreateChatCompletionStream(ctx context.Context, model string, messages []messaging.OpenAIMessage, tools []interfaces.ToolDefinition) (*openai.ChatCompletionStream, error) {
+	target, err := resolveModel(ctx, p.config, model)
+	if err != nil {
+		return nil, err
+	}
+	providerName := target.providerName
+	provider := target.provider
+
+	// Get available API keys for this provider
+	availableKeys := provider.GetAPIKeys()
+	if len(availableKeys) == 0 {
+		return nil, fmt.Errorf("no API keys configured for provider: %s", providerName)
+	}
+
+	// Create request
+	openaiMessages, media := convertToOpenAIMessages(messages)
+	req := openai.ChatCompletionRequest{
+		Model:    target.modelName,
+		Messages: openaiMessages,
+		Stream:   true,
+	}
+	// Ask for the token usage of the response in a final chunk, unless the server refused it before
+	if _, rejected := p.noStreamUsage.Load(providerName); !rejected {
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+
+	// Apply model-specific parameters
+	if target.params.Temperature != nil {
+		req.Temperature = *target.params.Temperature
+	}
+	if seed, ok := seedFromContext(ctx); ok {
+		seedValue := int(seed)
+		req.Seed = &seedValue
+	}
+
+	// Offer registered tools to the model
+	if len(tools) > 0 {
+		req.Tools = openAITools(tools)
+	}
+	if schema := responseSchemaFromContext(ctx); schema != nil {
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:        schema.Name,
+				Description: schema.Description,
+				Schema:      jsonSchema(schema.Schema),
+				Strict:      true,
+			},
+		}
+	}
+
+	// Forward reasoning_effort, search_parameters and any extra keys in the request body
+	bodyOverrides := buildRequestBodyOverrides(target.params)
+	if len(media) > 0 {
+		// Audio and PDF parts replace the typed messages in the request body
+		messagesWithMedia, err := messagesWithMediaParts(req.Messages, media)
+		if err != nil {
+			return nil, err
+		}
+		if bodyOverrides == nil {
+			bodyOverrides = make(map[string]any, 1)
+		}
+		bodyOverrides["messages"] = messagesWithMedia
+	}
+	streamCtx := withRequestBodyOverrides(ctx, bodyOverrides)
+
+	// Log request start
+	logging.LogToFile("Starting OpenAI-compatible LLM request: Model=%s, Provider=%s", req.Model, providerName)
+
+	// Debug: Print OpenAI payload
+	logOpenAIPayload(req, providerName, provider.BaseURL)
+	for idx, parts := range media {
+		logging.LogExternalContentToFile("Message %d has %d native audio or file part(s)", idx, len(parts))
+	}
+	if len(bodyOverrides) > 0 {
+		logged := make(map[string]any, len(bodyOverrides))
+		for key, value := range bodyOverrides {
+			// Messages with media are mostly base64, their parts are counted above instead
+			if key != "messages" {
+				logged[key] = value
+			}
+		}
+		if overridesJSON, err := json.Marshal(logged); err == nil && len(logged) > 0 {
+			logging.LogExternalContentToFile("Extra body params: %s", string(overridesJSON))
+		}
+	}
+
+	// Try API keys until one works or we run out
+	maxRetries := len(availableKeys)
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		apiKey, err := p.apiKeyManager.GetNextAPIKey(ctx, providerName, availableKeys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get API key: %w", err)
+		}
+
+		client := p.getClient(providerName, provider.BaseURL, apiKey)
+
+		// Try to create stream with 503 retry mechanism
+		var stream *openai.ChatCompletionStream
+		createStream := func() error {
+			return p.helpers.RetryWith503Backoff(ctx, func() error {
+				var streamErr error
+				stream, streamErr = client.CreateChatCompletionStream(streamCtx, req)
+				return streamErr
+			})
+		}
+		err = createStream()
+
+		// Some compatible servers don't know stream_options. Ask once more without it,
+		// counting tokens by estimate, and leave it out for this provider from now on.
+		if err != nil && req.StreamOptions != nil && rejectsStreamOptions(err) {
+			log.Printf("Provider %s rejected stream_options, token usage will be estimated: %v", providerName, err)
+			p.noStreamUsage.Store(providerName, true)
+			req.StreamOptions = nil
+			err = createStream()
+		}
+
+		if err != nil {
+			detailedErr := buildDetailedError(err, providerName, provider.BaseURL)
+
+			if p.helpers.IsAPIKeyError(err) {
+				markErr := p.apiKeyManager.MarkKeyAsBad(ctx, providerName, apiKey, err.Error())
+				if markErr != nil {
+					fmt.Printf("Failed to mark API key as bad: %v\n", markErr)
+				}
+				fmt.Printf("API key issue detected, trying next key. %v\n", detailedErr)
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to create chat completion stream: %w", detailedErr)
+		}
+
+		return stream, nil
+	}
+
+	return nil, fmt.Errorf("all API keys failed for provider: %s", providerName)
+}
+
+// StreamChat implements interfaces.LLMProvider
+func (p *OpenAIProvider) StreamChat(ctx context.Context, chatReq interfaces.ChatRequest) (<-chan StreamResponse, error) {
+	// Reasoning deltas are read off the wire, since go-openai doesn't decode them
+	tap := &reasoningTap{}
+	stream, err := p.CreateChatCompletionStream(withReasoningTap(ctx, tap), chatReq.Model, chatReq.Messages, chatReq.Tools)
+	if err != nil {
+		return nil, err
+	}
+
+	responseChan := make(chan StreamResponse, config.StreamResponseBufferSize)
+
+	go func() {
+		defer close(responseChan)
+		defer func() {
+			if err := stream.Close(); err != nil {
+				log.Printf("Failed to close stream: %v", err)
+			}
+		}()
+
+		// Tool call arguments arrive in fragments keyed by index
+		var toolCalls []messaging.ToolCall
+		// The usage chunk comes after the finish reason, so the final chunk waits for the end of the stream
+		finishReason := ""
+		metadata := &interfaces.ResponseMetadata{}
+
+		for {
+			response, err := stream.Recv()
+			if reasoning := tap.take(); reasoning != "" {
+				logging.LogExternalContentToFile("OpenAI Response Reasoning: %s", reasoning)
+				select {
+				case responseChan <- StreamResponse{Reasoning: reasoning}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					// Stream finished normally
+					final := StreamResponse{FinishReason: finishReason, Metadata: metadata}
+					if final.FinishReason == "" {
+						final.FinishReason = "stop"
+					}
+					if len(toolCalls) > 0 {
+						// Some providers finish with "stop" even when tool calls were emitted
+						final.FinishReason = string(openai.FinishReasonToolCalls)
+						final.ToolCalls = toolCalls
+						logging.LogExternalContentToFile("OpenAI Response Tool Calls: %+v", toolCalls)
+					}
+					metadata.FinishReason = final.FinishReason
+					responseChan <- final
+					return
+				}
+
+				// Stream error
+				responseChan <- StreamResponse{Error: err}
+				return
+			}
+
+			if response.Usage != nil {
+				addOpenAIUsage(metadata, response.Usage)
+			}
+
+			// Process response
+			if len(response.Choices) > 0 {
+				choice := response.Choices[0]
+
+				// Log the response content
+				if choice.Delta.Content != "" {
+					logging.LogExternalContentToFile("OpenAI Response Text: %s", choice.Delta.Content)
+				}
+				if choice.FinishReason != "" {
+					logging.LogExternalContentToFile("OpenAI Response Finish Reason: %s", string(choice.FinishReason))
+					finishReason = string(choice.FinishReason)
+					if choice.FinishReason == openai.FinishReasonContentFilter {
+						metadata.SafetyFlags = append(metadata.SafetyFlags, "content filter")
+					}
+				}
+
+				toolCalls = accumulateToolCallDeltas(toolCalls, choice.Delta.ToolCalls)
+
+				if choice.Delta.Content != "" {
+					select {
+					case responseChan <- StreamResponse{Content: choice.Delta.Content}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// addOpenAIUsage records the token usage reported in the last chunk of a stream
+func addOpenAIUsage(metadata *interfaces.ResponseMetadata, usage *openai.Usage) {
+	metadata.PromptTokens = usage.PromptTokens
+	metadata.CompletionTokens = usage.CompletionTokens
+	if usage.PromptTokensDetails != nil {
+		metadata.CachedTokens = usage.PromptTokensDetails.CachedTokens
+	}
+	if usage.CompletionTokensDetails != nil {
+		metadata.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	logging.LogExternalContentToFile("OpenAI Response Usage: %+v", *metadata)
+}
+
+// accumulateToolCallDeltas merges streamed tool call fragments into complete tool calls
+func accumulateToolCallDeltas(calls []messaging.ToolCall, deltas []openai.ToolCall) []messaging.ToolCall {
+	for _, delta := range deltas {
+		idx := len(calls) - 1
+		if delta.Index != nil {
+			idx = *delta.Index
+		} else if delta.ID != "" || idx < 0 {
+			idx = len(calls)
+		}
+		for len(calls) <= idx {
+			calls = append(calls, messaging.ToolCall{})
+		}
+
+		call := &calls[idx]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Function.Name != "" {
+			call.Name = delta.Function.Name
+		}
+		call.Arguments += delta.Function.Arguments
+	}
+	return calls
+}
+
+// logOpenAIPayload logs the OpenAI API request payload for debugging
+func logOpenAIPayload(req openai.ChatCompletionRequest, providerName, baseURL string) {
+	logging.LogExternalContentToFile("=== DEBUG: OpenAI-Compatible API Payload ===")
+	logging.LogExternalContentToFile("Model: %s", req.Model)
+	logging.LogExternalContentToFile("Provider: %s", providerName)
+	logging.LogExternalContentToFile("BaseURL: %s", baseURL)
+	logging.LogExternalContentToFile("Temperature: %f", req.Temperature)
+	logging.LogExternalContentToFile("Stream: %t", req.Stream)
+	if len(req.Tools) > 0 {
+		var toolNames []string
+		for _, tool := range req.Tools {
+			if tool.Function != nil {
+				toolNames = append(toolNames, tool.Function.Name)
+			}
+		}
+		logging.LogExternalContentToFile("Tools: %s", strings.Join(toolNames, ", "))
+	}
+	if req.ResponseFormat != nil && req.ResponseFormat.JSONSchema != nil {
+		logging.LogExternalContentToFile("ResponseFormat: json_schema %s", req.ResponseFormat.JSONSchema.Name)
+	}
+	logging.LogExternalContentToFile("Messages:")
+	for i, msg := range req.Messages {
+		logging.LogExternalContentToFile("  Message %d [Role: %s]:", i, msg.Role)
+		if msg.Name != "" {
+			logging.LogExternalContentToFile("    Name: %s", msg.Name)
+		}
+		if msg.Content != "" {
+			// Highlight system messages in the debug output
+			if msg.Role == "system" {
+				logging.LogExternalContentToFile("    SystemPrompt: %s", msg.Content)
+			} else {
+				logging.LogExternalContentToFile("    Content: %s", msg.Content)
+			}
+		} else if len(msg.MultiContent) > 0 {
+			logging.LogExternalContentToFile("    MultiContent:")
+			for j, part := range msg.MultiContent {
+				if part.Type == openai.ChatMessagePartTypeText {
+					logging.LogExternalContentToFile("      Part %d [Text]: %s", j, part.Text)
+				} else if part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil {
+					logging.LogExternalContentToFile("      Part %d [Image]: %s", j, part.ImageURL.URL)
+				}
+			}
+		}
+	}
+
+	// Also print as JSON for complete payload visibility
+	if payloadJSON, err := json.MarshalIndent(req, "", "  "); err == nil {
+		logging.LogExternalContentToFile("Complete JSON Payload:\n%s", string(payloadJSON))
+	}
+	logging.LogExternalContentToFile("=== END DEBUG ===\n")
+}
+
+// rejectsStreamOptions reports whether a request failed because the server doesn't accept stream_options
+func rejectsStreamOptions(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusBadRequest &&
+			(apiErr.Param != nil && *apiErr.Param == "stream_options" || strings.Contains(apiErr.Message, "stream_options"))
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == http.StatusBadRequest && strings.Contains(string(reqErr.Body), "stream_options")
+	}
+	return false
+}
+
+// buildDetailedError builds a detailed error message with helpful suggestions
+func buildDetailedError(err error, providerName, baseURL string) error {
+	errStr := err.Error()
+
+	// Detect common issues and provide helpful suggestions
+	if strings.Contains(errStr, "invalid character") && strings.Contains(errStr, "looking for beginning of value") {
+		return fmt.Errorf("server returned non-JSON response (likely HTML error page). "+
+			"Provider: %s, BaseURL: %s, Error: %w. "+
+			"This usually means: 1) The server at %s is down or misconfigured, "+
+			"2) Wrong base URL in config, or 3) Server returning HTML error pages instead of JSON. "+
+			"If using GitHub Copilot proxy, check proxy logs for upstream API errors",
+			providerName, baseURL, err, baseURL)
+	} else if strings.Contains(errStr, "Bad Request") || strings.Contains(errStr, "status code: 400") {
+		return fmt.Errorf("bad request error from API. "+
+			"Provider: %s, BaseURL: %s, Error: %w. "+
+			"This usually means: 1) Invalid request parameters, 2) Authentication issues, "+
+			"3) Model not available, or 4) Quota/rate limit exceeded",
+			providerName, baseURL, err)
+	} else if strings.Contains(errStr, "connection refused") || strings.Contains(errStr, "no such host") {
+		return fmt.Errorf("cannot connect to server. "+
+			"Provider: %s, BaseURL: %s, Error: %w. "+
+			"Please check: 1) Is the server running at %s? 2) Is the base URL correct? 3) Network connectivity",
+			providerName, baseURL, err, baseURL)
+	} else if strings.Contains(errStr, "timeout") {
+		return fmt.Errorf("request timeout. "+
+			"Provider: %s, BaseURL: %s, Error: %w. "+
+			"The server may be overloaded or too slow to respond",
+			providerName, baseURL, err)
+	} else {
+		return fmt.Errorf("request failed. "+
+			"Provider: %s, BaseURL: %s, Error: %w",
+			providerName, baseURL, err)
+	}
+}
@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	json "github.com/json-iterator/go"
+)
+
+// reasoningTap collects the reasoning deltas go-openai drops while decoding a stream.
+// OpenAI-compatible servers send them as delta.reasoning_content (DeepSeek, vLLM)
+// or delta.reasoning (OpenRouter).
+type reasoningTap struct {
+	mu      sync.Mutex
+	pending strings.Builder
+}
+
+// Context key carrying the reasoning tap of a streaming request
+type reasoningTapKey struct{}
+
+// withReasoningTap returns a context that makes the transport feed streamed events to the tap
+func withReasoningTap(ctx context.Context, tap *reasoningTap) context.Context {
+	return context.WithValue(ctx, reasoningTapKey{}, tap)
+}
+
+// reasoningTapFromContext returns the reasoning tap stored in the context, if any
+func reasoningTapFromContext(ctx context.Context) *reasoningTap {
+	tap, _ := ctx.Value(reasoningTapKey{}).(*reasoningTap)
+	return tap
+}
+
+// add records the reasoning in a server-sent event payload
+func (t *reasoningTap) add(payload []byte) {
+	var event struct {
+		Choices []struct {
+			Delta struct {
+				ReasoningContent string `json:"reasoning_content"`
+				Reasoning        string `json:"reasoning"`
+			} `json:"delta"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil || len(event.Choices) == 0 {
+		// [DONE] and keep-alive payloads carry no reasoning
+		return
+	}
+
+	delta := event.Choices[0].Delta
+	reasoning := delta.ReasoningContent
+	if reasoning == "" {
+		reasoning = delta.Reasoning
+	}
+	if reasoning == "" {
+		return
+	}
+
+	t.mu.Lock()
+	t.pending.WriteString(reasoning)
+	t.mu.Unlock()
+}
+
+// take returns the reasoning seen since the last call
+func (t *reasoningTap) take() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	reasoning := t.pending.String()
+	t.pending.Reset()
+	return reasoning
+}
+
+// tapReader passes a streamed response body through while feeding its events to a reasoning tap
+type tapReader struct {
+	body io.ReadCloser
+	tap  *reasoningTap
+	line []byte // Incomplete line carried over to the next read
+}
+
+// Read implements io.Reader
+func (r *tapReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.scan(p[:n])
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (r *tapReader) Close() error {
+	return r.body.Close()
+}
+
+// scan feeds every complete "data:" line to the tap
+func (r *tapReader) scan(data []byte) {
+	r.line = append(r.line, data...)
+	consumed := 0
+	for {
+		idx := bytes.IndexByte(r.line[consumed:], '\n')
+		if idx < 0 {
+			break
+		}
+		line := bytes.TrimSpace(r.line[consumed : consumed+idx])
+		consumed += idx + 1
+		if payload, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			r.tap.add(bytes.TrimSpace(payload))
+		}
+	}
+	r.line = append(r.line[:0], r.line[consumed:]...)
+}
@@ -0,0 +1,357 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// openAITestServer serves chat completions from handle and records the request bodies and keys
+type openAITestServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []map[string]any
+	keys   []string
+}
+
+func newOpenAITestServer(t *testing.T, handle func(w http.ResponseWriter, apiKey string)) *openAITestServer {
+	s := &openAITestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		apiKey := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		s.mu.Lock()
+		s.bodies = append(s.bodies, body)
+		s.keys = append(s.keys, apiKey)
+		s.mu.Unlock()
+
+		handle(w, apiKey)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// writeSSE streams the events as server-sent events followed by [DONE]
+func writeSSE(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, event := range events {
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", event)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	_, _ = io.WriteString(w, "data: [DONE]\n\n")
+}
+
+// writeAPIError responds with an OpenAI-style error body
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `{"error":{"message":%q,"type":"error"}}`, message)
+}
+
+// newTestOpenAIProvider configures a provider named "test" at the server with the given keys
+func newTestOpenAIProvider(serverURL string, keys []string, params config.ModelParams) (*OpenAIProvider, *fakeKeyManager) {
+	cfg := &config.Config{
+		Providers: map[string]config.Provider{
+			"test": {BaseURL: serverURL + "/v1", APIKeys: keys},
+		},
+		Models: map[string]config.ModelParams{"test/model-1": params},
+	}
+	keyManager := newFakeKeyManager()
+	return NewOpenAIProvider(cfg, keyManager, testHelpers()), keyManager
+}
+
+func TestOpenAIRequestMapping(t *testing.T) {
+	server := newOpenAITestServer(t, func(w http.ResponseWriter, _ string) {
+		writeSSE(w, `{"choices":[{"index":0,"delta":{"content":"ok"},"finish_reason":"stop"}]}`)
+	})
+
+	zero := float32(0)
+	provider, _ := newTestOpenAIProvider(server.URL, []string{"key-1"}, config.ModelParams{
+		Temperature:     &zero,
+		ReasoningEffort: "low",
+		ExtraParams:     map[string]any{"top_k": 5},
+	})
+
+	messages := []messaging.OpenAIMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Name: "alice", Content: []messaging.MessageContent{
+			{Type: "text", Text: "What is in this?"},
+			{Type: "image_url", ImageURL: &messaging.ImageURL{URL: "https://example.com/cat.png"}},
+			{Type: "pdf_file", PDFFile: &messaging.PDFContent{MIMEType: "application/pdf", Filename: "doc.pdf", Data: []byte("%PDF")}},
+		}},
+		{Role: "assistant", ToolCalls: []messaging.ToolCall{{Name: "web_search", Arguments: `{"query":"cats"}`}}},
+		{Role: "tool", Name: "web_search", Content: "results"},
+	}
+	tools := []interfaces.ToolDefinition{{
+		Name:        "web_search",
+		Description: "Search the web",
+		Parameters:  map[string]any{"type": "object", "properties": map[string]any{"query": map[string]any{"type": "string"}}},
+	}}
+
+	ctx := WithSeed(context.Background(), 7)
+	stream, err := provider.StreamChat(ctx, interfaces.ChatRequest{Model: "test/model-1", Messages: messages, Tools: tools})
+	if err != nil {
+		t.Fatalf("StreamChat: %v", err)
+	}
+	collectStream(t, stream)
+
+	if len(server.bodies) != 1 {
+		t.Fatalf("got %d requests, want 1", len(server.bodies))
+	}
+	body := server.bodies[0]
+	if body["model"] != "model-1" || body["stream"] != true {
+		t.Errorf("got model %v and stream %v, want model-1 streamed", body["model"], body["stream"])
+	}
+	if options, _ := body["stream_options"].(map[string]any); options["include_usage"] != true {
+		t.Errorf("got stream_options %v, want usage included", body["stream_options"])
+	}
+	if body["seed"] != float64(7) || body["temperature"] != float64(0) || body["reasoning_effort"] != "low" || body["top_k"] != float64(5) {
+		t.Errorf("got seed %v, temperature %v, reasoning_effort %v, top_k %v", body["seed"], body["temperature"], body["reasoning_effort"], body["top_k"])
+	}
+	if server.keys[0] != "key-1" {
+		t.Errorf("sent key %q, want key-1", server.keys[0])
+	}
+
+	sent, _ := body["messages"].([]any)
+	if len(sent) != 4 {
+		t.Fatalf("got %d messages, want 4", len(sent))
+	}
+	system := sent[0].(map[string]any)
+	if system["role"] != "system" || system["content"] != "Be brief." {
+		t.Errorf("got system message %v", system)
+	}
+
+	user := sent[1].(map[string]any)
+	if user["name"] != "alice" {
+		t.Errorf("got user name %v, want alice", user["name"])
+	}
+	parts, _ := user["content"].([]any)
+	var types []string
+	for _, part := range parts {
+		types = append(types, fmt.Sprint(part.(map[string]any)["type"]))
+	}
+	if strings.Join(types, ",") != "text,image_url,file" {
+		t.Fatalf("got user parts %v, want text, image_url and file", types)
+	}
+	file := parts[2].(map[string]any)["file"].(map[string]any)
+	if file["filename"] != "doc.pdf" || file["file_data"] != "data:application/pdf;base64,JVBERg==" {
+		t.Errorf("got file part %v", file)
+	}
+
+	// Tool calls without IDs get synthesized ones that the tool result refers to
+	assistant := sent[2].(map[string]any)
+	calls, _ := assistant["tool_calls"].([]any)
+	if len(calls) != 1 {
+		t.Fatalf("got assistant tool calls %v, want 1", assistant["tool_calls"])
+	}
+	call := calls[0].(map[string]any)
+	function := call["function"].(map[string]any)
+	if function["name"] != "web_search" || function["arguments"] != `{"query":"cats"}` || call["id"] == "" {
+		t.Errorf("got tool call %v", call)
+	}
+	tool := sent[3].(map[string]any)
+	if tool["role"] != "tool" || tool["tool_call_id"] != call["id"] || tool["name"] != nil {
+		t.Errorf("got tool message %v, want it answering %v without a name", tool, call["id"])
+	}
+
+	sentTools, _ := body["tools"].([]any)
+	if len(sentTools) != 1 || sentTools[0].(map[string]any)["function"].(map[string]any)["name"] != "web_search" {
+		t.Errorf("got tools %v", body["tools"])
+	}
+}
+
+func TestOpenAIStreaming(t *testing.T) {
+	server := newOpenAITestServer(t, func(w http.ResponseWriter, _ string) {
+		writeSSE(w,
+			`{"choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"Thinking "}}]}`,
+			`{"choices":[{"index":0,"delta":{"reasoning_content":"hard."}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"web_search","arguments":"{\"query\":"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"cats\"}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":8,"total_tokens":20,"prompt_tokens_details":{"cached_tokens":4},"completion_tokens_details":{"reasoning_tokens":3}}}`,
+		)
+	})
+	provider, _ := newTestOpenAIProvider(server.URL, []string{"key-1"}, config.ModelParams{})
+
+	stream, err := provider.StreamChat(context.Background(), interfaces.ChatRequest{
+		Model:    "test/model-1",
+		Messages: []messaging.OpenAIMessage{{Role: "user", Content: "Hi"}},
+	})
+	if err != nil {
+		t.Fatalf("StreamChat: %v", err)
+	}
+	content, reasoning, final := streamText(collectStream(t, stream))
+
+	if content != "Hello" {
+		t.Errorf("got content %q, want %q", content, "Hello")
+	}
+	if reasoning != "Thinking hard." {
+		t.Errorf("got reasoning %q, want %q", reasoning, "Thinking hard.")
+	}
+	if final.Error != nil {
+		t.Fatalf("stream failed: %v", final.Error)
+	}
+	// Providers may finish with "stop" after emitting tool calls
+	if final.FinishReason != "tool_calls" {
+		t.Errorf("got finish reason %q, want tool_calls", final.FinishReason)
+	}
+	if len(final.ToolCalls) != 1 || final.ToolCalls[0].ID != "call_1" || final.ToolCalls[0].Name != "web_search" || final.ToolCalls[0].Arguments != `{"query":"cats"}` {
+		t.Errorf("got tool calls %+v", final.ToolCalls)
+	}
+
+	metadata := final.Metadata
+	if metadata == nil {
+		t.Fatal("final chunk has no metadata")
+	}
+	if metadata.PromptTokens != 12 || metadata.CompletionTokens != 8 || metadata.CachedTokens != 4 || metadata.ReasoningTokens != 3 {
+		t.Errorf("got usage %+v", *metadata)
+	}
+	if metadata.FinishReason != "tool_calls" {
+		t.Errorf("got metadata finish reason %q, want tool_calls", metadata.FinishReason)
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   map[string]int // Status returned for each key, 200 streams a reply
+		wantKeys []string       // Keys tried in order
+		wantBad  int
+		wantErr  bool
+	}{
+		{
+			name:     "invalid key falls back to the next key",
+			status:   map[string]int{"key-1": http.StatusUnauthorized, "key-2": http.StatusOK},
+			wantKeys: []string{"key-1", "key-2"},
+			wantBad:  1,
+		},
+		{
+			name:     "overload is retried with the same key",
+			status:   map[string]int{"key-1": http.StatusServiceUnavailable, "key-2": http.StatusOK},
+			wantKeys: []string{"key-1", "key-1"},
+			wantErr:  true,
+		},
+		{
+			name:     "bad request is not retried",
+			status:   map[string]int{"key-1": http.StatusBadRequest, "key-2": http.StatusOK},
+			wantKeys: []string{"key-1"},
+			wantErr:  true,
+		},
+		{
+			name:     "every key invalid",
+			status:   map[string]int{"key-1": http.StatusUnauthorized, "key-2": http.StatusUnauthorized},
+			wantKeys: []string{"key-1", "key-2"},
+			wantBad:  2,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newOpenAITestServer(t, func(w http.ResponseWriter, apiKey string) {
+				switch status := tt.status[apiKey]; status {
+				case http.StatusOK:
+					writeSSE(w, `{"choices":[{"index":0,"delta":{"content":"ok"},"finish_reason":"stop"}]}`)
+				case http.StatusUnauthorized:
+					writeAPIError(w, status, "Incorrect API key provided")
+				default:
+					writeAPIError(w, status, http.StatusText(status))
+				}
+			})
+			provider, keyManager := newTestOpenAIProvider(server.URL, []string{"key-1", "key-2"}, config.ModelParams{})
+
+			stream, err := provider.StreamChat(context.Background(), interfaces.ChatRequest{
+				Model:    "test/model-1",
+				Messages: []messaging.OpenAIMessage{{Role: "user", Content: "Hi"}},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if content, _, final := streamText(collectStream(t, stream)); content != "ok" || final.Error != nil {
+					t.Errorf("got content %q and error %v, want ok", content, final.Error)
+				}
+			}
+
+			if strings.Join(server.keys, ",") != strings.Join(tt.wantKeys, ",") {
+				t.Errorf("tried keys %v, want %v", server.keys, tt.wantKeys)
+			}
+			if bad := keyManager.badKeys(); len(bad) != tt.wantBad {
+				t.Errorf("marked %v as bad, want %d keys", bad, tt.wantBad)
+			}
+		})
+	}
+}
+
+func TestOpenAIStreamOptionsRejected(t *testing.T) {
+	var server *openAITestServer
+	server = newOpenAITestServer(t, func(w http.ResponseWriter, _ string) {
+		server.mu.Lock()
+		_, withOptions := server.bodies[len(server.bodies)-1]["stream_options"]
+		server.mu.Unlock()
+		if withOptions {
+			writeAPIError(w, http.StatusBadRequest, "Unrecognized request argument supplied: stream_options")
+			return
+		}
+		writeSSE(w, `{"choices":[{"index":0,"delta":{"content":"ok"},"finish_reason":"stop"}]}`)
+	})
+	provider, keyManager := newTestOpenAIProvider(server.URL, []string{"key-1"}, config.ModelParams{})
+
+	for i := 0; i < 2; i++ {
+		stream, err := provider.StreamChat(context.Background(), interfaces.ChatRequest{
+			Model:    "test/model-1",
+			Messages: []messaging.OpenAIMessage{{Role: "user", Content: "Hi"}},
+		})
+		if err != nil {
+			t.Fatalf("StreamChat %d: %v", i, err)
+		}
+		if content, _, final := streamText(collectStream(t, stream)); content != "ok" || final.Error != nil {
+			t.Errorf("got content %q and error %v, want ok", content, final.Error)
+		}
+	}
+
+	// The first request is asked again without stream_options, the second leaves it out
+	if len(server.bodies) != 3 {
+		t.Fatalf("sent %d requests, want 3", len(server.bodies))
+	}
+	for i, body := range server.bodies[1:] {
+		if _, ok := body["stream_options"]; ok {
+			t.Errorf("request %d still has stream_options", i+2)
+		}
+	}
+	if bad := keyManager.badKeys(); len(bad) != 0 {
+		t.Errorf("marked %v as bad", bad)
+	}
+}
+
+func TestOpenAIUnknownModel(t *testing.T) {
+	provider, _ := newTestOpenAIProvider("http://127.0.0.1:0", []string{"key-1"}, config.ModelParams{})
+	for _, model := range []string{"model-1", "missing/model-1"} {
+		if _, err := provider.StreamChat(context.Background(), interfaces.ChatRequest{Model: model}); err == nil {
+			t.Errorf("StreamChat(%q) succeeded, want an error", model)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// StreamResponse represents a streaming response chunk
+type StreamResponse = interfaces.StreamResponse
+
+// maxErrorBodyBytes limits how much of an error response body is included in error messages
+const maxErrorBodyBytes = 2048
+
+// Helpers bundles the image download and retry callbacks that providers borrow from the LLM client.
+// Nil callbacks fall back to simple defaults so providers can be used standalone, e.g. against httptest servers.
+type Helpers struct {
+	DownloadImage            func(context.Context, string) ([]byte, string, error)
+	IsAPIKeyError            func(error) bool
+	Is503Error               func(error) bool
+	RetryWith503Backoff      func(context.Context, func() error) error
+	IsInternalError          func(error) bool
+	RetryWithInternalBackoff func(context.Context, func() error) error
+}
+
+// withDefaults returns a copy of the helpers with every nil callback replaced by a default
+func (h Helpers) withDefaults() Helpers {
+	never := func(error) bool { return false }
+	once := func(_ context.Context, fn func() error) error { return fn() }
+
+	if h.DownloadImage == nil {
+		h.DownloadImage = func(_ context.Context, url string) ([]byte, string, error) {
+			return nil, "", fmt.Errorf("no image downloader configured for %s", url)
+		}
+	}
+	if h.IsAPIKeyError == nil {
+		h.IsAPIKeyError = never
+	}
+	if h.Is503Error == nil {
+		h.Is503Error = never
+	}
+	if h.RetryWith503Backoff == nil {
+		h.RetryWith503Backoff = once
+	}
+	if h.IsInternalError == nil {
+		h.IsInternalError = never
+	}
+	if h.RetryWithInternalBackoff == nil {
+		h.RetryWithInternalBackoff = once
+	}
+	return h
+}
+
+// Context key carrying a sampling seed for the request
+type seedKey struct{}
+
+// WithSeed returns a context that asks providers supporting it to sample with the given seed.
+// Regenerated responses pass a fresh seed so they differ from earlier variants.
+func WithSeed(ctx context.Context, seed int32) context.Context {
+	return context.WithValue(ctx, seedKey{}, seed)
+}
+
+// seedFromContext returns the sampling seed stored in the context, if any
+func seedFromContext(ctx context.Context) (int32, bool) {
+	seed, ok := ctx.Value(seedKey{}).(int32)
+	return seed, ok
+}
+
+// Context key carrying a sampling temperature for the request
+type temperatureKey struct{}
+
+// WithTemperature returns a context that samples with the given temperature instead of the
+// one configured for the model. Personas use it to bring their own temperature.
+func WithTemperature(ctx context.Context, temperature float32) context.Context {
+	return context.WithValue(ctx, temperatureKey{}, temperature)
+}
+
+// paramsForRequest returns the model parameters with the overrides stored in the context applied
+func paramsForRequest(ctx context.Context, params config.ModelParams) config.ModelParams {
+	if temperature, ok := ctx.Value(temperatureKey{}).(float32); ok {
+		params.Temperature = &temperature
+	}
+	return params
+}
+
+// Context key asking providers to return the model's reasoning
+type reasoningKey struct{}
+
+// WithReasoning returns a context that asks providers to stream the model's reasoning as
+// StreamResponse.Reasoning. Providers that always return it, such as OpenAI-compatible
+// servers sending reasoning_content, stream it either way.
+func WithReasoning(ctx context.Context) context.Context {
+	return context.WithValue(ctx, reasoningKey{}, true)
+}
+
+// reasoningRequested reports whether the context asks for the model's reasoning
+func reasoningRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(reasoningKey{}).(bool)
+	return requested
+}
+
+// ResponseSchema asks for a reply that is a single JSON object matching Schema.
+// OpenAI strict mode needs every property listed as required and additionalProperties set to false.
+type ResponseSchema struct {
+	Name        string
+	Description string
+	Schema      map[string]any
+}
+
+// Context key carrying the response schema for the request
+type responseSchemaKey struct{}
+
+// WithResponseSchema returns a context that asks providers supporting structured output
+// to constrain the reply to the schema. Others ignore it.
+func WithResponseSchema(ctx context.Context, schema *ResponseSchema) context.Context {
+	return context.WithValue(ctx, responseSchemaKey{}, schema)
+}
+
+// responseSchemaFromContext returns the response schema stored in the context, if any
+func responseSchemaFromContext(ctx context.Context) *ResponseSchema {
+	schema, _ := ctx.Value(responseSchemaKey{}).(*ResponseSchema)
+	return schema
+}
+
+// SupportsResponseSchema reports whether a provider type constrains replies to a response schema natively
+func SupportsResponseSchema(providerType string) bool {
+	switch providerType {
+	case config.ProviderTypeOpenAI, config.ProviderTypeGemini, config.ProviderTypeOllama:
+		return true
+	}
+	return false
+}
+
+// SchemaStrings reads a JSON schema string list written as []string or decoded as []any
+func SchemaStrings(value any) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []any:
+		strs := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+// SupportsNativeModality reports whether a provider type can send an "audio" or "pdf" attachment
+// of the given MIME type as is. The model must also accept it, see config.AcceptsModality.
+func SupportsNativeModality(providerType, modality, mimeType string) bool {
+	switch providerType {
+	case config.ProviderTypeGemini:
+		return true
+	case config.ProviderTypeOpenAI:
+		if modality == config.ModalityAudio {
+			_, ok := openAIAudioFormat(mimeType)
+			return ok
+		}
+		return modality == config.ModalityPDF
+	case config.ProviderTypeAnthropic:
+		return modality == config.ModalityPDF
+	}
+	return false
+}
+
+// modelTarget is a "provider/model" reference resolved against the config
+type modelTarget struct {
+	providerName string
+	modelName    string
+	provider     config.Provider
+	params       config.ModelParams
+}
+
+// resolveModel splits a "provider/model" reference and looks up its provider config and model parameters,
+// applying the overrides stored in the context
+func resolveModel(ctx context.Context, cfg *config.Config, model string) (*modelTarget, error) {
+	parts := strings.SplitN(model, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid model format: %s (expected provider/model)", model)
+	}
+
+	provider, exists := cfg.Providers[parts[0]]
+	if !exists {
+		return nil, fmt.Errorf("unknown provider: %s", parts[0])
+	}
+
+	return &modelTarget{
+		providerName: parts[0],
+		modelName:    parts[1],
+		provider:     provider,
+		params:       paramsForRequest(ctx, cfg.Models[model]),
+	}, nil
+}
+
+// contentText flattens message content into plain text, ignoring non-text parts
+func contentText(content any) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []messaging.MessageContent:
+		var texts []string
+		for _, part := range c {
+			if part.Type == "text" && part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", c)
+	}
+}
+
+// decodeToolArguments parses the raw JSON arguments of a tool call into an object
+func decodeToolArguments(call messaging.ToolCall) map[string]any {
+	args := map[string]any{}
+	if strings.TrimSpace(call.Arguments) != "" {
+		if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+			log.Printf("Failed to decode tool call arguments for %s: %v", call.Name, err)
+		}
+	}
+	return args
+}
+
+// mergeExtraParams encodes a request body and merges the model's extra parameters into its top level
+func mergeExtraParams(body any, extra map[string]any) ([]byte, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request body: %w", err)
+	}
+	if len(extra) == 0 {
+		return encoded, nil
+	}
+
+	var merged map[string]any
+	if err := json.Unmarshal(encoded, &merged); err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+	for key, value := range extra {
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
+
+// postJSON sends a JSON POST request and returns the response when the status is 2xx.
+// Other statuses are turned into errors carrying the status code and the start of the body,
+// so the shared error classifiers can detect API key and overload problems.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer closeBody(resp)
+	errBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	return nil, fmt.Errorf("status code: %d, body: %s", resp.StatusCode, strings.TrimSpace(string(errBody)))
+}
+
+// openWithKeyRotation calls open with each available API key until one succeeds.
+// Keys rejected with authentication or quota errors are marked as bad. When the provider has
+// no keys configured (e.g. a local Ollama server), open is called once with an empty key.
+func openWithKeyRotation(ctx context.Context, keyManager interfaces.APIKeyManager, helpers Helpers, providerName string, availableKeys []string, open func(apiKey string) (*http.Response, error)) (*http.Response, error) {
+	if len(availableKeys) == 0 {
+		var resp *http.Response
+		err := helpers.RetryWith503Backoff(ctx, func() error {
+			var openErr error
+			resp, openErr = open("")
+			return openErr
+		})
+		return resp, err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < len(availableKeys); attempt++ {
+		apiKey, err := keyManager.GetNextAPIKey(ctx, providerName, availableKeys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get API key: %w", err)
+		}
+
+		var resp *http.Response
+		err = helpers.RetryWith503Backoff(ctx, func() error {
+			var openErr error
+			resp, openErr = open(apiKey)
+			return openErr
+		})
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+
+		if helpers.IsAPIKeyError(err) {
+			if markErr := keyManager.MarkKeyAsBad(ctx, providerName, apiKey, err.Error()); markErr != nil {
+				log.Printf("Failed to mark API key as bad: %v", markErr)
+			}
+			log.Printf("API key issue detected, trying next key: %v", err)
+			continue
+		}
+		if helpers.Is503Error(err) || helpers.IsInternalError(err) {
+			log.Printf("Transient error from provider %s, trying next key: %v", providerName, err)
+			continue
+		}
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("all API keys failed for provider: %s: %w", providerName, lastErr)
+}
+
+// closeBody closes a response body and logs any failure
+func closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		log.Printf("Failed to close response body: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"DiscordAIChatbot/internal/interfaces"
+)
+
+// fakeKeyManager hands out keys in order, skipping keys marked as bad
+type fakeKeyManager struct {
+	mu   sync.Mutex
+	next int
+	bad  map[string]string
+}
+
+func newFakeKeyManager() *fakeKeyManager {
+	return &fakeKeyManager{bad: make(map[string]string)}
+}
+
+func (m *fakeKeyManager) GetNextAPIKey(_ context.Context, _ string, availableKeys []string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for range availableKeys {
+		key := availableKeys[m.next%len(availableKeys)]
+		m.next++
+		if _, bad := m.bad[key]; !bad {
+			return key, nil
+		}
+	}
+	return "", errors.New("no good API keys left")
+}
+
+func (m *fakeKeyManager) MarkKeyAsBad(_ context.Context, _, apiKey, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bad[apiKey] = reason
+	return nil
+}
+
+func (m *fakeKeyManager) ResetBadKeys(context.Context, string) error { return nil }
+
+func (m *fakeKeyManager) GetBadKeyStats(context.Context) (map[string]int, error) { return nil, nil }
+
+func (m *fakeKeyManager) Close() error { return nil }
+
+// badKeys returns the keys marked as bad
+func (m *fakeKeyManager) badKeys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.bad {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+var _ interfaces.APIKeyManager = (*fakeKeyManager)(nil)
+
+// testHelpers classifies errors by status code like the LLM client does, retrying 503s once
+func testHelpers() Helpers {
+	is503 := func(err error) bool { return strings.Contains(err.Error(), "503") }
+	return Helpers{
+		IsAPIKeyError: func(err error) bool {
+			msg := strings.ToLower(err.Error())
+			return strings.Contains(msg, "401") || strings.Contains(msg, "api key")
+		},
+		Is503Error: is503,
+		RetryWith503Backoff: func(_ context.Context, fn func() error) error {
+			err := fn()
+			if err != nil && is503(err) {
+				err = fn()
+			}
+			return err
+		},
+		IsInternalError: func(err error) bool { return strings.Contains(err.Error(), "500") },
+	}
+}
+
+// collectStream reads a stream to the end, failing the test if it doesn't finish in time
+func collectStream(t *testing.T, stream <-chan StreamResponse) []StreamResponse {
+	t.Helper()
+	var chunks []StreamResponse
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case chunk, ok := <-stream:
+			if !ok {
+				return chunks
+			}
+			chunks = append(chunks, chunk)
+		case <-timeout:
+			t.Fatal("stream did not finish")
+		}
+	}
+}
+
+// streamText joins the content and reasoning of a stream and returns its final chunk
+func streamText(chunks []StreamResponse) (string, string, StreamResponse) {
+	var content, reasoning strings.Builder
+	var final StreamResponse
+	for _, chunk := range chunks {
+		content.WriteString(chunk.Content)
+		reasoning.WriteString(chunk.Reasoning)
+		if chunk.FinishReason != "" || chunk.Error != nil {
+			final = chunk
+		}
+	}
+	return content.String(), reasoning.String(), final
+}
+
+func TestOpenWithKeyRotation(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]error // Error returned for each key
+		wantKey   string
+		wantBad   int
+		wantErr   bool
+	}{
+		{"first key works", map[string]error{"a": nil, "b": nil}, "a", 0, false},
+		{"bad key is skipped", map[string]error{"a": errors.New("status code: 401"), "b": nil}, "b", 1, false},
+		{"overload moves to the next key", map[string]error{"a": errors.New("status code: 503"), "b": nil}, "b", 0, false},
+		{"other errors stop", map[string]error{"a": errors.New("status code: 400"), "b": nil}, "", 0, true},
+		{"all keys fail", map[string]error{"a": errors.New("status code: 401"), "b": errors.New("status code: 401")}, "", 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := newFakeKeyManager()
+			var used string
+			resp, err := openWithKeyRotation(context.Background(), keys, testHelpers().withDefaults(), "test", []string{"a", "b"}, func(apiKey string) (*http.Response, error) {
+				if err := tt.responses[apiKey]; err != nil {
+					return nil, err
+				}
+				used = apiKey
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (resp == nil || used != tt.wantKey) {
+				t.Errorf("opened with key %q, want %q", used, tt.wantKey)
+			}
+			if bad := keys.badKeys(); len(bad) != tt.wantBad {
+				t.Errorf("marked %v as bad, want %d keys", bad, tt.wantBad)
+			}
+		})
+	}
+}
+
+func TestOpenWithoutKeys(t *testing.T) {
+	calls := 0
+	_, err := openWithKeyRotation(context.Background(), newFakeKeyManager(), testHelpers().withDefaults(), "local", nil, func(apiKey string) (*http.Response, error) {
+		calls++
+		if apiKey != "" {
+			t.Errorf("got key %q for a provider without keys", apiKey)
+		}
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("got %d calls and error %v, want 1 call", calls, err)
+	}
+}
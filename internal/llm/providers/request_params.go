@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// Context key carrying extra request body fields for OpenAI-compatible requests
+type requestBodyOverridesKey struct{}
+
+// withRequestBodyOverrides returns a context that instructs the transport to merge the
+// given fields into the JSON request body
+func withRequestBodyOverrides(ctx context.Context, overrides map[string]any) context.Context {
+	if len(overrides) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, requestBodyOverridesKey{}, overrides)
+}
+
+// requestBodyOverridesFromContext returns the body overrides stored in the context, if any
+func requestBodyOverridesFromContext(ctx context.Context) map[string]any {
+	overrides, _ := ctx.Value(requestBodyOverridesKey{}).(map[string]any)
+	return overrides
+}
+
+// buildRequestBodyOverrides collects the model parameters that go-openai cannot express
+// (or would drop because of omitempty) so they can be merged into the request body
+func buildRequestBodyOverrides(params config.ModelParams) map[string]any {
+	overrides := make(map[string]any, len(params.ExtraParams)+3)
+
+	for key, value := range params.ExtraParams {
+		overrides[key] = value
+	}
+	if params.ReasoningEffort != "" {
+		overrides["reasoning_effort"] = params.ReasoningEffort
+	}
+	if len(params.SearchParameters) > 0 {
+		overrides["search_parameters"] = params.SearchParameters
+	}
+	// A zero temperature is dropped by the typed request because of omitempty
+	if params.Temperature != nil && *params.Temperature == 0 {
+		overrides["temperature"] = 0
+	}
+
+	if len(overrides) == 0 {
+		return nil
+	}
+	return overrides
+}
+
+// bodyOverrideTransport merges per-request overrides from the context into JSON request bodies,
+// and feeds streamed responses to the reasoning tap in the context
+type bodyOverrideTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *bodyOverrideTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if tap := reasoningTapFromContext(req.Context()); tap != nil && resp.Body != nil {
+		resp.Body = &tapReader{body: resp.Body, tap: tap}
+	}
+	return resp, nil
+}
+
+// roundTrip sends the request with the body overrides merged in
+func (t *bodyOverrideTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	overrides := requestBodyOverridesFromContext(req.Context())
+	if len(overrides) == 0 || req.Body == nil || !strings.Contains(req.Header.Get("Content-Type"), "application/json") {
+		return t.base.RoundTrip(req)
+	}
+
+	original, err := io.ReadAll(req.Body)
+	if closeErr := req.Body.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(original, &body); err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+	for key, value := range overrides {
+		body[key] = value
+	}
+
+	merged, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request body: %w", err)
+	}
+
+	// RoundTrippers must not modify the original request
+	clone := req.Clone(req.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(merged))
+	clone.ContentLength = int64(len(merged))
+	clone.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(merged)), nil
+	}
+
+	return t.base.RoundTrip(clone)
+}
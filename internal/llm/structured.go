@@ -0,0 +1,224 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/llm/providers"
+	"DiscordAIChatbot/internal/logging"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// maxStructuredAttempts is how many replies a structured completion asks for before giving up
+const maxStructuredAttempts = 3
+
+// ResponseSchema describes the JSON object a structured completion must return
+type ResponseSchema = providers.ResponseSchema
+
+// Validator is implemented by structured outputs that check their own contents
+// beyond what the schema expresses
+type Validator interface {
+	Validate() error
+}
+
+// GetStructuredCompletion asks model for a JSON object matching schema and decodes it into out.
+// Replies that aren't JSON, don't match the schema or fail out's Validate method are sent back
+// to the model with the problem, up to maxStructuredAttempts times. Provider errors are returned
+// as they are so callers can fall back to another model.
+func (c *LLMClient) GetStructuredCompletion(ctx context.Context, messages []messaging.OpenAIMessage, model string, schema *ResponseSchema, out any) error {
+	// Replies are appended below, so don't write into the caller's slice
+	messages = append([]messaging.OpenAIMessage(nil), messages...)
+
+	// Providers without native structured output only see the schema in the prompt
+	if provider, err := c.providerFor(model); err == nil && !providers.SupportsResponseSchema(provider.Name()) {
+		messages = appendSchemaInstruction(messages, schema)
+	}
+	ctx = providers.WithResponseSchema(ctx, schema)
+
+	var lastErr error
+	for attempt := 1; attempt <= maxStructuredAttempts; attempt++ {
+		reply, err := c.GetChatCompletion(ctx, messages, model, nil)
+		if err != nil {
+			return err
+		}
+
+		lastErr = decodeStructured(reply, schema.Schema, out)
+		if lastErr == nil {
+			return nil
+		}
+
+		logging.LogToFile("Structured reply %q from %s was invalid (attempt %d/%d): %v", schema.Name, model, attempt, maxStructuredAttempts, lastErr)
+		messages = append(messages,
+			messaging.OpenAIMessage{Role: "assistant", Content: reply},
+			messaging.OpenAIMessage{
+				Role:    "user",
+				Content: fmt.Sprintf("Your reply was invalid: %v. Reply again with only a JSON object that matches the schema.", lastErr),
+			},
+		)
+	}
+
+	return &StructuredOutputError{Name: schema.Name, Model: model, Err: lastErr}
+}
+
+// GetStructuredCompletionWithFallback gets a structured completion with an enforced Gemini 2.5 Flash fallback.
+func (c *LLMClient) GetStructuredCompletionWithFallback(ctx context.Context, messages []messaging.OpenAIMessage, model string, fallbackModel string, schema *ResponseSchema, out any) (*FallbackResult, error) {
+	fallbackResult := &FallbackResult{}
+	fallbackModel = c.resolveFallbackModel(fallbackModel)
+
+	err := c.GetStructuredCompletion(ctx, messages, model, schema, out)
+	if err == nil || !c.ShouldFallback(err) || fallbackModel == "" || fallbackModel == model {
+		return fallbackResult, err
+	}
+
+	logging.LogToFile("Structured completion with %s failed, attempting fallback to %s: %v", model, fallbackModel, err)
+	fallbackResult.OriginalError = err
+	fallbackResult.FallbackModel = fallbackModel
+
+	if fallbackErr := c.GetStructuredCompletion(ctx, messages, fallbackModel, schema, out); fallbackErr != nil {
+		return fallbackResult, fmt.Errorf("both original model (%s) and fallback model (%s) failed. Original error: %w, Fallback error: %v", model, fallbackModel, err, fallbackErr)
+	}
+
+	fallbackResult.UsedFallback = true
+	return fallbackResult, nil
+}
+
+// StructuredOutputError is returned when a model keeps replying with invalid structured output
+type StructuredOutputError struct {
+	Name  string
+	Model string
+	Err   error
+}
+
+// Error implements error
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("model %s returned invalid %s output after %d attempts: %v", e.Model, e.Name, maxStructuredAttempts, e.Err)
+}
+
+// Unwrap returns the last validation error
+func (e *StructuredOutputError) Unwrap() error {
+	return e.Err
+}
+
+// appendSchemaInstruction adds the schema to the prompt as a final user message
+func appendSchemaInstruction(messages []messaging.OpenAIMessage, schema *ResponseSchema) []messaging.OpenAIMessage {
+	encoded, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return messages
+	}
+
+	instruction := "Reply with only a JSON object, without code fences, that matches this JSON schema:\n" + string(encoded)
+	return append(messages, messaging.OpenAIMessage{Role: "user", Content: instruction})
+}
+
+// decodeStructured checks a reply against the schema, then decodes it into out and runs its Validate method
+func decodeStructured(reply string, schema map[string]any, out any) error {
+	data := []byte(jsonObjectText(reply))
+
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("not valid JSON: %w", err)
+	}
+	if err := validateSchema(value, schema, "$"); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode: %w", err)
+	}
+	if validator, ok := out.(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// jsonObjectText returns the JSON object in a reply. Providers without native structured
+// output sometimes wrap it in code fences or a sentence.
+func jsonObjectText(reply string) string {
+	reply = strings.TrimSpace(reply)
+	if strings.HasPrefix(reply, "{") && strings.HasSuffix(reply, "}") {
+		return reply
+	}
+
+	start := strings.Index(reply, "{")
+	end := strings.LastIndex(reply, "}")
+	if start == -1 || end < start {
+		return reply
+	}
+	return reply[start : end+1]
+}
+
+// validateSchema checks a decoded JSON value against the subset of JSON schema the
+// providers support: type, properties, required, additionalProperties, items and enum
+func validateSchema(value any, schema map[string]any, path string) error {
+	if schema == nil {
+		return nil
+	}
+
+	schemaType, _ := schema["type"].(string)
+	switch schemaType {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for _, name := range providers.SchemaStrings(schema["required"]) {
+			if _, exists := object[name]; !exists {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		for name, field := range object {
+			propertySchema, known := properties[name].(map[string]any)
+			if !known {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					return fmt.Errorf("%s.%s is not allowed", path, name)
+				}
+				continue
+			}
+			if err := validateSchema(field, propertySchema, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+		itemSchema, _ := schema["items"].(map[string]any)
+		for i, item := range items {
+			if err := validateSchema(item, itemSchema, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s must be a number", path)
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+	}
+
+	if allowed := providers.SchemaStrings(schema["enum"]); len(allowed) > 0 {
+		text, _ := value.(string)
+		for _, option := range allowed {
+			if text == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of %s", path, strings.Join(allowed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// fakeProvider replies with the given texts in order and records the messages of each request
+type fakeProvider struct {
+	name     string
+	replies  []string
+	requests [][]messaging.OpenAIMessage
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) StreamChat(ctx context.Context, req interfaces.ChatRequest) (<-chan interfaces.StreamResponse, error) {
+	p.requests = append(p.requests, req.Messages)
+	reply := p.replies[0]
+	if len(p.replies) > 1 {
+		p.replies = p.replies[1:]
+	}
+
+	stream := make(chan interfaces.StreamResponse, 1)
+	stream <- interfaces.StreamResponse{Content: reply, FinishReason: "stop"}
+	close(stream)
+	return stream, nil
+}
+
+// newFakeClient returns a client whose "test" provider is served by provider
+func newFakeClient(provider *fakeProvider) *LLMClient {
+	cfg := &config.Config{Providers: map[string]config.Provider{
+		"test": {Type: provider.name},
+	}}
+	return &LLMClient{config: cfg, providers: map[string]interfaces.LLMProvider{provider.name: provider}}
+}
+
+var verdictSchema = &ResponseSchema{
+	Name: "verdict",
+	Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"answer":     map[string]any{"type": "string", "enum": []string{"yes", "no"}},
+			"confidence": map[string]any{"type": "integer"},
+		},
+		"required":             []string{"answer", "confidence"},
+		"additionalProperties": false,
+	},
+}
+
+type verdict struct {
+	Answer     string `json:"answer"`
+	Confidence int    `json:"confidence"`
+}
+
+func TestStructuredCompletionRejectsInvalidReplies(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  string
+	}{
+		{"not json", "yes, probably", "not valid JSON"},
+		{"missing required", `{"answer": "yes"}`, "$.confidence is required"},
+		{"extra property", `{"answer": "yes", "confidence": 3, "reason": "because"}`, "$.reason is not allowed"},
+		{"wrong type", `{"answer": "yes", "confidence": "high"}`, "$.confidence must be an integer"},
+		{"not in enum", `{"answer": "maybe", "confidence": 3}`, "$.answer must be one of"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{name: config.ProviderTypeOpenAI, replies: []string{tt.reply}}
+			var out verdict
+			err := newFakeClient(provider).GetStructuredCompletion(context.Background(), nil, "test/model", verdictSchema, &out)
+
+			var structuredErr *StructuredOutputError
+			if !errors.As(err, &structuredErr) {
+				t.Fatalf("got %v, want a StructuredOutputError", err)
+			}
+			if !strings.Contains(structuredErr.Err.Error(), tt.want) {
+				t.Errorf("got %q, want it to mention %q", structuredErr.Err, tt.want)
+			}
+			if len(provider.requests) != maxStructuredAttempts {
+				t.Errorf("asked %d times, want %d", len(provider.requests), maxStructuredAttempts)
+			}
+		})
+	}
+}
+
+func TestStructuredCompletionReasksWithTheProblem(t *testing.T) {
+	provider := &fakeProvider{name: config.ProviderTypeOpenAI, replies: []string{
+		`{"answer": "maybe", "confidence": 3}`,
+		"```json\n{\"answer\": \"no\", \"confidence\": 7}\n```",
+	}}
+	prompt := []messaging.OpenAIMessage{{Role: "user", Content: "Is it raining?"}}
+
+	var out verdict
+	if err := newFakeClient(provider).GetStructuredCompletion(context.Background(), prompt, "test/model", verdictSchema, &out); err != nil {
+		t.Fatalf("GetStructuredCompletion: %v", err)
+	}
+	if out != (verdict{Answer: "no", Confidence: 7}) {
+		t.Errorf("decoded %+v", out)
+	}
+	if len(prompt) != 1 {
+		t.Errorf("the caller's messages were changed: %v", prompt)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("asked %d times, want 2", len(provider.requests))
+	}
+	reask := provider.requests[1]
+	if len(reask) != 3 || reask[1].Role != "assistant" {
+		t.Fatalf("re-ask does not carry the invalid reply: %+v", reask)
+	}
+	if content, _ := reask[2].Content.(string); !strings.HasPrefix(content, "Your reply was invalid: $.answer must be one of") {
+		t.Errorf("re-ask does not explain the problem: %q", content)
+	}
+}
+
+func TestStructuredCompletionPromptsProvidersWithoutSchemas(t *testing.T) {
+	provider := &fakeProvider{name: config.ProviderTypeAnthropic, replies: []string{`{"answer": "yes", "confidence": 1}`}}
+	var out verdict
+	if err := newFakeClient(provider).GetStructuredCompletion(context.Background(), nil, "test/model", verdictSchema, &out); err != nil {
+		t.Fatalf("GetStructuredCompletion: %v", err)
+	}
+
+	messages := provider.requests[0]
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want the schema instruction alone", len(messages))
+	}
+	if content, _ := messages[0].Content.(string); !strings.Contains(content, `"additionalProperties":false`) {
+		t.Errorf("schema is missing from the prompt: %q", content)
+	}
+}
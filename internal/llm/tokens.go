@@ -0,0 +1,43 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"DiscordAIChatbot/internal/logging"
+	"DiscordAIChatbot/internal/utils"
+)
+
+// maxCalibrationChars caps how much text is sent to a provider to be counted
+const maxCalibrationChars = 20000
+
+// CalibrateTokenizer compares the local token estimate for text with the provider's own count
+// and records the ratio for the model. Only Gemini can count tokens without a completion, so
+// other providers are calibrated from reported usage instead.
+func (c *LLMClient) CalibrateTokenizer(ctx context.Context, model string, tokenizer utils.Tokenizer, text string) error {
+	if !c.IsGeminiModel(model) {
+		return nil
+	}
+
+	// Cut at the end so the sample stays recent, and at a rune boundary
+	if len(text) > maxCalibrationChars {
+		runes := []rune(text)
+		if len(runes) > maxCalibrationChars {
+			text = string(runes[len(runes)-maxCalibrationChars:])
+		}
+	}
+
+	estimated := tokenizer.CountRawText(text)
+	if estimated == 0 {
+		return nil
+	}
+
+	reported, err := c.geminiProvider.CountTokens(ctx, model, text, c.isAPIKeyError)
+	if err != nil {
+		return fmt.Errorf("failed to count tokens for %s: %w", model, err)
+	}
+
+	utils.CalibrateTokenizer(model, estimated, reported)
+	logging.LogToFile("Calibrated %s tokenizer for %s: estimated %d, reported %d", tokenizer.Family(), model, estimated, reported)
+	return nil
+}
@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/interfaces"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// Tool is a function that the model may call while generating a response
+type Tool interface {
+	// Name returns the unique function name exposed to the model
+	Name() string
+	// Description explains to the model when and how to use the tool
+	Description() string
+	// Parameters returns the JSON schema describing the tool arguments
+	Parameters() map[string]any
+	// Execute runs the tool with the raw JSON arguments produced by the model
+	Execute(ctx context.Context, arguments string) (string, error)
+}
+
+// FuncTool adapts a plain function into a Tool
+type FuncTool struct {
+	ToolName        string
+	ToolDescription string
+	Schema          map[string]any
+	Fn              func(ctx context.Context, arguments string) (string, error)
+}
+
+// Name returns the tool name
+func (t *FuncTool) Name() string { return t.ToolName }
+
+// Description returns the tool description
+func (t *FuncTool) Description() string { return t.ToolDescription }
+
+// Parameters returns the tool parameter schema
+func (t *FuncTool) Parameters() map[string]any {
+	if t.Schema == nil {
+		return map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	return t.Schema
+}
+
+// Execute invokes the wrapped function
+func (t *FuncTool) Execute(ctx context.Context, arguments string) (string, error) {
+	return t.Fn(ctx, arguments)
+}
+
+// ToolRegistry holds the set of tools offered to the model for a request
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+	order []string
+}
+
+// NewToolRegistry creates an empty tool registry
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		tools: make(map[string]Tool),
+	}
+}
+
+// Register adds a tool to the registry. Tool names must be unique.
+func (r *ToolRegistry) Register(tool Tool) error {
+	name := strings.TrimSpace(tool.Name())
+	if name == "" {
+		return fmt.Errorf("tool name cannot be empty")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tools[name]; exists {
+		return fmt.Errorf("tool %s is already registered", name)
+	}
+	r.tools[name] = tool
+	r.order = append(r.order, name)
+	return nil
+}
+
+// Get returns the tool registered under the given name
+func (r *ToolRegistry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+// Tools returns the registered tools in registration order
+func (r *ToolRegistry) Tools() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tools := make([]Tool, 0, len(r.order))
+	for _, name := range r.order {
+		tools = append(tools, r.tools[name])
+	}
+	return tools
+}
+
+// Len returns the number of registered tools
+func (r *ToolRegistry) Len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.order)
+}
+
+// Definitions returns the provider-neutral definitions of the registered tools
+func (r *ToolRegistry) Definitions() []interfaces.ToolDefinition {
+	if r.Len() == 0 {
+		return nil
+	}
+
+	var defs []interfaces.ToolDefinition
+	for _, tool := range r.Tools() {
+		defs = append(defs, interfaces.ToolDefinition{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			Parameters:  tool.Parameters(),
+		})
+	}
+	return defs
+}
+
+// Execute runs a single tool call and returns the tool result message to send back to the model.
+// Errors are reported to the model as the tool output so it can recover or answer without the tool.
+func (r *ToolRegistry) Execute(ctx context.Context, call messaging.ToolCall) messaging.OpenAIMessage {
+	result := messaging.OpenAIMessage{
+		Role:       "tool",
+		Name:       call.Name,
+		ToolCallID: call.ID,
+	}
+
+	tool, ok := r.Get(call.Name)
+	if !ok {
+		result.Content = fmt.Sprintf("error: unknown tool %q", call.Name)
+		return result
+	}
+
+	arguments := strings.TrimSpace(call.Arguments)
+	if arguments == "" {
+		arguments = "{}"
+	}
+	if !json.Valid([]byte(arguments)) {
+		result.Content = fmt.Sprintf("error: arguments for %s are not valid JSON", call.Name)
+		return result
+	}
+
+	output, err := tool.Execute(ctx, arguments)
+	if err != nil {
+		result.Content = fmt.Sprintf("error: %v", err)
+		return result
+	}
+	if strings.TrimSpace(output) == "" {
+		output = "(no output)"
+	}
+	result.Content = output
+	return result
+}
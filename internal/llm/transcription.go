@@ -0,0 +1,103 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/llm/providers"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// audioExtensions maps audio MIME types to the file extensions whisper servers detect formats by
+var audioExtensions = map[string]string{
+	"audio/ogg":   ".ogg",
+	"audio/opus":  ".ogg",
+	"audio/mpeg":  ".mp3",
+	"audio/mp3":   ".mp3",
+	"audio/wav":   ".wav",
+	"audio/x-wav": ".wav",
+	"audio/wave":  ".wav",
+	"audio/webm":  ".webm",
+	"audio/mp4":   ".m4a",
+	"audio/x-m4a": ".m4a",
+	"audio/aac":   ".aac",
+	"audio/flac":  ".flac",
+}
+
+// Transcribe turns audio into text with the configured transcription backend
+func (c *LLMClient) Transcribe(ctx context.Context, cfg *config.Config, audio *messaging.AudioContent) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.TranscriptionTimeout*time.Minute)
+	defer cancel()
+
+	switch cfg.Transcription.Backend {
+	case config.TranscriptionBackendWhisper:
+		return c.transcribeWithWhisper(ctx, cfg, audio)
+	case config.TranscriptionBackendGemini:
+		return c.transcribeWithGemini(ctx, cfg, audio)
+	}
+	return "", fmt.Errorf("transcription is disabled")
+}
+
+// transcribeWithWhisper sends audio to an OpenAI-compatible /audio/transcriptions endpoint
+func (c *LLMClient) transcribeWithWhisper(ctx context.Context, cfg *config.Config, audio *messaging.AudioContent) (string, error) {
+	clientConfig := openai.DefaultConfig(cfg.Transcription.APIKey)
+	clientConfig.BaseURL = strings.TrimSuffix(cfg.Transcription.BaseURL, "/")
+	// Long recordings can outlive the shared client's timeout, so rely on the context instead
+	clientConfig.HTTPClient = &http.Client{Transport: c.httpClient.Transport}
+	client := openai.NewClientWithConfig(clientConfig)
+
+	resp, err := client.CreateTranscription(ctx, openai.AudioRequest{
+		Model:    cfg.Transcription.Model,
+		FilePath: audioFilename(audio),
+		Reader:   bytes.NewReader(audio.Data),
+		Language: cfg.Transcription.Language,
+		Format:   openai.AudioResponseFormatJSON,
+	})
+	if err != nil {
+		return "", fmt.Errorf("whisper transcription failed: %w", err)
+	}
+	return strings.TrimSpace(resp.Text), nil
+}
+
+// transcribeWithGemini asks a Gemini model for a verbatim transcript
+func (c *LLMClient) transcribeWithGemini(ctx context.Context, cfg *config.Config, audio *messaging.AudioContent) (string, error) {
+	prompt := "Transcribe this audio verbatim. Reply with the transcript only, without commentary."
+	if cfg.Transcription.Language != "" {
+		prompt += fmt.Sprintf(" The audio is probably in the language with ISO-639-1 code %q.", cfg.Transcription.Language)
+	}
+	messages := []messaging.OpenAIMessage{{
+		Role: "user",
+		Content: []messaging.MessageContent{
+			{Type: "text", Text: prompt},
+			{Type: "audio_file", AudioFile: audio},
+		},
+	}}
+
+	transcript, err := c.GetChatCompletion(providers.DisableGeminiGroundingInContext(ctx), messages, cfg.Transcription.Model, nil)
+	if err != nil {
+		return "", fmt.Errorf("gemini transcription failed: %w", err)
+	}
+	return transcript, nil
+}
+
+// audioFilename names an upload after the attachment, so the server can tell its format
+func audioFilename(audio *messaging.AudioContent) string {
+	if parsed, err := url.Parse(audio.URL); err == nil && path.Ext(parsed.Path) != "" {
+		return path.Base(parsed.Path)
+	}
+	mimeType := strings.ToLower(strings.TrimSpace(strings.Split(audio.MIMEType, ";")[0]))
+	if ext, ok := audioExtensions[mimeType]; ok {
+		return "audio" + ext
+	}
+	// Discord voice messages are Ogg Opus
+	return "audio.ogg"
+}
@@ -1,6 +1,7 @@
 package messaging
 
 import (
+	"strings"
 	"sync"
 
 	"github.com/bwmarrin/discordgo"
@@ -27,11 +28,30 @@ type MsgNode struct {
 	GroundingMetadata  *GroundingMetadata `json:"grounding_metadata,omitempty"`
 	DetectedURLs       []string           `json:"detected_urls,omitempty"`
 
+	// Regenerated alternatives of a response. Text always holds the selected variant
+	// so follow-up replies build on it.
+	Variants        []ResponseVariant `json:"variants,omitempty"`
+	SelectedVariant int               `json:"selected_variant,omitempty"`
+
 	ParentMsg *discordgo.Message `json:"-"`
+	// Parent linkage restored from the persistent cache, used to refetch ParentMsg
+	ParentMessageID string `json:"parent_message_id,omitempty"`
+	ParentChannelID string `json:"parent_channel_id,omitempty"`
+
+	// Imported nodes come from an uploaded transcript, not from the Discord message they are stored under
+	Imported bool `json:"imported,omitempty"`
 
 	mu sync.RWMutex
 }
 
+// ImportedMessagePrefix starts the IDs of imported messages that have no Discord message at all
+const ImportedMessagePrefix = "import-"
+
+// IsImportedMessageID reports whether a message ID belongs to an imported message that exists only as a node
+func IsImportedMessageID(id string) bool {
+	return strings.HasPrefix(id, ImportedMessagePrefix)
+}
+
 // ImageContent represents an image attachment
 type ImageContent struct {
 	Type     string   `json:"type"`
@@ -66,6 +86,13 @@ type PDFContent struct {
 	Data     []byte `json:"data,omitempty"`
 }
 
+// ResponseVariant is one generated alternative of a bot response
+type ResponseVariant struct {
+	Text    string `json:"text"`
+	Model   string `json:"model"`
+	Persona string `json:"persona,omitempty"`
+}
+
 // ProcessedNode is a container for a message ID and its corresponding MsgNode, used for batch saving.
 type ProcessedNode struct {
 	MessageID string
@@ -84,9 +111,20 @@ type MessageContent struct {
 
 // OpenAIMessage represents a message in OpenAI format
 type OpenAIMessage struct {
-	Role    string `json:"role"`
-	Content any    `json:"content"`
-	Name    string `json:"name,omitempty"`
+	Role       string     `json:"role"`
+	Content    any        `json:"content"`
+	Name       string     `json:"name,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall represents a request from the model to invoke a registered tool.
+// Arguments holds the raw JSON object produced by the model.
+type ToolCall struct {
+	ID               string `json:"id,omitempty"`
+	Name             string `json:"name"`
+	Arguments        string `json:"arguments"`
+	ThoughtSignature []byte `json:"thought_signature,omitempty"`
 }
 
 // GroundingMetadata stores the metadata for grounding with Google Search
@@ -255,6 +293,45 @@ func (m *MsgNode) SetDetectedURLs(urls []string) {
 	m.DetectedURLs = urls
 }
 
+// GetVariants safely returns a copy of the response variants and the selected index
+func (m *MsgNode) GetVariants() ([]ResponseVariant, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	variants := make([]ResponseVariant, len(m.Variants))
+	copy(variants, m.Variants)
+	return variants, m.SelectedVariant
+}
+
+// SetVariants safely replaces the response variants and selection without touching the text
+func (m *MsgNode) SetVariants(variants []ResponseVariant, selected int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Variants = variants
+	m.SelectedVariant = selected
+}
+
+// AddVariant safely appends a variant, selects it and returns its index
+func (m *MsgNode) AddVariant(variant ResponseVariant) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Variants = append(m.Variants, variant)
+	m.SelectedVariant = len(m.Variants) - 1
+	m.Text = variant.Text
+	return m.SelectedVariant
+}
+
+// SelectVariant safely selects a variant and makes its text the node text
+func (m *MsgNode) SelectVariant(index int) (ResponseVariant, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if index < 0 || index >= len(m.Variants) {
+		return ResponseVariant{}, false
+	}
+	m.SelectedVariant = index
+	m.Text = m.Variants[index].Text
+	return m.Variants[index], true
+}
+
 // MsgNodeManager manages message nodes with caching
 type MsgNodeManager struct {
 	cache *lru.Cache[string, *MsgNode] // Use the LRU cache
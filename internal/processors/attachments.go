@@ -18,14 +18,8 @@ import (
 	"DiscordAIChatbot/internal/messaging"
 )
 
-// ProcessAttachments processes Discord message attachments and returns images, audio, and text content
-// IsGeminiModelChecker defines an interface for checking if a model is a Gemini model.
-// This is used to avoid a direct dependency on the LLM client in the processor.
-type IsGeminiModelChecker interface {
-	IsGeminiModel(model string) bool
-}
-
-func ProcessAttachments(ctx context.Context, attachments []*discordgo.MessageAttachment, fileProcessor *FileProcessor, llmClient IsGeminiModelChecker, model string) ([]messaging.ImageContent, []messaging.AudioContent, []messaging.PDFContent, string, bool, bool, error) {
+// ProcessAttachments processes Discord message attachments and returns images, audio, PDFs and text content
+func ProcessAttachments(ctx context.Context, attachments []*discordgo.MessageAttachment, fileProcessor *FileProcessor) ([]messaging.ImageContent, []messaging.AudioContent, []messaging.PDFContent, string, bool, bool, error) {
 	log.Println("Starting attachment processing...")
 	// Launch one goroutine per attachment without an artificial semaphore limit.
 
@@ -72,8 +66,9 @@ func ProcessAttachments(ctx context.Context, attachments []*discordgo.MessageAtt
 			isPDFByExt := strings.EqualFold(filepath.Ext(attachment.Filename), ".pdf")
 			isPDF := isPDFByCT || isPDFByExt
 			isTextByExt := fileProcessor.isTextFileByExtension(attachment.Filename)
+			isDocument := fileProcessor.IsDocument(attachment.ContentType, attachment.Filename)
 
-			if !isImage && !isAudio && !isText && !isPDF && !isTextByExt {
+			if !isImage && !isAudio && !isText && !isPDF && !isTextByExt && !isDocument {
 				log.Printf("Attachment %d (%s) is an unsupported type.", index, attachment.Filename)
 				resultsChan <- indexedResult{idx: index, isBad: true}
 				return
@@ -134,11 +129,11 @@ func ProcessAttachments(ctx context.Context, attachments []*discordgo.MessageAtt
 				return
 			} else if isPDF {
 				log.Printf("Processing attachment %d as PDF...", index)
-				// PDF attachment -> store raw data. Text is extracted only for non-Gemini models.
-				isGemini := llmClient.IsGeminiModel(model)
-
+				// PDF attachment -> store raw data. Models that can't read PDFs get the extracted
+				// text instead when the request is sent, see llm.AdaptModalities.
 				result := indexedResult{
-					idx: index,
+					idx:               index,
+					shouldProcessURLs: fileProcessor.shouldProcessURLs(attachment.ContentType, attachment.Filename),
 					pdf: messaging.PDFContent{
 						Type: "pdf_file",
 						MIMEType: func() string {
@@ -153,32 +148,13 @@ func ProcessAttachments(ctx context.Context, attachments []*discordgo.MessageAtt
 					},
 				}
 
-				if !isGemini {
-					extractedText, shouldProcessURLs, err := fileProcessor.ProcessFile(data, result.pdf.MIMEType, attachment.Filename)
-					var fileTypeInfo string = fmt.Sprintf("**📄 PDF Document: %s**\n", attachment.Filename)
-
-					if err != nil {
-						log.Printf("Failed to extract text from PDF %d: %v", index, err)
-						result.text = fmt.Sprintf("%s\n> ⚠️ **Error:** Could not extract text from this PDF.", fileTypeInfo)
-					} else if strings.TrimSpace(extractedText) != "" {
-						log.Printf("Extracted %d chars from PDF %d.", len(extractedText), index)
-						result.text = fileTypeInfo + extractedText
-						result.shouldProcessURLs = shouldProcessURLs
-					} else {
-						log.Printf("PDF %d is empty or has no text.", index)
-						result.text = fmt.Sprintf("%s\n> 📄 This PDF appears to be empty or contains no text.", fileTypeInfo)
-					}
-				} else {
-					log.Printf("Skipping PDF text extraction for Gemini model.")
-				}
-
 				resultsChan <- result
 				log.Printf("Finished processing PDF attachment %d.", index)
 				return
 			}
 
 			log.Printf("Processing attachment %d as text...", index)
-			// Text attachment -> process via FileProcessor
+			// Text, office document, notebook or archive attachment -> process via FileProcessor
 			extractedText, shouldProcessURLs, err := fileProcessor.ProcessFile(data, attachment.ContentType, attachment.Filename)
 			if err != nil {
 				log.Printf("Error processing text attachment %d: %v", index, err)
@@ -188,6 +164,8 @@ func ProcessAttachments(ctx context.Context, attachments []*discordgo.MessageAtt
 
 			var fileTypeInfo string
 			switch {
+			case isDocument:
+				fileTypeInfo = fmt.Sprintf("**%s: %s**\n", fileProcessor.DocumentLabel(attachment.ContentType, attachment.Filename), attachment.Filename)
 			case isText:
 				fileTypeInfo = fmt.Sprintf("**📝 Text File: %s**\n", attachment.Filename)
 			case isTextByExt:
@@ -31,13 +31,15 @@ type ChannelResult struct {
 
 // FetchChannelMessages fetches messages from a Discord channel, respecting token limits
 // It fetches from newest to oldest, excluding bot messages, and ensures the total
-// (user query + channel messages) fits within the specified threshold of the provided token limit
-func (cp *ChannelProcessor) FetchChannelMessages(ctx context.Context, session *discordgo.Session, channelID string, userQuery string, botUserID string, modelTokenLimit int, tokenThreshold float64, cfg *config.Config) (*ChannelResult, error) {
+// (user query + channel messages) fits within the specified threshold of the provided token limit,
+// counted with the model's tokenizer
+func (cp *ChannelProcessor) FetchChannelMessages(ctx context.Context, session *discordgo.Session, channelID string, userQuery string, botUserID string, modelName string, modelTokenLimit int, tokenThreshold float64, cfg *config.Config) (*ChannelResult, error) {
 	// Calculate threshold percentage of the model's token limit
 	maxTokens := int(float64(modelTokenLimit) * tokenThreshold)
+	tokens := utils.TokenizerFor(modelName, cfg.GetModelTokenizer(modelName))
 
 	// Estimate tokens for user query
-	userQueryTokens := utils.EstimateTokenCountFromText(userQuery)
+	userQueryTokens := tokens.CountText(userQuery)
 	if userQueryTokens >= maxTokens {
 		return nil, fmt.Errorf("user query is too long (%d tokens), exceeds %.0f%% of token limit (%d tokens)", userQueryTokens, tokenThreshold*100, maxTokens)
 	}
@@ -89,7 +91,7 @@ func (cp *ChannelProcessor) FetchChannelMessages(ctx context.Context, session *d
 			openAIMsg := cp.convertToOpenAIMessage(msg)
 
 			// Estimate tokens for this message
-			msgTokens := utils.EstimateTokenCount([]messaging.OpenAIMessage{openAIMsg})
+			msgTokens := tokens.CountMessages([]messaging.OpenAIMessage{openAIMsg})
 
 			// Check if adding this message would exceed our token limit
 			if totalTokens+msgTokens > availableTokens {
@@ -202,6 +202,33 @@ func (cp *ChartProcessor) ProcessResponse(ctx context.Context, response string)
 	return chartImages, nil
 }
 
+// RenderChart executes a single Python plotting snippet and returns the rendered image
+func (cp *ChartProcessor) RenderChart(ctx context.Context, code string) (*ChartImage, error) {
+	if !cp.initialized {
+		if err := cp.initializeVenv(); err != nil {
+			return nil, fmt.Errorf("failed to initialize chart processor: %w", err)
+		}
+		cp.initialized = true
+	}
+
+	if strings.TrimSpace(code) == "" {
+		return nil, fmt.Errorf("chart code is empty")
+	}
+
+	cp.updateLibraryUsage(code)
+
+	filename := fmt.Sprintf("chart_%d.png", time.Now().UnixNano())
+	imageData, err := cp.executeChartCode(ctx, code, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChartImage{
+		Data:     imageData,
+		Filename: filename,
+	}, nil
+}
+
 // detectChartCode detects Python code blocks that generate charts
 func (cp *ChartProcessor) detectChartCode(response string) []string {
 	// Regex to match Python code blocks
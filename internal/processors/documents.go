@@ -0,0 +1,264 @@
+package processors
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// documentLabels names the document formats the FileProcessor extracts, keyed by extension
+var documentLabels = map[string]string{
+	".docx":  "📄 Word Document",
+	".xlsx":  "📊 Spreadsheet",
+	".pptx":  "📽️ Presentation",
+	".odt":   "📄 OpenDocument Text",
+	".epub":  "📘 E-book",
+	".ipynb": "📓 Notebook",
+	".zip":   "🗜️ Archive",
+}
+
+// documentContentTypes maps content types to document formats, for files without a known extension
+var documentContentTypes = map[string]string{
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         ".xlsx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+	"application/vnd.oasis.opendocument.text":                                   ".odt",
+	"application/epub+zip":         ".epub",
+	"application/x-ipynb+json":     ".ipynb",
+	"application/zip":              ".zip",
+	"application/x-zip-compressed": ".zip",
+}
+
+// documentFormat returns the document format of a file as its extension, or "" when it isn't a document
+func documentFormat(contentType, filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if _, ok := documentLabels[ext]; ok {
+		return ext
+	}
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return documentContentTypes[mediaType]
+}
+
+// IsDocument reports whether a file is an office document, e-book, notebook or archive the processor can read
+func (fp *FileProcessor) IsDocument(contentType, filename string) bool {
+	return documentFormat(contentType, filename) != ""
+}
+
+// DocumentLabel returns the label shown above a document's text, e.g. "📊 Spreadsheet"
+func (fp *FileProcessor) DocumentLabel(contentType, filename string) string {
+	if label, ok := documentLabels[documentFormat(contentType, filename)]; ok {
+		return label
+	}
+	return "📄 File"
+}
+
+// processDocument extracts the text of a document with a timeout
+func (fp *FileProcessor) processDocument(format string, data []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.DocumentExtractionTimeout*time.Second)
+	defer cancel()
+
+	type result struct {
+		text string
+		err  error
+	}
+
+	resultChan := make(chan result, 1)
+
+	// The budget stops the extraction at its next read once the timeout passes
+	budget := newExtractionBudget(ctx)
+	go func() {
+		text, err := fp.extractDocument(format, data, budget)
+		resultChan <- result{text: text, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("%s text extraction timed out after %d seconds", strings.TrimPrefix(format, "."), config.DocumentExtractionTimeout)
+	case res := <-resultChan:
+		return res.text, res.err
+	}
+}
+
+// extractDocument extracts the text of a document in one of the documentLabels formats,
+// reading its parts within the budget
+func (fp *FileProcessor) extractDocument(format string, data []byte, budget *extractionBudget) (string, error) {
+	switch format {
+	case ".docx":
+		return extractDOCX(data, budget)
+	case ".xlsx":
+		return extractXLSX(data, budget)
+	case ".pptx":
+		return extractPPTX(data, budget)
+	case ".odt":
+		return extractODT(data, budget)
+	case ".epub":
+		return extractEPUB(data, budget)
+	case ".ipynb":
+		return extractNotebook(data)
+	case ".zip":
+		return fp.extractArchive(data, budget)
+	}
+	return "", fmt.Errorf("unsupported document format: %s", format)
+}
+
+// errExtractionLimit is returned once an extraction has read as much as its budget allows
+var errExtractionLimit = errors.New("extraction size limit reached")
+
+// extractionBudget limits the archive members and uncompressed bytes one extraction reads from
+// zip containers, across documents nested in archives, and stops reading once its context is done
+type extractionBudget struct {
+	ctx       context.Context
+	filesLeft int   // Archive members that may still be extracted
+	bytesLeft int64 // Uncompressed bytes that may still be read
+}
+
+// newExtractionBudget creates a budget with the archive limits
+func newExtractionBudget(ctx context.Context) *extractionBudget {
+	return &extractionBudget{
+		ctx:       ctx,
+		filesLeft: config.MaxArchiveFiles,
+		bytesLeft: config.MaxArchiveTotalSize,
+	}
+}
+
+// fits reports whether a file of the given uncompressed size may still be read
+func (b *extractionBudget) fits(size uint64) bool {
+	return b.bytesLeft > 0 && size <= math.MaxInt64 && int64(size) <= b.bytesLeft
+}
+
+// readFile reads a file from a zip container and charges it to the budget
+func (b *extractionBudget) readFile(file *zip.File) ([]byte, error) {
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !b.fits(file.UncompressedSize64) {
+		return nil, fmt.Errorf("%s: %w", file.Name, errExtractionLimit)
+	}
+	data, err := readZipFile(file)
+	if err != nil {
+		return nil, err
+	}
+	// The size in the header can lie, so what was read is charged
+	b.bytesLeft -= int64(len(data))
+	if b.bytesLeft < 0 {
+		return nil, fmt.Errorf("%s: %w", file.Name, errExtractionLimit)
+	}
+	return data, nil
+}
+
+// readPath reads the file with the given path in a zip container and charges it to the budget
+func (b *extractionBudget) readPath(reader *zip.Reader, name string) ([]byte, error) {
+	file := zipFile(reader, name)
+	if file == nil {
+		return nil, fmt.Errorf("%s not found", name)
+	}
+	return b.readFile(file)
+}
+
+// openZip opens a zip container held in memory, such as an OOXML or ODF document
+func openZip(data []byte) (*zip.Reader, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip container: %w", err)
+	}
+	return reader, nil
+}
+
+// zipFile returns the file with the given path in a zip container, or nil
+func zipFile(reader *zip.Reader, name string) *zip.File {
+	name = strings.TrimPrefix(name, "/")
+	for _, file := range reader.File {
+		if file.Name == name {
+			return file
+		}
+	}
+	return nil
+}
+
+// readZipFile reads a file from a zip container, refusing files that inflate past the member size limit
+func readZipFile(file *zip.File) ([]byte, error) {
+	if file.UncompressedSize64 > config.MaxDocumentMemberSize {
+		return nil, fmt.Errorf("%s is too large to extract (%d bytes)", file.Name, file.UncompressedSize64)
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", file.Name, err)
+	}
+	defer rc.Close()
+
+	// The size in the header can lie, so the read is limited too
+	data, err := io.ReadAll(io.LimitReader(rc, config.MaxDocumentMemberSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	if len(data) > config.MaxDocumentMemberSize {
+		return nil, fmt.Errorf("%s is too large to extract", file.Name)
+	}
+	return data, nil
+}
+
+// xmlAttr returns the value of an attribute by local name, ignoring its namespace
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// newXMLDecoder returns a lenient decoder for document XML. Office formats are UTF-8,
+// so other declared charsets are read as is rather than failing the document.
+func newXMLDecoder(data []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder
+}
+
+// markdownTable renders rows as a Markdown table whose first row is the header
+func markdownTable(rows [][]string) string {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	if width == 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+	writeRow := func(row []string) {
+		builder.WriteString("|")
+		for i := 0; i < width; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			// Pipes and line breaks would end the cell or the row
+			cell = strings.ReplaceAll(cell, "|", "\\|")
+			cell = strings.Join(strings.Fields(cell), " ")
+			builder.WriteString(" " + cell + " |")
+		}
+		builder.WriteString("\n")
+	}
+
+	writeRow(rows[0])
+	builder.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	return strings.TrimSuffix(builder.String(), "\n")
+}
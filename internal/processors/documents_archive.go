@@ -0,0 +1,164 @@
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// archiveExpansion collects the text of an archive's files and what was left out, across nested archives
+type archiveExpansion struct {
+	budget   *extractionBudget // Shared with the documents in the archive
+	sections []string
+	skipped  []string // Files that aren't text, such as images and binaries
+	limited  int      // Files left out once a limit was reached
+	notes    []string // Files that failed to extract
+
+	// Skipped files and notes past MaxArchiveListedNames are only counted
+	moreSkipped int
+	moreNotes   int
+}
+
+// extractArchive extracts the text of every supported file in a zip archive, expanding archives
+// nested in it, until the budget's file count or size limit is reached
+func (fp *FileProcessor) extractArchive(data []byte, budget *extractionBudget) (string, error) {
+	expansion := &archiveExpansion{budget: budget}
+	if err := fp.expandArchive(data, "", 0, expansion); err != nil {
+		return "", err
+	}
+	return expansion.String(), nil
+}
+
+// expandArchive adds the files of a zip archive to the expansion. Prefix is the path of
+// the archive within its parents and depth the number of parents.
+func (fp *FileProcessor) expandArchive(data []byte, prefix string, depth int, expansion *archiveExpansion) error {
+	reader, err := openZip(data)
+	if err != nil {
+		return err
+	}
+
+	budget := expansion.budget
+	for _, file := range reader.File {
+		if err := budget.ctx.Err(); err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() || isArchiveClutter(file.Name) {
+			continue
+		}
+		name := prefix + file.Name
+		if budget.filesLeft <= 0 || !budget.fits(file.UncompressedSize64) {
+			expansion.limited++
+			continue
+		}
+
+		format := documentFormat("", file.Name)
+		base := path.Base(file.Name)
+		isPDF := strings.EqualFold(path.Ext(file.Name), ".pdf")
+		if format == "" && !isPDF && !fp.isTextFileByExtension(base) {
+			expansion.skip(name)
+			continue
+		}
+		if format == ".zip" && depth+1 > config.MaxArchiveDepth {
+			expansion.note("%s: nested too deeply", name)
+			continue
+		}
+
+		content, err := budget.readFile(file)
+		if errors.Is(err, errExtractionLimit) {
+			expansion.limited++
+			continue
+		}
+		if err != nil {
+			expansion.note("%s: %v", name, err)
+			continue
+		}
+		// Nested archives count as files too, so a chain of them can't exceed the limit
+		budget.filesLeft--
+
+		if format == ".zip" {
+			if err := fp.expandArchive(content, name+"/", depth+1, expansion); err != nil {
+				if budget.ctx.Err() != nil {
+					return err
+				}
+				expansion.note("%s: %v", name, err)
+			}
+			continue
+		}
+
+		var text, label string
+		switch {
+		case format != "":
+			label = documentLabels[format]
+			text, err = fp.extractDocument(format, content, budget)
+		case isPDF:
+			label = "📄 PDF Document"
+			text, err = fp.extractPDFText(content)
+		default:
+			label = "📄 File"
+			text, err = fp.processTextFile(content)
+		}
+		if err != nil {
+			expansion.note("%s: %v", name, err)
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			text = "(no text)"
+		}
+		expansion.sections = append(expansion.sections, fmt.Sprintf("**%s: %s**\n%s", label, name, text))
+	}
+	return nil
+}
+
+// isArchiveClutter reports whether an archive entry is metadata added by the OS that zipped it
+func isArchiveClutter(name string) bool {
+	base := path.Base(name)
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, ".") || strings.EqualFold(base, "Thumbs.db")
+}
+
+// skip records a file that isn't text
+func (e *archiveExpansion) skip(name string) {
+	if len(e.skipped) >= config.MaxArchiveListedNames {
+		e.moreSkipped++
+		return
+	}
+	e.skipped = append(e.skipped, name)
+}
+
+// note records a file that failed to extract
+func (e *archiveExpansion) note(format string, args ...any) {
+	if len(e.notes) >= config.MaxArchiveListedNames {
+		e.moreNotes++
+		return
+	}
+	e.notes = append(e.notes, fmt.Sprintf(format, args...))
+}
+
+// String returns the extracted files followed by notes on what was left out
+func (e *archiveExpansion) String() string {
+	parts := e.sections
+	if len(e.skipped) > 0 {
+		parts = append(parts, fmt.Sprintf("_Not extracted (not text): %s%s_", strings.Join(e.skipped, ", "), andMore(e.moreSkipped)))
+	}
+	if e.limited > 0 {
+		parts = append(parts, fmt.Sprintf("_%d more files left out, the archive limit of %d files or %dMB was reached._",
+			e.limited, config.MaxArchiveFiles, config.MaxArchiveTotalSize/(1024*1024)))
+	}
+	if len(e.notes) > 0 {
+		parts = append(parts, "_Could not extract: "+strings.Join(e.notes, "; ")+andMore(e.moreNotes)+"_")
+	}
+	if len(parts) == 0 {
+		return "(empty archive)"
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// andMore returns the suffix of a list that was cut short by count entries
+func andMore(count int) string {
+	if count == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" …and %d more", count)
+}
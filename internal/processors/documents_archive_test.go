@@ -0,0 +1,149 @@
+package processors
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// buildZip creates a zip archive holding the given files in order
+func buildZip(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := writer.Create(file[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(file[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// buildPPTX creates a presentation with one text slide per entry
+func buildPPTX(t *testing.T, slides ...string) []byte {
+	t.Helper()
+	var files [][2]string
+	for i, text := range slides {
+		files = append(files, [2]string{
+			fmt.Sprintf("ppt/slides/slide%d.xml", i+1),
+			`<p:sld><a:p><a:r><a:t>` + text + `</a:t></a:r></a:p></p:sld>`,
+		})
+	}
+	return buildZip(t, files...)
+}
+
+func TestExtractionBudgetFits(t *testing.T) {
+	budget := &extractionBudget{ctx: context.Background(), bytesLeft: 100}
+	tests := []struct {
+		size      uint64
+		bytesLeft int64
+		want      bool
+	}{
+		{100, 100, true},
+		{101, 100, false},
+		{0, 0, false},
+		{0, -5, false},
+		{1, -5, false},
+		{math.MaxUint64, 100, false},
+		{math.MaxInt64 + 1, math.MaxInt64, false},
+	}
+	for _, tt := range tests {
+		budget.bytesLeft = tt.bytesLeft
+		if got := budget.fits(tt.size); got != tt.want {
+			t.Errorf("fits(%d) with %d bytes left = %v, want %v", tt.size, tt.bytesLeft, got, tt.want)
+		}
+	}
+}
+
+func TestArchiveCountsNestedArchives(t *testing.T) {
+	// Every nested archive holds one file, so each costs two files of the budget
+	var members [][2]string
+	for i := 0; i < config.MaxArchiveFiles; i++ {
+		inner := buildZip(t, [2]string{"note.txt", fmt.Sprintf("note %d", i)})
+		members = append(members, [2]string{fmt.Sprintf("inner%d.zip", i), string(inner)})
+	}
+
+	fp := NewFileProcessor()
+	text, err := fp.extractArchive(buildZip(t, members...), newExtractionBudget(context.Background()))
+	if err != nil {
+		t.Fatalf("extractArchive: %v", err)
+	}
+	if got := strings.Count(text, "note.txt**"); got != config.MaxArchiveFiles/2 {
+		t.Errorf("extracted %d files, want %d", got, config.MaxArchiveFiles/2)
+	}
+	if !strings.Contains(text, "more files left out") {
+		t.Errorf("archive limit is not reported:\n%s", text)
+	}
+}
+
+func TestArchiveSharesBudgetWithDocuments(t *testing.T) {
+	slide := strings.Repeat("x", 1000)
+	deck := buildPPTX(t, slide, slide, slide)
+	archive := buildZip(t,
+		[2]string{"deck.pptx", string(deck)},
+		[2]string{"after.txt", "after"},
+	)
+
+	// Room for the presentation and one of its slides, but not the other slides or the next file
+	slideSize := len(`<p:sld><a:p><a:r><a:t>` + slide + `</a:t></a:r></a:p></p:sld>`)
+	budget := newExtractionBudget(context.Background())
+	budget.bytesLeft = int64(len(deck) + slideSize + 1)
+
+	text, err := NewFileProcessor().extractArchive(archive, budget)
+	if err != nil {
+		t.Fatalf("extractArchive: %v", err)
+	}
+	if !strings.Contains(text, "deck.pptx: ppt/slides/slide2.xml: "+errExtractionLimit.Error()) {
+		t.Errorf("presentation read past the archive budget:\n%s", text)
+	}
+	if strings.Contains(text, "after.txt") || !strings.Contains(text, "1 more files left out") {
+		t.Errorf("file extracted after the budget ran out:\n%s", text)
+	}
+}
+
+func TestExtractionStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	budget := newExtractionBudget(ctx)
+	fp := NewFileProcessor()
+
+	if _, err := fp.extractDocument(".pptx", buildPPTX(t, "slide"), budget); !errors.Is(err, context.Canceled) {
+		t.Errorf("presentation extraction returned %v, want it cancelled", err)
+	}
+	archive := buildZip(t, [2]string{"a.txt", "a"})
+	if _, err := fp.extractDocument(".zip", archive, budget); !errors.Is(err, context.Canceled) {
+		t.Errorf("archive extraction returned %v, want it cancelled", err)
+	}
+}
+
+func TestArchiveCapsSkippedNames(t *testing.T) {
+	var files [][2]string
+	for i := 0; i < 1000; i++ {
+		files = append(files, [2]string{fmt.Sprintf("images/photo%d.png", i), "png"})
+	}
+
+	text, err := NewFileProcessor().extractArchive(buildZip(t, files...), newExtractionBudget(context.Background()))
+	if err != nil {
+		t.Fatalf("extractArchive: %v", err)
+	}
+	if got := strings.Count(text, ".png"); got != config.MaxArchiveListedNames {
+		t.Errorf("named %d skipped files, want %d", got, config.MaxArchiveListedNames)
+	}
+	if want := fmt.Sprintf("…and %d more_", 1000-config.MaxArchiveListedNames); !strings.Contains(text, want) {
+		t.Errorf("skipped files past the cap are not counted:\n%s", text)
+	}
+}
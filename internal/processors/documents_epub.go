@@ -0,0 +1,114 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// epubContainer points at the package document of an EPUB
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage is the package document listing an EPUB's metadata, files and reading order
+type epubPackage struct {
+	Title    []string `xml:"metadata>title"`
+	Creators []string `xml:"metadata>creator"`
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// extractEPUB extracts the text of an EPUB e-book, chapter by chapter in reading order
+func extractEPUB(data []byte, budget *extractionBudget) (string, error) {
+	reader, err := openZip(data)
+	if err != nil {
+		return "", err
+	}
+
+	containerXML, err := budget.readPath(reader, "META-INF/container.xml")
+	if err != nil {
+		return "", fmt.Errorf("not an EPUB: %w", err)
+	}
+	var container epubContainer
+	if err := xml.Unmarshal(containerXML, &container); err != nil || len(container.Rootfiles) == 0 {
+		return "", fmt.Errorf("not an EPUB: no package document")
+	}
+
+	packagePath := container.Rootfiles[0].FullPath
+	packageXML, err := budget.readPath(reader, packagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read EPUB package: %w", err)
+	}
+	var pkg epubPackage
+	if err := xml.Unmarshal(packageXML, &pkg); err != nil {
+		return "", fmt.Errorf("failed to parse EPUB package: %w", err)
+	}
+
+	var sections []string
+	if len(pkg.Title) > 0 && strings.TrimSpace(pkg.Title[0]) != "" {
+		heading := "# " + strings.TrimSpace(pkg.Title[0])
+		if len(pkg.Creators) > 0 {
+			heading += "\nby " + strings.Join(pkg.Creators, ", ")
+		}
+		sections = append(sections, heading)
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		if strings.Contains(item.MediaType, "html") {
+			hrefs[item.ID] = item.Href
+		}
+	}
+
+	// Hrefs are URL-encoded and relative to the package document
+	baseDir := path.Dir(packagePath)
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		chapterPath := path.Join(baseDir, strings.SplitN(href, "#", 2)[0])
+
+		chapter, err := budget.readPath(reader, chapterPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read EPUB chapter: %w", err)
+		}
+		if text := chapterText(chapter); text != "" {
+			sections = append(sections, text)
+		}
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// chapterText returns the readable text of an XHTML chapter
+func chapterText(chapter []byte) string {
+	doc, err := html.Parse(bytes.NewReader(chapter))
+	if err != nil {
+		return ""
+	}
+	pruneNode(doc)
+
+	body := findFirst(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+	return renderText(body)
+}
@@ -0,0 +1,138 @@
+package processors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// jupyterNotebook is an nbformat 4 Jupyter notebook
+type jupyterNotebook struct {
+	Cells    []notebookCell `json:"cells"`
+	Metadata struct {
+		KernelSpec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+}
+
+// notebookCell is a markdown, code or raw cell
+type notebookCell struct {
+	CellType       string           `json:"cell_type"`
+	Source         notebookText     `json:"source"`
+	ExecutionCount *int             `json:"execution_count"`
+	Outputs        []notebookOutput `json:"outputs"`
+}
+
+// notebookOutput is the stream, result or error output of a code cell
+type notebookOutput struct {
+	OutputType string                  `json:"output_type"`
+	Text       notebookText            `json:"text"`
+	Data       map[string]notebookText `json:"data"`
+	EName      string                  `json:"ename"`
+	EValue     string                  `json:"evalue"`
+}
+
+// notebookText is multiline text, stored as a string or a list of lines
+type notebookText string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*t = notebookText(text)
+		return nil
+	}
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	// Outputs such as JSON data aren't text; leave them empty
+	*t = ""
+	return nil
+}
+
+// extractNotebook renders the cells of a Jupyter notebook with their outputs
+func extractNotebook(data []byte) (string, error) {
+	var notebook jupyterNotebook
+	if err := json.Unmarshal(data, &notebook); err != nil {
+		return "", fmt.Errorf("failed to parse notebook: %w", err)
+	}
+	if len(notebook.Cells) == 0 {
+		return "", fmt.Errorf("notebook has no cells (only nbformat 4 is supported)")
+	}
+
+	language := notebook.Metadata.LanguageInfo.Name
+	if language == "" {
+		language = notebook.Metadata.KernelSpec.Language
+	}
+
+	var sections []string
+	for i, cell := range notebook.Cells {
+		source := strings.TrimSpace(string(cell.Source))
+		switch cell.CellType {
+		case "markdown":
+			if source != "" {
+				sections = append(sections, fmt.Sprintf("### Cell %d (markdown)\n%s", i+1, source))
+			}
+		case "code":
+			heading := fmt.Sprintf("### Cell %d (code)", i+1)
+			if cell.ExecutionCount != nil {
+				heading = fmt.Sprintf("### Cell %d (code, In [%d])", i+1, *cell.ExecutionCount)
+			}
+			section := fmt.Sprintf("%s\n```%s\n%s\n```", heading, language, source)
+			for _, output := range cell.Outputs {
+				if text := outputText(output); text != "" {
+					section += "\nOutput:\n```\n" + text + "\n```"
+				}
+			}
+			sections = append(sections, section)
+		default:
+			if source != "" {
+				sections = append(sections, fmt.Sprintf("### Cell %d (%s)\n%s", i+1, cell.CellType, source))
+			}
+		}
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// outputText returns the text of a cell output, truncated, with rich outputs named instead
+func outputText(output notebookOutput) string {
+	var text string
+	switch output.OutputType {
+	case "stream":
+		text = string(output.Text)
+	case "error":
+		// Tracebacks are full of terminal color codes, the error itself is enough
+		text = output.EName + ": " + output.EValue
+	case "execute_result", "display_data":
+		if plain, ok := output.Data["text/plain"]; ok {
+			text = string(plain)
+		} else if markdown, ok := output.Data["text/markdown"]; ok {
+			text = string(markdown)
+		} else {
+			var kinds []string
+			for mimeType := range output.Data {
+				kinds = append(kinds, mimeType)
+			}
+			sort.Strings(kinds)
+			if len(kinds) > 0 {
+				text = fmt.Sprintf("[%s output]", strings.Join(kinds, ", "))
+			}
+		}
+	}
+
+	text = strings.TrimSpace(text)
+	if runes := []rune(text); len(runes) > config.MaxNotebookOutputLength {
+		text = string(runes[:config.MaxNotebookOutputLength]) + "\n… (output truncated)"
+	}
+	return text
+}
@@ -0,0 +1,315 @@
+package processors
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// flowText collects the paragraphs and tables of a word-processing document or slide
+type flowText struct {
+	blocks    []string // Finished paragraphs and tables
+	paragraph strings.Builder
+	prefix    string       // Heading or list marker of the current paragraph
+	tables    []*flowTable // Tables being read, innermost last
+}
+
+// flowTable is a table being read
+type flowTable struct {
+	rows [][]string
+	cell []string // Paragraphs of the current cell
+}
+
+// text appends text to the current paragraph
+func (f *flowText) text(s string) {
+	f.paragraph.WriteString(s)
+}
+
+// endParagraph adds the current paragraph to the open table cell or the document
+func (f *flowText) endParagraph() {
+	text := strings.TrimSpace(f.paragraph.String())
+	prefix := f.prefix
+	f.paragraph.Reset()
+	f.prefix = ""
+	if text == "" {
+		return
+	}
+	if table := f.table(); table != nil {
+		table.cell = append(table.cell, text)
+		return
+	}
+	f.blocks = append(f.blocks, prefix+text)
+}
+
+// table returns the innermost open table, or nil
+func (f *flowText) table() *flowTable {
+	if len(f.tables) == 0 {
+		return nil
+	}
+	return f.tables[len(f.tables)-1]
+}
+
+func (f *flowText) startTable() {
+	f.tables = append(f.tables, &flowTable{})
+}
+
+func (f *flowText) startRow() {
+	if table := f.table(); table != nil {
+		table.rows = append(table.rows, nil)
+	}
+}
+
+func (f *flowText) endCell() {
+	table := f.table()
+	if table == nil {
+		return
+	}
+	if len(table.rows) == 0 {
+		table.rows = append(table.rows, nil)
+	}
+	last := len(table.rows) - 1
+	table.rows[last] = append(table.rows[last], strings.Join(table.cell, " "))
+	table.cell = nil
+}
+
+// endTable renders the innermost table as Markdown. A table nested in a cell is flattened into it.
+func (f *flowText) endTable() {
+	table := f.table()
+	if table == nil {
+		return
+	}
+	f.tables = f.tables[:len(f.tables)-1]
+
+	if parent := f.table(); parent != nil {
+		for _, row := range table.rows {
+			parent.cell = append(parent.cell, strings.Join(row, " "))
+		}
+		return
+	}
+	if rendered := markdownTable(table.rows); rendered != "" {
+		f.blocks = append(f.blocks, rendered)
+	}
+}
+
+// String returns the document text, with blank lines between blocks
+func (f *flowText) String() string {
+	return strings.Join(f.blocks, "\n\n")
+}
+
+// extractDOCX extracts the text of a Word document, keeping headings, list items and tables
+func extractDOCX(data []byte, budget *extractionBudget) (string, error) {
+	reader, err := openZip(data)
+	if err != nil {
+		return "", err
+	}
+	documentXML, err := budget.readPath(reader, "word/document.xml")
+	if err != nil {
+		return "", fmt.Errorf("not a Word document: %w", err)
+	}
+	return ooxmlText(documentXML)
+}
+
+// extractPPTX extracts the text of each slide of a PowerPoint presentation
+func extractPPTX(data []byte, budget *extractionBudget) (string, error) {
+	reader, err := openZip(data)
+	if err != nil {
+		return "", err
+	}
+
+	// Slides are numbered in their file names
+	type slide struct {
+		number int
+		name   string
+	}
+	var slides []slide
+	for _, file := range reader.File {
+		name := file.Name
+		if !strings.HasPrefix(name, "ppt/slides/slide") || !strings.HasSuffix(name, ".xml") {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "ppt/slides/slide"), ".xml"))
+		if err != nil {
+			continue
+		}
+		slides = append(slides, slide{number: number, name: name})
+	}
+	if len(slides) == 0 {
+		return "", fmt.Errorf("not a PowerPoint presentation: no slides found")
+	}
+	sort.Slice(slides, func(i, j int) bool { return slides[i].number < slides[j].number })
+
+	var sections []string
+	for _, s := range slides {
+		slideXML, err := budget.readPath(reader, s.name)
+		if err != nil {
+			return "", err
+		}
+		text, err := ooxmlText(slideXML)
+		if err != nil {
+			return "", err
+		}
+		if text != "" {
+			sections = append(sections, fmt.Sprintf("### Slide %d\n%s", s.number, text))
+		}
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// ooxmlText extracts the text of WordprocessingML or DrawingML, which share their paragraph,
+// run and table element names
+func ooxmlText(documentXML []byte) (string, error) {
+	decoder := newXMLDecoder(documentXML)
+	var flow flowText
+	inRun, inText := false, false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse document XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "Fallback":
+				// Alternate content repeats the preferred choice for older readers
+				if err := decoder.Skip(); err != nil {
+					return "", fmt.Errorf("failed to parse document XML: %w", err)
+				}
+			case "r":
+				inRun = true
+			case "t":
+				inText = true
+			case "tab":
+				// Outside runs, tab elements are tab stop definitions
+				if inRun {
+					flow.text("\t")
+				}
+			case "br", "cr":
+				flow.text("\n")
+			case "pStyle":
+				flow.prefix = wordHeadingPrefix(xmlAttr(t, "val"))
+			case "numPr", "buChar", "buAutoNum":
+				if flow.prefix == "" {
+					flow.prefix = "- "
+				}
+			case "tbl":
+				flow.startTable()
+			case "tr":
+				flow.startRow()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "r":
+				inRun = false
+			case "t":
+				inText = false
+			case "p":
+				flow.endParagraph()
+			case "tc":
+				flow.endCell()
+			case "tbl":
+				flow.endTable()
+			}
+		case xml.CharData:
+			if inText {
+				flow.text(string(t))
+			}
+		}
+	}
+	return flow.String(), nil
+}
+
+// wordHeadingPrefix returns the Markdown heading marker for a Word paragraph style
+func wordHeadingPrefix(style string) string {
+	if style == "Title" {
+		return "# "
+	}
+	if level, err := strconv.Atoi(strings.TrimPrefix(style, "Heading")); err == nil && strings.HasPrefix(style, "Heading") && level >= 1 {
+		return strings.Repeat("#", min(level, 6)) + " "
+	}
+	return ""
+}
+
+// extractODT extracts the text of an OpenDocument text document, keeping headings, list items and tables
+func extractODT(data []byte, budget *extractionBudget) (string, error) {
+	reader, err := openZip(data)
+	if err != nil {
+		return "", err
+	}
+	contentXML, err := budget.readPath(reader, "content.xml")
+	if err != nil {
+		return "", fmt.Errorf("not an OpenDocument file: %w", err)
+	}
+
+	decoder := newXMLDecoder(contentXML)
+	var flow flowText
+	paragraphDepth := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse content.xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "annotation", "tracked-changes", "note-citation":
+				// Comments, deleted text and footnote numbers aren't part of the text
+				if err := decoder.Skip(); err != nil {
+					return "", fmt.Errorf("failed to parse content.xml: %w", err)
+				}
+			case "h":
+				level, err := strconv.Atoi(xmlAttr(t, "outline-level"))
+				if err != nil || level < 1 {
+					level = 1
+				}
+				flow.prefix = strings.Repeat("#", min(level, 6)) + " "
+				paragraphDepth++
+			case "p":
+				paragraphDepth++
+			case "list-item":
+				flow.prefix = "- "
+			case "s":
+				count, err := strconv.Atoi(xmlAttr(t, "c"))
+				if err != nil || count < 1 {
+					count = 1
+				}
+				flow.text(strings.Repeat(" ", count))
+			case "tab":
+				flow.text("\t")
+			case "line-break":
+				flow.text("\n")
+			case "table":
+				flow.startTable()
+			case "table-row":
+				flow.startRow()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "h", "p":
+				paragraphDepth--
+				flow.endParagraph()
+			case "table-cell":
+				flow.endCell()
+			case "table":
+				flow.endTable()
+			}
+		case xml.CharData:
+			if paragraphDepth > 0 {
+				flow.text(string(t))
+			}
+		}
+	}
+	return flow.String(), nil
+}
@@ -0,0 +1,292 @@
+package processors
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// xlsxWorkbook lists the sheets of a workbook in tab order
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name  string `xml:"name,attr"`
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		State string `xml:"state,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// xlsxRelationships maps relationship IDs to the parts they point at
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// extractXLSX renders each sheet of an Excel workbook as a Markdown table under its name
+func extractXLSX(data []byte, budget *extractionBudget) (string, error) {
+	reader, err := openZip(data)
+	if err != nil {
+		return "", err
+	}
+
+	workbookXML, err := budget.readPath(reader, "xl/workbook.xml")
+	if err != nil {
+		return "", fmt.Errorf("not an Excel workbook: %w", err)
+	}
+	var workbook xlsxWorkbook
+	if err := xml.Unmarshal(workbookXML, &workbook); err != nil {
+		return "", fmt.Errorf("failed to parse workbook.xml: %w", err)
+	}
+
+	targets := make(map[string]string)
+	if relsXML, err := budget.readPath(reader, "xl/_rels/workbook.xml.rels"); err == nil {
+		var rels xlsxRelationships
+		if err := xml.Unmarshal(relsXML, &rels); err != nil {
+			return "", fmt.Errorf("failed to parse workbook relationships: %w", err)
+		}
+		for _, rel := range rels.Relationships {
+			// Targets are relative to xl/ unless absolute
+			if strings.HasPrefix(rel.Target, "/") {
+				targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+			} else {
+				targets[rel.ID] = path.Join("xl", rel.Target)
+			}
+		}
+	}
+
+	sharedStrings, err := xlsxSharedStrings(reader, budget)
+	if err != nil {
+		return "", err
+	}
+
+	var sections []string
+	for i, sheet := range workbook.Sheets {
+		target, ok := targets[sheet.RelID]
+		if !ok {
+			// Workbooks without relationships number their sheets in order
+			target = fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		}
+		sheetXML, err := budget.readPath(reader, target)
+		if err != nil {
+			return "", err
+		}
+
+		rows, totalRows, err := xlsxSheetRows(sheetXML, sharedStrings)
+		if err != nil {
+			return "", fmt.Errorf("failed to read sheet %q: %w", sheet.Name, err)
+		}
+
+		heading := fmt.Sprintf("### Sheet: %s", sheet.Name)
+		if sheet.State == "hidden" || sheet.State == "veryHidden" {
+			heading += " (hidden)"
+		}
+		sections = append(sections, heading+"\n"+renderSheet(rows, totalRows))
+	}
+	if len(sections) == 0 {
+		return "", fmt.Errorf("workbook has no sheets")
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// xlsxSharedStrings reads the workbook's shared string table, which most text cells point into
+func xlsxSharedStrings(reader *zip.Reader, budget *extractionBudget) ([]string, error) {
+	file := zipFile(reader, "xl/sharedStrings.xml")
+	if file == nil {
+		return nil, nil
+	}
+	stringsXML, err := budget.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := newXMLDecoder(stringsXML)
+	var sharedStrings []string
+	var current strings.Builder
+	inText, inPhonetic := false, false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sharedStrings.xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				// Phonetic guides repeat the text in another script
+				inPhonetic = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				sharedStrings = append(sharedStrings, current.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				current.Write(t)
+			}
+		}
+	}
+	return sharedStrings, nil
+}
+
+// xlsxSheetRows reads the cell values of a worksheet, up to the row and column limits.
+// It returns the rows read and the number of rows the sheet has.
+func xlsxSheetRows(sheetXML []byte, sharedStrings []string) ([][]string, int, error) {
+	decoder := newXMLDecoder(sheetXML)
+	var rows [][]string
+	totalRows := 0
+
+	var row []string
+	column := 0
+	cellType := ""
+	var value strings.Builder
+	inValue := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row = nil
+				column = 0
+			case "c":
+				if ref := xlsxColumn(xmlAttr(t, "r")); ref >= 0 {
+					column = ref
+				}
+				cellType = xmlAttr(t, "t")
+				value.Reset()
+			case "v", "t":
+				// Inline strings keep their text in <is><t>
+				inValue = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				if column < config.MaxSpreadsheetColumns {
+					for len(row) <= column {
+						row = append(row, "")
+					}
+					row[column] = xlsxCellValue(cellType, value.String(), sharedStrings)
+				}
+				column++
+			case "row":
+				if rowIsEmpty(row) {
+					continue
+				}
+				totalRows++
+				if len(rows) < config.MaxSpreadsheetRows {
+					rows = append(rows, row)
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		}
+	}
+	return rows, totalRows, nil
+}
+
+// xlsxCellValue returns the text of a cell from its type and raw value
+func xlsxCellValue(cellType, raw string, sharedStrings []string) string {
+	switch cellType {
+	case "s":
+		index, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || index < 0 || index >= len(sharedStrings) {
+			return ""
+		}
+		return sharedStrings[index]
+	case "b":
+		if strings.TrimSpace(raw) == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	// Numbers, formula strings, inline strings and errors are stored as shown
+	return raw
+}
+
+// xlsxColumn returns the zero-based column of a cell reference such as "AB12", or -1
+func xlsxColumn(ref string) int {
+	column := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 {
+		return -1
+	}
+	return column - 1
+}
+
+// rowIsEmpty reports whether a row has no values
+func rowIsEmpty(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// renderSheet renders the rows of a sheet as a Markdown table, noting rows left out
+func renderSheet(rows [][]string, totalRows int) string {
+	if len(rows) == 0 {
+		return "(empty)"
+	}
+
+	// Drop trailing columns that are empty in every row, left over from formatting
+	width := 0
+	for _, row := range rows {
+		for i := len(row) - 1; i >= 0; i-- {
+			if strings.TrimSpace(row[i]) != "" {
+				width = max(width, i+1)
+				break
+			}
+		}
+	}
+	for i, row := range rows {
+		if len(row) > width {
+			rows[i] = row[:width]
+		}
+	}
+
+	table := markdownTable(rows)
+	if totalRows > len(rows) {
+		table += fmt.Sprintf("\n\n_Showing the first %d of %d rows._", len(rows), totalRows)
+	}
+	return table
+}
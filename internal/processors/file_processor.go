@@ -1,13 +1,11 @@
 package processors
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"strings"
 	"time"
 
-	"github.com/dslipak/pdf"
 	"github.com/gogits/chardet"
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/charmap"
@@ -16,6 +14,8 @@ import (
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/encoding/traditionalchinese"
 	"golang.org/x/text/encoding/unicode"
+
+	"DiscordAIChatbot/internal/config"
 )
 
 // FileProcessor handles processing of various file types
@@ -34,6 +34,11 @@ func (fp *FileProcessor) ProcessFile(data []byte, contentType, filename string)
 	case strings.HasPrefix(contentType, "application/pdf"):
 		text, err := fp.processPDF(data)
 		return text, shouldProcessURLs, err
+	case fp.IsDocument(contentType, filename):
+		// Office documents, e-books, notebooks and archives, checked before text/ since
+		// notebooks and archives are sometimes sent with a text content type
+		text, err := fp.processDocument(documentFormat(contentType, filename), data)
+		return text, shouldProcessURLs, err
 	case strings.HasPrefix(contentType, "text/"):
 		text, err := fp.processTextFile(data)
 		return text, shouldProcessURLs, err
@@ -48,7 +53,7 @@ func (fp *FileProcessor) ProcessFile(data []byte, contentType, filename string)
 
 // processPDF extracts text from PDF files with a timeout
 func (fp *FileProcessor) processPDF(data []byte) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), config.PDFExtractionTimeout*time.Second)
 	defer cancel()
 
 	type result struct {
@@ -65,46 +70,12 @@ func (fp *FileProcessor) processPDF(data []byte) (string, error) {
 
 	select {
 	case <-ctx.Done():
-		return "", fmt.Errorf("PDF text extraction timed out after 15 seconds")
+		return "", fmt.Errorf("PDF text extraction timed out after %d seconds", config.PDFExtractionTimeout)
 	case res := <-resultChan:
 		return res.text, res.err
 	}
 }
 
-// extractPDFText contains the original PDF text extraction logic
-func (fp *FileProcessor) extractPDFText(data []byte) (string, error) {
-	// Create a reader from the PDF data
-	reader := bytes.NewReader(data)
-
-	// Open the PDF
-	pdfReader, err := pdf.NewReader(reader, int64(len(data)))
-	if err != nil {
-		return "", fmt.Errorf("failed to open PDF: %w", err)
-	}
-
-	// Extract plain text from all pages
-	textReader, err := pdfReader.GetPlainText()
-	if err != nil {
-		return "", fmt.Errorf("failed to extract text from PDF: %w", err)
-	}
-
-	// Read all text content
-	var textBuffer bytes.Buffer
-	_, err = textBuffer.ReadFrom(textReader)
-	if err != nil {
-		return "", fmt.Errorf("failed to read PDF text: %w", err)
-	}
-
-	text := textBuffer.String()
-
-	// Clean up the extracted text
-	text = fp.cleanExtractedText(text)
-
-	// Do not return an error if the PDF has no text content.
-	// The caller can decide if this is an error condition.
-	return text, nil
-}
-
 // shouldProcessURLs determines if URLs should be processed for a given file type.
 func (fp *FileProcessor) shouldProcessURLs(contentType string, filename string) bool {
 	// For other file types, assume URLs should be processed
@@ -238,31 +209,6 @@ func (fp *FileProcessor) isTextFileByExtension(filename string) bool {
 	return false
 }
 
-// cleanExtractedText cleans up extracted text content
-func (fp *FileProcessor) cleanExtractedText(text string) string {
-	// Remove excessive whitespace and normalize line endings
-	lines := strings.Split(text, "\n")
-	var cleanedLines []string
-
-	for _, line := range lines {
-		// Trim whitespace from each line
-		line = strings.TrimSpace(line)
-
-		// Skip empty lines that are just whitespace
-		if line != "" {
-			cleanedLines = append(cleanedLines, line)
-		}
-	}
-
-	// Join lines back together with single newlines
-	cleaned := strings.Join(cleanedLines, "\n")
-
-	// Remove any remaining excessive whitespace
-	cleaned = strings.TrimSpace(cleaned)
-
-	return cleaned
-}
-
 // isValidUTF8 checks if the data is valid UTF-8
 func isValidUTF8(data []byte) bool {
 	return strings.ToValidUTF8(string(data), "�") == string(data)
@@ -272,6 +218,9 @@ func isValidUTF8(data []byte) bool {
 func (fp *FileProcessor) GetSupportedFileTypes() []string {
 	return []string{
 		"PDF files (.pdf)",
+		"Office documents (.docx, .xlsx, .pptx, .odt)",
+		"E-books (.epub) and Jupyter notebooks (.ipynb)",
+		"Zip archives (.zip), with the supported files inside extracted",
 		"Text files (.txt, .md, .log, etc.)",
 		"Source code files (.go, .py, .js, .java, .c, .cpp, etc.)",
 		"Configuration files (.json, .yaml, .xml, .ini, etc.)",
@@ -285,9 +234,16 @@ func (fp *FileProcessor) GetProcessingInfo() string {
 	return `**File Processing Capabilities:**
 
 📄 **PDF Files:**
-- Extracts plain text from PDF documents
-- Handles multi-page documents
-- Preserves text structure where possible
+- Extracts text page by page, with [p.N] markers to cite pages by
+- Reads multi-column layouts column by column and keeps tables as Markdown tables
+- Scanned PDFs are read by an OCR model when one is configured
+
+📊 **Documents and Archives:**
+- Word and OpenDocument text keeps headings, lists and tables
+- Spreadsheets become Markdown tables, one per sheet with its name
+- Presentations are extracted slide by slide
+- Jupyter notebooks show each cell with its outputs
+- Zip archives are expanded, nested archives included, up to file count and size limits
 
 📝 **Text Files:**
 - Auto-detects character encoding (UTF-8, UTF-16, Latin-1, etc.)
@@ -297,6 +253,9 @@ func (fp *FileProcessor) GetProcessingInfo() string {
 
 ✅ **Supported Formats:**
 - PDF documents (.pdf)
+- Office documents (.docx, .xlsx, .pptx, .odt)
+- E-books (.epub) and notebooks (.ipynb)
+- Zip archives (.zip)
 - Plain text (.txt, .md, .log)
 - Source code (.go, .py, .js, .java, .c, .cpp, .rs, etc.)
 - Config files (.json, .yaml, .xml, .ini, .toml)
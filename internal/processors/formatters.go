@@ -2,9 +2,13 @@ package processors
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
+// searchResultPattern matches the heading and URL that start each formatted search result
+var searchResultPattern = regexp.MustCompile(`(?m)^--- Result \d+ ---\nURL: `)
+
 // WebSearchResultFormatter handles formatting of web search results
 type WebSearchResultFormatter struct{}
 
@@ -53,6 +57,12 @@ func (f *WebSearchResultFormatter) FormatSearchResults(resp *FinalResponsePayloa
 	return builder.String()
 }
 
+// CountSearchResults counts the results in text written by FormatSearchResults,
+// e.g. the combined results of SearchMultiple
+func CountSearchResults(text string) int {
+	return len(searchResultPattern.FindAllStringIndex(text, -1))
+}
+
 // FormatExtractResults formats the extract results into a readable string
 func (f *WebSearchResultFormatter) FormatExtractResults(resp *ExtractResponsePayload) string {
 	builder := builderPool.Get().(*strings.Builder)
@@ -0,0 +1,527 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/dslipak/pdf"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/llm"
+)
+
+// Layout thresholds, in multiples of the font size
+const (
+	pdfLineTolerance = 0.5 // baselines closer than this are one line
+	pdfWordGap       = 0.15
+	pdfCellGap       = 1.0 // wider gaps separate table cells or columns
+	pdfParagraphGap  = 1.6 // wider line spacing starts a paragraph
+	pdfTableRowGap   = 3.0 // rows further apart than this end a table
+)
+
+// Column detection
+const (
+	pdfMinColumnLines = 5 // lines needed on each side of a gutter
+	pdfMaxColumns     = 3
+	pdfGutterStep     = 2.0 // points between the positions tested for a gutter
+)
+
+// pdfScanMinPixels is the width and height an image needs to be a scanned page, about a
+// letter page at 75 dpi
+const pdfScanMinPixels = 600
+
+// pdfSpan is a run of text on a line, either a word or a table cell
+type pdfSpan struct {
+	x0, x1 float64
+	text   string
+}
+
+// pdfLine is the text sharing a baseline, left to right
+type pdfLine struct {
+	y, size float64
+	words   []pdfSpan
+}
+
+// extractPDFText extracts the text of a PDF page by page, each page starting with a [p.N]
+// marker the model can cite. Columns are read one after another and rows of aligned cells
+// become Markdown tables. A PDF whose pages are mostly images without text returns
+// llm.ErrScannedPDF, so it can be read by OCR instead.
+func (fp *FileProcessor) extractPDFText(data []byte) (string, error) {
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open PDF: %w", err)
+	}
+
+	numPages := reader.NumPage()
+	pages := min(numPages, config.MaxPDFPages)
+	var sections []string
+	scanned := 0
+	for i := 1; i <= pages; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		lines, chars, err := pdfPageLines(page)
+		if err != nil {
+			sections = append(sections, fmt.Sprintf("[p.%d]\n_(this page could not be read: %v)_", i, err))
+			continue
+		}
+		text := layoutPDFPage(lines)
+		if chars < config.MinPDFPageText && pdfPageHasScan(page) {
+			scanned++
+			text = strings.TrimSpace("_(scanned page without a text layer)_\n" + text)
+		}
+		if text != "" {
+			sections = append(sections, fmt.Sprintf("[p.%d]\n%s", i, text))
+		}
+	}
+
+	if scanned*2 > pages {
+		return "", fmt.Errorf("%w: %d of %d pages are images", llm.ErrScannedPDF, scanned, pages)
+	}
+	// Do not return an error if the PDF has no text content.
+	// The caller can decide if this is an error condition.
+	if len(sections) == 0 {
+		return "", nil
+	}
+
+	intro := fmt.Sprintf("_%d pages, each starting with its [p.N] marker._", numPages)
+	if numPages > pages {
+		sections = append(sections, fmt.Sprintf("_Only the first %d of %d pages were read._", pages, numPages))
+	}
+	return intro + "\n\n" + strings.Join(sections, "\n\n"), nil
+}
+
+// pdfPageLines reads the text of a page as lines, top to bottom, and counts its characters.
+// The PDF library panics on content it can't parse, which is returned as an error.
+func pdfPageLines(page pdf.Page) (lines []pdfLine, chars int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			lines, chars, err = nil, 0, fmt.Errorf("%v", r)
+		}
+	}()
+
+	runs := pdfRuns(page.Content().Text)
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].y > runs[j].y })
+
+	var group []pdfRun
+	for _, run := range runs {
+		if len(group) > 0 && math.Abs(group[0].y-run.y) > run.size*pdfLineTolerance {
+			line, count := newPDFLine(group)
+			lines = append(lines, line)
+			chars += count
+			group = nil
+		}
+		group = append(group, run)
+	}
+	if len(group) > 0 {
+		line, count := newPDFLine(group)
+		lines = append(lines, line)
+		chars += count
+	}
+
+	// Lines of spaces only would read as paragraph breaks
+	kept := lines[:0]
+	for _, line := range lines {
+		if len(line.words) > 0 {
+			kept = append(kept, line)
+		}
+	}
+	return kept, chars, nil
+}
+
+// pdfRun is characters drawn one after another on a baseline, in the order of the page content
+type pdfRun struct {
+	y, size float64
+	x0, x1  float64
+	glyphs  []pdf.Text
+}
+
+// pdfRuns splits the characters of a page into runs. Characters of fonts without widths are
+// all placed at the start of their run by the PDF library, so they are spread out assuming
+// characters half an em wide.
+func pdfRuns(glyphs []pdf.Text) []pdfRun {
+	var runs []pdfRun
+	for start := 0; start < len(glyphs); {
+		first := glyphs[start]
+		size := glyphSize(first)
+		end := start + 1
+		for end < len(glyphs) && glyphs[end].Y == first.Y && (glyphs[end].W <= 0) == (first.W <= 0) {
+			previous := glyphs[end-1]
+			advance := glyphs[end].X - (previous.X + max(previous.W, 0))
+			if math.Abs(advance) > size*pdfWordGap {
+				break
+			}
+			end++
+		}
+
+		run := pdfRun{y: first.Y, size: size, x0: first.X, glyphs: glyphs[start:end]}
+		if first.W <= 0 {
+			for i := range run.glyphs {
+				run.glyphs[i].X = first.X + float64(i)*size*0.5
+				run.glyphs[i].W = size * 0.5
+			}
+		}
+		last := run.glyphs[len(run.glyphs)-1]
+		run.x1 = last.X + last.W
+		runs = append(runs, run)
+		start = end
+	}
+	return runs
+}
+
+// newPDFLine joins the runs of a line into words, returning the line and its character count.
+// Text is often drawn a few characters at a time, so runs only start a word after a gap.
+func newPDFLine(runs []pdfRun) (pdfLine, int) {
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].x0 < runs[j].x0 })
+
+	line := pdfLine{y: runs[0].y}
+	var word *pdfSpan
+	var previous *pdfRun
+	chars := 0
+	for i := range runs {
+		run := &runs[i]
+		line.size = max(line.size, run.size)
+		// Fake bold draws text twice, slightly offset
+		if previous != nil && math.Abs(run.x0-previous.x0) < run.size*pdfWordGap && runText(*run) == runText(*previous) {
+			continue
+		}
+		previous = run
+
+		newWord := word == nil || run.x0-word.x1 > run.size*pdfWordGap
+		for _, glyph := range run.glyphs {
+			if strings.TrimSpace(glyph.S) == "" {
+				newWord = true
+				continue
+			}
+			if newWord || word == nil {
+				line.words = append(line.words, pdfSpan{x0: glyph.X, x1: glyph.X})
+				word = &line.words[len(line.words)-1]
+				newWord = false
+			}
+			word.text += glyph.S
+			word.x1 = max(word.x1, glyph.X+glyph.W)
+			chars += len([]rune(glyph.S))
+		}
+	}
+	return line, chars
+}
+
+// runText returns the characters of a run
+func runText(run pdfRun) string {
+	var text strings.Builder
+	for _, glyph := range run.glyphs {
+		text.WriteString(glyph.S)
+	}
+	return text.String()
+}
+
+// glyphSize returns the font size of a character, which transforms can make negative or zero
+func glyphSize(glyph pdf.Text) float64 {
+	size := math.Abs(glyph.FontSize)
+	if size < 1 {
+		return 10
+	}
+	return size
+}
+
+// spans joins the words of a line into the runs separated by gaps wide enough for table cells
+func (l pdfLine) spans() []pdfSpan {
+	var spans []pdfSpan
+	for _, word := range l.words {
+		if n := len(spans); n > 0 && word.x0-spans[n-1].x1 <= l.size*pdfCellGap {
+			spans[n-1].text += " " + word.text
+			spans[n-1].x1 = max(spans[n-1].x1, word.x1)
+			continue
+		}
+		spans = append(spans, word)
+	}
+	return spans
+}
+
+// text returns the line as text, with wide gaps kept as two spaces
+func (l pdfLine) text() string {
+	spans := l.spans()
+	parts := make([]string, len(spans))
+	for i, span := range spans {
+		parts[i] = span.text
+	}
+	return strings.Join(parts, "  ")
+}
+
+// splitAt splits a line at a column gutter. Crosses is true when a span runs over the gutter,
+// or the line is a table row with cells on both sides of it.
+func (l pdfLine) splitAt(gutter float64) (left, right pdfLine, crosses bool) {
+	left = pdfLine{y: l.y, size: l.size}
+	right = left
+	spans := l.spans()
+	for _, span := range spans {
+		if span.x0 < gutter && span.x1 > gutter {
+			return left, right, true
+		}
+	}
+	for _, word := range l.words {
+		if word.x1 <= gutter {
+			left.words = append(left.words, word)
+		} else {
+			right.words = append(right.words, word)
+		}
+	}
+	if len(left.words) > 0 && len(right.words) > 0 && len(spans) > 2 {
+		return pdfLine{}, pdfLine{}, true
+	}
+	return left, right, false
+}
+
+// layoutPDFPage renders the lines of a page as text, reading columns one after another
+func layoutPDFPage(lines []pdfLine) string {
+	var blocks []string
+	for _, block := range splitPDFColumns(lines, 1) {
+		if text := renderPDFBlock(block); text != "" {
+			blocks = append(blocks, text)
+		}
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// splitPDFColumns splits lines into blocks in reading order. Lines running over the gutter,
+// such as titles, end the columns above them, which are read left then right.
+func splitPDFColumns(lines []pdfLine, columns int) [][]pdfLine {
+	if columns >= pdfMaxColumns {
+		return [][]pdfLine{lines}
+	}
+	gutter, ok := findPDFGutter(lines)
+	if !ok {
+		return [][]pdfLine{lines}
+	}
+
+	var blocks [][]pdfLine
+	var full, left, right []pdfLine
+	flushColumns := func() {
+		if len(left) > 0 {
+			blocks = append(blocks, splitPDFColumns(left, columns+1)...)
+		}
+		if len(right) > 0 {
+			blocks = append(blocks, splitPDFColumns(right, columns+1)...)
+		}
+		left, right = nil, nil
+	}
+	flushFull := func() {
+		if len(full) > 0 {
+			blocks = append(blocks, full)
+			full = nil
+		}
+	}
+
+	for _, line := range lines {
+		l, r, crosses := line.splitAt(gutter)
+		if crosses {
+			flushColumns()
+			full = append(full, line)
+			continue
+		}
+		flushFull()
+		if len(l.words) > 0 {
+			left = append(left, l)
+		}
+		if len(r.words) > 0 {
+			right = append(right, r)
+		}
+	}
+	flushColumns()
+	flushFull()
+	return blocks
+}
+
+// findPDFGutter finds the gap between two columns of text: a position in the middle half of
+// the lines that almost no line runs over, with prose on both sides. Tables have gaps like
+// gutters too, but their rows are split into several cells.
+func findPDFGutter(lines []pdfLine) (float64, bool) {
+	if len(lines) < 2*pdfMinColumnLines {
+		return 0, false
+	}
+	left, right := math.Inf(1), math.Inf(-1)
+	for _, line := range lines {
+		left = min(left, line.words[0].x0)
+		right = max(right, line.words[len(line.words)-1].x1)
+	}
+	width := right - left
+	if width <= 0 {
+		return 0, false
+	}
+
+	lo, hi := left+width*0.25, left+width*0.75
+	covered := make([]int, int((hi-lo)/pdfGutterStep)+1)
+	for _, line := range lines {
+		for _, span := range line.spans() {
+			from := max(int(math.Ceil((span.x0-lo)/pdfGutterStep)), 0)
+			to := min(int(math.Floor((span.x1-lo)/pdfGutterStep)), len(covered)-1)
+			for k := from; k <= to; k++ {
+				covered[k]++
+			}
+		}
+	}
+
+	// The widest run of positions that titles and the like run over at most
+	allowed := len(lines) / 10
+	bestStart, bestLength := -1, 0
+	for k := 0; k < len(covered); {
+		if covered[k] > allowed {
+			k++
+			continue
+		}
+		start := k
+		for k < len(covered) && covered[k] <= allowed {
+			k++
+		}
+		if k-start > bestLength {
+			bestStart, bestLength = start, k-start
+		}
+	}
+	if bestStart < 0 {
+		return 0, false
+	}
+	gutter := lo + (float64(bestStart)+float64(bestLength-1)/2)*pdfGutterStep
+
+	// Both sides need enough lines of prose filling their width
+	var sides [2]struct{ lines, prose int }
+	var fill [2]float64
+	for _, line := range lines {
+		l, r, crosses := line.splitAt(gutter)
+		if crosses {
+			continue
+		}
+		for i, side := range []pdfLine{l, r} {
+			if len(side.words) == 0 {
+				continue
+			}
+			sides[i].lines++
+			if len(side.spans()) == 1 {
+				sides[i].prose++
+			}
+			fill[i] += side.words[len(side.words)-1].x1 - side.words[0].x0
+		}
+	}
+	sideWidths := [2]float64{gutter - left, right - gutter}
+	for i, side := range sides {
+		if side.lines < pdfMinColumnLines || side.prose*10 < side.lines*7 || fill[i]/float64(side.lines) < sideWidths[i]*0.5 {
+			return 0, false
+		}
+	}
+	return gutter, true
+}
+
+// renderPDFBlock renders lines read top to bottom as paragraphs, turning runs of rows whose
+// cells line up into Markdown tables
+func renderPDFBlock(lines []pdfLine) string {
+	var blocks, paragraph []string
+	endParagraph := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, strings.Join(paragraph, "\n"))
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		if rows, n := pdfTableAt(lines[i:]); n > 0 {
+			endParagraph()
+			blocks = append(blocks, markdownTable(rows))
+			i += n
+			continue
+		}
+		line := lines[i]
+		if i > 0 && lines[i-1].y-line.y > max(line.size, lines[i-1].size)*pdfParagraphGap {
+			endParagraph()
+		}
+		paragraph = append(paragraph, line.text())
+		i++
+	}
+	endParagraph()
+	return strings.Join(blocks, "\n\n")
+}
+
+// pdfTableAt returns the rows of the table the lines start with and how many lines it takes,
+// or 0 lines. A table is two or more consecutive lines split into cells that line up in columns.
+func pdfTableAt(lines []pdfLine) ([][]string, int) {
+	end := 0
+	for end < len(lines) && len(lines[end].spans()) >= 2 {
+		if end > 0 && lines[end-1].y-lines[end].y > lines[end].size*pdfTableRowGap {
+			break
+		}
+		end++
+	}
+	if end < 2 {
+		return nil, 0
+	}
+
+	// Columns are the ranges where the cells of the rows overlap
+	var spans []pdfSpan
+	for _, line := range lines[:end] {
+		spans = append(spans, line.spans()...)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].x0 < spans[j].x0 })
+	var columns []pdfSpan
+	for _, span := range spans {
+		if n := len(columns); n > 0 && span.x0 <= columns[n-1].x1 {
+			columns[n-1].x1 = max(columns[n-1].x1, span.x1)
+			continue
+		}
+		columns = append(columns, pdfSpan{x0: span.x0, x1: span.x1})
+	}
+	if len(columns) < 2 {
+		return nil, 0
+	}
+
+	rows := make([][]string, end)
+	filled := 0
+	for i, line := range lines[:end] {
+		rows[i] = make([]string, len(columns))
+		for _, span := range line.spans() {
+			column := sort.Search(len(columns), func(k int) bool { return columns[k].x1 >= span.x0 }) // the column holding the span
+			if rows[i][column] == "" {
+				filled++
+				rows[i][column] = span.text
+			} else {
+				rows[i][column] += " " + span.text
+			}
+		}
+	}
+	// Lines whose gaps merely happen to fall in different places leave most cells empty
+	if filled*2 < end*len(columns) {
+		return nil, 0
+	}
+	return rows, end
+}
+
+// pdfPageHasScan reports whether a page draws an image large enough to be a scan of it,
+// directly or through a form. Logos and icons are too small.
+func pdfPageHasScan(page pdf.Page) (found bool) {
+	defer func() {
+		if recover() != nil {
+			found = false
+		}
+	}()
+	return resourcesHaveScan(page.Resources(), 0)
+}
+
+// resourcesHaveScan looks for a scan-sized image among the XObjects of a resource dictionary
+func resourcesHaveScan(resources pdf.Value, depth int) bool {
+	xObjects := resources.Key("XObject")
+	for _, name := range xObjects.Keys() {
+		xObject := xObjects.Key(name)
+		switch xObject.Key("Subtype").Name() {
+		case "Image":
+			if xObject.Key("Width").Int64() >= pdfScanMinPixels && xObject.Key("Height").Int64() >= pdfScanMinPixels {
+				return true
+			}
+		case "Form":
+			if depth < 2 && resourcesHaveScan(xObject.Key("Resources"), depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package processors
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"DiscordAIChatbot/internal/llm"
+)
+
+// testPDFPage is a page of a generated PDF: its content stream and the size of the image it
+// may draw, 0 for none
+type testPDFPage struct {
+	content    string
+	imageWidth int
+}
+
+// textContent returns a content stream drawing lines of Helvetica top down
+func textContent(lines ...string) string {
+	var content strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&content, "BT /F1 12 Tf 72 %d Td (%s) Tj ET\n", 720-i*16, line)
+	}
+	return content.String()
+}
+
+// buildPDF writes a minimal PDF with the given pages
+func buildPDF(t *testing.T, pages ...testPDFPage) []byte {
+	t.Helper()
+	var objects []string
+	add := func(object string) int {
+		objects = append(objects, object)
+		return len(objects)
+	}
+	stream := func(dict, data string) string {
+		return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+	}
+
+	add("<< /Type /Catalog /Pages 2 0 R >>")
+	add("") // The page tree, once the pages are known
+	font := add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+	var kids []string
+	for _, page := range pages {
+		resources := fmt.Sprintf("/Font << /F1 %d 0 R >>", font)
+		content := page.content
+		if page.imageWidth > 0 {
+			image := add(stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8",
+				page.imageWidth, page.imageWidth), ""))
+			resources += fmt.Sprintf(" /XObject << /Im1 %d 0 R >>", image)
+			content += "q 612 0 0 792 0 0 cm /Im1 Do Q\n"
+		}
+		contents := add(stream("", content))
+		kids = append(kids, fmt.Sprintf("%d 0 R", add(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << %s >> /Contents %d 0 R >>", resources, contents))))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// testLine creates a line of 10pt text from spans given as start, end and text
+func testLine(y float64, spans ...pdfSpan) pdfLine {
+	return pdfLine{y: y, size: 10, words: spans}
+}
+
+// twoColumnLines returns a title running across the page over lines in two columns
+func twoColumnLines(rows int) []pdfLine {
+	lines := []pdfLine{testLine(760, pdfSpan{50, 550, "A title running across both columns"})}
+	for i := 0; i < rows; i++ {
+		y := 740 - float64(i)*12
+		lines = append(lines, testLine(y,
+			pdfSpan{50, 280, fmt.Sprintf("left %d", i)},
+			pdfSpan{320, 550, fmt.Sprintf("right %d", i)},
+		))
+	}
+	return lines
+}
+
+func TestFindPDFGutter(t *testing.T) {
+	gutter, ok := findPDFGutter(twoColumnLines(12))
+	if !ok || gutter <= 280 || gutter >= 320 {
+		t.Errorf("findPDFGutter = %v, %v, want a gutter between 280 and 320", gutter, ok)
+	}
+
+	if _, ok := findPDFGutter(twoColumnLines(4)); ok {
+		t.Error("found a gutter between columns of 4 lines")
+	}
+
+	// Table rows have gaps like a gutter, but several cells a side
+	var table []pdfLine
+	for i := 0; i < 12; i++ {
+		table = append(table, testLine(740-float64(i)*12,
+			pdfSpan{50, 150, "name"}, pdfSpan{250, 350, "value"}, pdfSpan{450, 550, "unit"}))
+	}
+	if gutter, ok := findPDFGutter(table); ok {
+		t.Errorf("found a gutter at %v in a table", gutter)
+	}
+
+	// Short lines on one side aren't a column of prose
+	var ragged []pdfLine
+	for i := 0; i < 12; i++ {
+		ragged = append(ragged, testLine(740-float64(i)*12, pdfSpan{50, 280, "prose"}, pdfSpan{320, 340, "7"}))
+	}
+	ragged = append(ragged, testLine(500, pdfSpan{50, 550, "a full-width line"}))
+	if gutter, ok := findPDFGutter(ragged); ok {
+		t.Errorf("found a gutter at %v next to a column of numbers", gutter)
+	}
+}
+
+func TestLayoutPDFPageReadsColumnsInOrder(t *testing.T) {
+	got := layoutPDFPage(twoColumnLines(12))
+	title := strings.Index(got, "A title")
+	left := strings.Index(got, "left 11")
+	right := strings.Index(got, "right 0")
+	if title != 0 || left < 0 || right < left {
+		t.Errorf("columns are not read title, left, then right:\n%s", got)
+	}
+	if strings.Contains(got, "left 0  right 0") {
+		t.Errorf("columns were read across:\n%s", got)
+	}
+}
+
+func TestPDFTableAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []pdfLine
+		rows  [][]string
+		n     int
+	}{
+		{
+			"aligned rows then prose",
+			[]pdfLine{
+				testLine(700, pdfSpan{50, 100, "Item"}, pdfSpan{200, 240, "Qty"}, pdfSpan{300, 350, "Price"}),
+				testLine(688, pdfSpan{50, 110, "Apples"}, pdfSpan{200, 210, "3"}, pdfSpan{300, 330, "1.20"}),
+				testLine(676, pdfSpan{50, 105, "Pears"}, pdfSpan{300, 330, "0.80"}),
+				testLine(664, pdfSpan{50, 400, "A sentence after the table."}),
+			},
+			[][]string{{"Item", "Qty", "Price"}, {"Apples", "3", "1.20"}, {"Pears", "", "0.80"}},
+			3,
+		},
+		{
+			"single row",
+			[]pdfLine{
+				testLine(700, pdfSpan{50, 100, "Item"}, pdfSpan{200, 240, "Qty"}),
+				testLine(688, pdfSpan{50, 400, "Prose."}),
+			},
+			nil, 0,
+		},
+		{
+			"rows far apart",
+			[]pdfLine{
+				testLine(700, pdfSpan{50, 100, "Item"}, pdfSpan{200, 240, "Qty"}),
+				testLine(600, pdfSpan{50, 100, "Apples"}, pdfSpan{200, 240, "3"}),
+			},
+			nil, 0,
+		},
+		{
+			"gaps that don't line up",
+			[]pdfLine{
+				testLine(700, pdfSpan{50, 100, "a"}, pdfSpan{200, 250, "b"}),
+				testLine(688, pdfSpan{120, 170, "c"}, pdfSpan{300, 350, "d"}),
+				testLine(676, pdfSpan{400, 450, "e"}, pdfSpan{500, 550, "f"}),
+			},
+			nil, 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, n := pdfTableAt(tt.lines)
+			if n != tt.n || !reflect.DeepEqual(rows, tt.rows) {
+				t.Errorf("pdfTableAt = %q, %d, want %q, %d", rows, n, tt.rows, tt.n)
+			}
+		})
+	}
+}
+
+func TestExtractPDFText(t *testing.T) {
+	fp := NewFileProcessor()
+	text := testPDFPage{content: textContent("Hello world", "A second line of text on the page")}
+	scan := testPDFPage{imageWidth: 1200}
+	logo := testPDFPage{content: textContent("Hi"), imageWidth: 64}
+
+	got, err := fp.extractPDFText(buildPDF(t, text, logo))
+	if err != nil {
+		t.Fatalf("extractPDFText: %v", err)
+	}
+	if !strings.HasPrefix(got, "_2 pages, each starting with its [p.N] marker._\n\n[p.1]\nHello world\n") {
+		t.Errorf("pages are not marked:\n%s", got)
+	}
+	if !strings.Contains(got, "[p.2]\nHi") || strings.Contains(got, "scanned page") {
+		t.Errorf("a page with a logo was taken for a scan:\n%s", got)
+	}
+
+	got, err = fp.extractPDFText(buildPDF(t, text, scan, text))
+	if err != nil {
+		t.Fatalf("extractPDFText with one scanned page: %v", err)
+	}
+	if !strings.Contains(got, "[p.2]\n_(scanned page without a text layer)_") {
+		t.Errorf("the scanned page is not noted:\n%s", got)
+	}
+
+	if _, err := fp.extractPDFText(buildPDF(t, scan, scan, text)); !errors.Is(err, llm.ErrScannedPDF) {
+		t.Errorf("mostly scanned PDF returned %v, want llm.ErrScannedPDF", err)
+	}
+}
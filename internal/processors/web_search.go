@@ -1,19 +1,16 @@
 package processors
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"regexp"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
-	json "github.com/json-iterator/go"
-
 	"golang.org/x/sync/singleflight"
 
 	"DiscordAIChatbot/internal/auth"
@@ -24,11 +21,12 @@ import (
 	"DiscordAIChatbot/internal/utils"
 )
 
-// WebSearchClient handles web search API requests
+// WebSearchClient runs searches and URL extraction on the configured backends,
+// falling back to the next backend when one fails
 type WebSearchClient struct {
 	config     *config.Config
 	httpClient *http.Client
-	formatter  *WebSearchResultFormatter
+	backends   []namedBackend
 	fetchGroup singleflight.Group
 }
 
@@ -65,6 +63,40 @@ type WebSearchDecision struct {
 	SearchQueries     []string `json:"search_queries,omitempty"`
 }
 
+// webSearchDecisionSchema constrains the decider's reply to a WebSearchDecision
+var webSearchDecisionSchema = &llm.ResponseSchema{
+	Name:        "web_search_decision",
+	Description: "Whether the latest query needs a web search, and the queries to run if so",
+	Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"web_search_required": map[string]any{"type": "boolean"},
+			"search_queries": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"type": "string"},
+			},
+		},
+		"required":             []string{"web_search_required", "search_queries"},
+		"additionalProperties": false,
+	},
+}
+
+// Validate drops blank queries and requires at least one when a search is needed
+func (d *WebSearchDecision) Validate() error {
+	queries := d.SearchQueries[:0]
+	for _, query := range d.SearchQueries {
+		if query = strings.TrimSpace(query); query != "" {
+			queries = append(queries, query)
+		}
+	}
+	d.SearchQueries = queries
+
+	if d.WebSearchRequired && len(d.SearchQueries) == 0 {
+		return fmt.Errorf("search_queries must not be empty when web_search_required is true")
+	}
+	return nil
+}
+
 // ExtractRequest represents the request to the /extract endpoint
 type ExtractRequest struct {
 	URLs          []string `json:"urls"`
@@ -115,48 +147,62 @@ type TwitterComment struct {
 }
 
 // NewWebSearchClient creates a new web search client with optimized HTTP settings.
-// It configures connection pooling, timeouts, and other performance optimizations
-// for reliable web search API communication.
+// Backends come from web_search.backends in order; invalid entries are logged and skipped.
 func NewWebSearchClient(cfg *config.Config, httpClient *http.Client) *WebSearchClient {
+	backends, errs := newWebSearchBackends(cfg, httpClient)
+	for _, err := range errs {
+		log.Printf("Skipping web search backend: %v", err)
+	}
+
 	return &WebSearchClient{
 		config:     cfg,
 		httpClient: httpClient,
-		formatter:  NewWebSearchResultFormatter(),
+		backends:   backends,
 	}
 }
 
-// CheckHealth performs a health check on the web search API
+// CheckHealth checks every backend and succeeds when at least one is healthy
 func (w *WebSearchClient) CheckHealth(ctx context.Context) error {
-	url := w.config.WebSearch.BaseURL + "/health"
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create health check request: %w", err)
+	if len(w.backends) == 0 {
+		return fmt.Errorf("no web search backends configured")
 	}
 
-	resp, err := w.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("health check request failed: %w", err)
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Failed to close response body: %v", err)
+	var failures []string
+	for _, backend := range w.backends {
+		if err := backend.provider.CheckHealth(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", backend.name, err))
 		}
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("health check failed with status %d", resp.StatusCode)
 	}
 
-	var healthResp HealthResponse
-	if err := json.NewDecoder(resp.Body).Decode(&healthResp); err != nil {
-		return fmt.Errorf("failed to decode health response: %w", err)
+	if len(failures) == len(w.backends) {
+		return fmt.Errorf("all web search backends failed: %s", strings.Join(failures, "; "))
+	}
+	for _, failure := range failures {
+		log.Printf("Web search backend unhealthy, will fall back: %s", failure)
 	}
+	return nil
+}
 
-	if healthResp.Status != "healthy" {
-		return fmt.Errorf("API reported unhealthy status: %s", healthResp.Status)
+// firstSuccess calls op on each backend in order and returns the first result.
+// Backends returning ErrWebSearchUnsupported are skipped without being counted as failures.
+func (w *WebSearchClient) firstSuccess(operation string, op func(interfaces.WebSearchProvider) (string, error)) (string, error) {
+	var lastErr error
+	for _, backend := range w.backends {
+		result, err := op(backend.provider)
+		if err == nil {
+			return result, nil
+		}
+		if errors.Is(err, ErrWebSearchUnsupported) {
+			continue
+		}
+		log.Printf("Web search backend %s failed to %s, trying next: %v", backend.name, operation, err)
+		lastErr = err
 	}
 
-	return nil
+	if lastErr == nil {
+		return "", fmt.Errorf("no configured web search backend can %s", operation)
+	}
+	return "", lastErr
 }
 
 // DecideWebSearch uses the user's preferred model to determine if web search is needed
@@ -243,47 +289,14 @@ func (w *WebSearchClient) DecideWebSearch(ctx context.Context, llmClient *llm.LL
 		Content: userContent,
 	})
 
-	// Get response from LLM, with manual fallback handling for in-stream errors
-	responseContent, err := w.getDecisionFromModel(ctx, llmClient, model, messages)
-	if err != nil {
-		// Check if the error warrants a fallback
-		if llmClient.ShouldFallback(err) {
-			log.Printf("Web search decider failed with primary model %s, attempting fallback: %v", model, err)
-			fallbackModel := config.DefaultFallbackModel
-			if w.config.WebSearch.FallbackModel != "" && w.config.WebSearch.FallbackModel != fallbackModel {
-				log.Printf("Overriding configured web search fallback %s with %s per global policy", w.config.WebSearch.FallbackModel, fallbackModel)
-			}
-			log.Printf("Attempting web search decider with fallback model %s", fallbackModel)
-			responseContent, err = w.getDecisionFromModel(ctx, llmClient, fallbackModel, messages)
-			if err != nil {
-				return nil, fmt.Errorf("web search decider failed with both primary and fallback models: %w", err)
-			}
-			log.Printf("Successfully used fallback model %s for web search decision", fallbackModel)
-		} else {
-			// Non-fallbackable error
-			return nil, fmt.Errorf("web search decider failed with non-fallbackable error: %w", err)
-		}
-	}
-
-	// Parse JSON response
+	// Ask for a schema-constrained decision; invalid replies are re-asked before falling back
 	var decision WebSearchDecision
-	responseText := strings.TrimSpace(responseContent)
-
-	// Extract JSON from response (in case there's extra text)
-	startIdx := strings.Index(responseText, "{")
-	endIdx := strings.LastIndex(responseText, "}")
-	if startIdx == -1 || endIdx == -1 {
-		return nil, fmt.Errorf("no valid JSON found in response: %s", responseText)
+	fallbackResult, err := llmClient.GetStructuredCompletionWithFallback(ctx, messages, model, w.config.WebSearch.FallbackModel, webSearchDecisionSchema, &decision)
+	if err != nil {
+		return nil, fmt.Errorf("web search decider failed: %w", err)
 	}
-
-	jsonStr := responseText[startIdx : endIdx+1]
-
-	// Clean common JSON formatting issues
-	jsonStr = strings.ReplaceAll(jsonStr, ",]", "]") // Remove trailing commas in arrays
-	jsonStr = strings.ReplaceAll(jsonStr, ",}", "}") // Remove trailing commas in objects
-
-	if err := json.Unmarshal([]byte(jsonStr), &decision); err != nil {
-		return nil, fmt.Errorf("failed to parse web search decision JSON: %w. JSON: %s", err, jsonStr)
+	if fallbackResult.UsedFallback {
+		log.Printf("Web search decider used fallback model %s (%s failed: %v)", fallbackResult.FallbackModel, model, fallbackResult.OriginalError)
 	}
 
 	return &decision, nil
@@ -291,106 +304,14 @@ func (w *WebSearchClient) DecideWebSearch(ctx context.Context, llmClient *llm.LL
 
 // SearchMultiple performs multiple web searches and combines results
 func (w *WebSearchClient) SearchMultiple(ctx context.Context, queries []string) (string, error) {
-	if len(queries) == 0 {
-		return "", fmt.Errorf("no search queries provided")
-	}
-
-	// Prepare a slice to hold results in the same order as the queries
-	results := make([]string, len(queries))
-
-	// Launch concurrent searches
-	var wg sync.WaitGroup
-	for idx, q := range queries {
-		wg.Add(1)
-
-		// Capture loop variables
-		i := idx
-		query := q
-
-		go func() {
-			defer wg.Done()
-
-			res, err := w.Search(ctx, query)
-			if err != nil {
-				results[i] = fmt.Sprintf("Error searching for '%s': %v\n", query, err)
-				return
-			}
-			results[i] = res
-		}()
-	}
-
-	// Wait for all searches to complete
-	wg.Wait()
-
-	// Combine results in original order
-	allResults := builderPool.Get().(*strings.Builder)
-	defer func() {
-		allResults.Reset()
-		builderPool.Put(allResults)
-	}()
-	for i, res := range results {
-		if i > 0 {
-			allResults.WriteString("\n\n--- Search Query " + fmt.Sprintf("%d", i+1) + " ---\n")
-		}
-		allResults.WriteString(res)
-	}
-
-	return allResults.String(), nil
+	return searchEach(ctx, w.Search, queries)
 }
 
 // Search performs a web search and returns formatted results
 func (w *WebSearchClient) Search(ctx context.Context, query string) (string, error) {
-	// Prepare request
-	searchReq := SearchRequest{
-		Query:         query,
-		MaxResults:    w.config.WebSearch.MaxResults,
-		MaxCharPerURL: w.config.WebSearch.MaxChars,
-	}
-
-	// Convert to JSON
-	jsonData, err := json.Marshal(searchReq)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	// Create HTTP request
-	url := w.config.WebSearch.BaseURL + "/search"
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	// Make request
-	resp, err := w.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Failed to close response body: %v", err)
-		}
-	}()
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("web search API returned status %d", resp.StatusCode)
-	}
-
-	// Parse response
-	var searchResp FinalResponsePayload
-	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	// Check for API error
-	if searchResp.Error != nil {
-		return "", fmt.Errorf("web search API error: %s", *searchResp.Error)
-	}
-
-	// Format results using the formatter
-	return w.formatter.FormatSearchResults(&searchResp), nil
+	return w.firstSuccess("search", func(p interfaces.WebSearchProvider) (string, error) {
+		return p.Search(ctx, query)
+	})
 }
 
 // ExtractURLs extracts content from the provided URLs
@@ -431,47 +352,9 @@ func (w *WebSearchClient) ExtractURLs(ctx context.Context, urls []string) (strin
 			return nil, fmt.Errorf("too many URLs after expanding playlists: maximum %d URLs per request, got %d", w.config.WebSearch.MaxURLsPerExtract, len(processedURLs))
 		}
 
-		extractReq := ExtractRequest{
-			URLs:          processedURLs,
-			MaxCharPerURL: w.config.WebSearch.MaxChars,
-		}
-
-		jsonData, err := json.Marshal(extractReq)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request: %w", err)
-		}
-
-		url := w.config.WebSearch.BaseURL + "/extract"
-		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := w.httpClient.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to make request: %w", err)
-		}
-		defer func() {
-			if err := resp.Body.Close(); err != nil {
-				log.Printf("Failed to close response body: %v", err)
-			}
-		}()
-
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("URL extract API returned status %d", resp.StatusCode)
-		}
-
-		var extractResp ExtractResponsePayload
-		if err := json.NewDecoder(resp.Body).Decode(&extractResp); err != nil {
-			return nil, fmt.Errorf("failed to decode response: %w", err)
-		}
-
-		if extractResp.Error != nil {
-			return nil, fmt.Errorf("URL extract API error: %s", *extractResp.Error)
-		}
-
-		return w.formatter.FormatExtractResults(&extractResp), nil
+		return w.firstSuccess("extract URLs", func(p interfaces.WebSearchProvider) (string, error) {
+			return p.ExtractURLs(ctx, processedURLs, "")
+		})
 	})
 
 	if err != nil {
@@ -556,34 +439,3 @@ func isLikelyFilename(s string) bool {
 
 	return false
 }
-func (w *WebSearchClient) getDecisionFromModel(ctx context.Context, llmClient *llm.LLMClient, model string, messages []messaging.OpenAIMessage) (string, error) {
-	stream, err := llmClient.StreamChatCompletion(ctx, model, messages, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to start stream with model %s: %w", model, err)
-	}
-
-	responseContent := builderPool.Get().(*strings.Builder)
-	defer func() {
-		responseContent.Reset()
-		builderPool.Put(responseContent)
-	}()
-
-	for response := range stream {
-		if response.Error != nil {
-			// Return the original error without wrapping to preserve its type
-			return "", response.Error
-		}
-		if response.Content != "" {
-			responseContent.WriteString(response.Content)
-		}
-		if response.FinishReason != "" {
-			break
-		}
-	}
-
-	if responseContent.Len() == 0 {
-		return "", fmt.Errorf("received empty response from model %s", model)
-	}
-
-	return responseContent.String(), nil
-}
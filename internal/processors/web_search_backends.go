@@ -0,0 +1,173 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+)
+
+// ErrWebSearchUnsupported is returned by backends for operations they don't provide,
+// such as extraction on a search-only API. The client moves on to the next backend.
+var ErrWebSearchUnsupported = errors.New("operation not supported by this web search backend")
+
+// WebSearchBackendFactory creates a backend from its web_search.backends entry
+type WebSearchBackendFactory func(backend config.WebSearchBackend, cfg *config.Config, httpClient *http.Client) (interfaces.WebSearchProvider, error)
+
+var (
+	webSearchBackendsMu sync.RWMutex
+	webSearchBackends   = map[string]WebSearchBackendFactory{
+		config.WebSearchBackendRAGForge:    newRAGForgeBackend,
+		config.WebSearchBackendSearXNG:     newSearXNGBackend,
+		config.WebSearchBackendBrave:       newBraveBackend,
+		config.WebSearchBackendBing:        newBingBackend,
+		config.WebSearchBackendReadability: newReadabilityBackendProvider,
+	}
+)
+
+// RegisterWebSearchBackend makes a backend type selectable in web_search.backends,
+// replacing any existing factory for that type
+func RegisterWebSearchBackend(backendType string, factory WebSearchBackendFactory) {
+	webSearchBackendsMu.Lock()
+	defer webSearchBackendsMu.Unlock()
+	webSearchBackends[strings.ToLower(backendType)] = factory
+}
+
+// namedBackend pairs a backend with its type for logging
+type namedBackend struct {
+	name     string
+	provider interfaces.WebSearchProvider
+}
+
+// newWebSearchBackends creates the configured backends in order. Entries with an
+// unknown type or invalid settings are logged and skipped.
+func newWebSearchBackends(cfg *config.Config, httpClient *http.Client) ([]namedBackend, []error) {
+	webSearchBackendsMu.RLock()
+	defer webSearchBackendsMu.RUnlock()
+
+	var backends []namedBackend
+	var errs []error
+	for i, backend := range cfg.WebSearch.Backends {
+		backendType := strings.ToLower(strings.TrimSpace(backend.Type))
+		factory, ok := webSearchBackends[backendType]
+		if !ok {
+			errs = append(errs, fmt.Errorf("web_search.backends[%d]: unknown type %q", i, backend.Type))
+			continue
+		}
+		provider, err := factory(backend, cfg, httpClient)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("web_search.backends[%d] (%s): %w", i, backendType, err))
+			continue
+		}
+		backends = append(backends, namedBackend{name: backendType, provider: provider})
+	}
+	return backends, errs
+}
+
+// searchEach runs search for every query concurrently and joins the results in query order
+func searchEach(ctx context.Context, search func(context.Context, string) (string, error), queries []string) (string, error) {
+	if len(queries) == 0 {
+		return "", fmt.Errorf("no search queries provided")
+	}
+
+	// Prepare a slice to hold results in the same order as the queries
+	results := make([]string, len(queries))
+
+	// Launch concurrent searches
+	var wg sync.WaitGroup
+	for idx, q := range queries {
+		wg.Add(1)
+
+		// Capture loop variables
+		i := idx
+		query := q
+
+		go func() {
+			defer wg.Done()
+
+			res, err := search(ctx, query)
+			if err != nil {
+				results[i] = fmt.Sprintf("Error searching for '%s': %v\n", query, err)
+				return
+			}
+			results[i] = res
+		}()
+	}
+
+	// Wait for all searches to complete
+	wg.Wait()
+
+	// Combine results in original order
+	allResults := builderPool.Get().(*strings.Builder)
+	defer func() {
+		allResults.Reset()
+		builderPool.Put(allResults)
+	}()
+	for i, res := range results {
+		if i > 0 {
+			allResults.WriteString("\n\n--- Search Query " + fmt.Sprintf("%d", i+1) + " ---\n")
+		}
+		allResults.WriteString(res)
+	}
+
+	return allResults.String(), nil
+}
+
+// searchHit is one result from a search API before its page is fetched
+type searchHit struct {
+	URL     string
+	Title   string
+	Snippet string
+}
+
+// hitsToPayload converts search API hits into the RAG-Forge search payload so all
+// backends share one formatter. Unless snippetsOnly is set, each hit's page is
+// extracted and its text replaces the snippet; hits whose page can't be read keep the snippet.
+func hitsToPayload(ctx context.Context, query string, hits []searchHit, maxResults int, pages *readabilityBackend, snippetsOnly bool) *FinalResponsePayload {
+	if maxResults > 0 && len(hits) > maxResults {
+		hits = hits[:maxResults]
+	}
+
+	payload := &FinalResponsePayload{}
+	payload.QueryDetails.Query = query
+	payload.QueryDetails.MaxResultsRequested = maxResults
+	payload.QueryDetails.ActualResultsFound = len(hits)
+	payload.Results = make([]ExtractedResult, len(hits))
+
+	var wg sync.WaitGroup
+	for i, hit := range hits {
+		payload.Results[i] = ExtractedResult{
+			URL:                   hit.URL,
+			SourceType:            "webpage",
+			ProcessedSuccessfully: true,
+			Data: map[string]interface{}{
+				"title":        hit.Title,
+				"text_content": hit.Snippet,
+			},
+		}
+		if snippetsOnly || pages == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, hit searchHit) {
+			defer wg.Done()
+			result := pages.extract(ctx, hit.URL)
+			if !result.ProcessedSuccessfully {
+				return
+			}
+			if data, ok := result.Data.(map[string]interface{}); ok && data["title"] == "" {
+				data["title"] = hit.Title
+			}
+			payload.Results[i] = result
+		}(i, hit)
+	}
+	wg.Wait()
+
+	return payload
+}
@@ -0,0 +1,235 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+)
+
+// Public endpoints used when a brave or bing backend has no base_url
+const (
+	defaultBraveBaseURL = "https://api.search.brave.com/res/v1/web/search"
+	defaultBingBaseURL  = "https://api.bing.microsoft.com/v7.0/search"
+)
+
+// searchEngineBackend searches with a REST search API and reads result pages natively.
+// Engines differ only in how requests are authenticated and results decoded.
+type searchEngineBackend struct {
+	name         string
+	endpoint     string
+	healthURL    string // Empty when the API has no free health endpoint
+	maxResults   int
+	snippetsOnly bool
+	httpClient   *http.Client
+	formatter    *WebSearchResultFormatter
+	pages        *readabilityBackend
+
+	// newRequest builds the search request for a query
+	newRequest func(ctx context.Context, query string) (*http.Request, error)
+	// decode reads search hits from a response body
+	decode func(body []byte) ([]searchHit, error)
+}
+
+var _ interfaces.WebSearchProvider = (*searchEngineBackend)(nil)
+
+// newSearchEngineBackend fills in the fields shared by every search engine
+func newSearchEngineBackend(name, endpoint string, backend config.WebSearchBackend, cfg *config.Config, httpClient *http.Client) *searchEngineBackend {
+	return &searchEngineBackend{
+		name:         name,
+		endpoint:     endpoint,
+		maxResults:   cfg.WebSearch.MaxResults,
+		snippetsOnly: backend.SnippetsOnly,
+		httpClient:   httpClient,
+		formatter:    NewWebSearchResultFormatter(),
+		pages:        newReadabilityBackend(cfg, httpClient),
+	}
+}
+
+// newSearXNGBackend creates a backend for a SearXNG instance with the JSON format enabled
+func newSearXNGBackend(backend config.WebSearchBackend, cfg *config.Config, httpClient *http.Client) (interfaces.WebSearchProvider, error) {
+	if backend.BaseURL == "" {
+		return nil, fmt.Errorf("base_url is required")
+	}
+	baseURL := strings.TrimSuffix(backend.BaseURL, "/")
+
+	e := newSearchEngineBackend(config.WebSearchBackendSearXNG, baseURL+"/search", backend, cfg, httpClient)
+	e.healthURL = baseURL + "/healthz"
+	e.newRequest = func(ctx context.Context, query string) (*http.Request, error) {
+		params := url.Values{"q": {query}, "format": {"json"}}
+		return http.NewRequestWithContext(ctx, "GET", e.endpoint+"?"+params.Encode(), nil)
+	}
+	e.decode = func(body []byte) ([]searchHit, error) {
+		var resp struct {
+			Results []struct {
+				URL     string `json:"url"`
+				Title   string `json:"title"`
+				Content string `json:"content"`
+			} `json:"results"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		hits := make([]searchHit, 0, len(resp.Results))
+		for _, r := range resp.Results {
+			hits = append(hits, searchHit{URL: r.URL, Title: r.Title, Snippet: r.Content})
+		}
+		return hits, nil
+	}
+	return e, nil
+}
+
+// newBraveBackend creates a backend for the Brave Search API
+func newBraveBackend(backend config.WebSearchBackend, cfg *config.Config, httpClient *http.Client) (interfaces.WebSearchProvider, error) {
+	if backend.APIKey == "" {
+		return nil, fmt.Errorf("api_key is required")
+	}
+	endpoint := backend.BaseURL
+	if endpoint == "" {
+		endpoint = defaultBraveBaseURL
+	}
+
+	e := newSearchEngineBackend(config.WebSearchBackendBrave, endpoint, backend, cfg, httpClient)
+	e.newRequest = func(ctx context.Context, query string) (*http.Request, error) {
+		params := url.Values{"q": {query}, "count": {strconv.Itoa(e.maxResults)}}
+		req, err := http.NewRequestWithContext(ctx, "GET", e.endpoint+"?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-Subscription-Token", backend.APIKey)
+		return req, nil
+	}
+	e.decode = func(body []byte) ([]searchHit, error) {
+		var resp struct {
+			Web struct {
+				Results []struct {
+					URL         string `json:"url"`
+					Title       string `json:"title"`
+					Description string `json:"description"`
+				} `json:"results"`
+			} `json:"web"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		hits := make([]searchHit, 0, len(resp.Web.Results))
+		for _, r := range resp.Web.Results {
+			// Brave highlights matches with <strong> tags
+			hits = append(hits, searchHit{URL: r.URL, Title: stripTags(r.Title), Snippet: stripTags(r.Description)})
+		}
+		return hits, nil
+	}
+	return e, nil
+}
+
+// newBingBackend creates a backend for the Bing Web Search API
+func newBingBackend(backend config.WebSearchBackend, cfg *config.Config, httpClient *http.Client) (interfaces.WebSearchProvider, error) {
+	if backend.APIKey == "" {
+		return nil, fmt.Errorf("api_key is required")
+	}
+	endpoint := backend.BaseURL
+	if endpoint == "" {
+		endpoint = defaultBingBaseURL
+	}
+
+	e := newSearchEngineBackend(config.WebSearchBackendBing, endpoint, backend, cfg, httpClient)
+	e.newRequest = func(ctx context.Context, query string) (*http.Request, error) {
+		params := url.Values{"q": {query}, "count": {strconv.Itoa(e.maxResults)}, "responseFilter": {"Webpages"}}
+		req, err := http.NewRequestWithContext(ctx, "GET", e.endpoint+"?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Ocp-Apim-Subscription-Key", backend.APIKey)
+		return req, nil
+	}
+	e.decode = func(body []byte) ([]searchHit, error) {
+		var resp struct {
+			WebPages struct {
+				Value []struct {
+					URL     string `json:"url"`
+					Name    string `json:"name"`
+					Snippet string `json:"snippet"`
+				} `json:"value"`
+			} `json:"webPages"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		hits := make([]searchHit, 0, len(resp.WebPages.Value))
+		for _, r := range resp.WebPages.Value {
+			hits = append(hits, searchHit{URL: r.URL, Title: r.Name, Snippet: r.Snippet})
+		}
+		return hits, nil
+	}
+	return e, nil
+}
+
+// CheckHealth checks the engine's health endpoint. Paid APIs have none that's free
+// to call, so they only fail once a search does.
+func (e *searchEngineBackend) CheckHealth(ctx context.Context) error {
+	if e.healthURL == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", e.healthURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Failed to close response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Search queries the engine and formats the hits, with page text unless snippets_only is set
+func (e *searchEngineBackend) Search(ctx context.Context, query string) (string, error) {
+	req, err := e.newRequest(ctx, query)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	body, status, err := readResponse(e.httpClient, req, maxSearchResponseBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to make request: %w", err)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("%s search returned status %d", e.name, status)
+	}
+
+	hits, err := e.decode(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s response: %w", e.name, err)
+	}
+
+	payload := hitsToPayload(ctx, query, hits, e.maxResults, e.pages, e.snippetsOnly)
+	return e.formatter.FormatSearchResults(payload), nil
+}
+
+// SearchMultiple performs multiple searches concurrently and combines the results
+func (e *searchEngineBackend) SearchMultiple(ctx context.Context, queries []string) (string, error) {
+	return searchEach(ctx, e.Search, queries)
+}
+
+// ExtractURLs is left to extraction backends
+func (e *searchEngineBackend) ExtractURLs(context.Context, []string, string) (string, error) {
+	return "", ErrWebSearchUnsupported
+}
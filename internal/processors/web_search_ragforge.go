@@ -0,0 +1,157 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+)
+
+// ragForgeBackend talks to a RAG-Forge API, which searches and extracts YouTube,
+// Reddit, Twitter, PDF and web pages itself
+type ragForgeBackend struct {
+	baseURL    string
+	maxResults int
+	maxChars   int
+	httpClient *http.Client
+	formatter  *WebSearchResultFormatter
+}
+
+var _ interfaces.WebSearchProvider = (*ragForgeBackend)(nil)
+
+// newRAGForgeBackend creates a RAG-Forge backend, defaulting to web_search.base_url
+func newRAGForgeBackend(backend config.WebSearchBackend, cfg *config.Config, httpClient *http.Client) (interfaces.WebSearchProvider, error) {
+	baseURL := backend.BaseURL
+	if baseURL == "" {
+		baseURL = cfg.WebSearch.BaseURL
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("base_url is required")
+	}
+
+	return &ragForgeBackend{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		maxResults: cfg.WebSearch.MaxResults,
+		maxChars:   cfg.WebSearch.MaxChars,
+		httpClient: httpClient,
+		formatter:  NewWebSearchResultFormatter(),
+	}, nil
+}
+
+// CheckHealth checks the RAG-Forge /health endpoint
+func (r *ragForgeBackend) CheckHealth(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", r.baseURL+"/health", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Failed to close response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check failed with status %d", resp.StatusCode)
+	}
+
+	var healthResp HealthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&healthResp); err != nil {
+		return fmt.Errorf("failed to decode health response: %w", err)
+	}
+
+	if healthResp.Status != "healthy" {
+		return fmt.Errorf("API reported unhealthy status: %s", healthResp.Status)
+	}
+
+	return nil
+}
+
+// Search performs a web search through RAG-Forge's /search endpoint
+func (r *ragForgeBackend) Search(ctx context.Context, query string) (string, error) {
+	searchReq := SearchRequest{
+		Query:         query,
+		MaxResults:    r.maxResults,
+		MaxCharPerURL: r.maxChars,
+	}
+
+	var searchResp FinalResponsePayload
+	if err := r.post(ctx, "/search", searchReq, &searchResp); err != nil {
+		return "", err
+	}
+
+	// Check for API error
+	if searchResp.Error != nil {
+		return "", fmt.Errorf("web search API error: %s", *searchResp.Error)
+	}
+
+	return r.formatter.FormatSearchResults(&searchResp), nil
+}
+
+// SearchMultiple performs multiple searches concurrently and combines the results
+func (r *ragForgeBackend) SearchMultiple(ctx context.Context, queries []string) (string, error) {
+	return searchEach(ctx, r.Search, queries)
+}
+
+// ExtractURLs extracts content through RAG-Forge's /extract endpoint
+func (r *ragForgeBackend) ExtractURLs(ctx context.Context, urls []string, _ string) (string, error) {
+	extractReq := ExtractRequest{
+		URLs:          urls,
+		MaxCharPerURL: r.maxChars,
+	}
+
+	var extractResp ExtractResponsePayload
+	if err := r.post(ctx, "/extract", extractReq, &extractResp); err != nil {
+		return "", err
+	}
+
+	if extractResp.Error != nil {
+		return "", fmt.Errorf("URL extract API error: %s", *extractResp.Error)
+	}
+
+	return r.formatter.FormatExtractResults(&extractResp), nil
+}
+
+// post sends a JSON request to a RAG-Forge endpoint and decodes the JSON response
+func (r *ragForgeBackend) post(ctx context.Context, endpoint string, body, out interface{}) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.baseURL+endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Failed to close response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("RAG-Forge %s returned status %d", endpoint, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,522 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+)
+
+const (
+	// maxPageBytes caps how much of a page is downloaded for extraction
+	maxPageBytes = 5 << 20
+	// maxSearchResponseBytes caps a search API response
+	maxSearchResponseBytes = 2 << 20
+	// maxPageRedirects matches net/http's default redirect limit
+	maxPageRedirects = 10
+	// pageUserAgent is sent when fetching pages; some sites reject Go's default
+	pageUserAgent = "Mozilla/5.0 (compatible; DiscordAIChatbot/1.0; +https://github.com/anojndr/DiscordAIChatbot)"
+)
+
+var (
+	// unlikelyCandidates matches class and id names of page chrome rather than content
+	unlikelyCandidates = regexp.MustCompile(`(?i)comment|sidebar|footer|header|menu|nav|share|social|advert|promo|cookie|banner|related|popup|subscribe|newsletter|breadcrumb`)
+	// maybeCandidate matches class and id names that can hold content despite matching unlikelyCandidates
+	maybeCandidate = regexp.MustCompile(`(?i)article|content|main|body|post|entry|story|text`)
+	// blankLines matches runs of blank lines left after removing markup
+	blankLines = regexp.MustCompile(`\n\s*\n\s*\n+`)
+)
+
+// readabilityBackend fetches pages directly and keeps their main text, for
+// extraction without RAG-Forge. It doesn't search.
+type readabilityBackend struct {
+	maxChars   int
+	httpClient *http.Client
+	formatter  *WebSearchResultFormatter
+
+	// allowPrivateHosts permits loopback and private addresses; only for tests
+	allowPrivateHosts bool
+}
+
+var _ interfaces.WebSearchProvider = (*readabilityBackend)(nil)
+
+// newReadabilityBackend creates a page extractor whose requests and redirects
+// never reach loopback, private or link-local addresses
+func newReadabilityBackend(cfg *config.Config, httpClient *http.Client) *readabilityBackend {
+	r := &readabilityBackend{
+		maxChars:  cfg.WebSearch.MaxChars,
+		formatter: NewWebSearchResultFormatter(),
+	}
+
+	client := *httpClient
+	client.Transport = r.guardedTransport(httpClient.Transport)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxPageRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxPageRedirects)
+		}
+		return checkURL(req.URL)
+	}
+	r.httpClient = &client
+	return r
+}
+
+// guardedTransport copies base so that every connection, including those of redirects, is
+// checked against the address it actually dials. Checking a separate DNS lookup instead would
+// let a host resolve to a public address for the check and an internal one for the request.
+// Proxies and custom dialers are dropped since they would hide the dialed address.
+func (r *readabilityBackend) guardedTransport(base http.RoundTripper) *http.Transport {
+	transport, ok := base.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	transport.Proxy = nil
+	transport.DialTLSContext = nil
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   r.checkDial,
+	}
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// newReadabilityBackendProvider is the registry factory for the readability backend
+func newReadabilityBackendProvider(_ config.WebSearchBackend, cfg *config.Config, httpClient *http.Client) (interfaces.WebSearchProvider, error) {
+	return newReadabilityBackend(cfg, httpClient), nil
+}
+
+// CheckHealth always succeeds; there's no service to check
+func (r *readabilityBackend) CheckHealth(context.Context) error {
+	return nil
+}
+
+// Search is left to search backends
+func (r *readabilityBackend) Search(context.Context, string) (string, error) {
+	return "", ErrWebSearchUnsupported
+}
+
+// SearchMultiple is left to search backends
+func (r *readabilityBackend) SearchMultiple(context.Context, []string) (string, error) {
+	return "", ErrWebSearchUnsupported
+}
+
+// ExtractURLs fetches the pages concurrently and formats their main text
+func (r *readabilityBackend) ExtractURLs(ctx context.Context, urls []string, _ string) (string, error) {
+	resp := &ExtractResponsePayload{Results: make([]ExtractedResult, len(urls))}
+	resp.RequestDetails.URLsRequested = len(urls)
+
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			resp.Results[i] = r.extract(ctx, u)
+		}(i, u)
+	}
+	wg.Wait()
+
+	for _, result := range resp.Results {
+		if result.ProcessedSuccessfully {
+			resp.RequestDetails.URLsProcessed++
+		}
+	}
+	if resp.RequestDetails.URLsProcessed == 0 && len(urls) > 0 {
+		// Let the client try the next backend rather than reporting only failures
+		return "", fmt.Errorf("no URLs could be extracted: %s", *resp.Results[0].Error)
+	}
+
+	return r.formatter.FormatExtractResults(resp), nil
+}
+
+// extract fetches one page and returns its title and main text as a webpage result
+func (r *readabilityBackend) extract(ctx context.Context, pageURL string) ExtractedResult {
+	result := ExtractedResult{URL: pageURL, SourceType: "webpage"}
+	title, text, err := r.fetch(ctx, pageURL)
+	if err != nil {
+		msg := err.Error()
+		result.Error = &msg
+		return result
+	}
+
+	result.ProcessedSuccessfully = true
+	result.Data = map[string]interface{}{
+		"title":        title,
+		"text_content": truncateText(text, r.maxChars),
+	}
+	return result
+}
+
+// fetch downloads a page and returns its title and readable text
+func (r *readabilityBackend) fetch(ctx context.Context, pageURL string) (string, string, error) {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if err := checkURL(parsed); err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", parsed.String(), nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", pageUserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,*/*;q=0.5")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch page: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Failed to close response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("page returned status %d", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	body := io.LimitReader(resp.Body, maxPageBytes)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml" || mediaType == "":
+		doc, err := html.Parse(body)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to parse page: %w", err)
+		}
+		title, text := readableText(doc)
+		return title, text, nil
+	case strings.HasPrefix(mediaType, "text/"):
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read page: %w", err)
+		}
+		return "", strings.ToValidUTF8(string(data), ""), nil
+	default:
+		return "", "", fmt.Errorf("unsupported content type %s", mediaType)
+	}
+}
+
+// checkURL rejects non-HTTP URLs
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// checkDial is the dialer's Control hook. It runs on the resolved address right before
+// connecting and refuses loopback, private and link-local addresses.
+func (r *readabilityBackend) checkDial(_, address string, _ syscall.RawConn) error {
+	if r.allowPrivateHosts {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %s: %w", address, err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("refusing to connect to unresolved address %s", host)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("refusing to fetch internal address %s", ip)
+	}
+	return nil
+}
+
+// readableText returns a document's title and the text of its main content.
+// An <article> or <main> element is used when present; otherwise the container
+// with the most paragraph text, discounted by link density, wins.
+func readableText(doc *html.Node) (string, string) {
+	title := documentTitle(doc)
+	pruneNode(doc)
+
+	body := findFirst(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+
+	content := bestOf(findAll(body, atom.Article, atom.Main))
+	if content == nil {
+		content = topCandidate(body)
+	}
+	if content == nil {
+		content = body
+	}
+
+	return title, renderText(content)
+}
+
+// documentTitle prefers og:title over <title>, which often carries the site name
+func documentTitle(doc *html.Node) string {
+	for _, meta := range findAll(doc, atom.Meta) {
+		if attr(meta, "property") == "og:title" {
+			if title := strings.TrimSpace(attr(meta, "content")); title != "" {
+				return title
+			}
+		}
+	}
+	if title := findFirst(doc, atom.Title); title != nil {
+		return collapseSpace(nodeText(title))
+	}
+	return ""
+}
+
+// pruneNode removes scripts, styles, forms and page chrome in place
+func pruneNode(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && isChrome(c)) {
+			n.RemoveChild(c)
+		} else {
+			pruneNode(c)
+		}
+		c = next
+	}
+}
+
+// isChrome reports whether an element is non-content markup or looks like page chrome
+func isChrome(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Svg, atom.Iframe,
+		atom.Nav, atom.Aside, atom.Footer, atom.Form, atom.Button, atom.Select, atom.Head:
+		return true
+	case atom.Body, atom.Article, atom.Main:
+		return false
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	return strings.TrimSpace(names) != "" && unlikelyCandidates.MatchString(names) && !maybeCandidate.MatchString(names)
+}
+
+// topCandidate scores paragraphs' ancestors by their text and returns the best container
+func topCandidate(root *html.Node) *html.Node {
+	scores := make(map[*html.Node]float64)
+	for _, p := range findAll(root, atom.P, atom.Pre, atom.Td, atom.Blockquote) {
+		text := collapseSpace(nodeText(p))
+		if utf8.RuneCountInString(text) < 25 {
+			continue
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+
+		// The parent gets the full score and the grandparent half
+		if parent := p.Parent; parent != nil {
+			scores[parent] += score
+			if grandparent := parent.Parent; grandparent != nil {
+				scores[grandparent] += score / 2
+			}
+		}
+	}
+
+	var best *html.Node
+	var bestScore float64
+	for node, score := range scores {
+		score *= 1 - linkDensity(node)
+		if score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
+
+// bestOf returns the node with the most text, or nil for none
+func bestOf(nodes []*html.Node) *html.Node {
+	var best *html.Node
+	bestLen := 0
+	for _, n := range nodes {
+		if l := len(collapseSpace(nodeText(n))); l > bestLen {
+			best, bestLen = n, l
+		}
+	}
+	return best
+}
+
+// linkDensity returns the share of a node's text that sits inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(collapseSpace(nodeText(n)))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	for _, a := range findAll(n, atom.A) {
+		linked += len(collapseSpace(nodeText(a)))
+	}
+	return float64(linked) / float64(total)
+}
+
+// renderText flattens a node into text with a line break around every block element
+func renderText(n *html.Node) string {
+	var builder strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			builder.WriteString(collapseSpace(n.Data))
+			builder.WriteString(" ")
+			return
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Br:
+				builder.WriteString("\n")
+				return
+			case atom.Pre:
+				builder.WriteString("\n" + nodeText(n) + "\n")
+				return
+			case atom.Li:
+				builder.WriteString("\n- ")
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				builder.WriteString("\n\n" + strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+
+		if n.Type == html.ElementNode && isBlock(n.DataAtom) {
+			builder.WriteString("\n\n")
+		}
+	}
+	walk(n)
+
+	lines := strings.Split(builder.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// isBlock reports whether an element starts a new block of text
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Ul, atom.Ol,
+		atom.Table, atom.Tr, atom.Blockquote, atom.Figure, atom.Figcaption, atom.Dl, atom.Dt, atom.Dd,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return true
+	}
+	return false
+}
+
+// findFirst returns the first element of the given type in document order
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findFirst(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns every element of the given types in document order
+func findAll(n *html.Node, atoms ...atom.Atom) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, a := range atoms {
+				if n.DataAtom == a {
+					found = append(found, n)
+					break
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// nodeText concatenates all text below a node
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var builder strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		builder.WriteString(nodeText(c))
+	}
+	return builder.String()
+}
+
+// attr returns an attribute's value, or "" when missing
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// collapseSpace replaces runs of whitespace with one space and trims the ends
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// stripTags returns the text of an HTML fragment, such as a search snippet with highlighting
+func stripTags(fragment string) string {
+	if !strings.Contains(fragment, "<") && !strings.Contains(fragment, "&") {
+		return fragment
+	}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+	if err != nil {
+		return fragment
+	}
+	var builder strings.Builder
+	for _, n := range nodes {
+		builder.WriteString(nodeText(n))
+	}
+	return collapseSpace(builder.String())
+}
+
+// truncateText cuts text to at most maxChars characters; zero or less means no limit
+func truncateText(text string, maxChars int) string {
+	if maxChars <= 0 || utf8.RuneCountInString(text) <= maxChars {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:maxChars]) + "…"
+}
+
+// readResponse sends a request and reads at most limit bytes of the response body
+func readResponse(client *http.Client, req *http.Request, limit int64) ([]byte, int, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Failed to close response body: %v", err)
+		}
+	}()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+	return body, resp.StatusCode, nil
+}
@@ -0,0 +1,67 @@
+package processors
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+func TestReadabilityCheckDial(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"10.0.0.1:80", false},
+		{"192.168.1.1:8080", false},
+		{"169.254.169.254:80", false},
+		{"[fe80::1]:80", false},
+		{"0.0.0.0:80", false},
+		{"example.com:80", false},
+	}
+
+	r := newReadabilityBackend(&config.Config{}, &http.Client{})
+	for _, tt := range tests {
+		err := r.checkDial("tcp", tt.address, nil)
+		if (err == nil) != tt.allowed {
+			t.Errorf("checkDial(%s) = %v, want allowed %v", tt.address, err, tt.allowed)
+		}
+	}
+}
+
+func TestReadabilityRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/scheme" {
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, "internal")
+	}))
+	defer server.Close()
+
+	r := newReadabilityBackend(&config.Config{}, &http.Client{})
+	if _, _, err := r.fetch(context.Background(), server.URL); err == nil || !strings.Contains(err.Error(), "internal address") {
+		t.Errorf("fetching a loopback server returned %v, want it refused", err)
+	}
+	if _, _, err := r.fetch(context.Background(), "ftp://example.com/file"); err == nil {
+		t.Error("fetching an FTP URL succeeded, want it refused")
+	}
+
+	r.allowPrivateHosts = true
+	if _, text, err := r.fetch(context.Background(), server.URL); err != nil || text != "internal" {
+		t.Errorf("got %q, %v with private hosts allowed, want the page", text, err)
+	}
+	if _, _, err := r.fetch(context.Background(), server.URL+"/scheme"); err == nil || !strings.Contains(err.Error(), "unsupported URL scheme") {
+		t.Errorf("following a redirect to a file URL returned %v, want it refused", err)
+	}
+}
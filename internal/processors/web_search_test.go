@@ -0,0 +1,425 @@
+package processors
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// articlePage has page chrome around an article, which readability should drop
+const articlePage = `<!DOCTYPE html>
+<html><head>
+<title>Site name | Cats</title>
+<meta property="og:title" content="All about cats">
+<script>var tracking = "script text";</script>
+<style>body { color: red; }</style>
+</head><body>
+<nav><a href="/">Home</a> <a href="/about">About</a></nav>
+<div class="sidebar">Sidebar text</div>
+<article>
+<h2>Sleeping</h2>
+<p>Cats sleep for most of the day, often between twelve and sixteen hours.</p>
+<ul><li>Whiskers</li><li>Paws</li></ul>
+</article>
+<footer>Footer text</footer>
+</body></html>`
+
+// linkFarmPage has no article element, so the paragraph-rich container must win over the link list
+const linkFarmPage = `<html><head><title>Dogs</title></head><body>
+<div id="links"><p><a href="/1">A link that is long enough to count as a paragraph here</a></p>
+<p><a href="/2">Another link that is long enough to count as a paragraph</a></p></div>
+<div id="story"><p>Dogs were domesticated from wolves, probably more than fifteen thousand years ago.</p>
+<p>They have lived alongside people, guarding, herding and hunting, ever since.</p></div>
+</body></html>`
+
+// newPageServer serves test pages by path
+func newPageServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = io.WriteString(w, articlePage)
+		case "/links":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = io.WriteString(w, linkFarmPage)
+		case "/plain":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = io.WriteString(w, "Just plain text.")
+		case "/moved":
+			http.Redirect(w, r, "/article", http.StatusMovedPermanently)
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write([]byte{0, 1, 2})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestReadabilityBackend creates a readability backend that may fetch test servers
+func newTestReadabilityBackend(maxChars int) *readabilityBackend {
+	cfg := &config.Config{}
+	cfg.WebSearch.MaxChars = maxChars
+	r := newReadabilityBackend(cfg, &http.Client{})
+	r.allowPrivateHosts = true
+	return r
+}
+
+func TestReadabilityFetch(t *testing.T) {
+	pages := newPageServer(t)
+	r := newTestReadabilityBackend(0)
+
+	tests := []struct {
+		path      string
+		wantTitle string
+		want      []string
+		wantNot   []string
+		wantErr   string
+	}{
+		{
+			path:      "/article",
+			wantTitle: "All about cats",
+			want:      []string{"## Sleeping", "Cats sleep for most of the day", "- Whiskers", "- Paws"},
+			wantNot:   []string{"Home", "Sidebar text", "Footer text", "script text", "color: red"},
+		},
+		{
+			path:      "/links",
+			wantTitle: "Dogs",
+			want:      []string{"domesticated from wolves", "guarding, herding"},
+			wantNot:   []string{"Another link"},
+		},
+		{path: "/plain", want: []string{"Just plain text."}},
+		{path: "/moved", wantTitle: "All about cats", want: []string{"Cats sleep"}},
+		{path: "/binary", wantErr: "unsupported content type"},
+		{path: "/missing", wantErr: "status 404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			title, text, err := r.fetch(context.Background(), pages.URL+tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetch: %v", err)
+			}
+			if title != tt.wantTitle {
+				t.Errorf("got title %q, want %q", title, tt.wantTitle)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("text is missing %q:\n%s", want, text)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(text, unwanted) {
+					t.Errorf("text contains %q:\n%s", unwanted, text)
+				}
+			}
+		})
+	}
+}
+
+func TestReadabilityExtractURLs(t *testing.T) {
+	pages := newPageServer(t)
+
+	r := newTestReadabilityBackend(20)
+	result, err := r.ExtractURLs(context.Background(), []string{pages.URL + "/article", pages.URL + "/missing"}, "")
+	if err != nil {
+		t.Fatalf("ExtractURLs: %v", err)
+	}
+	for _, want := range []string{
+		"Extracted content from 1 URL(s)",
+		"URL: " + pages.URL + "/article",
+		"Title: All about cats",
+		"## Sleeping\n\nCats sl…",
+		"URL: " + pages.URL + "/missing",
+		"Error: page returned status 404",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("result is missing %q:\n%s", want, result)
+		}
+	}
+
+	// Reporting nothing but failures lets the client try the next backend
+	if _, err := r.ExtractURLs(context.Background(), []string{pages.URL + "/missing"}, ""); err == nil {
+		t.Error("ExtractURLs succeeded without extracting any URL")
+	}
+}
+
+// ragForgeServer is a fake RAG-Forge API recording the requests it gets
+type ragForgeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	searches []SearchRequest
+	extracts []ExtractRequest
+}
+
+func newRAGForgeServer(t *testing.T, status int) *ragForgeServer {
+	s := &ragForgeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/health":
+			_, _ = io.WriteString(w, `{"status":"healthy","timestamp":"now"}`)
+		case "/search":
+			var req SearchRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			s.mu.Lock()
+			s.searches = append(s.searches, req)
+			s.mu.Unlock()
+			if req.Query == "fail" {
+				_, _ = io.WriteString(w, `{"error":"search engine unavailable"}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{"query_details":{"query":"`+req.Query+`","max_results_requested":2,"actual_results_found":1},`+
+				`"results":[{"url":"https://example.com/cats","source_type":"webpage","processed_successfully":true,`+
+				`"data":{"title":"Cats","text_content":"Cats are small carnivores."}}]}`)
+		case "/extract":
+			var req ExtractRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			s.mu.Lock()
+			s.extracts = append(s.extracts, req)
+			s.mu.Unlock()
+			_, _ = io.WriteString(w, `{"request_details":{"urls_requested":1,"urls_processed":1},`+
+				`"results":[{"url":"https://example.com/doc.pdf","source_type":"pdf","processed_successfully":true,`+
+				`"data":{"text_content":"PDF text"}}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// newTestWebSearchConfig returns a config using the given backends in order
+func newTestWebSearchConfig(backends ...config.WebSearchBackend) *config.Config {
+	cfg := &config.Config{}
+	cfg.WebSearch.MaxResults = 2
+	cfg.WebSearch.MaxChars = 1000
+	cfg.WebSearch.MaxURLsPerExtract = 5
+	cfg.WebSearch.Backends = backends
+	return cfg
+}
+
+func TestRAGForgeBackend(t *testing.T) {
+	ctx := context.Background()
+	server := newRAGForgeServer(t, http.StatusOK)
+	provider, err := newRAGForgeBackend(config.WebSearchBackend{Type: config.WebSearchBackendRAGForge, BaseURL: server.URL + "/"}, newTestWebSearchConfig(), &http.Client{})
+	if err != nil {
+		t.Fatalf("newRAGForgeBackend: %v", err)
+	}
+
+	if err := provider.CheckHealth(ctx); err != nil {
+		t.Errorf("CheckHealth: %v", err)
+	}
+
+	result, err := provider.Search(ctx, "cats")
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	for _, want := range []string{"Found 1 results for query: cats", "URL: https://example.com/cats", "Title: Cats", "Cats are small carnivores."} {
+		if !strings.Contains(result, want) {
+			t.Errorf("search result is missing %q:\n%s", want, result)
+		}
+	}
+	if len(server.searches) != 1 || server.searches[0] != (SearchRequest{Query: "cats", MaxResults: 2, MaxCharPerURL: 1000}) {
+		t.Errorf("got search requests %+v", server.searches)
+	}
+
+	if _, err := provider.Search(ctx, "fail"); err == nil || !strings.Contains(err.Error(), "search engine unavailable") {
+		t.Errorf("got error %v for a search the API failed, want its message", err)
+	}
+
+	result, err = provider.ExtractURLs(ctx, []string{"https://example.com/doc.pdf"}, "")
+	if err != nil {
+		t.Fatalf("ExtractURLs: %v", err)
+	}
+	if !strings.Contains(result, "Source Type: pdf") || !strings.Contains(result, "PDF text") {
+		t.Errorf("got extract result:\n%s", result)
+	}
+	if len(server.extracts) != 1 || len(server.extracts[0].URLs) != 1 || server.extracts[0].MaxCharPerURL != 1000 {
+		t.Errorf("got extract requests %+v", server.extracts)
+	}
+
+	multiple, err := provider.SearchMultiple(ctx, []string{"cats", "dogs"})
+	if err != nil {
+		t.Fatalf("SearchMultiple: %v", err)
+	}
+	if !strings.Contains(multiple, "query: cats") || !strings.Contains(multiple, "--- Search Query 2 ---\nFound 1 results for query: dogs") {
+		t.Errorf("got combined results in the wrong order:\n%s", multiple)
+	}
+
+	down := newRAGForgeServer(t, http.StatusBadGateway)
+	provider, _ = newRAGForgeBackend(config.WebSearchBackend{Type: config.WebSearchBackendRAGForge, BaseURL: down.URL}, newTestWebSearchConfig(), &http.Client{})
+	if err := provider.CheckHealth(ctx); err == nil {
+		t.Error("CheckHealth succeeded for a failing server")
+	}
+	if _, err := provider.Search(ctx, "cats"); err == nil || !strings.Contains(err.Error(), "status 502") {
+		t.Errorf("got error %v, want the status", err)
+	}
+
+	if _, err := newRAGForgeBackend(config.WebSearchBackend{Type: config.WebSearchBackendRAGForge}, newTestWebSearchConfig(), &http.Client{}); err == nil {
+		t.Error("created a RAG-Forge backend without a base URL")
+	}
+}
+
+// newSearXNGServer answers searches with a hit on pageURL and one whose page is missing
+func newSearXNGServer(t *testing.T, pageURL string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" || r.URL.Query().Get("format") != "json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"results":[`+
+			`{"url":"`+pageURL+`/article","title":"Cat article","content":"Snippet about cats"},`+
+			`{"url":"`+pageURL+`/missing","title":"Gone","content":"Snippet of a missing page"}]}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// allowPrivatePages lets every page extractor of the client fetch test servers
+func allowPrivatePages(w *WebSearchClient) {
+	for _, backend := range w.backends {
+		switch provider := backend.provider.(type) {
+		case *readabilityBackend:
+			provider.allowPrivateHosts = true
+		case *searchEngineBackend:
+			provider.pages.allowPrivateHosts = true
+		}
+	}
+}
+
+func TestWebSearchClientFallback(t *testing.T) {
+	ctx := context.Background()
+	pages := newPageServer(t)
+	ragForgeDown := newRAGForgeServer(t, http.StatusInternalServerError)
+	searxng := newSearXNGServer(t, pages.URL)
+
+	t.Run("search falls back to the next backend", func(t *testing.T) {
+		client := NewWebSearchClient(newTestWebSearchConfig(
+			config.WebSearchBackend{Type: config.WebSearchBackendReadability},
+			config.WebSearchBackend{Type: config.WebSearchBackendRAGForge, BaseURL: ragForgeDown.URL},
+			config.WebSearchBackend{Type: config.WebSearchBackendSearXNG, BaseURL: searxng.URL},
+		), &http.Client{})
+		allowPrivatePages(client)
+
+		result, err := client.Search(ctx, "cats")
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		// Result pages are fetched; a page that can't be read keeps its snippet
+		for _, want := range []string{"Found 2 results for query: cats", "Title: All about cats", "Cats sleep for most of the day", "Snippet of a missing page"} {
+			if !strings.Contains(result, want) {
+				t.Errorf("result is missing %q:\n%s", want, result)
+			}
+		}
+		if strings.Contains(result, "Snippet about cats") {
+			t.Errorf("snippet was kept although its page was fetched:\n%s", result)
+		}
+	})
+
+	t.Run("snippets only", func(t *testing.T) {
+		client := NewWebSearchClient(newTestWebSearchConfig(
+			config.WebSearchBackend{Type: config.WebSearchBackendSearXNG, BaseURL: searxng.URL, SnippetsOnly: true},
+		), &http.Client{})
+
+		result, err := client.Search(ctx, "cats")
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if !strings.Contains(result, "Snippet about cats") || strings.Contains(result, "Cats sleep") {
+			t.Errorf("got result with fetched pages:\n%s", result)
+		}
+	})
+
+	t.Run("extraction falls back past search-only backends", func(t *testing.T) {
+		client := NewWebSearchClient(newTestWebSearchConfig(
+			config.WebSearchBackend{Type: config.WebSearchBackendSearXNG, BaseURL: searxng.URL},
+			config.WebSearchBackend{Type: config.WebSearchBackendRAGForge, BaseURL: ragForgeDown.URL},
+			config.WebSearchBackend{Type: config.WebSearchBackendReadability},
+		), &http.Client{})
+		allowPrivatePages(client)
+
+		result, err := client.ExtractURLs(ctx, []string{pages.URL + "/article"})
+		if err != nil {
+			t.Fatalf("ExtractURLs: %v", err)
+		}
+		if !strings.Contains(result, "Cats sleep for most of the day") {
+			t.Errorf("got extract result:\n%s", result)
+		}
+	})
+
+	t.Run("last error is reported when every backend fails", func(t *testing.T) {
+		client := NewWebSearchClient(newTestWebSearchConfig(
+			config.WebSearchBackend{Type: config.WebSearchBackendRAGForge, BaseURL: ragForgeDown.URL},
+		), &http.Client{})
+
+		if _, err := client.Search(ctx, "cats"); err == nil || !strings.Contains(err.Error(), "status 500") {
+			t.Errorf("got error %v, want the RAG-Forge status", err)
+		}
+		if err := client.CheckHealth(ctx); err == nil {
+			t.Error("CheckHealth succeeded with every backend down")
+		}
+	})
+
+	t.Run("no backend supports the operation", func(t *testing.T) {
+		client := NewWebSearchClient(newTestWebSearchConfig(
+			config.WebSearchBackend{Type: config.WebSearchBackendReadability},
+		), &http.Client{})
+
+		if _, err := client.Search(ctx, "cats"); err == nil || !strings.Contains(err.Error(), "no configured web search backend can search") {
+			t.Errorf("got error %v, want no backend able to search", err)
+		}
+	})
+
+	t.Run("invalid backends are skipped", func(t *testing.T) {
+		client := NewWebSearchClient(newTestWebSearchConfig(
+			config.WebSearchBackend{Type: "unknown"},
+			config.WebSearchBackend{Type: config.WebSearchBackendBrave},
+			config.WebSearchBackend{Type: config.WebSearchBackendSearXNG, BaseURL: searxng.URL, SnippetsOnly: true},
+		), &http.Client{})
+
+		if len(client.backends) != 1 || client.backends[0].name != config.WebSearchBackendSearXNG {
+			t.Fatalf("got backends %+v, want only searxng", client.backends)
+		}
+		if _, err := client.Search(ctx, "cats"); err != nil {
+			t.Errorf("Search: %v", err)
+		}
+	})
+}
+
+func TestCountSearchResults(t *testing.T) {
+	failed := "timed out"
+	payload := &FinalResponsePayload{Results: []ExtractedResult{
+		{URL: "https://example.com/a", SourceType: "webpage", ProcessedSuccessfully: true, Data: "--- Result 9 --- is quoted here"},
+		{URL: "https://example.com/b", SourceType: "webpage", Error: &failed},
+	}}
+	payload.QueryDetails.Query = "cats"
+	formatted := NewWebSearchResultFormatter().FormatSearchResults(payload)
+
+	// Queries that failed or found nothing add no results
+	combined := strings.Join([]string{formatted, "Error searching for 'dogs': timeout\n", formatted}, "\n")
+	if got := CountSearchResults(combined); got != 4 {
+		t.Errorf("counted %d results, want 4:\n%s", got, combined)
+	}
+}
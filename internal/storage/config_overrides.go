@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	json "github.com/json-iterator/go"
+
+	"DiscordAIChatbot/internal/config"
+)
+
+// Override scopes
+const (
+	ScopeGuild   = "guild"
+	ScopeChannel = "channel"
+)
+
+// overrideCacheTTL is how long overrides are served from memory. Writes through this store
+// are seen at once; writes by other bot instances within this time.
+const overrideCacheTTL = time.Minute
+
+// cachedOverrides is a cached lookup, including lookups that found nothing
+type cachedOverrides struct {
+	overrides *config.Overrides
+	expires   time.Time
+}
+
+// ConfigOverrideStore persists the guild and channel settings that override the YAML config
+type ConfigOverrideStore struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	cache map[string]cachedOverrides
+}
+
+// NewConfigOverrideStore creates a new config override store with shared database connection
+func NewConfigOverrideStore(dbURL string) *ConfigOverrideStore {
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+
+	// Use shared database connection
+	db, err := GetDatabase(dbURL)
+	if err != nil {
+		log.Fatalf("Failed to get database connection: %v", err)
+	}
+
+	return &ConfigOverrideStore{
+		db:    db,
+		cache: make(map[string]cachedOverrides),
+	}
+}
+
+// GetOverrides returns the overrides of a guild or channel, or nil if it has none
+func (cs *ConfigOverrideStore) GetOverrides(ctx context.Context, scope, scopeID string) (*config.Overrides, error) {
+	key := scope + ":" + scopeID
+
+	cs.mu.RLock()
+	cached, ok := cs.cache[key]
+	cs.mu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.overrides, nil
+	}
+
+	var raw string
+	err := cs.db.QueryRowContext(ctx, `SELECT overrides FROM config_overrides WHERE scope = $1 AND scope_id = $2`, scope, scopeID).Scan(&raw)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get %s overrides: %w", scope, err)
+	}
+
+	var overrides *config.Overrides
+	if err == nil {
+		overrides = &config.Overrides{}
+		if err := json.Unmarshal([]byte(raw), overrides); err != nil {
+			return nil, fmt.Errorf("failed to decode %s overrides: %w", scope, err)
+		}
+	}
+
+	cs.mu.Lock()
+	cs.cache[key] = cachedOverrides{overrides: overrides, expires: time.Now().Add(overrideCacheTTL)}
+	cs.mu.Unlock()
+	return overrides, nil
+}
+
+// SaveOverrides replaces the overrides of a guild or channel. Empty overrides are deleted.
+func (cs *ConfigOverrideStore) SaveOverrides(ctx context.Context, scope, scopeID string, overrides *config.Overrides, updatedBy string) error {
+	if overrides.IsEmpty() {
+		if _, err := cs.db.ExecContext(ctx, `DELETE FROM config_overrides WHERE scope = $1 AND scope_id = $2`, scope, scopeID); err != nil {
+			return fmt.Errorf("failed to delete %s overrides: %w", scope, err)
+		}
+		cs.invalidate(scope, scopeID)
+		return nil
+	}
+
+	raw, err := json.Marshal(overrides)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s overrides: %w", scope, err)
+	}
+
+	_, err = cs.db.ExecContext(ctx, `
+		INSERT INTO config_overrides (scope, scope_id, overrides, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (scope, scope_id) DO UPDATE SET
+			overrides = EXCLUDED.overrides,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = EXCLUDED.updated_at
+	`, scope, scopeID, string(raw), updatedBy, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save %s overrides: %w", scope, err)
+	}
+	cs.invalidate(scope, scopeID)
+	return nil
+}
+
+// invalidate drops a cached lookup after a write
+func (cs *ConfigOverrideStore) invalidate(scope, scopeID string) {
+	cs.mu.Lock()
+	delete(cs.cache, scope+":"+scopeID)
+	cs.mu.Unlock()
+}
+
+// Close closes the database connection
+func (cs *ConfigOverrideStore) Close() error {
+	// Database connection is shared, don't close it here
+	return nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect identifies the SQL flavour of the configured database
+type Dialect string
+
+const (
+	// DialectPostgres is used for postgres:// and postgresql:// URLs
+	DialectPostgres Dialect = "postgres"
+	// DialectSQLite is used for sqlite:// URLs and runs embedded in the bot process
+	DialectSQLite Dialect = "sqlite"
+)
+
+// sqlitePragmas are applied to every SQLite connection
+const sqlitePragmas = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+
+// DialectOf returns the dialect selected by a database_url scheme
+func DialectOf(dbURL string) Dialect {
+	if strings.HasPrefix(strings.ToLower(dbURL), "sqlite:") {
+		return DialectSQLite
+	}
+	return DialectPostgres
+}
+
+// driverAndDSN returns the database/sql driver name and data source for a database_url.
+// SQLite URLs take a file path: sqlite://bot.db, sqlite:///var/lib/bot/bot.db or sqlite://:memory:
+func driverAndDSN(dbURL string) (string, string, error) {
+	if DialectOf(dbURL) != DialectSQLite {
+		return "pgx", dbURL, nil
+	}
+
+	path := dbURL[len("sqlite:"):]
+	path = strings.TrimPrefix(path, "//")
+	path, query, _ := strings.Cut(path, "?")
+	if path == "" {
+		return "", "", fmt.Errorf("sqlite database_url needs a file path, e.g. sqlite://bot.db")
+	}
+
+	dsn := "file:" + path + "?" + sqlitePragmas
+	if query != "" {
+		dsn += "&" + query
+	}
+	return "sqlite", dsn, nil
+}
+
+// placeholders returns "$start, $start+1, ..." for n parameters, for IN lists
+func placeholders(start, n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", start+i)
+	}
+	return strings.Join(params, ", ")
+}
+
+// greatest returns the SQL function returning the larger of two values
+func (d Dialect) greatest() string {
+	if d == DialectSQLite {
+		return "MAX" // The multi-argument form of MAX is scalar in SQLite
+	}
+	return "GREATEST"
+}
+
+// jsonFieldMissing returns a condition matching rows whose JSON column lacks a top-level field
+func (d Dialect) jsonFieldMissing(column, field string) string {
+	if d == DialectSQLite {
+		return fmt.Sprintf("json_extract(%s, '$.%s') IS NULL", column, field)
+	}
+	return fmt.Sprintf("%s->'%s' IS NULL", column, field)
+}
+
+// jsonValue converts encoded JSON into a parameter for a JSON column. SQLite stores
+// JSON as text; a BLOB would be read back as its binary JSONB format.
+func (d Dialect) jsonValue(data []byte) any {
+	if d == DialectSQLite {
+		return string(data)
+	}
+	return data
+}
+
+// lockRowsSuffix returns the clause that lets concurrent workers skip rows another one is updating.
+// SQLite has a single writer, so it needs none.
+func (d Dialect) lockRowsSuffix() string {
+	if d == DialectSQLite {
+		return ""
+	}
+	return "FOR UPDATE SKIP LOCKED"
+}
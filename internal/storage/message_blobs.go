@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	json "github.com/json-iterator/go"
+)
+
+// copyBlobs upserts blobs through a temporary table. last_used only moves forward,
+// so a blob outlives every node written with it.
+func copyBlobs(ctx context.Context, tx pgx.Tx, blobs blobSet, now int64) error {
+	if len(blobs) == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, `
+		CREATE TEMP TABLE temp_message_blobs (
+			hash TEXT PRIMARY KEY,
+			data BYTEA NOT NULL,
+			size BIGINT NOT NULL,
+			last_used BIGINT NOT NULL
+		) ON COMMIT DROP
+	`); err != nil {
+		return fmt.Errorf("failed to create temp blob table: %w", err)
+	}
+
+	rows := make([][]interface{}, 0, len(blobs))
+	for hash, data := range blobs {
+		rows = append(rows, []interface{}{hash, data, int64(len(data)), now})
+	}
+	if _, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"temp_message_blobs"},
+		[]string{"hash", "data", "size", "last_used"},
+		pgx.CopyFromRows(rows),
+	); err != nil {
+		return fmt.Errorf("failed to copy blobs: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO message_blobs (hash, data, size, last_used)
+		SELECT hash, data, size, last_used FROM temp_message_blobs
+		ON CONFLICT (hash) DO UPDATE SET
+			last_used = GREATEST(message_blobs.last_used, EXCLUDED.last_used)
+	`); err != nil {
+		return fmt.Errorf("failed to upsert blobs: %w", err)
+	}
+	return nil
+}
+
+// loadBlobs fetches blobs by hash. Hashes that no longer exist are left out.
+func (c *MessageNodeCache) loadBlobs(ctx context.Context, hashes []string) (blobSet, error) {
+	blobs := make(blobSet, len(hashes))
+	if len(hashes) == 0 {
+		return blobs, nil
+	}
+
+	args := make([]any, len(hashes))
+	for i, hash := range hashes {
+		args[i] = hash
+	}
+	rows, err := c.db.QueryContext(ctx, `SELECT hash, data FROM message_blobs WHERE hash IN (`+placeholders(1, len(hashes))+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("blob query error: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close blob rows: %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var hash string
+		var data []byte
+		if err := rows.Scan(&hash, &data); err != nil {
+			return nil, fmt.Errorf("blob scan error: %w", err)
+		}
+		blobs[hash] = data
+	}
+	return blobs, rows.Err()
+}
+
+// maintenanceWorker migrates legacy rows once, then evicts expired nodes periodically
+func (c *MessageNodeCache) maintenanceWorker() {
+	defer c.wg.Done()
+
+	if err := c.migrateLegacyNodes(context.Background()); err != nil {
+		log.Printf("Failed to migrate cached message nodes: %v", err)
+	}
+
+	ticker := time.NewTicker(evictionInterval)
+	defer ticker.Stop()
+
+	for {
+		if ttl := c.ttl(); ttl > 0 {
+			nodes, blobs, err := c.EvictExpired(context.Background(), time.Now().Add(-ttl))
+			if err != nil {
+				log.Printf("Failed to evict cached message nodes: %v", err)
+			} else if nodes > 0 || blobs > 0 {
+				log.Printf("Evicted %d cached message nodes and %d blobs", nodes, blobs)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// EvictExpired deletes nodes last written before cutoff, then blobs no newer node uses
+func (c *MessageNodeCache) EvictExpired(ctx context.Context, cutoff time.Time) (int64, int64, error) {
+	result, err := c.db.ExecContext(ctx, `DELETE FROM message_nodes WHERE updated_at < $1`, cutoff.Unix())
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to evict nodes: %w", err)
+	}
+	nodes, _ := result.RowsAffected()
+
+	result, err = c.db.ExecContext(ctx, `DELETE FROM message_blobs WHERE last_used < $1`, cutoff.Unix())
+	if err != nil {
+		return nodes, 0, fmt.Errorf("failed to evict blobs: %w", err)
+	}
+	blobs, _ := result.RowsAffected()
+
+	return nodes, blobs, nil
+}
+
+// migrateLegacyNodes rewrites version 1 rows in the current schema, moving their
+// inline binary data into blobs. updated_at is kept so migration doesn't extend the TTL.
+func (c *MessageNodeCache) migrateLegacyNodes(ctx context.Context) error {
+	migrated := 0
+	for {
+		count, err := c.migrateLegacyBatch(ctx)
+		if err != nil {
+			return err
+		}
+		migrated += count
+		if count < migrationBatchSize {
+			break
+		}
+	}
+
+	if migrated > 0 {
+		log.Printf("Migrated %d cached message nodes to schema version %d", migrated, nodeSchemaVersion)
+	}
+	return nil
+}
+
+// migrateLegacyBatch migrates up to migrationBatchSize legacy rows in one transaction
+func (c *MessageNodeCache) migrateLegacyBatch(ctx context.Context) (int, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin migration transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT message_id, data, updated_at FROM message_nodes
+		WHERE `+c.dialect.jsonFieldMissing("data", "version")+`
+		LIMIT $1
+		`+c.dialect.lockRowsSuffix(), migrationBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query legacy nodes: %w", err)
+	}
+
+	type legacyRow struct {
+		messageID string
+		data      []byte
+		updatedAt int64
+	}
+	var legacy []legacyRow
+	for rows.Next() {
+		var row legacyRow
+		if err := rows.Scan(&row.messageID, &row.data, &row.updatedAt); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("failed to scan legacy node: %w", err)
+		}
+		legacy = append(legacy, row)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, fmt.Errorf("failed to read legacy nodes: %w", err)
+	}
+
+	for _, row := range legacy {
+		var serial msgNodeSerializable
+		if err := json.Unmarshal(row.data, &serial); err != nil {
+			// It's only a cache; drop rows that can't be read
+			log.Printf("Dropping unreadable cached node %s: %v", row.messageID, err)
+			if _, err := tx.ExecContext(ctx, `DELETE FROM message_nodes WHERE message_id = $1`, row.messageID); err != nil {
+				return 0, fmt.Errorf("failed to delete legacy node: %w", err)
+			}
+			continue
+		}
+
+		node, _ := decodeNode(&serial, nil)
+		blobs := make(blobSet)
+		data, err := json.Marshal(encodeNode(node, blobs))
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal node %s: %w", row.messageID, err)
+		}
+
+		if err := insertBlobs(ctx, tx, c.dialect, blobs, row.updatedAt); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE message_nodes SET data = $2 WHERE message_id = $1`, row.messageID, c.dialect.jsonValue(data)); err != nil {
+			return 0, fmt.Errorf("failed to update legacy node: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit migration: %w", err)
+	}
+	return len(legacy), nil
+}
+
+// insertBlobs upserts blobs row by row within a database/sql transaction
+func insertBlobs(ctx context.Context, tx *sql.Tx, dialect Dialect, blobs blobSet, lastUsed int64) error {
+	for hash, data := range blobs {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO message_blobs (hash, data, size, last_used)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (hash) DO UPDATE SET
+				last_used = `+dialect.greatest()+`(message_blobs.last_used, EXCLUDED.last_used)
+		`, hash, data, int64(len(data)), lastUsed); err != nil {
+			return fmt.Errorf("failed to insert blob: %w", err)
+		}
+	}
+	return nil
+}
@@ -18,35 +18,31 @@ import (
 const (
 	batchSize    = 50
 	batchTimeout = 5 * time.Second
+
+	// How often expired nodes and unused blobs are evicted
+	evictionInterval = time.Hour
+	// How stale a last use may get before a read records it again; far below any sensible TTL
+	touchInterval = time.Hour
+	// Legacy rows rewritten per migration transaction
+	migrationBatchSize = 100
 )
 
 // MessageNodeCache provides simple persistence for processed MsgNode objects.
-// The data is stored as JSONB so the schema can evolve without migrations.
-// Only the fields needed to skip expensive re-processing are kept.
-// ParentMsg and mutex fields are deliberately omitted.
+// Nodes are stored as versioned JSONB (see nodeSchemaVersion) so the schema can evolve
+// without table changes. Binary attachments live in the content-addressed message_blobs
+// table and are shared between nodes. The mutex is omitted and ParentMsg is reduced to its IDs.
 type MessageNodeCache struct {
 	db        *sql.DB
+	dialect   Dialect
 	nodeQueue chan *messaging.ProcessedNode
+	ttl       func() time.Duration
+	stop      chan struct{}
 	wg        sync.WaitGroup
 }
 
-// msgNodeSerializable mirrors messaging.MsgNode but excludes unmarshalable fields.
-// We don t embed RWMutex and ParentMsg to keep JSON lean.
-
-type msgNodeSerializable struct {
-	Text               string                            `json:"text"`
-	Images             []messaging.ImageContent          `json:"images"`
-	GeneratedImages    []messaging.GeneratedImageContent `json:"generated_images"`
-	Role               string                            `json:"role"`
-	UserID             string                            `json:"user_id"`
-	HasBadAttachments  bool                              `json:"has_bad_attachments"`
-	FetchParentFailed  bool                              `json:"fetch_parent_failed"`
-	WebSearchPerformed bool                              `json:"web_search_performed"`
-	SearchResultCount  int                               `json:"search_result_count"`
-}
-
 // NewMessageNodeCache initialises the cache with shared database connection.
-func NewMessageNodeCache(dbURL string) *MessageNodeCache {
+// ttl is called before every eviction pass so it follows config reloads; zero keeps nodes forever.
+func NewMessageNodeCache(dbURL string, ttl func() time.Duration) *MessageNodeCache {
 	if dbURL == "" {
 		log.Fatal("DATABASE_URL is required for message node cache")
 	}
@@ -60,11 +56,15 @@ func NewMessageNodeCache(dbURL string) *MessageNodeCache {
 	queue := make(chan *messaging.ProcessedNode, batchSize*2)
 	cache := &MessageNodeCache{
 		db:        db,
+		dialect:   DialectOf(dbURL),
 		nodeQueue: queue,
+		ttl:       ttl,
+		stop:      make(chan struct{}),
 	}
 
-	cache.wg.Add(1)
+	cache.wg.Add(2)
 	go cache.batchWorker()
+	go cache.maintenanceWorker()
 
 	return cache
 }
@@ -128,12 +128,36 @@ func (c *MessageNodeCache) SaveNode(ctx context.Context, messageID string, node
 	}
 }
 
-// saveNodes uses `COPY FROM` for efficient bulk insertion/updates.
+// saveNodes encodes a batch of nodes and writes them together with their blobs
 func (c *MessageNodeCache) saveNodes(ctx context.Context, nodes []*messaging.ProcessedNode) error {
 	if len(nodes) == 0 {
 		return nil
 	}
 
+	now := time.Now().Unix()
+	blobs := make(blobSet)
+	rows := make([][]interface{}, 0, len(nodes))
+	for _, pNode := range nodes {
+		data, err := json.Marshal(encodeNode(pNode.Node, blobs))
+		if err != nil {
+			log.Printf("Failed to marshal node %s: %v", pNode.MessageID, err)
+			continue // Skip this node
+		}
+		rows = append(rows, []interface{}{pNode.MessageID, data, now})
+	}
+
+	if len(rows) == 0 {
+		return nil // All nodes failed to marshal
+	}
+
+	if c.dialect == DialectSQLite {
+		return c.upsertNodes(ctx, rows, blobs, now)
+	}
+	return c.copyNodes(ctx, rows, blobs, now)
+}
+
+// copyNodes uses `COPY FROM` for efficient bulk insertion/updates on PostgreSQL.
+func (c *MessageNodeCache) copyNodes(ctx context.Context, rows [][]interface{}, blobs blobSet, now int64) error {
 	// We need to get a raw pgx connection to use the COPY protocol
 	sqlConn, err := c.db.Conn(ctx)
 	if err != nil {
@@ -179,30 +203,9 @@ func (c *MessageNodeCache) saveNodes(ctx context.Context, nodes []*messaging.Pro
 		return fmt.Errorf("failed to create temp table: %w", err)
 	}
 
-	// Prepare rows for CopyFrom
-	rows := make([][]interface{}, 0, len(nodes))
-	for _, pNode := range nodes {
-		serial := msgNodeSerializable{
-			Text:               pNode.Node.GetText(),
-			Images:             pNode.Node.GetImages(),
-			GeneratedImages:    pNode.Node.GetGeneratedImages(),
-			Role:               pNode.Node.Role,
-			UserID:             pNode.Node.UserID,
-			HasBadAttachments:  pNode.Node.HasBadAttachments,
-			FetchParentFailed:  pNode.Node.FetchParentFailed,
-			WebSearchPerformed: pNode.Node.WebSearchPerformed,
-			SearchResultCount:  pNode.Node.SearchResultCount,
-		}
-		data, err := json.Marshal(serial)
-		if err != nil {
-			log.Printf("Failed to marshal node %s: %v", pNode.MessageID, err)
-			continue // Skip this node
-		}
-		rows = append(rows, []interface{}{pNode.MessageID, data, time.Now().Unix()})
-	}
-
-	if len(rows) == 0 {
-		return nil // All nodes failed to marshal
+	// Blobs go in first so no committed node refers to a missing blob
+	if err := copyBlobs(ctx, tx, blobs, now); err != nil {
+		return err
 	}
 
 	// Use pgx-specific COPY FROM
@@ -231,11 +234,40 @@ func (c *MessageNodeCache) saveNodes(ctx context.Context, nodes []*messaging.Pro
 	return tx.Commit(ctx)
 }
 
+// upsertNodes writes nodes row by row for databases without COPY (SQLite)
+func (c *MessageNodeCache) upsertNodes(ctx context.Context, rows [][]interface{}, blobs blobSet, now int64) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Blobs go in first so no committed node refers to a missing blob
+	if err := insertBlobs(ctx, tx, c.dialect, blobs, now); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO message_nodes (message_id, data, updated_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (message_id) DO UPDATE SET
+				data = EXCLUDED.data,
+				updated_at = EXCLUDED.updated_at
+		`, row[0], c.dialect.jsonValue(row[1].([]byte)), row[2]); err != nil {
+			return fmt.Errorf("failed to upsert node: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
 // GetNode retrieves a cached node. Returns (nil, nil) if not found.
 func (c *MessageNodeCache) GetNode(ctx context.Context, messageID string) (*messaging.MsgNode, error) {
 	var rawData []byte
+	var updatedAt int64
 	// Since writes are now async, we can't rely on a prepared statement from the old struct
-	err := c.db.QueryRowContext(ctx, `SELECT data FROM message_nodes WHERE message_id = $1`, messageID).Scan(&rawData)
+	err := c.db.QueryRowContext(ctx, `SELECT data, updated_at FROM message_nodes WHERE message_id = $1`, messageID).Scan(&rawData, &updatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // cache miss
@@ -247,23 +279,64 @@ func (c *MessageNodeCache) GetNode(ctx context.Context, messageID string) (*mess
 	if err := json.Unmarshal(rawData, &serial); err != nil {
 		return nil, fmt.Errorf("unmarshal error: %w", err)
 	}
+	if serial.Version > nodeSchemaVersion {
+		// Written by a newer build; treat as a miss rather than dropping fields
+		log.Printf("Cached node %s has unknown schema version %d", messageID, serial.Version)
+		return nil, nil
+	}
+
+	blobs, err := c.loadBlobs(ctx, serial.blobHashes())
+	if err != nil {
+		return nil, err
+	}
 
-	node := messaging.NewMsgNode()
-	node.SetText(serial.Text)
-	node.SetImages(serial.Images)
-	node.SetGeneratedImages(serial.GeneratedImages)
-	node.Role = serial.Role
-	node.UserID = serial.UserID
-	node.HasBadAttachments = serial.HasBadAttachments
-	node.FetchParentFailed = serial.FetchParentFailed
-	node.WebSearchPerformed = serial.WebSearchPerformed
-	node.SearchResultCount = serial.SearchResultCount
+	node, missing := decodeNode(&serial, blobs)
+	if missing > 0 {
+		log.Printf("Cached node %s lost %d attachment(s) whose data was evicted", messageID, missing)
+	}
+
+	if time.Since(time.Unix(updatedAt, 0)) >= touchInterval {
+		c.touchNode(ctx, messageID, serial.blobHashes())
+	}
 
 	return node, nil
 }
 
-// Close closes the underlying DB connection and waits for the batch worker to finish.
+// touchNode marks a node and its blobs as used so TTL eviction keeps conversations that are
+// still read. Blobs are last used no earlier than the nodes pointing at them, so they are only
+// touched along with a node.
+func (c *MessageNodeCache) touchNode(ctx context.Context, messageID string, hashes []string) {
+	now := time.Now().Unix()
+	if _, err := c.db.ExecContext(ctx, `UPDATE message_nodes SET updated_at = $2 WHERE message_id = $1`, messageID, now); err != nil {
+		log.Printf("Failed to touch cached node %s: %v", messageID, err)
+		return
+	}
+	if len(hashes) == 0 {
+		return
+	}
+
+	args := make([]any, 0, len(hashes)+1)
+	args = append(args, now)
+	for _, hash := range hashes {
+		args = append(args, hash)
+	}
+	query := `UPDATE message_blobs SET last_used = $1 WHERE last_used < $1 AND hash IN (` + placeholders(2, len(hashes)) + `)`
+	if _, err := c.db.ExecContext(ctx, query, args...); err != nil {
+		log.Printf("Failed to touch blobs of cached node %s: %v", messageID, err)
+	}
+}
+
+// DeleteNode removes a cached node, e.g. after the message was edited.
+func (c *MessageNodeCache) DeleteNode(ctx context.Context, messageID string) error {
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM message_nodes WHERE message_id = $1`, messageID); err != nil {
+		return fmt.Errorf("delete error: %w", err)
+	}
+	return nil
+}
+
+// Close stops the maintenance worker and waits for the batch worker to save queued nodes.
 func (c *MessageNodeCache) Close() error {
+	close(c.stop)
 	close(c.nodeQueue)
 	c.wg.Wait()
 	return nil
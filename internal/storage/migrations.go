@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLockID is the advisory lock key held while migrating, so replicas
+// starting at the same time apply each migration once
+const migrationLockID int64 = 0x44414943 // "DAIC"
+
+// migrationFiles holds one directory of migrations per dialect with matching versions
+//
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change with its up and down scripts
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	AppliedAt time.Time // Zero when pending
+}
+
+// Applied reports whether the migration has been applied
+func (s MigrationStatus) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+// Migrator applies the embedded migrations in version order
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// NewMigrator creates a migrator using the shared database connection
+func NewMigrator(dbURL string) (*Migrator, error) {
+	db, err := GetDatabase(dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	dialect := DialectOf(dbURL)
+	migrations, err := loadMigrations(migrationFiles, path.Join("migrations", string(dialect)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// loadMigrations reads NNNN_name.up.sql and NNNN_name.down.sql pairs from dir sorted by version
+func loadMigrations(files fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name: %s", fileName)
+		}
+		versionText, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", fileName)
+		}
+		version, err := strconv.Atoi(versionText)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", fileName)
+		}
+
+		script, err := fs.ReadFile(files, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Printf("Failed to close migration connection: %v", err)
+		}
+	}()
+
+	// Session-level locks belong to the connection, so lock and unlock on the same one.
+	// SQLite is embedded in a single process and uses its only connection.
+	if m.dialect == DialectPostgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer func() {
+			if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+				log.Printf("Failed to release migration lock: %v", err)
+			}
+		}()
+	}
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at BIGINT NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// appliedVersions returns the applied migration versions and when they were applied
+func appliedVersions(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}) (map[int]time.Time, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close migration rows: %v", err)
+		}
+	}()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[version] = time.Unix(appliedAt, 0)
+	}
+	return applied, rows.Err()
+}
+
+// Up applies all pending migrations in order and returns the ones applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the given number of most recently applied migrations and returns the ones reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %04d_%s has no down script", migration.Version, migration.Name)
+			}
+			if err := m.run(ctx, conn, migration, migration.Down, false); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// run executes one script and records the result in schema_migrations in a single transaction
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, script string, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %04d: %w", migration.Version, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+			migration.Version, migration.Name, time.Now().Unix())
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %04d: %w", migration.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %04d: %w", migration.Version, err)
+	}
+
+	if up {
+		log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+	} else {
+		log.Printf("Reverted migration %04d_%s", migration.Version, migration.Name)
+	}
+	return nil
+}
+
+// Status lists every known migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			statuses = append(statuses, MigrationStatus{Migration: migration, AppliedAt: applied[migration.Version]})
+		}
+		return nil
+	})
+	return statuses, err
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS message_nodes;
+DROP TABLE IF EXISTS chart_libraries;
+DROP TABLE IF EXISTS user_preferences;
+DROP TABLE IF EXISTS bad_api_keys;
@@ -0,0 +1,37 @@
+-- Tables created by InitializeAllTables before migrations existed.
+-- IF NOT EXISTS lets existing databases adopt this version as-is.
+
+CREATE TABLE IF NOT EXISTS bad_api_keys (
+    provider TEXT NOT NULL,
+    api_key TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    marked_at BIGINT NOT NULL,
+    PRIMARY KEY (provider, api_key)
+);
+
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id TEXT PRIMARY KEY,
+    preferred_model TEXT NOT NULL,
+    system_prompt TEXT,
+    last_updated BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS chart_libraries (
+    name TEXT PRIMARY KEY,
+    version TEXT NOT NULL,
+    install_date BIGINT NOT NULL,
+    last_used BIGINT NOT NULL,
+    is_installed BOOLEAN NOT NULL DEFAULT false,
+    dependencies TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE IF NOT EXISTS message_nodes (
+    message_id TEXT PRIMARY KEY,
+    data JSONB NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_chart_libraries_installed ON chart_libraries(is_installed);
+CREATE INDEX IF NOT EXISTS idx_chart_libraries_last_used ON chart_libraries(last_used);
+CREATE INDEX IF NOT EXISTS idx_user_preferences_user_id ON user_preferences(user_id);
+CREATE INDEX IF NOT EXISTS idx_bad_api_keys_provider ON bad_api_keys(provider);
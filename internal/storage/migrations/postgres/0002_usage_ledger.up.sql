@@ -0,0 +1,15 @@
+-- Token usage per user, guild, model and day (usage_ledger.go)
+
+CREATE TABLE IF NOT EXISTS usage_ledger (
+    user_id TEXT NOT NULL,
+    guild_id TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL,
+    day DATE NOT NULL,
+    prompt_tokens BIGINT NOT NULL DEFAULT 0,
+    completion_tokens BIGINT NOT NULL DEFAULT 0,
+    cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+    requests BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, guild_id, model, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_ledger_guild_day ON usage_ledger(guild_id, day);
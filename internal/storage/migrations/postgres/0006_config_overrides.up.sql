@@ -0,0 +1,11 @@
+-- Guild and channel settings that override the YAML config (config_overrides.go).
+-- scope is "guild" or "channel"; overrides holds the JSON of config.Overrides.
+
+CREATE TABLE IF NOT EXISTS config_overrides (
+    scope TEXT NOT NULL,
+    scope_id TEXT NOT NULL,
+    overrides TEXT NOT NULL,
+    updated_by TEXT NOT NULL DEFAULT '',
+    updated_at BIGINT NOT NULL,
+    PRIMARY KEY (scope, scope_id)
+);
@@ -0,0 +1,38 @@
+-- Tables created by InitializeAllTables before migrations existed.
+-- IF NOT EXISTS lets existing databases adopt this version as-is.
+
+CREATE TABLE IF NOT EXISTS bad_api_keys (
+    provider TEXT NOT NULL,
+    api_key TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    marked_at INTEGER NOT NULL,
+    PRIMARY KEY (provider, api_key)
+);
+
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id TEXT PRIMARY KEY,
+    preferred_model TEXT NOT NULL,
+    system_prompt TEXT,
+    last_updated INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS chart_libraries (
+    name TEXT PRIMARY KEY,
+    version TEXT NOT NULL,
+    install_date INTEGER NOT NULL,
+    last_used INTEGER NOT NULL,
+    is_installed BOOLEAN NOT NULL DEFAULT false,
+    dependencies TEXT NOT NULL DEFAULT '{}'
+);
+
+-- JSON is stored as text; SQLite reads BLOB values as its binary JSONB format
+CREATE TABLE IF NOT EXISTS message_nodes (
+    message_id TEXT PRIMARY KEY,
+    data TEXT NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_chart_libraries_installed ON chart_libraries(is_installed);
+CREATE INDEX IF NOT EXISTS idx_chart_libraries_last_used ON chart_libraries(last_used);
+CREATE INDEX IF NOT EXISTS idx_user_preferences_user_id ON user_preferences(user_id);
+CREATE INDEX IF NOT EXISTS idx_bad_api_keys_provider ON bad_api_keys(provider);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_message_nodes_updated_at;
+DROP TABLE IF EXISTS message_blobs;
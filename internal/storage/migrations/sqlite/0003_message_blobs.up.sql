@@ -0,0 +1,12 @@
+-- Content-addressed attachment data of cached nodes (message_blobs.go)
+-- and the indexes used by TTL eviction
+
+CREATE TABLE IF NOT EXISTS message_blobs (
+    hash TEXT PRIMARY KEY,
+    data BLOB NOT NULL,
+    size INTEGER NOT NULL,
+    last_used INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_nodes_updated_at ON message_nodes(updated_at);
+CREATE INDEX IF NOT EXISTS idx_message_blobs_last_used ON message_blobs(last_used);
@@ -0,0 +1,10 @@
+-- Summaries of conversation ranges keyed by a hash of what they summarize (summary_cache.go)
+
+CREATE TABLE IF NOT EXISTS context_summaries (
+    hash TEXT PRIMARY KEY,
+    level INTEGER NOT NULL,
+    summary TEXT NOT NULL,
+    last_used INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_context_summaries_last_used ON context_summaries(last_used);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS channel_personas;
+DROP TABLE IF EXISTS user_personas;
+DROP TABLE IF EXISTS personas;
@@ -0,0 +1,28 @@
+-- Named persona presets and where they are in use (personas.go).
+-- Shared personas, created by admins, have an empty owner_id.
+
+CREATE TABLE IF NOT EXISTS personas (
+    owner_id TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    system_prompt TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL DEFAULT '',
+    temperature REAL,
+    avatar_url TEXT NOT NULL DEFAULT '',
+    display_name TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    PRIMARY KEY (owner_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS user_personas (
+    user_id TEXT PRIMARY KEY,
+    owner_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS channel_personas (
+    channel_id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    updated_at INTEGER NOT NULL
+);
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// nodeSchemaVersion is the layout of the cached node JSON written by this build.
+//
+//	1: text, images and generated images with binary data inline (rows without a version)
+//	2: every MsgNode field; binary data moved to the message_blobs table
+const nodeSchemaVersion = 2
+
+// msgNodeSerializable mirrors messaging.MsgNode but excludes unmarshalable fields.
+// Binary data is replaced by blob hashes; the Data fields are only set by version 1 rows.
+type msgNodeSerializable struct {
+	Version            int                          `json:"version,omitempty"`
+	Text               string                       `json:"text"`
+	Images             []imageSerializable          `json:"images"`
+	GeneratedImages    []generatedImageSerializable `json:"generated_images"`
+	AudioFiles         []audioSerializable          `json:"audio_files,omitempty"`
+	PDFFiles           []pdfSerializable            `json:"pdf_files,omitempty"`
+	Role               string                       `json:"role"`
+	UserID             string                       `json:"user_id"`
+	HasBadAttachments  bool                         `json:"has_bad_attachments"`
+	FetchParentFailed  bool                         `json:"fetch_parent_failed"`
+	WebSearchPerformed bool                         `json:"web_search_performed"`
+	SearchResultCount  int                          `json:"search_result_count"`
+	GroundingMetadata  *messaging.GroundingMetadata `json:"grounding_metadata,omitempty"`
+	DetectedURLs       []string                     `json:"detected_urls,omitempty"`
+	Variants           []messaging.ResponseVariant  `json:"variants,omitempty"`
+	SelectedVariant    int                          `json:"selected_variant,omitempty"`
+	ParentMessageID    string                       `json:"parent_message_id,omitempty"`
+	ParentChannelID    string                       `json:"parent_channel_id,omitempty"`
+	Imported           bool                         `json:"imported,omitempty"`
+}
+
+// imageSerializable stores an image attachment. Data URLs are moved to a blob.
+type imageSerializable struct {
+	Type     string             `json:"type"`
+	ImageURL messaging.ImageURL `json:"image_url"`
+	MIMEType string             `json:"mime_type,omitempty"`
+	Blob     string             `json:"blob,omitempty"`
+}
+
+type generatedImageSerializable struct {
+	Data     []byte `json:"data,omitempty"`
+	MIMEType string `json:"mime_type"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+type audioSerializable struct {
+	Type     string `json:"type"`
+	MIMEType string `json:"mime_type"`
+	URL      string `json:"url"`
+	Data     []byte `json:"data,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+type pdfSerializable struct {
+	Type     string `json:"type"`
+	MIMEType string `json:"mime_type"`
+	URL      string `json:"url"`
+	Filename string `json:"filename,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// blobSet collects binary data by content hash
+type blobSet map[string][]byte
+
+// put stores data and returns its content hash
+func (b blobSet) put(data []byte) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	b[hash] = data
+	return hash
+}
+
+// encodeNode converts a node into its current serialized form, moving binary data into blobs
+func encodeNode(node *messaging.MsgNode, blobs blobSet) msgNodeSerializable {
+	serial := msgNodeSerializable{
+		Version:           nodeSchemaVersion,
+		Text:              node.GetText(),
+		Role:              node.Role,
+		UserID:            node.UserID,
+		HasBadAttachments: node.HasBadAttachments,
+		FetchParentFailed: node.FetchParentFailed,
+		GroundingMetadata: node.GetGroundingMetadata(),
+		DetectedURLs:      node.GetDetectedURLs(),
+		ParentMessageID:   node.ParentMessageID,
+		ParentChannelID:   node.ParentChannelID,
+		Imported:          node.Imported,
+	}
+	serial.WebSearchPerformed, serial.SearchResultCount = node.GetWebSearchInfo()
+	serial.Variants, serial.SelectedVariant = node.GetVariants()
+	if node.ParentMsg != nil {
+		serial.ParentMessageID = node.ParentMsg.ID
+		serial.ParentChannelID = node.ParentMsg.ChannelID
+	}
+
+	for _, img := range node.GetImages() {
+		entry := imageSerializable{Type: img.Type, ImageURL: img.ImageURL}
+		if mimeType, data, ok := parseDataURL(img.ImageURL.URL); ok {
+			entry.ImageURL.URL = ""
+			entry.MIMEType = mimeType
+			entry.Blob = blobs.put(data)
+		}
+		serial.Images = append(serial.Images, entry)
+	}
+	for _, img := range node.GetGeneratedImages() {
+		entry := generatedImageSerializable{MIMEType: img.MIMEType}
+		if len(img.Data) > 0 {
+			entry.Blob = blobs.put(img.Data)
+		}
+		serial.GeneratedImages = append(serial.GeneratedImages, entry)
+	}
+	for _, audio := range node.GetAudioFiles() {
+		entry := audioSerializable{Type: audio.Type, MIMEType: audio.MIMEType, URL: audio.URL}
+		if len(audio.Data) > 0 {
+			entry.Blob = blobs.put(audio.Data)
+		}
+		serial.AudioFiles = append(serial.AudioFiles, entry)
+	}
+	for _, pdf := range node.GetPDFFiles() {
+		entry := pdfSerializable{Type: pdf.Type, MIMEType: pdf.MIMEType, URL: pdf.URL, Filename: pdf.Filename}
+		if len(pdf.Data) > 0 {
+			entry.Blob = blobs.put(pdf.Data)
+		}
+		serial.PDFFiles = append(serial.PDFFiles, entry)
+	}
+
+	return serial
+}
+
+// blobHashes returns the hashes of all blobs a serialized node refers to
+func (s *msgNodeSerializable) blobHashes() []string {
+	var hashes []string
+	for _, img := range s.Images {
+		if img.Blob != "" {
+			hashes = append(hashes, img.Blob)
+		}
+	}
+	for _, img := range s.GeneratedImages {
+		if img.Blob != "" {
+			hashes = append(hashes, img.Blob)
+		}
+	}
+	for _, audio := range s.AudioFiles {
+		if audio.Blob != "" {
+			hashes = append(hashes, audio.Blob)
+		}
+	}
+	for _, pdf := range s.PDFFiles {
+		if pdf.Blob != "" {
+			hashes = append(hashes, pdf.Blob)
+		}
+	}
+	return hashes
+}
+
+// decodeNode rebuilds a node from any schema version. Attachments whose blob is
+// missing are dropped and counted in the returned value.
+func decodeNode(serial *msgNodeSerializable, blobs blobSet) (*messaging.MsgNode, int) {
+	missing := 0
+	node := messaging.NewMsgNode()
+	node.SetText(serial.Text)
+	node.Role = serial.Role
+	node.UserID = serial.UserID
+	node.HasBadAttachments = serial.HasBadAttachments
+	node.FetchParentFailed = serial.FetchParentFailed
+	node.SetWebSearchInfo(serial.WebSearchPerformed, serial.SearchResultCount)
+	node.SetGroundingMetadata(serial.GroundingMetadata)
+	node.SetDetectedURLs(serial.DetectedURLs)
+	node.SetVariants(serial.Variants, serial.SelectedVariant)
+	node.ParentMessageID = serial.ParentMessageID
+	node.ParentChannelID = serial.ParentChannelID
+	node.Imported = serial.Imported
+
+	// resolve returns inline data of version 1 rows or the referenced blob
+	resolve := func(inline []byte, hash string) ([]byte, bool) {
+		if hash == "" {
+			return inline, true
+		}
+		data, ok := blobs[hash]
+		if !ok {
+			missing++
+		}
+		return data, ok
+	}
+
+	for _, img := range serial.Images {
+		content := messaging.ImageContent{Type: img.Type, ImageURL: img.ImageURL}
+		if img.Blob != "" {
+			data, ok := resolve(nil, img.Blob)
+			if !ok {
+				continue
+			}
+			content.ImageURL.URL = fmt.Sprintf("data:%s;base64,%s", img.MIMEType, base64.StdEncoding.EncodeToString(data))
+		}
+		node.AddImage(content)
+	}
+	for _, img := range serial.GeneratedImages {
+		data, ok := resolve(img.Data, img.Blob)
+		if !ok {
+			continue
+		}
+		node.AddGeneratedImage(messaging.GeneratedImageContent{Data: data, MIMEType: img.MIMEType})
+	}
+	for _, audio := range serial.AudioFiles {
+		data, ok := resolve(audio.Data, audio.Blob)
+		if !ok {
+			continue
+		}
+		node.AddAudioFile(messaging.AudioContent{Type: audio.Type, MIMEType: audio.MIMEType, URL: audio.URL, Data: data})
+	}
+	for _, pdf := range serial.PDFFiles {
+		data, ok := resolve(pdf.Data, pdf.Blob)
+		if !ok {
+			continue
+		}
+		node.AddPDFFile(messaging.PDFContent{Type: pdf.Type, MIMEType: pdf.MIMEType, URL: pdf.URL, Filename: pdf.Filename, Data: data})
+	}
+
+	return node, missing
+}
+
+// parseDataURL splits a base64 data URL into its MIME type and decoded data
+func parseDataURL(url string) (string, []byte, bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", nil, false
+	}
+	header, payload, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", nil, false
+	}
+	mimeType, ok := strings.CutSuffix(header, ";base64")
+	if !ok {
+		return "", nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, false
+	}
+	return mimeType, data, true
+}
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Persona is a named preset of system prompt, model, temperature and appearance
+type Persona struct {
+	OwnerID      string // Empty for shared personas created by admins
+	Name         string
+	SystemPrompt string
+	Model        string   // Empty to keep the user's model
+	Temperature  *float32 // Nil to keep the model's temperature
+	AvatarURL    string
+	DisplayName  string
+}
+
+// Shared reports whether the persona is available to everyone
+func (p *Persona) Shared() bool {
+	return p.OwnerID == ""
+}
+
+// personaColumns are the persona columns in the order scanPersona reads them
+const personaColumns = "p.owner_id, p.name, p.system_prompt, p.model, p.temperature, p.avatar_url, p.display_name"
+
+// PersonaStore persists personas, the persona each user has chosen and the persona bound to each channel
+type PersonaStore struct {
+	db *sql.DB
+}
+
+// NewPersonaStore creates a new persona store with shared database connection
+func NewPersonaStore(dbURL string) *PersonaStore {
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+
+	// Use shared database connection
+	db, err := GetDatabase(dbURL)
+	if err != nil {
+		log.Fatalf("Failed to get database connection: %v", err)
+	}
+
+	return &PersonaStore{db: db}
+}
+
+// SavePersona creates a persona or replaces the one with the same owner and name
+func (ps *PersonaStore) SavePersona(ctx context.Context, persona Persona) error {
+	var temperature sql.NullFloat64
+	if persona.Temperature != nil {
+		temperature = sql.NullFloat64{Float64: float64(*persona.Temperature), Valid: true}
+	}
+
+	now := time.Now().Unix()
+	_, err := ps.db.ExecContext(ctx, `
+		INSERT INTO personas (owner_id, name, system_prompt, model, temperature, avatar_url, display_name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		ON CONFLICT (owner_id, name) DO UPDATE SET
+			system_prompt = EXCLUDED.system_prompt,
+			model = EXCLUDED.model,
+			temperature = EXCLUDED.temperature,
+			avatar_url = EXCLUDED.avatar_url,
+			display_name = EXCLUDED.display_name,
+			updated_at = EXCLUDED.updated_at
+	`, persona.OwnerID, persona.Name, persona.SystemPrompt, persona.Model, temperature, persona.AvatarURL, persona.DisplayName, now)
+	if err != nil {
+		return fmt.Errorf("failed to save persona: %w", err)
+	}
+	return nil
+}
+
+// DeletePersona deletes a persona and stops using it wherever it was chosen or bound.
+// It reports whether the persona existed.
+func (ps *PersonaStore) DeletePersona(ctx context.Context, ownerID, name string) (bool, error) {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to roll back persona deletion: %v", err)
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM personas WHERE owner_id = $1 AND name = $2`, ownerID, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete persona: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete persona: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_personas WHERE owner_id = $1 AND name = $2`, ownerID, name); err != nil {
+		return false, fmt.Errorf("failed to clear persona selections: %w", err)
+	}
+	if ownerID == "" {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM channel_personas WHERE name = $1`, name); err != nil {
+			return false, fmt.Errorf("failed to clear channel personas: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit persona deletion: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// FindPersona returns the persona a user means by name: their own, otherwise the shared one.
+// It returns nil if neither exists.
+func (ps *PersonaStore) FindPersona(ctx context.Context, userID, name string) (*Persona, error) {
+	return ps.queryPersona(ctx, `
+		SELECT `+personaColumns+` FROM personas p
+		WHERE p.name = $2 AND (p.owner_id = $1 OR p.owner_id = '')
+		ORDER BY p.owner_id DESC
+		LIMIT 1
+	`, userID, name)
+}
+
+// GetSharedPersona returns the shared persona with the given name, or nil if there is none
+func (ps *PersonaStore) GetSharedPersona(ctx context.Context, name string) (*Persona, error) {
+	return ps.queryPersona(ctx, `SELECT `+personaColumns+` FROM personas p WHERE p.owner_id = '' AND p.name = $1`, name)
+}
+
+// ListPersonas returns a user's own personas followed by the shared ones, each sorted by name
+func (ps *PersonaStore) ListPersonas(ctx context.Context, userID string) ([]Persona, error) {
+	rows, err := ps.db.QueryContext(ctx, `
+		SELECT `+personaColumns+` FROM personas p
+		WHERE p.owner_id = $1 OR p.owner_id = ''
+		ORDER BY p.owner_id DESC, p.name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list personas: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var personas []Persona
+	for rows.Next() {
+		persona, err := scanPersona(rows)
+		if err != nil {
+			return nil, err
+		}
+		personas = append(personas, *persona)
+	}
+	return personas, rows.Err()
+}
+
+// SetUserPersona makes a persona the one a user talks to everywhere
+func (ps *PersonaStore) SetUserPersona(ctx context.Context, userID string, persona *Persona) error {
+	_, err := ps.db.ExecContext(ctx, `
+		INSERT INTO user_personas (user_id, owner_id, name, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET
+			owner_id = EXCLUDED.owner_id,
+			name = EXCLUDED.name,
+			updated_at = EXCLUDED.updated_at
+	`, userID, persona.OwnerID, persona.Name, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save user persona: %w", err)
+	}
+	return nil
+}
+
+// ClearUserPersona returns a user to the channel's persona, if any
+func (ps *PersonaStore) ClearUserPersona(ctx context.Context, userID string) error {
+	if _, err := ps.db.ExecContext(ctx, `DELETE FROM user_personas WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to clear user persona: %w", err)
+	}
+	return nil
+}
+
+// SetChannelPersona binds a shared persona to a channel as the default for its users
+func (ps *PersonaStore) SetChannelPersona(ctx context.Context, channelID, name string) error {
+	_, err := ps.db.ExecContext(ctx, `
+		INSERT INTO channel_personas (channel_id, name, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (channel_id) DO UPDATE SET
+			name = EXCLUDED.name,
+			updated_at = EXCLUDED.updated_at
+	`, channelID, name, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save channel persona: %w", err)
+	}
+	return nil
+}
+
+// ClearChannelPersona unbinds a channel's persona
+func (ps *PersonaStore) ClearChannelPersona(ctx context.Context, channelID string) error {
+	if _, err := ps.db.ExecContext(ctx, `DELETE FROM channel_personas WHERE channel_id = $1`, channelID); err != nil {
+		return fmt.Errorf("failed to clear channel persona: %w", err)
+	}
+	return nil
+}
+
+// ActivePersona returns the persona answering a user in a channel: the one the user chose,
+// otherwise the one bound to the channel. It returns nil if there is neither.
+func (ps *PersonaStore) ActivePersona(ctx context.Context, userID, channelID string) (*Persona, error) {
+	persona, err := ps.queryPersona(ctx, `
+		SELECT `+personaColumns+` FROM user_personas u
+		JOIN personas p ON p.owner_id = u.owner_id AND p.name = u.name
+		WHERE u.user_id = $1
+	`, userID)
+	if err != nil || persona != nil || channelID == "" {
+		return persona, err
+	}
+
+	return ps.queryPersona(ctx, `
+		SELECT `+personaColumns+` FROM channel_personas c
+		JOIN personas p ON p.owner_id = '' AND p.name = c.name
+		WHERE c.channel_id = $1
+	`, channelID)
+}
+
+// queryPersona runs a query for at most one persona, returning nil if there is none
+func (ps *PersonaStore) queryPersona(ctx context.Context, query string, args ...any) (*Persona, error) {
+	persona, err := scanPersona(ps.db.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return persona, err
+}
+
+// scanPersona reads a persona selected with personaColumns
+func scanPersona(row interface{ Scan(...any) error }) (*Persona, error) {
+	var persona Persona
+	var temperature sql.NullFloat64
+	err := row.Scan(&persona.OwnerID, &persona.Name, &persona.SystemPrompt, &persona.Model,
+		&temperature, &persona.AvatarURL, &persona.DisplayName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read persona: %w", err)
+	}
+	if temperature.Valid {
+		value := float32(temperature.Float64)
+		persona.Temperature = &value
+	}
+	return &persona, nil
+}
+
+// Close closes the database connection
+func (ps *PersonaStore) Close() error {
+	// Database connection is shared, don't close it here
+	return nil
+}
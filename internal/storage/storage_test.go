@@ -0,0 +1,805 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// postgresURLEnv names a Postgres database the tests may drop and recreate tables in.
+// Postgres cases are skipped when it is unset.
+const postgresURLEnv = "TEST_DATABASE_URL"
+
+// testBackends returns the database URL of every backend the storage tests run against
+func testBackends(t *testing.T) []struct{ name, url string } {
+	return []struct{ name, url string }{
+		{"sqlite", "sqlite://" + filepath.Join(t.TempDir(), "bot.db")},
+		{"postgres", os.Getenv(postgresURLEnv)},
+	}
+}
+
+// openTestDatabase points the shared pool at dbURL and migrates a fresh schema into it
+func openTestDatabase(t *testing.T, dbURL string) {
+	t.Helper()
+	ctx := context.Background()
+
+	globalPool = nil
+	t.Cleanup(func() {
+		if err := CloseDatabase(); err != nil {
+			t.Errorf("CloseDatabase: %v", err)
+		}
+		globalPool = nil
+	})
+
+	if err := DropAllTables(ctx, dbURL); err != nil {
+		t.Fatalf("DropAllTables: %v", err)
+	}
+	if err := InitializeAllTables(ctx, dbURL); err != nil {
+		t.Fatalf("InitializeAllTables: %v", err)
+	}
+}
+
+// newTestNodeCache creates a node cache that keeps nodes until evicted by the test
+func newTestNodeCache(t *testing.T, dbURL string) *MessageNodeCache {
+	t.Helper()
+	cache := NewMessageNodeCache(dbURL, func() time.Duration { return 0 })
+	t.Cleanup(func() { _ = cache.Close() })
+	return cache
+}
+
+// saveTestNodes writes nodes synchronously, bypassing the batching queue
+func saveTestNodes(t *testing.T, cache *MessageNodeCache, nodes map[string]*messaging.MsgNode) {
+	t.Helper()
+	var batch []*messaging.ProcessedNode
+	for id, node := range nodes {
+		batch = append(batch, &messaging.ProcessedNode{MessageID: id, Node: node})
+	}
+	if err := cache.saveNodes(context.Background(), batch); err != nil {
+		t.Fatalf("saveNodes: %v", err)
+	}
+}
+
+// mustGetNode returns a cached node, failing the test on errors
+func mustGetNode(t *testing.T, cache *MessageNodeCache, id string) *messaging.MsgNode {
+	t.Helper()
+	node, err := cache.GetNode(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetNode(%s): %v", id, err)
+	}
+	return node
+}
+
+// countRows returns the number of rows in a table
+func countRows(t *testing.T, dbURL, table string) int {
+	t.Helper()
+	db, err := GetDatabase(dbURL)
+	if err != nil {
+		t.Fatalf("GetDatabase: %v", err)
+	}
+	var count int
+	if err := db.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return count
+}
+
+// execSQL runs a statement on the shared connection
+func execSQL(t *testing.T, dbURL, query string, args ...any) {
+	t.Helper()
+	db, err := GetDatabase(dbURL)
+	if err != nil {
+		t.Fatalf("GetDatabase: %v", err)
+	}
+	if _, err := db.ExecContext(context.Background(), query, args...); err != nil {
+		t.Fatalf("exec %q: %v", query, err)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, dbURL string)
+	}{
+		{"migrations", testMigrations},
+		{"node save and get", testNodeSaveGet},
+		{"shared blobs", testSharedBlobs},
+		{"legacy node migration", testLegacyNodeMigration},
+		{"TTL cleanup", testTTLCleanup},
+		{"summary last use", testSummaryLastUse},
+		{"config overrides", testConfigOverrides},
+		{"usage ledger", testUsageLedger},
+		{"user preferences", testUserPreferences},
+		{"API keys", testAPIKeys},
+		{"chart libraries", testChartLibraries},
+		{"personas", testPersonas},
+	}
+
+	for _, backend := range testBackends(t) {
+		t.Run(backend.name, func(t *testing.T) {
+			if backend.url == "" {
+				t.Skipf("%s is not set", postgresURLEnv)
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					openTestDatabase(t, backend.url)
+					tt.run(t, backend.url)
+				})
+			}
+		})
+	}
+}
+
+func testMigrations(t *testing.T, dbURL string) {
+	ctx := context.Background()
+	migrator, err := NewMigrator(dbURL)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(statuses) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for _, status := range statuses {
+		if !status.Applied() {
+			t.Errorf("migration %04d_%s not applied", status.Version, status.Name)
+		}
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("second Up applied %d migrations, want 0", len(applied))
+	}
+
+	reverted, err := migrator.Down(ctx, len(statuses))
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if len(reverted) != len(statuses) {
+		t.Errorf("Down reverted %d migrations, want %d", len(reverted), len(statuses))
+	}
+	if reverted[0].Version != statuses[len(statuses)-1].Version {
+		t.Errorf("Down reverted %04d first, want the latest %04d", reverted[0].Version, statuses[len(statuses)-1].Version)
+	}
+
+	applied, err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+	if len(applied) != len(statuses) {
+		t.Errorf("Up after Down applied %d migrations, want %d", len(applied), len(statuses))
+	}
+}
+
+func testNodeSaveGet(t *testing.T, dbURL string) {
+	cache := newTestNodeCache(t, dbURL)
+
+	node := messaging.NewMsgNode()
+	node.SetText("hello")
+	node.Role = "assistant"
+	node.UserID = "42"
+	node.ParentMessageID = "1"
+	node.ParentChannelID = "2"
+	node.SetWebSearchInfo(true, 3)
+	node.SetVariants([]messaging.ResponseVariant{{Text: "first"}, {Text: "hello"}}, 1)
+	node.AddImage(messaging.ImageContent{Type: "image_url", ImageURL: messaging.ImageURL{URL: "data:image/png;base64,AAECAw=="}})
+	node.AddImage(messaging.ImageContent{Type: "image_url", ImageURL: messaging.ImageURL{URL: "https://example.com/cat.png"}})
+	node.AddGeneratedImage(messaging.GeneratedImageContent{Data: []byte("generated"), MIMEType: "image/png"})
+	node.AddPDFFile(messaging.PDFContent{Type: "pdf_file", MIMEType: "application/pdf", Filename: "doc.pdf", Data: []byte("%PDF-1.7")})
+	saveTestNodes(t, cache, map[string]*messaging.MsgNode{"100": node})
+
+	got := mustGetNode(t, cache, "100")
+	if got == nil {
+		t.Fatal("GetNode returned a miss for a saved node")
+	}
+	if got.GetText() != "hello" || got.Role != "assistant" || got.UserID != "42" {
+		t.Errorf("got text %q, role %q, user %q", got.GetText(), got.Role, got.UserID)
+	}
+	if got.ParentMessageID != "1" || got.ParentChannelID != "2" {
+		t.Errorf("got parent %s/%s, want 2/1", got.ParentChannelID, got.ParentMessageID)
+	}
+	if searched, count := got.GetWebSearchInfo(); !searched || count != 3 {
+		t.Errorf("got web search %v with %d results, want true with 3", searched, count)
+	}
+	if variants, selected := got.GetVariants(); len(variants) != 2 || selected != 1 {
+		t.Errorf("got %d variants with %d selected, want 2 with 1", len(variants), selected)
+	}
+
+	images := got.GetImages()
+	if len(images) != 2 || images[0].ImageURL.URL != "data:image/png;base64,AAECAw==" || images[1].ImageURL.URL != "https://example.com/cat.png" {
+		t.Errorf("got images %+v", images)
+	}
+	if generated := got.GetGeneratedImages(); len(generated) != 1 || !bytes.Equal(generated[0].Data, []byte("generated")) {
+		t.Errorf("got generated images %+v", generated)
+	}
+	if pdfs := got.GetPDFFiles(); len(pdfs) != 1 || pdfs[0].Filename != "doc.pdf" || !bytes.Equal(pdfs[0].Data, []byte("%PDF-1.7")) {
+		t.Errorf("got PDFs %+v", pdfs)
+	}
+	if blobs := countRows(t, dbURL, "message_blobs"); blobs != 3 {
+		t.Errorf("got %d blobs, want 3", blobs)
+	}
+
+	// Saving again replaces the node
+	node.SetText("edited")
+	saveTestNodes(t, cache, map[string]*messaging.MsgNode{"100": node})
+	if got := mustGetNode(t, cache, "100"); got == nil || got.GetText() != "edited" {
+		t.Errorf("got %+v after resaving, want text %q", got, "edited")
+	}
+
+	if err := cache.DeleteNode(context.Background(), "100"); err != nil {
+		t.Fatalf("DeleteNode: %v", err)
+	}
+	if got := mustGetNode(t, cache, "100"); got != nil {
+		t.Error("GetNode found a deleted node")
+	}
+	if got := mustGetNode(t, cache, "missing"); got != nil {
+		t.Error("GetNode found a node that was never saved")
+	}
+}
+
+func testSharedBlobs(t *testing.T, dbURL string) {
+	cache := newTestNodeCache(t, dbURL)
+
+	nodes := make(map[string]*messaging.MsgNode)
+	for _, id := range []string{"1", "2"} {
+		node := messaging.NewMsgNode()
+		node.SetText("node " + id)
+		node.AddGeneratedImage(messaging.GeneratedImageContent{Data: []byte("same image"), MIMEType: "image/png"})
+		nodes[id] = node
+	}
+	saveTestNodes(t, cache, nodes)
+
+	if blobs := countRows(t, dbURL, "message_blobs"); blobs != 1 {
+		t.Errorf("got %d blobs for identical data, want 1", blobs)
+	}
+	for id := range nodes {
+		got := mustGetNode(t, cache, id)
+		if got == nil || len(got.GetGeneratedImages()) != 1 || !bytes.Equal(got.GetGeneratedImages()[0].Data, []byte("same image")) {
+			t.Errorf("node %s lost its shared image: %+v", id, got)
+		}
+	}
+
+	// last_used only moves forward when a blob is written again
+	future := time.Now().Add(time.Hour).Unix()
+	execSQL(t, dbURL, `UPDATE message_blobs SET last_used = $1`, future)
+	saveTestNodes(t, cache, map[string]*messaging.MsgNode{"1": nodes["1"]})
+
+	db, _ := GetDatabase(dbURL)
+	var lastUsed int64
+	if err := db.QueryRowContext(context.Background(), `SELECT last_used FROM message_blobs`).Scan(&lastUsed); err != nil {
+		t.Fatalf("query last_used: %v", err)
+	}
+	if lastUsed != future {
+		t.Errorf("resaving moved last_used back to %d, want %d", lastUsed, future)
+	}
+
+	// A node whose blob was evicted loses only that attachment
+	execSQL(t, dbURL, `DELETE FROM message_blobs`)
+	got := mustGetNode(t, cache, "2")
+	if got == nil || got.GetText() != "node 2" || len(got.GetGeneratedImages()) != 0 {
+		t.Errorf("got %+v for a node with an evicted blob, want its text without images", got)
+	}
+}
+
+func testLegacyNodeMigration(t *testing.T, dbURL string) {
+	cache := newTestNodeCache(t, dbURL)
+	dialect := DialectOf(dbURL)
+
+	// Version 1 rows have no version and keep image data inline
+	legacy := []byte(`{"text":"old","images":[{"type":"image_url","image_url":{"url":"data:image/png;base64,AAECAw=="}}],"generated_images":[],"role":"user","user_id":"7"}`)
+	updatedAt := time.Now().Add(-time.Hour).Unix()
+	execSQL(t, dbURL, `INSERT INTO message_nodes (message_id, data, updated_at) VALUES ($1, $2, $3)`, "legacy", dialect.jsonValue(legacy), updatedAt)
+	execSQL(t, dbURL, `INSERT INTO message_nodes (message_id, data, updated_at) VALUES ($1, $2, $3)`, "broken", dialect.jsonValue([]byte(`{"text":1}`)), updatedAt)
+
+	if err := cache.migrateLegacyNodes(context.Background()); err != nil {
+		t.Fatalf("migrateLegacyNodes: %v", err)
+	}
+
+	// Checked before reading the node, which refreshes it
+	db, _ := GetDatabase(dbURL)
+	var kept int64
+	if err := db.QueryRowContext(context.Background(), `SELECT updated_at FROM message_nodes WHERE message_id = $1`, "legacy").Scan(&kept); err != nil {
+		t.Fatalf("query updated_at: %v", err)
+	}
+	if kept != updatedAt {
+		t.Errorf("migration changed updated_at to %d, want %d", kept, updatedAt)
+	}
+
+	got := mustGetNode(t, cache, "legacy")
+	if got == nil || got.GetText() != "old" || got.UserID != "7" {
+		t.Fatalf("got %+v for the migrated node", got)
+	}
+	if images := got.GetImages(); len(images) != 1 || images[0].ImageURL.URL != "data:image/png;base64,AAECAw==" {
+		t.Errorf("got images %+v after migration", images)
+	}
+	if blobs := countRows(t, dbURL, "message_blobs"); blobs != 1 {
+		t.Errorf("got %d blobs after migration, want the inline image moved to 1", blobs)
+	}
+	if got := mustGetNode(t, cache, "broken"); got != nil {
+		t.Error("unreadable legacy node was kept")
+	}
+}
+
+func testTTLCleanup(t *testing.T, dbURL string) {
+	cache := newTestNodeCache(t, dbURL)
+
+	nodes := make(map[string]*messaging.MsgNode)
+	for _, id := range []string{"old", "read", "new"} {
+		node := messaging.NewMsgNode()
+		node.SetText(id)
+		node.AddGeneratedImage(messaging.GeneratedImageContent{Data: []byte("image of " + id), MIMEType: "image/png"})
+		nodes[id] = node
+	}
+	saveTestNodes(t, cache, nodes)
+
+	old := time.Now().Add(-48 * time.Hour).Unix()
+	for _, id := range []string{"old", "read"} {
+		hash := make(blobSet).put([]byte("image of " + id))
+		execSQL(t, dbURL, `UPDATE message_nodes SET updated_at = $1 WHERE message_id = $2`, old, id)
+		execSQL(t, dbURL, `UPDATE message_blobs SET last_used = $1 WHERE hash = $2`, old, hash)
+	}
+
+	// Reading a node keeps it and its blobs from expiring
+	if got := mustGetNode(t, cache, "read"); got == nil {
+		t.Fatal("node to read is missing")
+	}
+
+	evictedNodes, evictedBlobs, err := cache.EvictExpired(context.Background(), time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("EvictExpired: %v", err)
+	}
+	if evictedNodes != 1 || evictedBlobs != 1 {
+		t.Errorf("evicted %d nodes and %d blobs, want 1 and 1", evictedNodes, evictedBlobs)
+	}
+
+	if got := mustGetNode(t, cache, "old"); got != nil {
+		t.Error("expired node was not evicted")
+	}
+	for _, id := range []string{"read", "new"} {
+		got := mustGetNode(t, cache, id)
+		if got == nil || len(got.GetGeneratedImages()) != 1 {
+			t.Errorf("got %+v for unexpired node %s, want it with its image", got, id)
+		}
+	}
+}
+
+func testSummaryLastUse(t *testing.T, dbURL string) {
+	ctx := context.Background()
+	cache := NewSummaryCache(dbURL, func() time.Duration { return 0 })
+	t.Cleanup(func() { _ = cache.Close() })
+
+	if err := cache.SaveSummary(ctx, "recent", 1, "recently touched"); err != nil {
+		t.Fatalf("SaveSummary: %v", err)
+	}
+	if err := cache.SaveSummary(ctx, "stale", 1, "touched long ago"); err != nil {
+		t.Fatalf("SaveSummary: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	execSQL(t, dbURL, `UPDATE context_summaries SET last_used = $1`, old.Unix())
+	cache.memory.Add("stale", cachedSummary{summary: "touched long ago", touched: old})
+
+	// Memory hits write the use through only once the last write is older than touchInterval
+	for _, hash := range []string{"recent", "stale"} {
+		if _, ok, err := cache.GetSummary(ctx, hash); err != nil || !ok {
+			t.Fatalf("GetSummary(%s) = %v, %v", hash, ok, err)
+		}
+	}
+	evicted, err := cache.EvictExpired(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("EvictExpired: %v", err)
+	}
+	if evicted != 1 {
+		t.Errorf("evicted %d summaries, want only the one not touched", evicted)
+	}
+	if _, ok, _ := cache.GetSummary(ctx, "stale"); !ok {
+		t.Error("summary used from memory was evicted")
+	}
+}
+
+func testConfigOverrides(t *testing.T, dbURL string) {
+	ctx := context.Background()
+	store := NewConfigOverrideStore(dbURL)
+
+	got, err := store.GetOverrides(ctx, ScopeGuild, "1")
+	if err != nil {
+		t.Fatalf("GetOverrides: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("got %+v for a guild without overrides, want nil", got)
+	}
+
+	model := "openai/gpt-4o"
+	maxMessages := 10
+	webSearch := false
+	overrides := &config.Overrides{
+		DefaultModel:  &model,
+		AllowedModels: []string{"openai/gpt-4o", "google/gemini-2.5-pro"},
+		MaxMessages:   &maxMessages,
+		WebSearch:     &webSearch,
+	}
+	if err := store.SaveOverrides(ctx, ScopeGuild, "1", overrides, "admin"); err != nil {
+		t.Fatalf("SaveOverrides: %v", err)
+	}
+
+	got, err = store.GetOverrides(ctx, ScopeGuild, "1")
+	if err != nil {
+		t.Fatalf("GetOverrides after save: %v", err)
+	}
+	if got == nil || got.DefaultModel == nil || *got.DefaultModel != model || len(got.AllowedModels) != 2 ||
+		got.MaxMessages == nil || *got.MaxMessages != maxMessages || got.WebSearch == nil || *got.WebSearch {
+		t.Errorf("got %+v after save, want %+v", got, overrides)
+	}
+	if got.SystemPrompt != nil || got.UseThreads != nil {
+		t.Errorf("unset settings came back overridden: %+v", got)
+	}
+
+	// Scopes are independent
+	if got, err := store.GetOverrides(ctx, ScopeChannel, "1"); err != nil || got != nil {
+		t.Errorf("got %+v, %v for a channel with the guild's ID, want nil", got, err)
+	}
+
+	// Updates replace the stored overrides and are seen at once
+	maxMessages = 20
+	if err := store.SaveOverrides(ctx, ScopeGuild, "1", &config.Overrides{MaxMessages: &maxMessages}, "admin"); err != nil {
+		t.Fatalf("SaveOverrides update: %v", err)
+	}
+	got, err = store.GetOverrides(ctx, ScopeGuild, "1")
+	if err != nil || got == nil || got.MaxMessages == nil || *got.MaxMessages != 20 || got.DefaultModel != nil {
+		t.Errorf("got %+v, %v after update, want only max_messages 20", got, err)
+	}
+
+	// Empty overrides delete the row
+	if err := store.SaveOverrides(ctx, ScopeGuild, "1", &config.Overrides{}, "admin"); err != nil {
+		t.Fatalf("SaveOverrides empty: %v", err)
+	}
+	if got, err := store.GetOverrides(ctx, ScopeGuild, "1"); err != nil || got != nil {
+		t.Errorf("got %+v, %v after clearing, want nil", got, err)
+	}
+	if rows := countRows(t, dbURL, "config_overrides"); rows != 0 {
+		t.Errorf("got %d override rows after clearing, want 0", rows)
+	}
+}
+
+func testUsageLedger(t *testing.T, dbURL string) {
+	ctx := context.Background()
+	ledger := NewUsageLedger(dbURL)
+
+	// Late on the last day of a month in UTC+2, which is still that day in UTC
+	now := time.Date(2026, 3, 31, 23, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	records := []UsageRecord{
+		{UserID: "1", GuildID: "g", Model: "openai/gpt-5", PromptTokens: 100, CompletionTokens: 10, Cost: 0.5, Time: now},
+		{UserID: "1", GuildID: "g", Model: "openai/gpt-5", PromptTokens: 200, CompletionTokens: 20, Cost: 0.25, Time: now.Add(-time.Hour)},
+		{UserID: "1", Model: "gemini/flash", PromptTokens: 50, CompletionTokens: 5, Time: now},
+		// Past midnight locally, but still March 31st in UTC
+		{UserID: "1", GuildID: "g", Model: "openai/gpt-5", PromptTokens: 1, Time: now.Add(90 * time.Minute)},
+		{UserID: "1", GuildID: "g", Model: "openai/gpt-5", PromptTokens: 1000, Time: now.AddDate(0, 0, -1)},
+		{UserID: "1", GuildID: "g", Model: "openai/gpt-5", PromptTokens: 5000, Time: now.AddDate(0, 0, -31)},
+		{UserID: "2", GuildID: "g", Model: "gemini/flash", PromptTokens: 7, CompletionTokens: 3, Time: now},
+	}
+	for _, record := range records {
+		if err := ledger.Record(ctx, record); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	// Responses of a user, guild, model and day add up in one row
+	if rows := countRows(t, dbURL, "usage_ledger"); rows != 5 {
+		t.Errorf("got %d ledger rows, want 5", rows)
+	}
+
+	day, err := ledger.UserTotals(ctx, "1", StartOfDay(now))
+	if err != nil {
+		t.Fatalf("UserTotals: %v", err)
+	}
+	want := UsageTotals{PromptTokens: 351, CompletionTokens: 35, Cost: 0.75, Requests: 4}
+	if day != want {
+		t.Errorf("day totals = %+v, want %+v", day, want)
+	}
+	month, err := ledger.UserTotals(ctx, "1", StartOfMonth(now))
+	if err != nil {
+		t.Fatalf("UserTotals: %v", err)
+	}
+	if month.PromptTokens != 1351 || month.Requests != 5 {
+		t.Errorf("month totals = %+v, want 1351 prompt tokens in 5 requests", month)
+	}
+	if got := StartOfMonth(now); !got.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("StartOfMonth = %v, want March 1st in UTC", got)
+	}
+
+	guild, err := ledger.GuildTotals(ctx, "g", StartOfDay(now))
+	if err != nil {
+		t.Fatalf("GuildTotals: %v", err)
+	}
+	if guild.TotalTokens() != 341 || guild.Requests != 4 {
+		t.Errorf("guild totals = %+v, want 341 tokens in 4 requests", guild)
+	}
+
+	breakdown, err := ledger.UserModelBreakdown(ctx, "1", StartOfMonth(now))
+	if err != nil {
+		t.Fatalf("UserModelBreakdown: %v", err)
+	}
+	if len(breakdown) != 2 || breakdown[0].Model != "openai/gpt-5" || breakdown[0].TotalTokens() != 1331 ||
+		breakdown[1].Model != "gemini/flash" || breakdown[1].Requests != 1 {
+		t.Errorf("breakdown = %+v, want openai/gpt-5 with 1331 tokens, then gemini/flash", breakdown)
+	}
+
+	if empty, err := ledger.UserTotals(ctx, "3", StartOfMonth(now)); err != nil || empty != (UsageTotals{}) {
+		t.Errorf("totals of a user without usage = %+v, %v, want zero", empty, err)
+	}
+}
+
+func testUserPreferences(t *testing.T, dbURL string) {
+	ctx := context.Background()
+	prefs := NewUserPreferencesManager(dbURL)
+	t.Cleanup(func() { _ = prefs.Close() })
+
+	if got := prefs.GetUserModel(ctx, "1", "default/model"); got != "default/model" {
+		t.Errorf("model of a new user = %q, want the default", got)
+	}
+	if got := prefs.GetUserSystemPrompt(ctx, "1"); got != "" {
+		t.Errorf("system prompt of a new user = %q, want none", got)
+	}
+
+	// The model and system prompt upserts each keep the other column
+	if err := prefs.SetUserModel(ctx, "1", "openai/gpt-5"); err != nil {
+		t.Fatalf("SetUserModel: %v", err)
+	}
+	if err := prefs.SetUserSystemPrompt(ctx, "1", "Be brief."); err != nil {
+		t.Fatalf("SetUserSystemPrompt: %v", err)
+	}
+	if err := prefs.SetUserModel(ctx, "1", "anthropic/opus"); err != nil {
+		t.Fatalf("SetUserModel: %v", err)
+	}
+	if got := prefs.GetUserModel(ctx, "1", "default/model"); got != "anthropic/opus" {
+		t.Errorf("model = %q, want anthropic/opus", got)
+	}
+	if got := prefs.GetUserSystemPrompt(ctx, "1"); got != "Be brief." {
+		t.Errorf("system prompt = %q, want it kept when the model changed", got)
+	}
+
+	if err := prefs.ClearUserSystemPrompt(ctx, "1"); err != nil {
+		t.Fatalf("ClearUserSystemPrompt: %v", err)
+	}
+	if got := prefs.GetUserSystemPrompt(ctx, "1"); got != "" {
+		t.Errorf("system prompt after clearing = %q, want none", got)
+	}
+	if got := prefs.GetUserModel(ctx, "1", "default/model"); got != "anthropic/opus" {
+		t.Errorf("model after clearing the prompt = %q, want it kept", got)
+	}
+	if rows := countRows(t, dbURL, "user_preferences"); rows != 1 {
+		t.Errorf("got %d preference rows, want 1", rows)
+	}
+
+	// Gemini models saved before provider prefixes get one
+	if err := prefs.SetUserModel(ctx, "2", "gemini-1.5-flash"); err != nil {
+		t.Fatalf("SetUserModel: %v", err)
+	}
+	if got := prefs.GetUserModel(ctx, "2", "default/model"); got != "gemini/gemini-1.5-flash" {
+		t.Errorf("legacy Gemini model = %q, want gemini/gemini-1.5-flash", got)
+	}
+}
+
+func testAPIKeys(t *testing.T, dbURL string) {
+	ctx := context.Background()
+	keys := []string{"a", "b", "c"}
+	manager := NewAPIKeyManager(dbURL)
+
+	next := func() string {
+		t.Helper()
+		key, err := manager.GetNextAPIKey(ctx, "openai", keys)
+		if err != nil {
+			t.Fatalf("GetNextAPIKey: %v", err)
+		}
+		return key
+	}
+	for i, want := range []string{"a", "b", "c", "a"} {
+		if got := next(); got != want {
+			t.Errorf("key %d = %s, want %s", i, got, want)
+		}
+	}
+
+	// Marking a key again updates its row
+	for _, reason := range []string{"rate limited", "invalid"} {
+		if err := manager.MarkKeyAsBad(ctx, "openai", "b", reason); err != nil {
+			t.Fatalf("MarkKeyAsBad: %v", err)
+		}
+	}
+	if rows := countRows(t, dbURL, "bad_api_keys"); rows != 1 {
+		t.Errorf("got %d bad key rows, want 1", rows)
+	}
+	for i := 0; i < 4; i++ {
+		if got := next(); got == "b" {
+			t.Fatal("a bad key was handed out")
+		}
+	}
+
+	// A new manager reads bad keys from the database
+	if key, err := NewAPIKeyManager(dbURL).GetNextAPIKey(ctx, "openai", []string{"b", "c"}); err != nil || key != "c" {
+		t.Errorf("new manager returned %s, %v, want c", key, err)
+	}
+	stats, err := manager.GetBadKeyStats(ctx)
+	if err != nil || stats["openai"] != 1 {
+		t.Errorf("GetBadKeyStats = %v, %v, want one bad openai key", stats, err)
+	}
+
+	// Once every key is bad they are all reset
+	for _, key := range []string{"a", "c"} {
+		if err := manager.MarkKeyAsBad(ctx, "openai", key, "invalid"); err != nil {
+			t.Fatalf("MarkKeyAsBad: %v", err)
+		}
+	}
+	if got := next(); got != "a" {
+		t.Errorf("key after every key went bad = %s, want the first", got)
+	}
+	if rows := countRows(t, dbURL, "bad_api_keys"); rows != 0 {
+		t.Errorf("got %d bad key rows after the reset, want 0", rows)
+	}
+
+	if _, err := manager.GetNextAPIKey(ctx, "openai", nil); err == nil {
+		t.Error("GetNextAPIKey without keys succeeded")
+	}
+}
+
+func testChartLibraries(t *testing.T, dbURL string) {
+	ctx := context.Background()
+	manager := NewChartLibraryManager(dbURL)
+	t.Cleanup(func() { _ = manager.Close() })
+
+	library := &ChartLibrary{
+		Name:         "seaborn",
+		Version:      "0.13.0",
+		InstallDate:  1000,
+		LastUsed:     1000,
+		IsInstalled:  true,
+		Dependencies: `{"matplotlib": ">=3.4", "pandas": ">=1.2"}`,
+	}
+	if err := manager.AddLibrary(ctx, library); err != nil {
+		t.Fatalf("AddLibrary: %v", err)
+	}
+	got, err := manager.GetLibrary(ctx, "seaborn")
+	if err != nil {
+		t.Fatalf("GetLibrary: %v", err)
+	}
+	if got == nil || *got != *library {
+		t.Errorf("GetLibrary = %+v, want %+v", got, library)
+	}
+
+	// Marking an added library installed keeps its dependencies
+	if err := manager.MarkLibraryInstalled(ctx, "seaborn", "0.13.2"); err != nil {
+		t.Fatalf("MarkLibraryInstalled: %v", err)
+	}
+	if err := manager.MarkLibraryInstalled(ctx, "plotly", "5.0.0"); err != nil {
+		t.Fatalf("MarkLibraryInstalled: %v", err)
+	}
+	got, err = manager.GetLibrary(ctx, "seaborn")
+	if err != nil || got == nil || got.Version != "0.13.2" || got.Dependencies != library.Dependencies || got.InstallDate <= 1000 {
+		t.Errorf("GetLibrary after install = %+v, %v, want version 0.13.2 with the same dependencies", got, err)
+	}
+	if got, err := manager.GetLibrary(ctx, "plotly"); err != nil || got == nil || got.Dependencies != "{}" {
+		t.Errorf("GetLibrary(plotly) = %+v, %v, want empty dependencies", got, err)
+	}
+
+	if err := manager.MarkLibraryUninstalled(ctx, "plotly"); err != nil {
+		t.Fatalf("MarkLibraryUninstalled: %v", err)
+	}
+	for name, want := range map[string]bool{"seaborn": true, "plotly": false, "bokeh": false} {
+		if installed, err := manager.IsLibraryInstalled(ctx, name); err != nil || installed != want {
+			t.Errorf("IsLibraryInstalled(%s) = %v, %v, want %v", name, installed, err, want)
+		}
+	}
+	installed, err := manager.GetInstalledLibraries(ctx)
+	if err != nil || len(installed) != 1 || installed[0].Name != "seaborn" {
+		t.Errorf("GetInstalledLibraries = %+v, %v, want seaborn", installed, err)
+	}
+	stats, err := manager.GetLibraryStats(ctx)
+	if err != nil || stats["total_libraries"] != 2 || stats["installed_libraries"] != 1 {
+		t.Errorf("GetLibraryStats = %v, %v, want 2 libraries with 1 installed", stats, err)
+	}
+
+	if err := manager.RemoveLibrary(ctx, "seaborn"); err != nil {
+		t.Fatalf("RemoveLibrary: %v", err)
+	}
+	if got, err := manager.GetLibrary(ctx, "seaborn"); err != nil || got != nil {
+		t.Errorf("GetLibrary after removal = %+v, %v, want nil", got, err)
+	}
+}
+
+func testPersonas(t *testing.T, dbURL string) {
+	ctx := context.Background()
+	store := NewPersonaStore(dbURL)
+	t.Cleanup(func() { _ = store.Close() })
+
+	temperature := float32(0.5)
+	shared := Persona{Name: "pirate", SystemPrompt: "Talk like a pirate.", Model: "openai/gpt-5", Temperature: &temperature}
+	own := Persona{OwnerID: "1", Name: "pirate", SystemPrompt: "Talk like my pirate.", DisplayName: "Captain"}
+	for _, persona := range []Persona{shared, own, {Name: "tutor", SystemPrompt: "Explain step by step."}} {
+		if err := store.SavePersona(ctx, persona); err != nil {
+			t.Fatalf("SavePersona: %v", err)
+		}
+	}
+
+	// A user's own persona takes precedence over the shared one of the same name
+	if got, err := store.FindPersona(ctx, "1", "pirate"); err != nil || got == nil || got.OwnerID != "1" || got.DisplayName != "Captain" {
+		t.Errorf("FindPersona for the owner = %+v, %v, want their own", got, err)
+	}
+	got, err := store.FindPersona(ctx, "2", "pirate")
+	if err != nil || got == nil || !got.Shared() || got.Temperature == nil || *got.Temperature != temperature || got.Model != "openai/gpt-5" {
+		t.Errorf("FindPersona for someone else = %+v, %v, want the shared one", got, err)
+	}
+	if got, err := store.FindPersona(ctx, "2", "missing"); err != nil || got != nil {
+		t.Errorf("FindPersona(missing) = %+v, %v, want nil", got, err)
+	}
+
+	list, err := store.ListPersonas(ctx, "1")
+	if err != nil || len(list) != 3 || list[0].OwnerID != "1" || list[1].Name != "pirate" || list[2].Name != "tutor" {
+		t.Errorf("ListPersonas = %+v, %v, want the user's pirate, then the shared pirate and tutor", list, err)
+	}
+
+	// Saving again replaces the persona
+	shared.SystemPrompt = "Talk like a polite pirate."
+	shared.Temperature = nil
+	if err := store.SavePersona(ctx, shared); err != nil {
+		t.Fatalf("SavePersona: %v", err)
+	}
+	if got, err := store.GetSharedPersona(ctx, "pirate"); err != nil || got == nil || got.SystemPrompt != shared.SystemPrompt || got.Temperature != nil {
+		t.Errorf("GetSharedPersona after update = %+v, %v, want the new prompt without a temperature", got, err)
+	}
+
+	// A user's choice wins over the channel's persona
+	if err := store.SetChannelPersona(ctx, "c", "tutor"); err != nil {
+		t.Fatalf("SetChannelPersona: %v", err)
+	}
+	if err := store.SetUserPersona(ctx, "1", &own); err != nil {
+		t.Fatalf("SetUserPersona: %v", err)
+	}
+	active := func(userID string) string {
+		t.Helper()
+		persona, err := store.ActivePersona(ctx, userID, "c")
+		if err != nil {
+			t.Fatalf("ActivePersona: %v", err)
+		}
+		if persona == nil {
+			return ""
+		}
+		return persona.OwnerID + "/" + persona.Name
+	}
+	if got := active("1"); got != "1/pirate" {
+		t.Errorf("active persona of the user = %s, want their own pirate", got)
+	}
+	if got := active("2"); got != "/tutor" {
+		t.Errorf("active persona of others = %s, want the channel's tutor", got)
+	}
+
+	if err := store.ClearUserPersona(ctx, "1"); err != nil {
+		t.Fatalf("ClearUserPersona: %v", err)
+	}
+	if got := active("1"); got != "/tutor" {
+		t.Errorf("active persona after clearing = %s, want the channel's tutor", got)
+	}
+
+	// Deleting a shared persona unbinds it from channels
+	if deleted, err := store.DeletePersona(ctx, "", "tutor"); err != nil || !deleted {
+		t.Fatalf("DeletePersona = %v, %v", deleted, err)
+	}
+	if got := active("2"); got != "" {
+		t.Errorf("active persona after deleting the channel's = %s, want none", got)
+	}
+	if rows := countRows(t, dbURL, "channel_personas"); rows != 0 {
+		t.Errorf("got %d channel persona rows, want 0", rows)
+	}
+	if deleted, err := store.DeletePersona(ctx, "", "tutor"); err != nil || deleted {
+		t.Errorf("deleting a missing persona = %v, %v, want false", deleted, err)
+	}
+}
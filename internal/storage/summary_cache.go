@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// summaryMemoryEntries is how many summaries are kept in memory in front of the database
+const summaryMemoryEntries = 1000
+
+// cachedSummary is a summary held in memory and when its last use was last written to the database
+type cachedSummary struct {
+	summary string
+	touched time.Time
+}
+
+// SummaryCache persists conversation summaries keyed by a hash of the summarized messages,
+// so later turns of a long chain reuse them instead of summarizing again. Rows unused for
+// the message cache TTL are evicted.
+type SummaryCache struct {
+	db     *sql.DB
+	memory *lru.Cache[string, cachedSummary]
+	ttl    func() time.Duration
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewSummaryCache creates the cache on the shared database connection.
+// ttl is called before every eviction pass; zero keeps summaries forever.
+func NewSummaryCache(dbURL string, ttl func() time.Duration) *SummaryCache {
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL is required for summary cache")
+	}
+
+	db, err := GetDatabase(dbURL)
+	if err != nil {
+		log.Fatalf("Failed to get database connection: %v", err)
+	}
+
+	memory, err := lru.New[string, cachedSummary](summaryMemoryEntries)
+	if err != nil {
+		log.Fatalf("Failed to create summary memory cache: %v", err)
+	}
+
+	cache := &SummaryCache{
+		db:     db,
+		memory: memory,
+		ttl:    ttl,
+		stop:   make(chan struct{}),
+	}
+
+	cache.wg.Add(1)
+	go cache.evictionWorker()
+
+	return cache
+}
+
+// GetSummary returns the summary stored under hash and marks it as used. Uses served from
+// memory are written to the database at most once per touchInterval.
+func (c *SummaryCache) GetSummary(ctx context.Context, hash string) (string, bool, error) {
+	if entry, ok := c.memory.Get(hash); ok {
+		if time.Since(entry.touched) >= touchInterval {
+			c.touch(ctx, hash)
+			c.memory.Add(hash, cachedSummary{summary: entry.summary, touched: time.Now()})
+		}
+		return entry.summary, true, nil
+	}
+
+	var summary string
+	err := c.db.QueryRowContext(ctx, `SELECT summary FROM context_summaries WHERE hash = $1`, hash).Scan(&summary)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("summary query error: %w", err)
+	}
+
+	c.touch(ctx, hash)
+	c.memory.Add(hash, cachedSummary{summary: summary, touched: time.Now()})
+	return summary, true, nil
+}
+
+// touch records a use of the summary so eviction keeps it
+func (c *SummaryCache) touch(ctx context.Context, hash string) {
+	if _, err := c.db.ExecContext(ctx, `UPDATE context_summaries SET last_used = $2 WHERE hash = $1`, hash, time.Now().Unix()); err != nil {
+		log.Printf("Failed to touch summary %s: %v", hash, err)
+	}
+}
+
+// SaveSummary stores a summary of the given hierarchy level (1 for conversation pairs)
+func (c *SummaryCache) SaveSummary(ctx context.Context, hash string, level int, summary string) error {
+	c.memory.Add(hash, cachedSummary{summary: summary, touched: time.Now()})
+
+	_, err := c.db.ExecContext(ctx, `
+		INSERT INTO context_summaries (hash, level, summary, last_used)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (hash) DO UPDATE SET
+			summary = EXCLUDED.summary,
+			last_used = EXCLUDED.last_used
+	`, hash, level, summary, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save summary: %w", err)
+	}
+	return nil
+}
+
+// EvictExpired deletes summaries last used before cutoff
+func (c *SummaryCache) EvictExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := c.db.ExecContext(ctx, `DELETE FROM context_summaries WHERE last_used < $1`, cutoff.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to evict summaries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// evictionWorker evicts expired summaries periodically
+func (c *SummaryCache) evictionWorker() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(evictionInterval)
+	defer ticker.Stop()
+
+	for {
+		if ttl := c.ttl(); ttl > 0 {
+			evicted, err := c.EvictExpired(context.Background(), time.Now().Add(-ttl))
+			if err != nil {
+				log.Printf("Failed to evict cached summaries: %v", err)
+			} else if evicted > 0 {
+				log.Printf("Evicted %d cached summaries", evicted)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Close stops the eviction worker
+func (c *SummaryCache) Close() error {
+	close(c.stop)
+	c.wg.Wait()
+	return nil
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// UsageRecord describes the tokens consumed by a single response
+type UsageRecord struct {
+	UserID           string
+	GuildID          string // Empty for DMs
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	Time             time.Time
+}
+
+// UsageTotals aggregates usage over a period
+type UsageTotals struct {
+	PromptTokens     int64
+	CompletionTokens int64
+	Cost             float64
+	Requests         int64
+}
+
+// TotalTokens returns the sum of prompt and completion tokens
+func (t UsageTotals) TotalTokens() int64 {
+	return t.PromptTokens + t.CompletionTokens
+}
+
+// ModelUsage is the usage of a single model over a period
+type ModelUsage struct {
+	Model string
+	UsageTotals
+}
+
+// UsageLedger records token usage per user, guild, model and day
+type UsageLedger struct {
+	db *sql.DB
+}
+
+// NewUsageLedger creates a new usage ledger with shared database connection
+func NewUsageLedger(dbURL string) *UsageLedger {
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+
+	// Use shared database connection
+	db, err := GetDatabase(dbURL)
+	if err != nil {
+		log.Fatalf("Failed to get database connection: %v", err)
+	}
+
+	return &UsageLedger{db: db}
+}
+
+// usageDay returns the UTC calendar day used as the ledger bucket
+func usageDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// StartOfDay returns the start of the current UTC ledger day
+func StartOfDay(now time.Time) time.Time {
+	return usageDay(now)
+}
+
+// StartOfMonth returns the first UTC ledger day of the current month
+func StartOfMonth(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Record adds a response's usage to the ledger
+func (l *UsageLedger) Record(ctx context.Context, record UsageRecord) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+
+	_, err := l.db.ExecContext(ctx, `
+		INSERT INTO usage_ledger (user_id, guild_id, model, day, prompt_tokens, completion_tokens, cost, requests)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 1)
+		ON CONFLICT (user_id, guild_id, model, day) DO UPDATE SET
+			prompt_tokens = usage_ledger.prompt_tokens + EXCLUDED.prompt_tokens,
+			completion_tokens = usage_ledger.completion_tokens + EXCLUDED.completion_tokens,
+			cost = usage_ledger.cost + EXCLUDED.cost,
+			requests = usage_ledger.requests + 1
+	`, record.UserID, record.GuildID, record.Model, usageDay(record.Time), record.PromptTokens, record.CompletionTokens, record.Cost)
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	return nil
+}
+
+// UserTotals returns a user's usage across all guilds and DMs since the given day
+func (l *UsageLedger) UserTotals(ctx context.Context, userID string, since time.Time) (UsageTotals, error) {
+	return l.totals(ctx, "user_id", userID, since)
+}
+
+// GuildTotals returns the usage of all users in a guild since the given day
+func (l *UsageLedger) GuildTotals(ctx context.Context, guildID string, since time.Time) (UsageTotals, error) {
+	return l.totals(ctx, "guild_id", guildID, since)
+}
+
+// totals sums the ledger rows matching a single column since the given day
+func (l *UsageLedger) totals(ctx context.Context, column, value string, since time.Time) (UsageTotals, error) {
+	var totals UsageTotals
+	err := l.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+			COALESCE(SUM(cost), 0), COALESCE(SUM(requests), 0)
+		FROM usage_ledger
+		WHERE `+column+` = $1 AND day >= $2
+	`, value, usageDay(since)).Scan(&totals.PromptTokens, &totals.CompletionTokens, &totals.Cost, &totals.Requests)
+	if err != nil {
+		return UsageTotals{}, fmt.Errorf("failed to query usage totals: %w", err)
+	}
+	return totals, nil
+}
+
+// UserModelBreakdown returns a user's usage per model since the given day, most used first
+func (l *UsageLedger) UserModelBreakdown(ctx context.Context, userID string, since time.Time) ([]ModelUsage, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT model, SUM(prompt_tokens), SUM(completion_tokens), SUM(cost), SUM(requests)
+		FROM usage_ledger
+		WHERE user_id = $1 AND day >= $2
+		GROUP BY model
+		ORDER BY SUM(prompt_tokens + completion_tokens) DESC
+	`, userID, usageDay(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage breakdown: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var breakdown []ModelUsage
+	for rows.Next() {
+		var usage ModelUsage
+		if err := rows.Scan(&usage.Model, &usage.PromptTokens, &usage.CompletionTokens, &usage.Cost, &usage.Requests); err != nil {
+			return nil, err
+		}
+		breakdown = append(breakdown, usage)
+	}
+	return breakdown, rows.Err()
+}
+
+// Close does nothing since we use a shared database connection
+func (l *UsageLedger) Close() error {
+	// Database connection is shared, don't close it here
+	return nil
+}
@@ -2,12 +2,16 @@ package uploader
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"sync"
 	"time"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
 )
 
 var bufferPool = sync.Pool{
@@ -18,6 +22,31 @@ var bufferPool = sync.Pool{
 
 const catboxAPIURL = "https://catbox.moe/user/api.php"
 
+// CatboxUploader publishes files to Catbox.moe. Responses are uploaded as Markdown files.
+type CatboxUploader struct{}
+
+var _ interfaces.Uploader = (*CatboxUploader)(nil)
+
+// NewCatboxUploader creates a Catbox uploader
+func NewCatboxUploader() *CatboxUploader {
+	return &CatboxUploader{}
+}
+
+// Name returns "catbox"
+func (c *CatboxUploader) Name() string {
+	return config.UploaderCatbox
+}
+
+// UploadFile uploads a file to Catbox
+func (c *CatboxUploader) UploadFile(_ context.Context, filename string, data []byte) (string, error) {
+	return UploadToCatbox(filename, data)
+}
+
+// UploadText uploads a response to Catbox as a Markdown file
+func (c *CatboxUploader) UploadText(_ context.Context, content string) (string, error) {
+	return UploadToCatbox("response.md", []byte(content))
+}
+
 // UploadToCatbox uploads a file to Catbox.moe and returns the URL.
 func UploadToCatbox(filename string, fileData []byte) (string, error) {
 	body := bufferPool.Get().(*bytes.Buffer)
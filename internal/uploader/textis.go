@@ -0,0 +1,80 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"DiscordAIChatbot/internal/config"
+	"DiscordAIChatbot/internal/interfaces"
+)
+
+// ErrUnsupported is returned by uploaders that can't host a kind of content
+var ErrUnsupported = errors.New("not supported by this uploader")
+
+const textIsAPIURL = "https://text.is/"
+
+// TextIsUploader publishes responses as text.is pastes. It can't host files.
+type TextIsUploader struct {
+	client *http.Client
+}
+
+var _ interfaces.Uploader = (*TextIsUploader)(nil)
+
+// NewTextIsUploader creates a text.is uploader
+func NewTextIsUploader() *TextIsUploader {
+	return &TextIsUploader{
+		// Redirects are followed so the final URL is the paste
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name returns "textis"
+func (t *TextIsUploader) Name() string {
+	return config.UploaderTextIs
+}
+
+// UploadFile is not supported by text.is
+func (t *TextIsUploader) UploadFile(context.Context, string, []byte) (string, error) {
+	return "", fmt.Errorf("text.is: %w", ErrUnsupported)
+}
+
+// UploadText posts content to text.is and returns the shareable URL
+func (t *TextIsUploader) UploadText(ctx context.Context, content string) (string, error) {
+	// text.is expects the content in the "text" field
+	formData := url.Values{}
+	formData.Set("text", content)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", textIsAPIURL, strings.NewReader(formData.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to post to text.is: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Failed to close response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return "", fmt.Errorf("text.is returned error status %d", resp.StatusCode)
+	}
+
+	// The final URL after any redirects should be the paste URL
+	finalURL := resp.Request.URL.String()
+	if finalURL == textIsAPIURL || finalURL == strings.TrimSuffix(textIsAPIURL, "/") {
+		return "", fmt.Errorf("failed to create paste - no redirect occurred")
+	}
+
+	return finalURL, nil
+}
@@ -1,101 +1,381 @@
 package utils
 
 import (
-	"DiscordAIChatbot/internal/messaging"
+	"bytes"
 	"log"
+	"regexp"
+	"strings"
 	"sync"
 
 	"github.com/pkoukk/tiktoken-go"
+
+	"DiscordAIChatbot/internal/messaging"
 )
 
 // DefaultTokenLimit provides a conservative context window size for most 16k models.
 const DefaultTokenLimit = 128000
 
+// Tokenizer family names. Models are matched to a family by name, or by the
+// "tokenizer" model parameter in the config.
+const (
+	TokenizerO200k   = "o200k"
+	TokenizerCL100k  = "cl100k"
+	TokenizerGemini  = "gemini"
+	TokenizerClaude  = "claude"
+	TokenizerLlama   = "llama"
+	TokenizerMistral = "mistral"
+)
+
+// Calibration settings: estimates are scaled by a running average of reported/estimated
+// counts, clamped so one odd sample can't throw the budget off
+const (
+	calibrationSamples  = 5
+	calibrationWeight   = 0.3
+	minCalibrationRatio = 0.5
+	maxCalibrationRatio = 2.0
+)
+
+// Byte rates used to guess the length of audio attachments, by MIME type substring.
+// Discord voice messages are Ogg Opus at about 32 kbps.
+var audioBytesPerSecond = []struct {
+	mimeType string
+	rate     int
+}{
+	{"ogg", 4000},
+	{"opus", 4000},
+	{"webm", 4000},
+	{"wav", 88200},
+	{"flac", 44100},
+}
+
+// defaultAudioBytesPerSecond covers MP3/AAC at 128 kbps and anything unrecognised
+const defaultAudioBytesPerSecond = 16000
+
+// pdfBytesPerPage guesses the page count of PDFs whose page objects are compressed
+const pdfBytesPerPage = 50000
+
+// pdfPagePattern matches page objects, but not the /Pages tree nodes
+var pdfPagePattern = regexp.MustCompile(`/Type\s*/Page[^s]`)
+
+// TextEncoder counts the tokens of plain text
+type TextEncoder interface {
+	Count(text string) int
+}
+
+// TokenizerFamily describes how a family of models tokenizes text and what other modalities cost
+type TokenizerFamily struct {
+	Name                 string
+	Encoder              TextEncoder
+	ImageTokens          int     // Per image
+	AudioTokensPerSecond float64 // Per second of audio
+	PDFTokensPerPage     int     // Per PDF page
+}
+
+type tokenizerPattern struct {
+	pattern string
+	family  *TokenizerFamily
+}
+
 var (
-	cachedEncoder *tiktoken.Tiktoken
-	encoderOnce   sync.Once
-	encoderError  error
+	tokenizerMu       sync.RWMutex
+	tokenizerFamilies = make(map[string]*TokenizerFamily)
+	tokenizerPatterns []tokenizerPattern
+
+	calibrationMu sync.Mutex
+	calibrations  = make(map[string]*calibration)
 )
 
-// getEncoder returns the cached o200k_base encoder, initializing it only once
-func getEncoder() (*tiktoken.Tiktoken, error) {
-	encoderOnce.Do(func() {
-		cachedEncoder, encoderError = tiktoken.GetEncoding("o200k_base")
-	})
-	return cachedEncoder, encoderError
+// calibration is the running ratio of reported to estimated tokens for one model
+type calibration struct {
+	ratio   float64
+	samples int
 }
 
-// EstimateTokenCount provides accurate token count of a slice of messages using tiktoken.
-// Always uses o200k_base encoding regardless of the model used.
-func EstimateTokenCount(msgs []messaging.OpenAIMessage) int {
-	// Get cached o200k_base encoding
-	tke, err := getEncoder()
-	if err != nil {
-		log.Printf("Warning: failed to get o200k_base encoding: %v, falling back to rough estimate", err)
-		// Fallback to rough estimation if tiktoken fails
-		totalChars := 0
-		for _, msg := range msgs {
-			switch c := msg.Content.(type) {
-			case string:
-				totalChars += len(c)
-			case []messaging.MessageContent:
-				for _, part := range c {
-					if part.Type == "text" {
-						totalChars += len(part.Text)
-					}
-				}
-			}
+func init() {
+	o200k := &tiktokenEncoder{encoding: "o200k_base"}
+	cl100k := &tiktokenEncoder{encoding: "cl100k_base"}
+
+	RegisterTokenizerFamily(&TokenizerFamily{
+		Name:                 TokenizerO200k,
+		Encoder:              o200k,
+		ImageTokens:          765, // A high detail 1024x1024 image
+		AudioTokensPerSecond: 10,
+		PDFTokensPerPage:     800,
+	}, "gpt-4o", "gpt-4.1", "gpt-5", "gpt-oss", "grok")
+	RegisterTokenizerFamily(&TokenizerFamily{
+		Name:                 TokenizerCL100k,
+		Encoder:              cl100k,
+		ImageTokens:          765,
+		AudioTokensPerSecond: 4, // Transcribed speech
+		PDFTokensPerPage:     500,
+	}, "gpt-4", "gpt-3.5", "deepseek", "qwen")
+	RegisterTokenizerFamily(&TokenizerFamily{
+		Name:                 TokenizerGemini,
+		Encoder:              &scaledEncoder{base: o200k, scale: 1.05},
+		ImageTokens:          258,
+		AudioTokensPerSecond: 32,
+		PDFTokensPerPage:     258,
+	}, "gemini", "gemma")
+	RegisterTokenizerFamily(&TokenizerFamily{
+		Name:                 TokenizerClaude,
+		Encoder:              &scaledEncoder{base: cl100k, scale: 1.15},
+		ImageTokens:          1600, // About 1.15 megapixels
+		AudioTokensPerSecond: 4,
+		PDFTokensPerPage:     1500, // Text plus the page image
+	}, "claude")
+	RegisterTokenizerFamily(&TokenizerFamily{
+		Name:                 TokenizerLlama,
+		Encoder:              cl100k, // Llama 3's vocabulary extends cl100k
+		ImageTokens:          1601,
+		AudioTokensPerSecond: 4,
+		PDFTokensPerPage:     500,
+	}, "llama")
+	RegisterTokenizerFamily(&TokenizerFamily{
+		Name:                 TokenizerMistral,
+		Encoder:              &scaledEncoder{base: cl100k, scale: 1.1},
+		ImageTokens:          1024,
+		AudioTokensPerSecond: 4,
+		PDFTokensPerPage:     500,
+	}, "mistral", "mixtral", "ministral", "codestral", "pixtral", "magistral", "devstral")
+}
+
+// RegisterTokenizerFamily adds or replaces a tokenizer family. Models whose reference contains
+// one of patterns use it; the longest matching pattern wins.
+func RegisterTokenizerFamily(family *TokenizerFamily, patterns ...string) {
+	tokenizerMu.Lock()
+	defer tokenizerMu.Unlock()
+
+	tokenizerFamilies[family.Name] = family
+	for _, pattern := range patterns {
+		tokenizerPatterns = append(tokenizerPatterns, tokenizerPattern{pattern: strings.ToLower(pattern), family: family})
+	}
+}
+
+// Tokenizer estimates token counts for one model
+type Tokenizer struct {
+	model  string
+	family *TokenizerFamily
+}
+
+// TokenizerFor returns the tokenizer for a "provider/model" reference. A registered family
+// name in override takes precedence over matching the model name; unknown models use o200k.
+func TokenizerFor(model, override string) Tokenizer {
+	tokenizerMu.RLock()
+	defer tokenizerMu.RUnlock()
+
+	if family, ok := tokenizerFamilies[override]; ok {
+		return Tokenizer{model: model, family: family}
+	}
+	if override != "" {
+		log.Printf("Warning: unknown tokenizer %q for model %s, matching by name", override, model)
+	}
+
+	name := strings.ToLower(model)
+	var best tokenizerPattern
+	for _, candidate := range tokenizerPatterns {
+		if len(candidate.pattern) > len(best.pattern) && strings.Contains(name, candidate.pattern) {
+			best = candidate
 		}
-		return totalChars / 4 // rough fallback
 	}
+	if best.family != nil {
+		return Tokenizer{model: model, family: best.family}
+	}
+	return Tokenizer{model: model, family: tokenizerFamilies[TokenizerO200k]}
+}
+
+// Family returns the name of the tokenizer family
+func (t Tokenizer) Family() string {
+	return t.family.Name
+}
+
+// CountText estimates the tokens of plain text, calibrated against reported usage when available
+func (t Tokenizer) CountText(text string) int {
+	if text == "" {
+		return 0
+	}
+	return t.calibrate(t.family.Encoder.Count(text))
+}
+
+// CountRawText counts the tokens of plain text without calibration, for comparing with reported counts
+func (t Tokenizer) CountRawText(text string) int {
+	if text == "" {
+		return 0
+	}
+	return t.family.Encoder.Count(text)
+}
+
+// CountMessages estimates the tokens of a slice of messages, including images, audio and PDFs
+func (t Tokenizer) CountMessages(msgs []messaging.OpenAIMessage) int {
+	textTokens, mediaTokens := t.countMessages(msgs)
+	return t.calibrate(textTokens) + mediaTokens
+}
+
+// CalibrateFromUsage calibrates the model's tokenizer with the prompt tokens a provider
+// reported for messages. Media estimates aren't calibrated, so they are taken out first.
+func (t Tokenizer) CalibrateFromUsage(msgs []messaging.OpenAIMessage, reportedPromptTokens int) {
+	textTokens, mediaTokens := t.countMessages(msgs)
+	CalibrateTokenizer(t.model, textTokens, reportedPromptTokens-mediaTokens)
+}
 
-	totalTokens := 0
+// countMessages returns the uncalibrated text tokens and the media tokens of a slice of messages
+func (t Tokenizer) countMessages(msgs []messaging.OpenAIMessage) (int, int) {
+	textTokens := 0
+	mediaTokens := 0
 
-	// Count tokens for each message
 	for _, msg := range msgs {
 		// Add tokens per message overhead (approximate)
-		totalTokens += 3 // message formatting overhead
+		textTokens += 3
 
-		// Add role tokens
 		if msg.Role != "" {
-			roleTokens := tke.Encode(msg.Role, nil, nil)
-			totalTokens += len(roleTokens)
+			textTokens += t.family.Encoder.Count(msg.Role)
 		}
 
-		// Add content tokens
 		switch c := msg.Content.(type) {
 		case string:
 			if c != "" {
-				contentTokens := tke.Encode(c, nil, nil)
-				totalTokens += len(contentTokens)
+				textTokens += t.family.Encoder.Count(c)
 			}
 		case []messaging.MessageContent:
 			for _, part := range c {
-				if part.Type == "text" && part.Text != "" {
-					textTokens := tke.Encode(part.Text, nil, nil)
-					totalTokens += len(textTokens)
+				switch {
+				case part.Type == "text":
+					if part.Text != "" {
+						textTokens += t.family.Encoder.Count(part.Text)
+					}
+				case part.ImageURL != nil || part.GeneratedImage != nil:
+					mediaTokens += t.family.ImageTokens
+				case part.AudioFile != nil:
+					mediaTokens += int(audioSeconds(part.AudioFile) * t.family.AudioTokensPerSecond)
+				case part.PDFFile != nil:
+					mediaTokens += pdfPages(part.PDFFile) * t.family.PDFTokensPerPage
 				}
 			}
 		}
+
+		for _, call := range msg.ToolCalls {
+			textTokens += t.family.Encoder.Count(call.Name) + t.family.Encoder.Count(call.Arguments)
+		}
 	}
 
 	// Add reply priming overhead
-	totalTokens += 3
+	textTokens += 3
 
-	return totalTokens
+	return textTokens, mediaTokens
 }
 
-// EstimateTokenCountFromText provides accurate token count for plain text using tiktoken.
-// Always uses o200k_base encoding regardless of the model used.
-func EstimateTokenCountFromText(text string) int {
-	// Get cached o200k_base encoding
-	tke, err := getEncoder()
-	if err != nil {
-		log.Printf("Warning: failed to get o200k_base encoding: %v, falling back to rough estimate", err)
-		// Fallback to rough estimation if tiktoken fails
-		return len(text) / 4
+// calibrate scales a text estimate by the model's calibration ratio. CalibrateTokenizer
+// updates ratios in place, so the ratio is read under the lock.
+func (t Tokenizer) calibrate(tokens int) int {
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	c, ok := calibrations[t.model]
+	if !ok {
+		return tokens
 	}
+	return int(float64(tokens)*c.ratio + 0.5)
+}
 
-	tokens := tke.Encode(text, nil, nil)
-	return len(tokens)
+// CalibrateTokenizer records that a provider counted reported tokens for text the model's
+// tokenizer estimated (uncalibrated) as estimated. Later estimates for the model are scaled
+// by a running average of the ratio.
+func CalibrateTokenizer(model string, estimated, reported int) {
+	if estimated <= 0 || reported <= 0 {
+		return
+	}
+	ratio := min(max(float64(reported)/float64(estimated), minCalibrationRatio), maxCalibrationRatio)
+
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	c, ok := calibrations[model]
+	if !ok {
+		calibrations[model] = &calibration{ratio: ratio, samples: 1}
+		return
+	}
+	c.ratio += (ratio - c.ratio) * calibrationWeight
+	c.samples++
+}
+
+// NeedsCalibration reports whether a model has fewer calibration samples than wanted,
+// so callers can limit how often they ask a provider to count tokens
+func NeedsCalibration(model string) bool {
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+
+	c, ok := calibrations[model]
+	return !ok || c.samples < calibrationSamples
+}
+
+// audioSeconds guesses the length of an audio attachment from its size
+func audioSeconds(audio *messaging.AudioContent) float64 {
+	rate := defaultAudioBytesPerSecond
+	mimeType := strings.ToLower(audio.MIMEType)
+	for _, candidate := range audioBytesPerSecond {
+		if strings.Contains(mimeType, candidate.mimeType) {
+			rate = candidate.rate
+			break
+		}
+	}
+	return float64(len(audio.Data)) / float64(rate)
+}
+
+// pdfPages counts the page objects of a PDF, falling back to a guess from its size
+func pdfPages(pdf *messaging.PDFContent) int {
+	if len(pdf.Data) == 0 {
+		return 1
+	}
+	if pages := len(pdfPagePattern.FindAllIndex(pdf.Data, -1)); pages > 0 {
+		return pages
+	}
+	// Page objects are hidden in compressed object streams
+	if bytes.Contains(pdf.Data, []byte("/ObjStm")) {
+		return max(1, len(pdf.Data)/pdfBytesPerPage)
+	}
+	return 1
+}
+
+// tiktokenEncoder counts tokens with a tiktoken encoding, loaded on first use
+type tiktokenEncoder struct {
+	encoding string
+	once     sync.Once
+	tke      *tiktoken.Tiktoken
+	err      error
+}
+
+// Count counts the tokens of text, falling back to a rough estimate if the encoding fails to load
+func (e *tiktokenEncoder) Count(text string) int {
+	e.once.Do(func() {
+		e.tke, e.err = tiktoken.GetEncoding(e.encoding)
+		if e.err != nil {
+			log.Printf("Warning: failed to get %s encoding: %v, falling back to rough estimate", e.encoding, e.err)
+		}
+	})
+	if e.err != nil {
+		return len(text) / 4 // rough fallback
+	}
+	return len(e.tke.Encode(text, nil, nil))
+}
+
+// scaledEncoder approximates a tokenizer that isn't available locally by scaling a similar one
+type scaledEncoder struct {
+	base  TextEncoder
+	scale float64
+}
+
+// Count counts the tokens of text with the base encoder and scales the result
+func (e *scaledEncoder) Count(text string) int {
+	return int(float64(e.base.Count(text))*e.scale + 0.5)
+}
+
+// EstimateTokenCount estimates the token count of a slice of messages with the o200k tokenizer.
+// Use TokenizerFor when the model is known.
+func EstimateTokenCount(msgs []messaging.OpenAIMessage) int {
+	return TokenizerFor("", TokenizerO200k).CountMessages(msgs)
+}
+
+// EstimateTokenCountFromText estimates the token count of plain text with the o200k tokenizer.
+// Use TokenizerFor when the model is known.
+func EstimateTokenCountFromText(text string) int {
+	return TokenizerFor("", TokenizerO200k).CountText(text)
 }
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"DiscordAIChatbot/internal/messaging"
+)
+
+// resetCalibration drops the calibration of a model when the test ends
+func resetCalibration(t *testing.T, model string) {
+	t.Cleanup(func() {
+		calibrationMu.Lock()
+		delete(calibrations, model)
+		calibrationMu.Unlock()
+	})
+}
+
+func TestCalibrationScalesEstimates(t *testing.T) {
+	const model = "test/calibrated-model"
+	resetCalibration(t, model)
+	tokens := TokenizerFor(model, TokenizerO200k)
+
+	text := "The quick brown fox jumps over the lazy dog."
+	raw := tokens.CountRawText(text)
+	if got := tokens.CountText(text); got != raw {
+		t.Fatalf("uncalibrated estimate is %d, want the raw count %d", got, raw)
+	}
+
+	CalibrateTokenizer(model, raw, raw*2)
+	if got := tokens.CountText(text); got != raw*2 {
+		t.Errorf("calibrated estimate is %d, want %d", got, raw*2)
+	}
+	if !NeedsCalibration(model) {
+		t.Error("one sample is enough calibration")
+	}
+}
+
+// TestCalibrationIsConcurrencySafe is meant for go test -race: calibration runs in the
+// background while responses are being counted
+func TestCalibrationIsConcurrencySafe(t *testing.T) {
+	const model = "test/concurrent-model"
+	resetCalibration(t, model)
+	tokens := TokenizerFor(model, TokenizerO200k)
+	messages := []messaging.OpenAIMessage{{Role: "user", Content: "How many tokens is this?"}}
+
+	// Several Ps and a common start let calibrating and counting interleave, even on one CPU
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			for j := 0; j < 2000; j++ {
+				CalibrateTokenizer(model, 100, 90+(i+j)%20)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			<-start
+			for j := 0; j < 2000; j++ {
+				if count := tokens.CountMessages(messages); count <= 0 {
+					panic(fmt.Sprintf("counted %d tokens", count))
+				}
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
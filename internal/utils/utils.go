@@ -2,9 +2,6 @@ package utils
 
 import (
 	"fmt"
-	"log"
-	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
@@ -18,6 +15,7 @@ const (
 	EditDelaySeconds      = 1
 	MaxMessageLength      = 4096
 	PlainMaxMessageLength = 2000
+	MaxSelectMenuOptions  = 25
 
 	// Simplified progress indicator text (no animations)
 	ProgressProcessing = "<a:anthropicgif:1389926560391368765> Processing..."
@@ -44,6 +42,16 @@ func NewProgressManager(session *discordgo.Session, channelID string) *ProgressM
 	}
 }
 
+// NewProgressManagerForMessage creates a progress manager that reuses an existing message,
+// e.g. a response being regenerated in place
+func NewProgressManagerForMessage(session *discordgo.Session, channelID, messageID string) *ProgressManager {
+	return &ProgressManager{
+		session:   session,
+		channelID: channelID,
+		messageID: messageID,
+	}
+}
+
 // UpdateProgress shows a simple progress message only once at the start
 func (p *ProgressManager) UpdateProgress(state string, warnings []string, replyRef *discordgo.MessageReference) error {
 	// Only show progress message once at the beginning
@@ -115,6 +123,16 @@ type FooterInfo struct {
 	SearchResultCount  int
 	CurrentTokens      int
 	TokenLimit         int
+	Persona            string // Name of the persona that answered, if any
+	PersonaDisplayName string
+	PersonaAvatarURL   string
+	// Reported by the provider once the response is complete; zero when unknown
+	CompletionTokens  int
+	CachedTokens      int
+	ReasoningTokens   int
+	FirstTokenLatency time.Duration
+	FinishReason      string
+	SafetyFlags       []string
 }
 
 // CreateEmbed creates a Discord embed with warnings, content, and footer information
@@ -156,9 +174,46 @@ func CreateEmbed(content string, warnings []string, isComplete bool, footerInfo
 			footerParts = append(footerParts, fmt.Sprintf("🤖 Model: %s", footerInfo.Model))
 		}
 
+		// Add persona information
+		if footerInfo.Persona != "" {
+			footerParts = append(footerParts, fmt.Sprintf("🎭 Persona: %s", footerInfo.Persona))
+
+			// Show the persona as the embed's author
+			authorName := footerInfo.PersonaDisplayName
+			if authorName == "" {
+				authorName = footerInfo.Persona
+			}
+			embed.Author = &discordgo.MessageEmbedAuthor{
+				Name:    authorName,
+				IconURL: footerInfo.PersonaAvatarURL,
+			}
+		}
+
 		// Add token usage if provided
 		if footerInfo.CurrentTokens > 0 && footerInfo.TokenLimit > 0 {
-			footerParts = append(footerParts, fmt.Sprintf("🧮 %d/%d tokens", footerInfo.CurrentTokens, footerInfo.TokenLimit))
+			tokens := fmt.Sprintf("🧮 %d/%d tokens", footerInfo.CurrentTokens, footerInfo.TokenLimit)
+			if footerInfo.CachedTokens > 0 {
+				tokens += fmt.Sprintf(" (%d cached)", footerInfo.CachedTokens)
+			}
+			footerParts = append(footerParts, tokens)
+		}
+		if footerInfo.CompletionTokens > 0 {
+			output := fmt.Sprintf("✍️ %d out", footerInfo.CompletionTokens)
+			if footerInfo.ReasoningTokens > 0 {
+				output += fmt.Sprintf(" (%d thinking)", footerInfo.ReasoningTokens)
+			}
+			footerParts = append(footerParts, output)
+		}
+		if footerInfo.FirstTokenLatency > 0 {
+			footerParts = append(footerParts, fmt.Sprintf("⏱️ %.1fs to first token", footerInfo.FirstTokenLatency.Seconds()))
+		}
+
+		// Unusual finishes and safety flags explain a cut-off or missing answer
+		if footerInfo.FinishReason != "" && !IsGoodFinishReason(footerInfo.FinishReason) {
+			footerParts = append(footerParts, fmt.Sprintf("⚠️ Finished: %s", strings.ToLower(footerInfo.FinishReason)))
+		}
+		if len(footerInfo.SafetyFlags) > 0 {
+			footerParts = append(footerParts, fmt.Sprintf("🛡️ Flagged: %s", strings.Join(footerInfo.SafetyFlags, ", ")))
 		}
 
 		// Add web search information
@@ -211,6 +266,100 @@ func CreateActionButtons(messageID string, webSearchPerformed bool, hasGrounding
 	}
 }
 
+// CreateVariantComponents returns variant navigation, a regenerate button and a model picker for a response.
+// Navigation is only shown once there is more than one variant.
+func CreateVariantComponents(messageID string, selected, total int, models []string) []discordgo.MessageComponent {
+	var buttons []discordgo.MessageComponent
+	if total > 1 {
+		buttons = append(buttons,
+			discordgo.Button{
+				Label:    "◀",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("variant_select_%s_%d", messageID, selected-1),
+				Disabled: selected <= 0,
+			},
+			discordgo.Button{
+				Label:    fmt.Sprintf("%d/%d", selected+1, total),
+				Style:    discordgo.SecondaryButton,
+				CustomID: "variant_count_" + messageID,
+				Disabled: true,
+			},
+			discordgo.Button{
+				Label:    "▶",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("variant_select_%s_%d", messageID, selected+1),
+				Disabled: selected >= total-1,
+			},
+		)
+	}
+	buttons = append(buttons, discordgo.Button{
+		Label:    "🔄 Regenerate",
+		Style:    discordgo.SecondaryButton,
+		CustomID: "regenerate_response_" + messageID,
+	})
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: buttons,
+		},
+	}
+
+	// Discord allows at most 25 options per select menu
+	if len(models) > MaxSelectMenuOptions {
+		models = models[:MaxSelectMenuOptions]
+	}
+	if len(models) > 0 {
+		options := make([]discordgo.SelectMenuOption, 0, len(models))
+		for _, model := range models {
+			options = append(options, discordgo.SelectMenuOption{
+				Label: TruncateWithEllipsis(model, 100),
+				Value: model,
+			})
+		}
+		components = append(components, discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    "reroll_model_" + messageID,
+					Placeholder: "🎲 Try with model…",
+					Options:     options,
+				},
+			},
+		})
+	}
+
+	return components
+}
+
+// CreateStopButton returns a button that stops an in-progress response.
+func CreateStopButton(requestID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "⏹️ Stop",
+					Style:    discordgo.DangerButton,
+					CustomID: "stop_generation_" + requestID,
+				},
+			},
+		},
+	}
+}
+
+// CreateRegenerateButton returns a button that regenerates the reply to an edited message.
+func CreateRegenerateButton(messageID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "🔄 Regenerate",
+					Style:    discordgo.PrimaryButton,
+					CustomID: "regenerate_edit_" + messageID,
+				},
+			},
+		},
+	}
+}
+
 // ProcessAttachments downloads and processes message attachments
 
 // ExtractEmbedText extracts text from message embeds
@@ -391,51 +540,6 @@ func IsGoodFinishReason(reason string) bool {
 	return reasonLower == "stop" || reasonLower == "end_turn"
 }
 
-// PostToTextIs posts content to text.is and returns the shareable URL
-func PostToTextIs(content string) (string, error) {
-	// text.is API endpoint
-	apiURL := "https://text.is/"
-
-	// Prepare form data - text.is expects the content in the "text" field
-	formData := url.Values{}
-	formData.Set("text", content)
-
-	// Create HTTP client with timeout and allow redirects
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Allow redirects, but capture the final URL
-			return nil
-		},
-	}
-
-	// Make POST request
-	resp, err := client.PostForm(apiURL, formData)
-	if err != nil {
-		return "", fmt.Errorf("failed to post to text.is: %w", err)
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Failed to close response body: %v", err)
-		}
-	}()
-
-	// Check for successful response
-	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
-		return "", fmt.Errorf("text.is returned error status %d", resp.StatusCode)
-	}
-
-	// The final URL after any redirects should be the paste URL
-	finalURL := resp.Request.URL.String()
-
-	// Verify we got a valid text.is URL (should not be the original API endpoint)
-	if finalURL == apiURL || finalURL == apiURL+"/" {
-		return "", fmt.Errorf("failed to create paste - no redirect occurred")
-	}
-
-	return finalURL, nil
-}
-
 // TruncateWithEllipsis shortens a string to a maximum length, adding "..." if truncated.
 func TruncateWithEllipsis(s string, maxLength int) string {
 	if len(s) <= maxLength {